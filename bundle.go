@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/hooks"
+	"lan-chat/internal/platform"
+	"lan-chat/internal/store"
+	"lan-chat/ui"
+)
+
+// Settings bundles: `lan-chat export-settings` packs config.toml and the
+// hooks directory into one file, and `lan-chat import-settings` unpacks it
+// on another machine, so a team can start from the same settings. Secrets
+// are left out, or sealed with a passphrase with --secrets.
+
+// bundleFormat names the file format and its version
+const bundleFormat = "lan-chat-settings/1"
+
+// secretKeys are the config values that are credentials. For
+// user.password_file the secret is the file's contents, not the path.
+var secretKeys = []string{"irc.password", "matrix.token", "mqtt.password", "user.password_file"}
+
+// passwordFileName is where an imported password is written, next to
+// config.toml
+const passwordFileName = "password"
+
+type settingsBundle struct {
+	Format   string       `json:"format"`
+	Exported time.Time    `json:"exported"`
+	Config   string       `json:"config"`            // config.toml, secret lines commented out
+	Secrets  string       `json:"secrets,omitempty"` // crypto.Seal of a key → value JSON object
+	Hooks    []bundleFile `json:"hooks,omitempty"`
+}
+
+type bundleFile struct {
+	Name string      `json:"name"`
+	Mode os.FileMode `json:"mode"`
+	Data []byte      `json:"data"`
+}
+
+// `lan-chat export-settings [-o FILE]`: write the settings bundle to FILE
+// or stdout
+func runExportSettings(args []string) {
+	fs := flag.NewFlagSet("export-settings", flag.ExitOnError)
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Config file to export")
+	secrets := fs.Bool("secrets", false, "Include passwords and tokens, sealed with a passphrase asked for on the terminal")
+	out := fs.String("o", "", "Write the bundle to this file instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Println("Usage: lan-chat export-settings [--config=PATH] [--secrets] [-o FILE]")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+
+	passphrase := ""
+	if *secrets {
+		var err error
+		if passphrase, err = readPassphrase("Passphrase for the secrets: ", true); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	b, stripped, err := exportSettings(*configFile, hooks.Dir(), passphrase)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		fatalf("%v", err)
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		os.Stdout.Write(data)
+	} else if err := os.WriteFile(*out, data, 0600); err != nil {
+		fatalf("%v", err)
+	}
+	switch {
+	case len(stripped) > 0 && *secrets:
+		fmt.Fprintf(os.Stderr, "Sealed with the passphrase: %s\n", strings.Join(stripped, ", "))
+	case len(stripped) > 0:
+		fmt.Fprintf(os.Stderr, "Left out (--secrets includes them): %s\n", strings.Join(stripped, ", "))
+	}
+}
+
+// exportSettings bundles the config file at configPath and the hooks in
+// hookDir. The secrets in it are sealed with passphrase, or left out
+// without one; stripped lists them.
+func exportSettings(configPath, hookDir, passphrase string) (b settingsBundle, stripped []string, err error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return b, nil, err
+	}
+	values, err := store.ParseFile(configPath)
+	if err != nil {
+		return b, nil, err
+	}
+	b = settingsBundle{Format: bundleFormat, Exported: time.Now().UTC()}
+	b.Config, stripped = stripSecrets(string(data))
+	if passphrase != "" && len(stripped) > 0 {
+		secrets := make(map[string]string)
+		for _, k := range stripped {
+			v := values[k]
+			if k == "user.password_file" {
+				content, err := os.ReadFile(platform.ExpandHome(v))
+				if err == nil {
+					content, err = unsealSecret(content) // a machine seal wouldn't open elsewhere
+				}
+				if err != nil {
+					return b, nil, fmt.Errorf("%s: %w", k, err)
+				}
+				v = string(content)
+			}
+			secrets[k] = v
+		}
+		plain, _ := json.Marshal(secrets)
+		if b.Secrets, err = crypto.Seal(plain, passphrase); err != nil {
+			return b, nil, err
+		}
+	}
+	entries, err := os.ReadDir(hookDir)
+	if err != nil && !os.IsNotExist(err) {
+		return b, nil, err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(hookDir, e.Name()))
+		if err != nil {
+			return b, nil, err
+		}
+		b.Hooks = append(b.Hooks, bundleFile{Name: e.Name(), Mode: info.Mode().Perm(), Data: data})
+	}
+	return b, stripped, nil
+}
+
+// stripSecrets comments out the lines setting a secret key, as
+// "# key = <secret>" where restoreSecrets finds them again
+func stripSecrets(config string) (string, []string) {
+	var stripped []string
+	lines := strings.Split(config, "\n")
+	section := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+		key, _, ok := strings.Cut(trimmed, "=")
+		if !ok || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if full := section + "." + key; slices.Contains(secretKeys, full) {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			lines[i] = indent + "# " + key + " = <secret>"
+			stripped = append(stripped, full)
+		}
+	}
+	return strings.Join(lines, "\n"), stripped
+}
+
+// restoreSecrets puts the secrets back in place of the lines stripSecrets
+// commented out. set writes one, returning the value for the line; missing
+// lists the ones there was no value for.
+func restoreSecrets(config string, secrets map[string]string, set func(key, value string) (string, error)) (string, []string, error) {
+	var missing []string
+	lines := strings.Split(config, "\n")
+	section := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+		rest, ok := strings.CutPrefix(trimmed, "# ")
+		if !ok {
+			continue
+		}
+		key, ok := strings.CutSuffix(rest, " = <secret>")
+		if !ok {
+			continue
+		}
+		full := section + "." + key
+		v, ok := secrets[full]
+		if !ok {
+			missing = append(missing, full)
+			continue
+		}
+		v, err := set(full, v)
+		if err != nil {
+			return "", nil, err
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		lines[i] = indent + key + " = " + strconv.Quote(v)
+	}
+	return strings.Join(lines, "\n"), missing, nil
+}
+
+// `lan-chat import-settings [--force] FILE`: write the config file and
+// hooks from a settings bundle
+func runImportSettings(args []string) {
+	fs := flag.NewFlagSet("import-settings", flag.ExitOnError)
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Config file to write")
+	force := fs.Bool("force", false, "Replace an existing config file (kept as .bak) and hooks")
+	skipSecrets := fs.Bool("skip-secrets", false, "Don't ask for the passphrase; leave the secrets out")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: lan-chat import-settings [--config=PATH] [--force] [--skip-secrets] <file>")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	var b settingsBundle
+	if err := json.Unmarshal(data, &b); err != nil || b.Format != bundleFormat {
+		fatalf("%s: not a lan-chat settings bundle (%s)", fs.Arg(0), bundleFormat)
+	}
+	if _, err := os.Stat(*configFile); err == nil && !*force {
+		fatalf("%s already exists; --force replaces it, keeping it as %s.bak", *configFile, filepath.Base(*configFile))
+	}
+
+	secrets := map[string]string{}
+	if b.Secrets != "" && !*skipSecrets {
+		passphrase, err := readPassphrase("Passphrase for the secrets: ", false)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		plain, err := crypto.Open(b.Secrets, passphrase)
+		if err != nil {
+			fatalf("secrets: %v", err)
+		}
+		if err := json.Unmarshal(plain, &secrets); err != nil {
+			fatalf("secrets: %v", err)
+		}
+	}
+	missing, err := importSettings(b, *configFile, hooks.Dir(), secrets, *force)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("Imported %s", *configFile)
+	if len(b.Hooks) > 0 {
+		fmt.Printf(" and %d hooks to %s", len(b.Hooks), hooks.Dir())
+	}
+	fmt.Println()
+	if len(missing) > 0 {
+		fmt.Printf("Not imported, set them in %s: %s\n", *configFile, strings.Join(missing, ", "))
+	}
+}
+
+// importSettings writes the bundle's config to configPath, with secrets in
+// place of the lines they were stripped from, and its hooks to hookDir. The
+// config is checked before anything is replaced.
+func importSettings(b settingsBundle, configPath, hookDir string, secrets map[string]string, force bool) ([]string, error) {
+	dir := filepath.Dir(configPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var passwords []func() error // written once the config checks out
+	config, missing, err := restoreSecrets(b.Config, secrets, func(key, value string) (string, error) {
+		if key != "user.password_file" {
+			return value, nil
+		}
+		path := filepath.Join(dir, passwordFileName)
+		passwords = append(passwords, func() error { return os.WriteFile(path, []byte(value), 0600) })
+		return path, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	mode := os.FileMode(0644)
+	if len(secrets) > 0 {
+		mode = 0600
+	}
+	tmp := configPath + ".import"
+	if err := os.WriteFile(tmp, []byte(config), mode); err != nil {
+		return nil, err
+	}
+	if err := checkConfig(tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	for _, write := range passwords {
+		if err := write(); err != nil {
+			os.Remove(tmp)
+			return nil, err
+		}
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		if err := os.Rename(configPath, configPath+".bak"); err != nil {
+			os.Remove(tmp)
+			return nil, err
+		}
+	}
+	if err := os.Rename(tmp, configPath); err != nil {
+		return nil, err
+	}
+
+	if len(b.Hooks) > 0 {
+		if err := os.MkdirAll(hookDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range b.Hooks {
+		if h.Name != filepath.Base(h.Name) || h.Name == "." || h.Name == ".." {
+			return nil, fmt.Errorf("hook %q: not a file name", h.Name)
+		}
+		path := filepath.Join(hookDir, h.Name)
+		if _, err := os.Stat(path); err == nil && !force {
+			return nil, fmt.Errorf("%s already exists; --force replaces it", path)
+		}
+		if err := os.WriteFile(path, h.Data, h.Mode.Perm()); err != nil {
+			return nil, err
+		}
+		os.Chmod(path, h.Mode.Perm()) // WriteFile keeps the mode of a file it replaces
+	}
+	return missing, nil
+}
+
+// checkConfig reads the config file the way the TUI and the daemon would
+func checkConfig(path string) error {
+	if _, err := loadSettings(path); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if _, err := ui.LoadConfig(path); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if _, err := hooks.New(path); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+// readPassphrase asks for a passphrase on the terminal without echoing it,
+// twice when confirm is set. Without a terminal it reads a line of stdin.
+func readPassphrase(prompt string, confirm bool) (string, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line == "" {
+			if err == nil {
+				err = errors.New("empty passphrase")
+			}
+			return "", fmt.Errorf("passphrase from stdin: %w", err)
+		}
+		return line, nil
+	}
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(os.Stderr, prompt)
+		p, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		return string(p), err
+	}
+	p, err := ask(prompt)
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errors.New("empty passphrase")
+	}
+	if confirm {
+		again, err := ask("Again: ")
+		if err != nil {
+			return "", err
+		}
+		if again != p {
+			return "", errors.New("the passphrases don't match")
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"lan-chat/internal/control"
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/node"
+	"lan-chat/internal/protocol"
+	"lan-chat/internal/store"
+	"lan-chat/ui"
+)
+
+// Scripting subcommands. They go through the control socket of an instance
+// already running here (TUI, background session or daemon), which holds the
+// ports; otherwise peers, msg and send listen for announcements themselves
+// for a few seconds and recv starts its own node.
+
+// discoverWait covers at least one announcement from every peer
+const discoverWait = discovery.AnnounceInterval + time.Second
+
+// instanceRunning reports whether an instance answers on the control socket
+func instanceRunning(socket string) bool {
+	_, err := control.Do(socket, "STATUS")
+	return err == nil
+}
+
+// discover collects announcements for up to wait, returning early once
+// done reports true for a peer
+func discover(wait time.Duration, done func(discovery.Peer) bool) ([]discovery.Peer, error) {
+	l, err := discovery.Listen("")
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for peers on UDP port %s: %w (is another program using it?)", discovery.Port, err)
+	}
+	found := make(chan struct{})
+	var once sync.Once
+	go l.Run(func(p discovery.Peer) {
+		if done != nil && done(p) {
+			once.Do(func() { close(found) })
+		}
+	})
+	select {
+	case <-found:
+	case <-time.After(wait):
+	}
+	l.Close()
+	peers := l.Peers()
+	for _, p := range peers {
+		protocol.SetPeerPort(p.IP, p.Port)
+	}
+	return peers, nil
+}
+
+// resolvePeer finds a peer by name or IP. An IP is used as is, so a known
+// address works even when its announcements don't get through.
+func resolvePeer(peer string, wait time.Duration) (discovery.Peer, error) {
+	if net.ParseIP(peer) != nil {
+		return discovery.Peer{Name: peer, IP: peer}, nil
+	}
+	peers, err := discover(wait, func(p discovery.Peer) bool { return strings.EqualFold(p.Name, peer) })
+	if err != nil {
+		return discovery.Peer{}, err
+	}
+	for _, p := range peers {
+		if strings.EqualFold(p.Name, peer) {
+			return p, nil
+		}
+	}
+	return discovery.Peer{}, fmt.Errorf("no peer named %s found within %v", peer, wait)
+}
+
+// verified checks the password with a peer; without one nothing is verified
+func verified(ip, password string) bool {
+	if password == "" {
+		return false
+	}
+	ok, _ := protocol.VerifyPassword(ip, password)
+	return ok
+}
+
+// sendPassword is the password to encrypt to p with: password once p has
+// verified it, none without one. A peer that doesn't verify it is an error,
+// unless insecure allows sending in plaintext.
+func sendPassword(p discovery.Peer, password string, insecure bool) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	ok, err := protocol.VerifyPassword(p.IP, password)
+	switch {
+	case ok:
+		return password, nil
+	case insecure:
+	case errors.Is(err, protocol.ErrLegacySalted):
+		return "", fmt.Errorf("%s doesn't take PAKE; [network] legacy_salted allows the older check, --insecure sends in plaintext anyway", p.Name)
+	default:
+		return "", fmt.Errorf("%s did not verify the password; --insecure sends in plaintext anyway", p.Name)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s did not verify the password, sending in plaintext\n", p.Name)
+	return "", nil
+}
+
+// `lan-chat peers [--json]`
+func runPeers(args []string) {
+	fs := flag.NewFlagSet("peers", flag.ExitOnError)
+	password := fs.String("pass", "", "Shared password, to report which peers are verified (default: from the config)")
+	addPasswordFlags(fs)
+	addPortFlags(fs)
+	asJSON := fs.Bool("json", false, "Print a JSON array instead of a table")
+	wait := fs.Duration("wait", discoverWait, "How long to listen for announcements")
+	socket := fs.String("control", control.SocketPath(), "Control socket of a running instance")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Config file for the ports and password")
+	fs.Parse(args)
+	s := cliSettings(fs, *configFile)
+
+	var peers []node.PeerInfo
+	if instanceRunning(*socket) {
+		lines, err := control.Do(*socket, "PEERS")
+		if err != nil {
+			fatalf("%v", err)
+		}
+		for _, l := range lines {
+			f := control.Fields(l)
+			if len(f) != 4 {
+				continue
+			}
+			secure, _ := strconv.ParseBool(f[2])
+			reachable, _ := strconv.ParseBool(f[3])
+			peers = append(peers, node.PeerInfo{Name: f[0], IP: f[1], Secure: secure, Reachable: reachable})
+		}
+	} else {
+		pass, err := s.resolvePassword(fs, *password)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		found, err := discover(*wait, nil)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		for _, p := range found {
+			peers = append(peers, node.PeerInfo{Name: p.Name, IP: p.IP, Secure: verified(p.IP, pass), Reachable: protocol.Ping(p.IP)})
+		}
+		sortPeers(peers)
+	}
+
+	if *asJSON {
+		if peers == nil {
+			peers = []node.PeerInfo{} // [] rather than null
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(peers)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tIP\tVERIFIED\tREACHABLE")
+	for _, p := range peers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, p.IP, yesNo(p.Secure), yesNo(p.Reachable))
+	}
+	w.Flush()
+}
+
+// `lan-chat msg <peer> <text>`
+func runMsg(args []string) {
+	fs := flag.NewFlagSet("msg", flag.ExitOnError)
+	password := fs.String("pass", "", "Shared password; the message is only sent if the peer verifies it (default: from the config)")
+	insecure := fs.Bool("insecure", false, "Send in plaintext when the peer doesn't verify the password")
+	addPasswordFlags(fs)
+	addPortFlags(fs)
+	name := fs.String("name", "", "Sender name the peer sees (default: name under [user] in the config, or the hostname)")
+	wait := fs.Duration("wait", discoverWait, "How long to look for the peer by name")
+	socket := fs.String("control", control.SocketPath(), "Control socket of a running instance")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Config file for the name, ports and password")
+	fs.Parse(args)
+	s := cliSettings(fs, *configFile)
+	if fs.NArg() < 2 {
+		fmt.Println("Usage: lan-chat msg [--pass=PASSWORD|--encrypt|--keyring] [--insecure] [--name=NAME] <peer> <text>")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	peer := fs.Arg(0)
+	text := strings.Join(fs.Args()[1:], " ")
+
+	if instanceRunning(*socket) {
+		if _, err := control.Do(*socket, "MSG "+peer+" "+control.Escape(text)); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	var err error
+	if *password, err = s.resolvePassword(fs, *password); err != nil {
+		fatalf("%v", err)
+	}
+	p, err := resolvePeer(peer, *wait)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	pass, err := sendPassword(p, *password, *insecure)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if err := protocol.SendChat(p.IP, s.nameOr(*name), text, pass); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// `lan-chat send <peer> <file>...`: send each file in turn, returning once
+// it has arrived. The rest are still sent after one fails; the status is 1
+// if any didn't arrive.
+func runSend(args []string) {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	password := fs.String("pass", "", "Shared password; the files are only sent if the peer verifies it (default: from the config)")
+	insecure := fs.Bool("insecure", false, "Send in plaintext when the peer doesn't verify the password")
+	addPasswordFlags(fs)
+	addPortFlags(fs)
+	wait := fs.Duration("wait", discoverWait, "How long to look for the peer by name")
+	socket := fs.String("control", control.SocketPath(), "Control socket of a running instance")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Config file for the ports and password")
+	fs.Parse(args)
+	s := cliSettings(fs, *configFile)
+	if fs.NArg() < 2 {
+		fmt.Println("Usage: lan-chat send [--pass=PASSWORD|--encrypt|--keyring] [--insecure] <peer> <file>...")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	peer := fs.Arg(0)
+	var paths []string
+	for _, path := range fs.Args()[1:] {
+		fi, err := os.Stat(path)
+		if err == nil && fi.IsDir() {
+			err = fmt.Errorf("%s is a directory", path)
+		}
+		if err == nil {
+			// A running instance reads the file itself, from its own directory
+			path, err = filepath.Abs(path)
+		}
+		if err != nil {
+			fatalf("%v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	var send func(path string) error
+	if instanceRunning(*socket) {
+		send = func(path string) error {
+			_, err := control.Do(*socket, "SEND "+peer+" "+path)
+			return err
+		}
+	} else {
+		var err error
+		if *password, err = s.resolvePassword(fs, *password); err != nil {
+			fatalf("%v", err)
+		}
+		p, err := resolvePeer(peer, *wait)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		pass, err := sendPassword(p, *password, *insecure)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		send = func(path string) error {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return protocol.SendFile(p.IP, filepath.Base(path), f, pass)
+		}
+	}
+	failed := false
+	for _, path := range paths {
+		if err := send(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", filepath.Base(path), err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// `lan-chat recv --dir X`: save what arrives in X until interrupted,
+// printing a line per chat and the saved path per file
+func runRecv(args []string) {
+	fs := flag.NewFlagSet("recv", flag.ExitOnError)
+	password := fs.String("pass", "", "Shared password for encrypted communication (default: from the config)")
+	addPasswordFlags(fs)
+	addPortFlags(fs)
+	name := fs.String("name", "", "Name to announce to peers (default: name under [user] in the config, or the hostname)")
+	dir := fs.String("dir", "", "Directory received files are saved in (default: dir under [downloads] in the config, or the downloads folder)")
+	once := fs.Bool("once", false, "Exit after the first file")
+	socket := fs.String("control", control.SocketPath(), "Control socket of a running instance")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Config file for the name, ports, password and download directory")
+	fs.Parse(args)
+	s := cliSettings(fs, *configFile)
+	*dir = s.downloads(*dir)
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fatalf("%v", err)
+	}
+
+	if status, err := control.Do(*socket, "STATUS"); err == nil {
+		// The running instance receives; files are moved here as they land,
+		// but only from its own download folder
+		var from string
+		if f := control.Fields(strings.Join(status, "")); len(f) == 4 {
+			from = f[3]
+		}
+		err := control.Watch(*socket, func(f []string) bool {
+			switch {
+			case len(f) >= 3 && f[0] == "MSG":
+				printChat(f[1], f[2], len(f) > 3 && f[3] == "true")
+			case len(f) == 3 && f[0] == "FILE":
+				dest := filepath.Join(*dir, filepath.Base(f[1]))
+				if !within(from, f[1]) {
+					fmt.Fprintf(os.Stderr, "Warning: keeping %s where it is, outside %s\n", f[1], from)
+					dest = f[1]
+				} else if err := moveFile(f[1], dest); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: keeping %s where it is: %v\n", f[1], err)
+					dest = f[1]
+				}
+				fmt.Println(dest)
+				return !*once
+			}
+			return true
+		})
+		if err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+
+	pass, err := s.resolvePassword(fs, *password)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	n := node.New(s.nameOr(*name), pass)
+	n.Dir = *dir
+	if err := s.persist(n); err != nil {
+		fatalf("%v", err)
+	}
+	n.Start()
+	logf := log.New(os.Stderr, "", 0).Printf
+	for ev := range n.Events() {
+		switch ev := ev.(type) {
+		case node.ListenerUp:
+			if ev.Err != nil && ev.Proto == "TCP" {
+				fatalf("cannot listen on TCP port %s: %v", ev.Port, ev.Err)
+			} else if ev.Err != nil {
+				logf("Warning: discovery unavailable (UDP %s: %v), peers must send to this machine's IP", ev.Port, ev.Err)
+			}
+		case node.ChatReceived:
+			if ev.Err != nil {
+				logf("Warning: unreadable message from %s: %v", ev.Sender, ev.Err)
+				continue
+			}
+			printChat(ev.Sender, ev.Text, ev.Group)
+		case node.FileReceived:
+			fmt.Println(ev.Path)
+			if *once {
+				return
+			}
+		case node.ServerError:
+			logf("Warning: %v", ev.Err)
+		}
+	}
+}
+
+// printChat writes a received message as recv prints it, "sender: text",
+// with the sender marked "sender to everyone" for a group message
+func printChat(sender, text string, group bool) {
+	if group {
+		sender += " to everyone"
+	}
+	fmt.Printf("%s: %s\n", sender, text)
+}
+
+// within reports whether path is inside dir; both must be absolute
+func within(dir, path string) bool {
+	if !filepath.IsAbs(dir) || !filepath.IsAbs(path) {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// moveFile renames src to dest, copying when they are on different devices
+func moveFile(src, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// cliSettings reads the config for a scripting subcommand and switches to
+// its ports and directories
+// `lan-chat tag <peer> [tag...]`: replace a known peer's tags, clearing
+// them when none are given
+func runTag(args []string) {
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	socket := fs.String("control", control.SocketPath(), "Control socket of a running instance")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Config file for the data directory")
+	fs.Parse(args)
+	cliSettings(fs, *configFile)
+	if fs.NArg() < 1 {
+		fmt.Println("Usage: lan-chat tag <peer> [tag...]")
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	peer := fs.Arg(0)
+	var tags []string
+	for _, t := range fs.Args()[1:] {
+		if t = strings.TrimPrefix(t, "#"); t != "" {
+			tags = append(tags, t)
+		}
+	}
+
+	if instanceRunning(*socket) {
+		if _, err := control.Do(*socket, strings.Join(append([]string{"TAG", peer}, tags...), " ")); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	// Nothing is running that writes the database
+	db, err := store.OpenDB(store.DBPath())
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer db.Close()
+	known := db.Peers()
+	i := slices.IndexFunc(known, func(k store.KnownPeer) bool {
+		return strings.EqualFold(k.Name, peer) || slices.Contains(k.IPs, peer)
+	})
+	if i < 0 {
+		fatalf("no known peer %s", peer)
+	}
+	known[i].Tags = tags
+	if err := db.PutPeer(known[i]); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func cliSettings(fs *flag.FlagSet, path string) settings {
+	s, err := loadSettings(path)
+	if err == nil {
+		err = s.usePortFlags(fs)
+	}
+	if err != nil {
+		fatalf("config: %v", err)
+	}
+	s.apply()
+	return s
+}
+
+// nameOr is the --name flag when given, else the configured name, else
+// user@host
+func (s settings) nameOr(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if s.name != "" {
+		return s.name
+	}
+	return defaultName()
+}
+
+func sortPeers(peers []node.PeerInfo) {
+	slices.SortFunc(peers, func(a, b node.PeerInfo) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", v...)
+	os.Exit(1)
+}
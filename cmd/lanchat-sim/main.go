@@ -0,0 +1,135 @@
+// Command lanchat-sim soak-tests a running lan-chat: it starts simulated
+// peers on addresses of this machine, runs a script of joins, chats,
+// transfers and drops on each, and checks through the target's REST API
+// that it discovered them, got every message in order and the files
+// intact. See docs/plans/simulator.md.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"lan-chat/internal/sim"
+)
+
+func main() {
+	addrs := flag.String("addrs", "", "Local addresses for the peers, e.g. 192.168.1.201-192.168.1.220 (required)")
+	peers := flag.Int("peers", 0, "Number of peers (default: one per address)")
+	prefix := flag.String("prefix", "sim", "Peer names are <prefix>1, <prefix>2...")
+	password := flag.String("pass", "", "Shared password, as the target's --pass")
+	script := flag.String("script", "", "Script every peer runs (default: the built-in one, see --print-script)")
+	printScript := flag.Bool("print-script", false, "Print the built-in script and exit")
+	stagger := flag.Duration("stagger", 200*time.Millisecond, "Delay between one peer starting and the next")
+	duration := flag.Duration("duration", 0, "Run the script again until this long has passed (default: once)")
+	apiURL := flag.String("api", "", "Target's REST API, e.g. http://192.168.1.20:8787, for the delivery checks")
+	token := flag.String("token", os.Getenv("LANCHAT_API_TOKEN"), "Target's API token (default $LANCHAT_API_TOKEN)")
+	tokenFile := flag.String("token-file", "", "File holding the target's API token")
+	targetDir := flag.String("target-dir", "", "Where the target saves received files (its --dir), to have transfers sent back and compared")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: lanchat-sim --addrs=RANGE [--peers=N] [--pass=PASSWORD] [--script=FILE] [--duration=D] [--api=URL --token=TOKEN [--target-dir=DIR]] <target-ip>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *printScript {
+		fmt.Print(sim.DefaultScript)
+		return
+	}
+	if flag.NArg() != 1 || *addrs == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := &sim.Config{Target: flag.Arg(0), Prefix: *prefix, Password: *password, Stagger: *stagger, Duration: *duration, TargetDir: *targetDir}
+	var err error
+	if cfg.Addrs, err = sim.ParseAddrs(*addrs); err != nil {
+		fatalf("--addrs: %v", err)
+	}
+	if *peers > 0 {
+		if *peers > len(cfg.Addrs) {
+			fatalf("%d peers need %d addresses, --addrs has %d", *peers, *peers, len(cfg.Addrs))
+		}
+		cfg.Addrs = cfg.Addrs[:*peers]
+	}
+	text := sim.DefaultScript
+	if *script != "" {
+		data, err := os.ReadFile(*script)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		text = string(data)
+	}
+	if cfg.Script, err = sim.ParseScript(strings.NewReader(text)); err != nil {
+		fatalf("%v", err)
+	}
+	if *apiURL != "" {
+		if *tokenFile != "" {
+			data, err := os.ReadFile(*tokenFile)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			*token = strings.TrimSpace(string(data))
+		}
+		if *token == "" {
+			fatalf("--api needs --token or --token-file")
+		}
+		cfg.API = &sim.API{URL: *apiURL, Token: *token}
+		if _, err := cfg.API.Peers(context.Background()); err != nil {
+			fatalf("target API: %v", err)
+		}
+	} else {
+		fmt.Println("No --api: only checking that the target accepts what is sent")
+	}
+
+	start := time.Now()
+	cfg.Logf = func(format string, v ...interface{}) {
+		fmt.Printf("[%6.1fs] "+format+"\n", append([]interface{}{time.Since(start).Seconds()}, v...)...)
+	}
+	// ctrl+c stops the scripts; what was sent so far is still checked
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := sim.Run(ctx, cfg)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PEER\tIP\tLISTED\tCHATS\tFILES\tDROPS\tFAILURES")
+	for _, p := range result {
+		listed := "-"
+		if cfg.API != nil {
+			listed = "no"
+			if d := p.Found(); d > 0 {
+				listed = fmt.Sprintf("%.1fs", d.Seconds())
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", p.Name, p.Host.IP(), listed, tally(p.Chats), tally(p.Files), tally(p.Drops), len(p.Failures))
+	}
+	w.Flush()
+	if sim.Failed(result) {
+		fmt.Printf("FAIL (%d peers, %.1fs)\n", len(result), time.Since(start).Seconds())
+		os.Exit(1)
+	}
+	fmt.Printf("PASS (%d peers, %.1fs)\n", len(result), time.Since(start).Seconds())
+}
+
+// tally is how many were done, then how many were checked good and bad
+func tally(t sim.Tally) string {
+	s := fmt.Sprint(t.Done)
+	if t.OK > 0 || t.Bad > 0 {
+		s += fmt.Sprintf(" (%d ok, %d bad)", t.OK, t.Bad)
+	}
+	return s
+}
+
+func fatalf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", v...)
+	os.Exit(1)
+}
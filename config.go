@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/protocol"
+	"lan-chat/ui"
+)
+
+// configTemplate is what `lan-chat config init` writes: the settings most
+// people change, all but the name commented out at their defaults. %s is
+// the name, %s and %s the ports.
+const configTemplate = `# lan-chat settings; flags given on the command line win over these.
+# Every section and key is described in the README.
+
+[user]
+name = %s
+# Where the shared password comes from, when --pass isn't given; set one
+#password_file = "~/.config/lan-chat/password"
+#password_command = "pass show lan-chat"
+#keyring = true                 # the OS keyring, as --keyring
+
+[network]
+#tcp_port = %s                # announced to peers, so each can pick its own
+#udp_port = %s                # every peer must agree on this one
+
+[downloads]
+#dir = "~/Downloads/lan-chat"
+#files = "accept"               # or "ask", or "refuse"
+
+[theme]
+#mode = "auto"                  # or "dark", or "light"
+
+[ui]
+#keymap = "default"             # or "vim"
+
+[notifications]
+#alert = "bell"                 # or "flash", "both", "none"
+#desktop = false
+
+[logging]
+#debug = false                  # as --debug
+#level = "debug"                # as --log-level
+#format = "text"                # or "json", as --log-format
+#file = "~/.local/state/lan-chat/debug.log"
+`
+
+// runConfig is `lan-chat config init`: write a config file to start from
+func runConfig(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Config file to write")
+	force := fs.Bool("force", false, "Replace an existing config file, keeping it as .bak")
+	fs.Usage = func() {
+		fmt.Println("Usage: lan-chat config init [--config=PATH] [--force] [<yourname>]")
+		fmt.Println("Writes a commented config file with the usual settings at their defaults; <yourname> defaults to user@host.")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "init" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+	if *configFile == "" {
+		fatalf("no config directory; give --config=PATH")
+	}
+	name := defaultName()
+	if fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if err := writeConfig(*configFile, name, *force); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("Wrote %s\n", *configFile)
+}
+
+// writeConfig writes configTemplate for name to path, checked before it
+// replaces anything
+func writeConfig(path, name string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists; --force replaces it, keeping it as %s.bak", path, filepath.Base(path))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	config := fmt.Sprintf(configTemplate, strconv.Quote(name), protocol.DefaultPort, discovery.DefaultPort)
+	tmp := path + ".init"
+	if err := os.WriteFile(tmp, []byte(config), 0644); err != nil {
+		return err
+	}
+	if err := checkConfig(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Rename(path, path+".bak"); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
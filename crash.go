@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"lan-chat/internal/crash"
+	"lan-chat/ui"
+)
+
+// askRestart writes the report of the panic that stopped the TUI and asks
+// whether to start again
+func askRestart(r *crash.Report) bool {
+	ui.Debugf("%s\n%s", r, r.Stack)
+	fmt.Printf("lan-chat hit a bug and stopped: %s\n", r)
+	if err := r.Write(crash.Dir()); err != nil {
+		fmt.Printf("Writing the crash report: %v\n", err)
+	} else {
+		fmt.Printf("Crash report: %s\n", r.Path)
+	}
+	fmt.Print("The conversation and queued sends are saved. Restart now? [Y/n] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"lan-chat/internal/api"
+	"lan-chat/internal/bot"
+	"lan-chat/internal/bridge"
+	"lan-chat/internal/control"
+	"lan-chat/internal/crash"
+	"lan-chat/internal/hooks"
+	"lan-chat/internal/logging"
+	"lan-chat/internal/mqtt"
+	"lan-chat/internal/node"
+	"lan-chat/internal/protocol"
+	"lan-chat/internal/rpc"
+	"lan-chat/internal/store"
+	"lan-chat/internal/systemd"
+	"lan-chat/internal/update"
+	"lan-chat/ui"
+)
+
+// runDaemon is `lan-chat daemon`: the node without a terminal, for a
+// headless file-drop box. Events go to stdout, commands come in on the
+// control socket, and `lan-chat --attach` opens the TUI it keeps running.
+func runDaemon(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	password := fs.String("pass", "", "Shared password for encrypted communication (default: user.password_file or user.password_command from the config)")
+	addPasswordFlags(fs)
+	addPortFlags(fs)
+	fs.Bool("debug", false, "Also log discovery, verification and transfer details (default: debug under [logging])")
+	dir := fs.String("dir", "", "Directory received files are saved in (default: dir under [downloads] in the config, or the downloads folder)")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Path to the config file ([user], [network], [downloads], [hooks], [webhooks], [irc], [matrix], [bridge], [mqtt], [bot] and [update] sections)")
+	socket := fs.String("control", control.SocketPath(), "Path of the control socket")
+	apiAddr := fs.String("api", "", "Serve the local REST API on this address, e.g. 127.0.0.1:8787")
+	webAddr := fs.String("web", "", "Serve the browser frontend on this address, e.g. 127.0.0.1:8443 (same token as --api)")
+	webCert := fs.String("web-cert", "", "TLS certificate for --web, needed on an address other than loopback")
+	webKey := fs.String("web-key", "", "TLS key for --web-cert")
+	grpcOn := fs.Bool("grpc", false, "Serve the gRPC control API on a unix socket in $XDG_RUNTIME_DIR")
+	pprofAddr := fs.String("pprof", "", "Serve net/http/pprof on this loopback address, e.g. localhost:6060")
+	logFile := fs.String("log-file", "", "Log to this file, rotated by the [logging] limits, instead of stdout")
+	fs.String("log-format", "text", "Log record format: text or json (default: format under [logging])")
+	fs.String("log-level", "", "Lowest level logged: debug, info, warn or error (default: level under [logging], else info, debug with --debug)")
+	systemdOn := fs.Bool("systemd", false, "Run as a systemd Type=notify service: readiness, watchdog and socket activation")
+	jsonEvents := fs.Bool("json-events", false, "Write every event as one JSON object per line on stdout; logs go to stderr")
+	fs.Usage = func() {
+		fmt.Println("Usage: lan-chat daemon [--pass=PASSWORD|--encrypt|--keyring] [--tcp-port=PORT] [--udp-port=PORT] [--debug] [--dir=DIR] [--config=PATH] [--control=PATH] [--api=ADDR] [--web=ADDR [--web-cert=FILE --web-key=FILE]] [--grpc] [--pprof=ADDR] [--log-file=PATH] [--log-format=text|json] [--log-level=LEVEL] [--systemd] [--json-events] [<yourname>]")
+		fmt.Println("<yourname> defaults to name under [user] in the config file, else to user@host.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	s, err := loadSettings(*configFile)
+	if err == nil {
+		err = s.usePortFlags(fs)
+	}
+	if err != nil {
+		fatalf("Config: %v", err)
+	}
+	name := s.name
+	if fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" {
+		name = defaultName()
+	}
+	s.apply()
+
+	level := slog.LevelInfo
+	debugOn := s.debugOn(fs)
+	if debugOn {
+		level = slog.LevelDebug
+	}
+	if l := flagOr(fs, "log-level", s.logLevel); l != "" {
+		l, err := logging.ParseLevel(l)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		level = l
+	}
+	logOut := os.Stdout
+	if *jsonEvents {
+		logOut = os.Stderr // stdout is the event stream
+	}
+	logger, logCloser, err := logging.New(logOut, logging.Options{Path: *logFile, Format: flagOr(fs, "log-format", s.logFormat), Level: level, Limits: s.logLimits})
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer logCloser.Close()
+	die := func(what string, err error) {
+		logger.Error(what, "err", err)
+		os.Exit(1)
+	}
+
+	if err := moveOldFiles(); err != nil {
+		logger.Warn("Moving files from the config directory", "err", err)
+	}
+	hookRunner, err := hooks.New(*configFile)
+	if err != nil {
+		die("Config", err)
+	}
+	chatBridge, err := bridge.New(*configFile)
+	if err != nil {
+		die("Config", err)
+	}
+	mqttBridge, err := mqtt.New(*configFile, name)
+	if err != nil {
+		die("Config", err)
+	}
+	responder, err := bot.New(*configFile)
+	if err != nil {
+		die("Config", err)
+	}
+	updater, err := update.New(*configFile)
+	if err != nil {
+		die("Config", err)
+	}
+	pass, err := s.resolvePassword(fs, *password)
+	if err != nil {
+		die("Config", err)
+	}
+	n := node.New(name, pass)
+	n.Dir = s.downloads(*dir)
+	n.DirFor = s.dirFor()
+	n.FilePolicy = s.files
+	if n.FilePolicy == "ask" {
+		// Nobody to ask; what isn't to be taken unasked isn't taken
+		n.FilePolicy = "refuse"
+	}
+	n.Collision = s.collision
+	if n.Collision == "ask" {
+		// Nor anybody to choose; keep both
+		n.Collision = "rename"
+	}
+	if err := os.MkdirAll(n.Dir, 0755); err != nil {
+		die("Download directory", err)
+	}
+	if err := s.persist(n); err != nil {
+		die("Data directory", err)
+	}
+	if debugOn {
+		n.Logf = logging.Printf(logger, slog.LevelDebug)
+	}
+	var watchdog <-chan time.Time
+	if *systemdOn {
+		// With lan-chat.socket, systemd already holds the TCP port
+		listeners, err := systemd.Listeners()
+		if err != nil {
+			die("Socket activation", err)
+		}
+		if len(listeners) > 0 {
+			n.Listener = systemd.Activated{L: listeners[0]}
+			logger.Info("Using the socket from systemd", "addr", listeners[0].Addr().String())
+		}
+		if every := systemd.WatchdogInterval(); every > 0 {
+			watchdog = time.Tick(every)
+		}
+	}
+
+	// The TUI runs headless from the start, so it has the whole
+	// conversation when somebody attaches
+	cfg, err := ui.LoadConfig(*configFile)
+	if err != nil {
+		die("Config", err)
+	}
+	st := store.LoadUIState(store.StatePath())
+	cfg.Restore(st)
+	// SIGHUP and the palette reload through the TUI. Only hooks, webhooks
+	// and bot rules reload out here; the bridges keep their connections
+	// until a restart.
+	cfg.OnReload = func() error {
+		if err := reloadConfig(*configFile, hookRunner, responder); err != nil {
+			logger.Error("Config not reloaded", "err", err)
+			return err
+		}
+		logger.Info("Config reloaded", "path", *configFile)
+		return nil
+	}
+	tui := ui.NewSession(ui.New(n, cfg, st, ui.FollowNetwork(n)))
+
+	ln, err := control.Listen(*socket)
+	if err != nil {
+		die("Control socket", err)
+	}
+	go control.Serve(ln, daemonBackend{n, tui})
+	// A node missing a goroutine is worse than a restart: log where the
+	// report went and exit non-zero, which Restart=on-failure answers
+	crash.Handle(func(r crash.Report) {
+		logger.Error("Crashed", "in", r.Where, "panic", fmt.Sprint(r.Value), "report", r.Path)
+		ln.Close()
+		os.Exit(1)
+	})
+	if *apiAddr != "" {
+		if err := serveAPI(*apiAddr, n); err != nil {
+			die("API", err)
+		}
+		logger.Info("REST API up", "url", "http://"+*apiAddr, "token", api.TokenPath())
+	}
+	if *webAddr != "" {
+		if err := serveWeb(*webAddr, *webCert, *webKey, n); err != nil {
+			die("Web", err)
+		}
+		logger.Info("Web UI up", "addr", *webAddr, "token", api.TokenPath())
+	}
+	if *grpcOn {
+		if err := serveGRPC(rpc.SocketPath(), n); err != nil {
+			die("gRPC", err)
+		}
+		logger.Info("gRPC API up", "socket", rpc.SocketPath())
+	}
+	if *pprofAddr != "" {
+		if err := servePprof(*pprofAddr); err != nil {
+			die("pprof", err)
+		}
+		logger.Info("pprof up", "url", "http://"+*pprofAddr+"/debug/pprof/")
+	}
+	stop := func(args ...any) {
+		logger.Info("Stopping", args...)
+		if *systemdOn {
+			systemd.Notify("STOPPING=1")
+		}
+		ln.Close() // removes the socket file
+		if *grpcOn {
+			os.Remove(rpc.SocketPath())
+		}
+		os.Exit(0)
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		stop("signal", s.String())
+	}()
+	// "Stop background session" in an attached TUI's palette stops the
+	// daemon too
+	go func() {
+		if err := tui.Run(); err != nil {
+			logger.Error("TUI", "err", err)
+		}
+		stop("from", "TUI")
+	}()
+
+	logger.Info("Starting", "name", n.Name, "encrypted", pass != "", "control", *socket)
+	hookRunner.Logf = logging.Printf(logger, slog.LevelInfo)
+	hookRunner.Start(n)
+	for _, r := range chatBridge.Remotes() {
+		logger.Info("Bridging", "to", r.Name())
+	}
+	chatBridge.Logf = logging.Printf(logger, slog.LevelInfo)
+	chatBridge.Start(n)
+	mqttBridge.Logf = logging.Printf(logger, slog.LevelInfo)
+	mqttBridge.Start(n)
+	responder.Logf = logging.Printf(logger, slog.LevelInfo)
+	responder.Start(n)
+	updater.Version, updater.Logf = version, logging.Printf(logger, slog.LevelInfo)
+	updater.Notify(func(r update.Release) {
+		logger.Info("Update available", "version", r.Version, "url", r.URL, "install", "lan-chat update")
+	})
+	n.Start()
+	// Ready once both listeners have reported, whether or not they opened;
+	// the watchdog is fed from this loop, so a stuck loop gets restarted
+	listening := 0
+	events := json.NewEncoder(os.Stdout)
+	for {
+		select {
+		case ev := <-n.Events():
+			logEvent(logger, n, ev)
+			if *jsonEvents {
+				writeEvent(events, n, ev)
+			}
+			if *systemdOn {
+				if _, ok := ev.(node.ListenerUp); ok {
+					if listening++; listening == 2 {
+						systemd.Notify(fmt.Sprintf("READY=1\nSTATUS=Announcing as %s", n.Name))
+					}
+				}
+			}
+		case <-watchdog:
+			systemd.Notify("WATCHDOG=1")
+		}
+	}
+}
+
+// daemonBackend is the node behind the control socket, with the TUI that
+// ATTACH and RESIZE are handed to
+type daemonBackend struct {
+	*node.Node
+	tui *ui.Session
+}
+
+func (b daemonBackend) ServeTerminal(c net.Conn, header string) {
+	b.tui.Handle(c, header)
+}
+
+// logEvent writes one record per node event
+func logEvent(logger *slog.Logger, n *node.Node, ev node.Event) {
+	// Peers are logged with their name where we know it
+	peer := func(ip string) slog.Attr {
+		if p, ok := n.Lookup(ip); ok {
+			return slog.Group("peer", "name", p.Name, "ip", ip)
+		}
+		return slog.Group("peer", "ip", ip)
+	}
+	switch ev := ev.(type) {
+	case node.ListenerUp:
+		if ev.Err != nil {
+			logger.Error("Cannot listen", "proto", ev.Proto, "port", ev.Port, "err", ev.Err)
+		} else {
+			logger.Info("Listening", "proto", ev.Proto, "port", ev.Port)
+		}
+	case node.PeerFound:
+		logger.Info("Discovered peer", peer(ev.Peer.IP))
+	case node.PeerLost:
+		logger.Info("Lost peer", slog.Group("peer", "name", ev.Peer.Name, "ip", ev.Peer.IP), "last_seen", ev.LastSeen)
+	case node.PeerVerified:
+		if ev.Secure {
+			logger.Info("Verified peer, traffic is encrypted", peer(ev.IP))
+		} else {
+			logger.Warn("Password mismatch, traffic is plaintext", peer(ev.IP))
+		}
+	case node.PeerIdentified:
+		if ev.Changed {
+			logger.Warn("Identity key changed, not the machine seen before", peer(ev.IP), "pinned", ev.Pinned, "key", ev.Key)
+		} else {
+			logger.Info("Identified peer", peer(ev.IP), "key", ev.Key)
+		}
+	case node.PeerTagged:
+		logger.Info("Tagged peer", "name", ev.Name, "tags", ev.Tags)
+	case node.PeerHealth:
+		if ev.Reachable {
+			logger.Info("Peer is reachable", peer(ev.IP))
+		} else {
+			logger.Warn("Peer is unreachable", peer(ev.IP))
+		}
+	case node.ChatReceived:
+		switch {
+		case errors.Is(ev.Err, protocol.ErrNoPassword):
+			logger.Warn("Encrypted message but no --pass set", "from", ev.Sender)
+		case ev.Err != nil:
+			logger.Warn("Could not decrypt message", "from", ev.Sender, "err", ev.Err)
+		default:
+			logger.Info("Message received", "from", ev.Sender, "text", ev.Text, "encrypted", ev.Encrypted)
+		}
+	case node.ChatSent:
+		logger.Info("Message sent", peer(ev.IP), "text", ev.Text, "encrypted", ev.Encrypted)
+	case node.TransferProgress:
+		if ev.Done && ev.Err != nil {
+			logger.Error("Sending file failed", "file", ev.Name, peer(ev.IP), "err", ev.Err)
+		} else if ev.Done {
+			logger.Info("Sent file", "file", ev.Name, peer(ev.IP))
+		}
+	case node.FileReceived:
+		logger.Info("Received file", "file", ev.Name, peer(ev.From), "path", ev.Path)
+	case node.ServerError:
+		logger.Error("Server error", "err", ev.Err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"lan-chat/internal/node"
+)
+
+// jsonEvent is one line of `daemon --json-events`; Type says which other
+// field is set
+type jsonEvent struct {
+	Type     string         `json:"type"` // peer, peer_lost, message, file, transfer or error
+	Time     time.Time      `json:"time"`
+	Peer     *node.PeerInfo `json:"peer,omitempty"`
+	Message  *node.Message  `json:"message,omitempty"`
+	File     *jsonFile      `json:"file,omitempty"`
+	Transfer *jsonTransfer  `json:"transfer,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// jsonFile is a received file
+type jsonFile struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"` // absolute path it was saved to
+	Peer      string `json:"peer,omitempty"`
+	IP        string `json:"ip"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+// jsonTransfer is progress on an outgoing file
+type jsonTransfer struct {
+	Peer  string `json:"peer,omitempty"`
+	IP    string `json:"ip"`
+	Name  string `json:"name"`
+	Sent  int64  `json:"sent"`
+	Total int64  `json:"total"`
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// writeEvent writes ev as one line of JSON; events with nothing to say
+// (a listener that opened) are skipped
+func writeEvent(enc *json.Encoder, n *node.Node, ev node.Event) {
+	e := jsonEvent{Time: time.Now()}
+	peer := func(ip string) *node.PeerInfo {
+		if p, ok := n.Lookup(ip); ok {
+			return &p
+		}
+		return &node.PeerInfo{IP: ip}
+	}
+	switch ev := ev.(type) {
+	case node.ListenerUp:
+		if ev.Err == nil {
+			return
+		}
+		e.Type, e.Error = "error", ev.Proto+" listen on port "+ev.Port+": "+ev.Err.Error()
+	case node.PeerFound:
+		e.Type, e.Peer = "peer", peer(ev.Peer.IP)
+	case node.PeerLost:
+		e.Type, e.Peer = "peer_lost", &node.PeerInfo{Name: ev.Peer.Name, IP: ev.Peer.IP}
+	case node.PeerVerified:
+		e.Type, e.Peer = "peer", peer(ev.IP)
+	case node.PeerHealth:
+		e.Type, e.Peer = "peer", peer(ev.IP)
+	case node.PeerIdentified:
+		e.Type, e.Peer = "peer", peer(ev.IP)
+	case node.ChatReceived:
+		if ev.Err != nil {
+			e.Type, e.Error = "error", "message from "+ev.Sender+": "+ev.Err.Error()
+			break
+		}
+		e.Type = "message"
+		e.Message = &node.Message{Time: ev.Time, Peer: ev.Sender, IP: ev.From, Text: ev.Text, Encrypted: ev.Encrypted, Group: ev.Group}
+	case node.ChatSent:
+		m := ev.Message
+		e.Type, e.Message = "message", &m
+	case node.FileReceived:
+		path, _ := filepath.Abs(ev.Path)
+		e.Type = "file"
+		e.File = &jsonFile{Name: ev.Name, Path: path, Peer: peer(ev.From).Name, IP: ev.From, Encrypted: ev.Encrypted}
+	case node.TransferProgress:
+		t := &jsonTransfer{Peer: peer(ev.IP).Name, IP: ev.IP, Name: ev.Name, Sent: ev.Sent, Total: ev.Total, Done: ev.Done}
+		if ev.Err != nil {
+			t.Error = ev.Err.Error()
+		}
+		e.Type, e.Transfer = "transfer", t
+	case node.ServerError:
+		e.Type, e.Error = "error", ev.Err.Error()
+	default:
+		return
+	}
+	enc.Encode(e)
+}
@@ -0,0 +1,181 @@
+// Package api is the local REST API enabled with --api. Every request needs
+// "Authorization: Bearer <token>" with the token from TokenPath.
+//
+//	GET  /v1/peers                        discovered peers
+//	GET  /v1/messages?peer=NAME&q=&limit= chat history, oldest first; q keeps
+//	                                      messages with every word of it
+//	POST /v1/messages   {"peer", "text"}  send a chat message
+//	GET  /v1/transfers?peer=NAME&limit=N  files sent and received, oldest first
+//	POST /v1/transfers  {"peer", "path"}  send a file (path is read by lan-chat)
+//
+// Errors are {"error": "..."} with a 4xx/5xx status.
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lan-chat/internal/node"
+	"lan-chat/internal/platform"
+	"lan-chat/internal/store"
+)
+
+// Backend is what the API drives; *node.Node implements it
+type Backend interface {
+	Peers() []node.PeerInfo
+	Lookup(peer string) (node.PeerInfo, bool)
+	SendChat(ip, text string) error
+	SendFile(ip, path string) error
+	History(peer string) []node.Message
+	Search(peer, query string) []node.Message
+	Transfers(peer string) []store.Transfer
+}
+
+// TokenPath is where the API token is kept, readable only by the user
+func TokenPath() string {
+	if dir := platform.DataDir(); dir != "" {
+		return filepath.Join(dir, "api-token")
+	}
+	return ""
+}
+
+// LoadToken reads the token at path, creating a random one the first time
+func LoadToken(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("no config directory for the API token")
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	return token, os.WriteFile(path, []byte(token+"\n"), 0600)
+}
+
+// Handler serves the API for b
+func Handler(b Backend, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/peers", func(w http.ResponseWriter, r *http.Request) {
+		peers := b.Peers()
+		if peers == nil {
+			peers = []node.PeerInfo{}
+		}
+		writeJSON(w, http.StatusOK, peers)
+	})
+	mux.HandleFunc("GET /v1/messages", func(w http.ResponseWriter, r *http.Request) {
+		peer := r.URL.Query().Get("peer")
+		var history []node.Message
+		if q := r.URL.Query().Get("q"); q != "" {
+			history = b.Search(peer, q)
+		} else {
+			history = b.History(peer)
+		}
+		if history, ok := limit(w, r, history); ok {
+			writeJSON(w, http.StatusOK, history)
+		}
+	})
+	mux.HandleFunc("GET /v1/transfers", func(w http.ResponseWriter, r *http.Request) {
+		if transfers, ok := limit(w, r, b.Transfers(r.URL.Query().Get("peer"))); ok {
+			writeJSON(w, http.StatusOK, transfers)
+		}
+	})
+	mux.HandleFunc("POST /v1/messages", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Peer, Text string }
+		if !decode(w, r, &req) {
+			return
+		}
+		if req.Text == "" {
+			writeError(w, http.StatusBadRequest, "text must not be empty")
+			return
+		}
+		send(w, b, req.Peer, func(ip string) error { return b.SendChat(ip, req.Text) })
+	})
+	mux.HandleFunc("POST /v1/transfers", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Peer, Path string }
+		if !decode(w, r, &req) {
+			return
+		}
+		if !filepath.IsAbs(req.Path) {
+			writeError(w, http.StatusBadRequest, "path must be absolute")
+			return
+		}
+		send(w, b, req.Peer, func(ip string) error { return b.SendFile(ip, req.Path) })
+	})
+	return authorize(token, mux)
+}
+
+// limit keeps the last ?limit= items, answering 400 for a bad limit. The
+// result is never nil, so an empty list is [] rather than null.
+func limit[T any](w http.ResponseWriter, r *http.Request, items []T) ([]T, bool) {
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative number")
+			return nil, false
+		}
+		items = items[max(len(items)-n, 0):]
+	}
+	if items == nil {
+		items = []T{}
+	}
+	return items, true
+}
+
+func authorize(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or wrong bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// send resolves the peer and runs f, mapping failures to statuses
+func send(w http.ResponseWriter, b Backend, peer string, f func(ip string) error) {
+	p, ok := b.Lookup(peer)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no peer named "+peer)
+		return
+	}
+	if err := f(p.IP); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,188 @@
+// Package bench measures the hot paths, encryption, the wire format and
+// file transfers, so a change that slows them down shows up in numbers.
+// It uses testing.Benchmark rather than _test files, so the same binary
+// runs it on any machine with `lan-chat bench`. The network benchmarks
+// use a real server on loopback.
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/protocol"
+)
+
+const password = "bench-password"
+
+// Sizes the benchmarks send: a typical chat line and a typical file
+const (
+	chatSize = 200
+	fileSize = 4 << 20
+)
+
+// benchmark is one measurement; setup failures are reported with b.Fatal
+type benchmark struct {
+	name string
+	run  func(b *testing.B)
+}
+
+var benchmarks = []benchmark{
+	{"crypto/encrypt-chat", benchEncrypt(chatSize)},
+	{"crypto/decrypt-chat", benchDecrypt(chatSize)},
+	{"crypto/encrypt-file", benchEncrypt(fileSize)},
+	{"crypto/decrypt-file", benchDecrypt(fileSize)},
+	{"framing/chat-dial", benchChat(false, "")},
+	{"framing/chat-pooled", benchChat(true, "")},
+	{"framing/echat-pooled", benchChat(true, password)},
+	{"framing/ping-pooled", benchPing},
+	{"transfer/file", benchFile("")},
+	{"transfer/efile", benchFile(password)},
+}
+
+// Run runs every benchmark whose name matches (all of them for nil) and
+// prints one line for each, in the format of `go test -bench`
+func Run(match *regexp.Regexp, printf func(format string, v ...interface{})) error {
+	ran := 0
+	for _, bm := range benchmarks {
+		if match != nil && !match.MatchString(bm.name) {
+			continue
+		}
+		r := testing.Benchmark(bm.run)
+		if r.N == 0 {
+			return fmt.Errorf("%s failed", bm.name)
+		}
+		printf("%-24s %s\t%s", bm.name, r.String(), r.MemString())
+		ran++
+	}
+	if ran == 0 {
+		return fmt.Errorf("no benchmark matches %s", match)
+	}
+	return nil
+}
+
+func benchEncrypt(size int) func(b *testing.B) {
+	return func(b *testing.B) {
+		data := bytes.Repeat([]byte("x"), size)
+		b.SetBytes(int64(size))
+		for b.Loop() {
+			if _, err := crypto.Encrypt(data, password); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchDecrypt(size int) func(b *testing.B) {
+	return func(b *testing.B) {
+		sealed, err := crypto.Encrypt(bytes.Repeat([]byte("x"), size), password)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(size))
+		for b.Loop() {
+			if _, err := crypto.Decrypt(sealed, password); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchChat(pooled bool, pass string) func(b *testing.B) {
+	return func(b *testing.B) {
+		srv := serve(b)
+		c := srv.client(pooled)
+		text := strings.Repeat("x", chatSize)
+		for b.Loop() {
+			if err := c.SendChat(srv.ip, "bench", text, pass); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchPing(b *testing.B) {
+	srv := serve(b)
+	c := srv.client(true)
+	for b.Loop() {
+		if !c.Ping(srv.ip) {
+			b.Fatal("no PONG")
+		}
+	}
+}
+
+func benchFile(pass string) func(b *testing.B) {
+	return func(b *testing.B) {
+		srv := serve(b)
+		c := srv.client(true)
+		data := bytes.Repeat([]byte("x"), fileSize)
+		b.SetBytes(fileSize)
+		for b.Loop() {
+			if err := c.SendFile(srv.ip, "bench.bin", bytes.NewReader(data), pass); err != nil {
+				b.Fatal(err)
+			}
+			// Until it is on disk, or the next file overlaps this one
+			select {
+			case <-srv.files:
+			case err := <-srv.errs:
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// server is a protocol.Server on a loopback port, saving files in a
+// temporary directory, until the benchmark ends
+type server struct {
+	ip    string
+	addr  string
+	files chan struct{}
+	errs  chan error
+}
+
+func serve(b *testing.B) *server {
+	b.StopTimer()
+	defer b.StartTimer()
+	dir, err := os.MkdirTemp("", "lan-chat-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.RemoveAll(dir)
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		ln.Close()
+		os.RemoveAll(dir)
+	})
+	s := &server{ip: "127.0.0.1", addr: ln.Addr().String(), files: make(chan struct{}, 1), errs: make(chan error, 1)}
+	srv := &protocol.Server{Password: password, Fingerprint: crypto.Fingerprint(password), Handler: s, Dir: dir}
+	go srv.Serve(ln)
+	return s
+}
+
+func (s *server) Chat(c protocol.Chat) {}
+func (s *server) File(f protocol.File) { s.files <- struct{}{} }
+func (s *server) Error(err error)      { s.errs <- err }
+
+// client talks to the server, through a pool when pooled
+func (s *server) client(pooled bool) protocol.Client {
+	c := protocol.Client{Dialer: dialer(s.addr)}
+	if pooled {
+		c.Pool = protocol.NewPool()
+	}
+	return c
+}
+
+// dialer connects to one address whatever the IP asked for
+type dialer string
+
+func (d dialer) Dial(ip string) (net.Conn, error) {
+	return net.DialTimeout("tcp", string(d), protocol.DialTimeout)
+}
@@ -0,0 +1,216 @@
+// Package bot answers incoming chat messages that match configured
+// patterns, with a templated reply or with the output of a script, so a
+// daemon can be a LAN bot: "!build status", "!uptime", "!wiki <term>".
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/hooks"
+	"lan-chat/internal/node"
+)
+
+// Defaults for bot.timeout and bot.cooldown
+const (
+	DefaultTimeout  = 10 * time.Second
+	DefaultCooldown = time.Second
+)
+
+// A script's reply is cut to maxReply bytes and maxLines lines; the rest of
+// its output is dropped
+const (
+	maxReply = 4096
+	maxLines = 20
+)
+
+// Backend is the node the bot answers through; *node.Node implements it
+type Backend interface {
+	SendChat(ip, text string) error
+	Subscribe(buffer int, policy bus.Policy) *bus.Subscription[node.Event]
+}
+
+// Rule is one [bot.<name>] section: a message matching Match is answered
+// with Reply, or with what Run prints
+type Rule struct {
+	Name  string
+	Match *regexp.Regexp
+	Reply string // template; see fill
+	Run   string // command template, split like a hook's
+}
+
+// Bot holds the rules, tried in name order; the first match answers
+type Bot struct {
+	Rules    []Rule
+	Timeout  time.Duration                         // how long Run may take
+	Cooldown time.Duration                         // least time between two answers to one peer
+	Logf     func(format string, v ...interface{}) // optional debug log
+
+	mu   sync.Mutex           // guards the fields above against Reload, and last
+	last map[string]time.Time // by peer IP
+}
+
+func (b *Bot) logf(format string, v ...interface{}) {
+	if b.Logf != nil {
+		b.Logf(format, v...)
+	}
+}
+
+// Reload replaces the rules and timings with those in the config file at
+// configPath; on error nothing changes
+func (b *Bot) Reload(configPath string) error {
+	next, err := New(configPath)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.Rules, b.Timeout, b.Cooldown = next.Rules, next.Timeout, next.Cooldown
+	b.mu.Unlock()
+	return nil
+}
+
+// Start answers be's incoming messages in the background until the process
+// exits. Like hooks, call it before the node starts; with no rules it only
+// waits for a Reload to bring some.
+func (b *Bot) Start(be Backend) {
+	sub := be.Subscribe(node.DefaultBuffer, bus.Block)
+	go func() {
+		for ev := range sub.Events() {
+			if m, ok := ev.(node.ChatReceived); ok && m.Err == nil {
+				go b.answer(be, m)
+			}
+		}
+	}()
+}
+
+// answer replies to m if a rule matches it and the peer isn't cooling down
+func (b *Bot) answer(be Backend, m node.ChatReceived) {
+	b.mu.Lock()
+	var rule Rule
+	var groups []string
+	for _, r := range b.Rules {
+		if groups = r.Match.FindStringSubmatch(m.Text); groups != nil {
+			rule = r
+			break
+		}
+	}
+	timeout := b.Timeout
+	// Two bots answering each other would otherwise chat forever at full speed
+	cooling := time.Since(b.last[m.From]) < b.Cooldown
+	if groups != nil && !cooling {
+		if b.last == nil {
+			b.last = make(map[string]time.Time)
+		}
+		b.last[m.From] = time.Now()
+	}
+	b.mu.Unlock()
+	if groups == nil {
+		return
+	}
+	if cooling {
+		b.logf("Bot %s: not answering %s, answered it less than a cooldown ago", rule.Name, m.Sender)
+		return
+	}
+
+	value := lookup(rule.Match, groups, m)
+	var reply string
+	if rule.Run != "" {
+		argv, err := hooks.Expand(rule.Run, value)
+		if err != nil {
+			b.logf("Bot %s: %v", rule.Name, err)
+			return
+		}
+		if reply, err = run(argv, m, timeout); err != nil {
+			b.logf("Bot %s: %v", rule.Name, err)
+			return
+		}
+	} else {
+		reply = fill(rule.Reply, value)
+	}
+	// Messages keep their line breaks, so the reply goes as one
+	lines := strings.Split(strings.TrimSpace(reply), "\n")
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	if reply = strings.Join(lines, "\n"); reply == "" {
+		return
+	}
+	if err := be.SendChat(m.From, reply); err != nil {
+		b.logf("Bot %s: reply to %s: %v", rule.Name, m.Sender, err)
+	}
+}
+
+// lookup gives a placeholder's value: {sender}, {ip}, {text}, {0} for the
+// whole match, {1}... for the groups and named groups by name
+func lookup(re *regexp.Regexp, groups []string, m node.ChatReceived) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		switch name {
+		case "sender":
+			return m.Sender, true
+		case "ip":
+			return m.From, true
+		case "text":
+			return m.Text, true
+		}
+		if i := re.SubexpIndex(name); i >= 0 {
+			return groups[i], true
+		}
+		var i int
+		for _, c := range name {
+			if c < '0' || c > '9' {
+				return "", false
+			}
+			i = i*10 + int(c-'0')
+		}
+		if i < len(groups) {
+			return groups[i], true
+		}
+		return "", false
+	}
+}
+
+var placeholderRe = regexp.MustCompile(`\{[A-Za-z0-9_]+\}`)
+
+// fill replaces the placeholders in a reply template. New has checked them
+// all, so nothing is left over.
+func fill(tmpl string, value func(string) (string, bool)) string {
+	return placeholderRe.ReplaceAllStringFunc(tmpl, func(ph string) string {
+		if v, ok := value(ph[1 : len(ph)-1]); ok {
+			return v
+		}
+		return ph
+	})
+}
+
+// run starts argv with the message on stdin and returns what it printed
+func run(argv []string, m node.ChatReceived, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = strings.NewReader(m.Text)
+	cmd.Env = append(os.Environ(), "LANCHAT_SENDER="+m.Sender, "LANCHAT_IP="+m.From)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	switch {
+	case ctx.Err() != nil:
+		return "", fmt.Errorf("killed after %v", timeout)
+	case err != nil:
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	if len(out) > maxReply {
+		out = out[:maxReply]
+	}
+	return strings.ToValidUTF8(string(out), ""), nil
+}
@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lan-chat/internal/hooks"
+	"lan-chat/internal/node"
+	"lan-chat/internal/store"
+)
+
+// ruleKeys are the keys of a [bot.<name>] section
+var ruleKeys = map[string]bool{"match": true, "reply": true, "run": true}
+
+// New is the bot configured in the config file at configPath: [bot] for
+// the timings and a [bot.<name>] section per rule. A missing file or no
+// rules means it never answers.
+func New(configPath string) (*Bot, error) {
+	b := &Bot{Timeout: DefaultTimeout, Cooldown: DefaultCooldown}
+	if configPath == "" {
+		return b, nil
+	}
+	values, err := store.ParseFile(configPath)
+	if os.IsNotExist(err) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rules := make(map[string]bool)
+	for k := range values {
+		rest, ok := strings.CutPrefix(k, "bot.")
+		if !ok {
+			continue
+		}
+		name, key, isRule := strings.Cut(rest, ".")
+		switch {
+		case !isRule && (rest == "timeout" || rest == "cooldown"):
+		case isRule && ruleKeys[key]:
+			rules[name] = true
+		default:
+			return nil, fmt.Errorf("%s: unknown key", k)
+		}
+	}
+	for key, dst := range map[string]*time.Duration{"bot.timeout": &b.Timeout, "bot.cooldown": &b.Cooldown} {
+		if v, ok := values[key]; ok {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs < 0 || key == "bot.timeout" && secs == 0 {
+				return nil, fmt.Errorf("%s: must be a number of seconds, got %q", key, v)
+			}
+			*dst = time.Duration(secs) * time.Second
+		}
+	}
+	for name := range rules {
+		r, err := ruleConfig(name, values)
+		if err != nil {
+			return nil, err
+		}
+		b.Rules = append(b.Rules, r)
+	}
+	sort.Slice(b.Rules, func(i, j int) bool { return b.Rules[i].Name < b.Rules[j].Name })
+	return b, nil
+}
+
+func ruleConfig(name string, values map[string]string) (Rule, error) {
+	prefix := "bot." + name + "."
+	r := Rule{Name: name, Reply: values[prefix+"reply"], Run: values[prefix+"run"]}
+	pattern, ok := values[prefix+"match"]
+	if !ok || pattern == "" {
+		return r, fmt.Errorf("%smatch: required", prefix)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return r, fmt.Errorf("%smatch: %v", prefix, err)
+	}
+	r.Match = re
+	if (r.Reply == "") == (r.Run == "") {
+		return r, fmt.Errorf("bot.%s: needs one of reply or run", name)
+	}
+	// Every placeholder must be one the pattern can fill
+	value := lookup(re, make([]string, re.NumSubexp()+1), node.ChatReceived{})
+	if r.Run != "" {
+		if _, err := hooks.Expand(r.Run, value); err != nil {
+			return r, fmt.Errorf("%srun: %v", prefix, err)
+		}
+	}
+	for _, ph := range placeholderRe.FindAllString(r.Reply, -1) {
+		if _, ok := value(ph[1 : len(ph)-1]); !ok {
+			return r, fmt.Errorf("%sreply: unknown placeholder %s", prefix, ph)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,253 @@
+// Package bridge mirrors LAN chat to other chat networks, two ways:
+//
+//   - As a room: the instance running the bridge is the room. A message a
+//     room peer sends it goes to the remote side and to the other room
+//     peers, and a message arriving on the remote side goes to every room
+//     peer. Run it on a daemon with its own name (`lan-chat daemon team`)
+//     so the room is a peer people chat with.
+//   - Direct: everything the instance receives is forwarded to the remote,
+//     and replies there ("alice: text", or just text for whoever wrote
+//     last) go back to the LAN, so messages reach you while you are away.
+package bridge
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/node"
+)
+
+// Backend is the node the bridge relays through; *node.Node implements it
+type Backend interface {
+	Peers() []node.PeerInfo
+	Lookup(peer string) (node.PeerInfo, bool)
+	SendChat(ip, text string) error
+	Subscribe(buffer int, policy bus.Policy) *bus.Subscription[node.Event]
+}
+
+// Remote is the other side of the bridge
+type Remote interface {
+	// Name is how the remote shows up in logs, e.g. "irc #team"
+	Name() string
+	// Run connects and calls recv for each message arriving on the remote
+	// side until the connection fails
+	Run(recv func(from, text string)) error
+	// Send posts text on behalf of the LAN peer from; it may fail while
+	// Run is not connected
+	Send(from, text string) error
+}
+
+// Reconnect delays: the first retry comes quickly, then they double up to
+// the maximum
+const (
+	retryMin = 5 * time.Second
+	retryMax = 5 * time.Minute
+)
+
+// sendTimeout bounds one post to a remote. The relay waits for each in
+// turn, so a slow server holds up the messages behind it but never longer.
+const sendTimeout = 15 * time.Second
+
+// notice is the sender of messages from the bridge itself
+const notice = "lan-chat"
+
+// Bridge relays between the node and its remotes
+type Bridge struct {
+	Rooms  []Remote                              // remotes the room is mirrored to
+	Direct []Remote                              // remotes everything received is forwarded to
+	Peers  []string                              // room members by name or IP; empty means every peer
+	Logf   func(format string, v ...interface{}) // optional debug log
+
+	mu   sync.Mutex
+	last string // IP of the last peer a direct message came from
+}
+
+func (br *Bridge) logf(format string, v ...interface{}) {
+	if br.Logf != nil {
+		br.Logf(format, v...)
+	}
+}
+
+// Remotes is every configured remote, rooms first
+func (br *Bridge) Remotes() []Remote {
+	return append(append([]Remote(nil), br.Rooms...), br.Direct...)
+}
+
+// Start connects the remotes and relays in the background until the process
+// exits; it does nothing without remotes. Like hooks, call it before the
+// node starts so no message is missed. Remote servers can be slow or gone,
+// so the relay drops the oldest events when it falls behind rather than
+// hold up the node and everyone else reading its events.
+func (br *Bridge) Start(b Backend) {
+	if len(br.Rooms)+len(br.Direct) == 0 {
+		return
+	}
+	for _, r := range br.Rooms {
+		go br.run(r, func(from, text string) { br.toLAN(b, "", from, text) })
+	}
+	for _, r := range br.Direct {
+		go br.run(r, func(from, text string) { br.reply(b, r, text) })
+	}
+	sub := b.Subscribe(node.DefaultBuffer, bus.DropOldest)
+	go func() {
+		var dropped uint64
+		for ev := range sub.Events() {
+			if n := sub.Dropped(); n > dropped {
+				br.logf("Bridge: fell behind, %d events dropped", n-dropped)
+				dropped = n
+			}
+			switch ev := ev.(type) {
+			case node.ChatReceived:
+				if ev.Err != nil {
+					continue
+				}
+				sender := ev.Sender
+				if ev.Group {
+					sender += " to everyone"
+				}
+				br.forward(ev.From, sender, ev.Text)
+				if len(br.Rooms) > 0 && br.member(b, ev.From) {
+					br.fromLAN(b, ev.Sender, ev.From, ev.Text, ev.Group)
+				}
+			case node.FileReceived:
+				sender := ev.From
+				if p, ok := b.Lookup(ev.From); ok {
+					sender = p.Name
+				}
+				path, _ := filepath.Abs(ev.Path)
+				br.forward(ev.From, sender, fmt.Sprintf("sent a file: %s (saved as %s)", ev.Name, path))
+			}
+		}
+	}()
+}
+
+// run keeps r connected, retrying with backoff whenever it drops
+func (br *Bridge) run(r Remote, recv func(from, text string)) {
+	delay := retryMin
+	for {
+		start := time.Now()
+		err := r.Run(func(from, text string) {
+			br.logf("Bridge %s: %s: %s", r.Name(), from, text)
+			recv(from, text)
+		})
+		if time.Since(start) > retryMax {
+			delay = retryMin // it was up for a while; this is a fresh failure
+		}
+		br.logf("Bridge %s: %v; reconnecting in %v", r.Name(), err, delay)
+		time.Sleep(delay)
+		delay = min(delay*2, retryMax)
+	}
+}
+
+// fromLAN relays a message a room peer sent us to every remote and to the
+// rest of the room; a group message reached the room from its sender
+// already, so only the remotes get it. Remote sends keep their order, each
+// within sendTimeout; the LAN fan-out dials each peer, so it runs in the
+// background rather than hold up the relay.
+func (br *Bridge) fromLAN(b Backend, sender, ip, text string, group bool) {
+	for _, r := range br.Rooms {
+		if err := r.Send(sender, text); err != nil {
+			br.logf("Bridge %s: dropped message from %s: %v", r.Name(), sender, err)
+		}
+	}
+	if group {
+		return
+	}
+	go br.toLAN(b, ip, sender, text)
+}
+
+// toLAN sends text from the named speaker to every room peer except skip
+func (br *Bridge) toLAN(b Backend, skip, from, text string) {
+	line := fmt.Sprintf("<%s> %s", from, text)
+	for _, p := range br.room(b) {
+		if p.IP == skip {
+			continue
+		}
+		if err := b.SendChat(p.IP, line); err != nil {
+			br.logf("Bridge: relay to %s: %v", p.Name, err)
+		}
+	}
+}
+
+// forward sends what the peer at ip said to the direct remotes
+func (br *Bridge) forward(ip, sender, text string) {
+	if len(br.Direct) == 0 {
+		return
+	}
+	br.mu.Lock()
+	br.last = ip
+	br.mu.Unlock()
+	for _, r := range br.Direct {
+		if err := r.Send(sender, text); err != nil {
+			br.logf("Bridge %s: dropped message from %s: %v", r.Name(), sender, err)
+		}
+	}
+}
+
+// reply sends text written on a direct remote to the peer it names
+// ("alice: text"), or else to the last peer that wrote. Problems are
+// answered on the remote, where the writer will see them.
+func (br *Bridge) reply(b Backend, r Remote, text string) {
+	var to node.PeerInfo
+	found := false
+	if name, rest, ok := strings.Cut(text, ": "); ok {
+		if to, found = b.Lookup(strings.TrimSpace(name)); found {
+			text = rest
+		}
+	}
+	if !found {
+		br.mu.Lock()
+		last := br.last
+		br.mu.Unlock()
+		if last == "" {
+			r.Send(notice, "Nobody to reply to yet; start with a peer's name, e.g. alice: hello")
+			return
+		}
+		to, found = b.Lookup(last)
+		if !found {
+			to = node.PeerInfo{Name: last, IP: last}
+		}
+	}
+	if err := b.SendChat(to.IP, text); err != nil {
+		r.Send(notice, fmt.Sprintf("Not sent to %s: %v", to.Name, err))
+	}
+}
+
+// room is the reachable members: the configured ones, or every peer when
+// none are configured
+func (br *Bridge) room(b Backend) []node.PeerInfo {
+	var peers []node.PeerInfo
+	if len(br.Peers) == 0 {
+		peers = b.Peers()
+	} else {
+		for _, name := range br.Peers {
+			if p, ok := b.Lookup(name); ok {
+				peers = append(peers, p)
+			}
+		}
+	}
+	reachable := peers[:0]
+	for _, p := range peers {
+		if p.Reachable {
+			reachable = append(reachable, p)
+		}
+	}
+	return reachable
+}
+
+// member reports whether a message from ip belongs in the room
+func (br *Bridge) member(b Backend, ip string) bool {
+	if len(br.Peers) == 0 {
+		return true
+	}
+	for _, name := range br.Peers {
+		if p, ok := b.Lookup(name); ok && p.IP == ip || name == ip {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"lan-chat/internal/store"
+)
+
+// New is the bridge configured in the config file at configPath: the
+// [irc] and [matrix] sections, and [bridge] for the room's members. A
+// missing file or section means no remotes.
+func New(configPath string) (*Bridge, error) {
+	br := &Bridge{}
+	if configPath == "" {
+		return br, nil
+	}
+	values, err := store.ParseFile(configPath)
+	if os.IsNotExist(err) {
+		return br, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for k := range values {
+		section, key, _ := strings.Cut(k, ".")
+		if section == "irc" && !ircKeys[key] || section == "matrix" && !matrixKeys[key] || section == "bridge" && key != "peers" {
+			return nil, fmt.Errorf("%s: unknown key", k)
+		}
+	}
+	if v := values["bridge.peers"]; v != "" {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				br.Peers = append(br.Peers, p)
+			}
+		}
+	}
+	if _, ok := values["irc.server"]; ok {
+		irc, err := ircConfig(values)
+		if err != nil {
+			return nil, err
+		}
+		br.Rooms = append(br.Rooms, irc)
+	}
+	if _, ok := values["matrix.homeserver"]; ok {
+		m, err := matrixConfig(values)
+		if err != nil {
+			return nil, err
+		}
+		if values["matrix.mode"] == "room" {
+			br.Rooms = append(br.Rooms, m)
+		} else {
+			br.Direct = append(br.Direct, m)
+		}
+	}
+	return br, nil
+}
+
+var ircKeys = map[string]bool{"server": true, "tls": true, "nick": true, "channel": true, "password": true}
+
+func ircConfig(values map[string]string) (*IRC, error) {
+	c := &IRC{
+		Server:   values["irc.server"],
+		TLS:      true,
+		Nick:     values["irc.nick"],
+		Channel:  values["irc.channel"],
+		Password: values["irc.password"],
+	}
+	if _, _, err := net.SplitHostPort(c.Server); err != nil {
+		return nil, fmt.Errorf("irc.server: must be host:port, got %q", c.Server)
+	}
+	if v, ok := values["irc.tls"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("irc.tls: must be true or false, got %q", v)
+		}
+		c.TLS = b
+	}
+	if c.Nick == "" {
+		c.Nick = "lanchat"
+	}
+	if strings.ContainsAny(c.Nick, " \r\n") {
+		return nil, fmt.Errorf("irc.nick: no spaces allowed, got %q", c.Nick)
+	}
+	if !strings.HasPrefix(c.Channel, "#") || strings.ContainsAny(c.Channel, " ,\r\n") {
+		return nil, fmt.Errorf("irc.channel: must be a channel like #team, got %q", c.Channel)
+	}
+	return c, nil
+}
+
+var matrixKeys = map[string]bool{"homeserver": true, "token": true, "room": true, "mode": true}
+
+func matrixConfig(values map[string]string) (*Matrix, error) {
+	m := &Matrix{Homeserver: values["matrix.homeserver"], Token: values["matrix.token"], Room: values["matrix.room"]}
+	m.client.Timeout = matrixPoll + 30*time.Second
+	if u, err := url.Parse(m.Homeserver); err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("matrix.homeserver: must be a URL like https://matrix.org, got %q", m.Homeserver)
+	}
+	if m.Token == "" {
+		return nil, fmt.Errorf("matrix.token: the bridge account's access token is required")
+	}
+	if !strings.HasPrefix(m.Room, "!") && !strings.HasPrefix(m.Room, "#") {
+		return nil, fmt.Errorf("matrix.room: must be a room ID (!abc:example.org) or alias (#team:example.org), got %q", m.Room)
+	}
+	if v, ok := values["matrix.mode"]; ok && v != "direct" && v != "room" {
+		return nil, fmt.Errorf("matrix.mode: must be direct or room, got %q", v)
+	}
+	return m, nil
+}
@@ -0,0 +1,175 @@
+package bridge
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// IRC timeouts: connecting, and silence from the server (which pings
+// every few minutes) before the connection counts as dead
+const (
+	ircDialTimeout = 15 * time.Second
+	ircIdleTimeout = 6 * time.Minute
+)
+
+// ircMaxText is how many bytes of text go in one PRIVMSG; servers cut lines
+// at 512 bytes including the prefix they add when relaying
+const ircMaxText = 400
+
+var errNotConnected = errors.New("not connected")
+
+// IRC is one channel on an IRC server
+type IRC struct {
+	Server   string // host:port
+	TLS      bool
+	Nick     string
+	Channel  string // with its leading #
+	Password string // server password (PASS), "" for none
+
+	mu   sync.Mutex
+	conn net.Conn // set while joined
+}
+
+// Name is "irc #channel"
+func (c *IRC) Name() string { return "irc " + c.Channel }
+
+// Run connects, registers, joins the channel and delivers its messages to
+// recv until the connection fails
+func (c *IRC) Run(recv func(from, text string)) error {
+	d := &net.Dialer{Timeout: ircDialTimeout}
+	var conn net.Conn
+	var err error
+	if c.TLS {
+		host, _, _ := net.SplitHostPort(c.Server)
+		conn, err = tls.DialWithDialer(d, "tcp", c.Server, &tls.Config{ServerName: host})
+	} else {
+		conn, err = d.Dial("tcp", c.Server)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	if c.Password != "" {
+		fmt.Fprintf(conn, "PASS %s\r\n", c.Password)
+	}
+	nick := c.Nick
+	fmt.Fprintf(conn, "NICK %s\r\nUSER %s 0 * :LAN-CHAT bridge\r\n", nick, c.Nick)
+
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(ircIdleTimeout))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		prefix, cmd, params := parseIRC(strings.TrimRight(line, "\r\n"))
+		switch cmd {
+		case "PING":
+			fmt.Fprintf(conn, "PONG :%s\r\n", strings.Join(params, " "))
+		case "001": // registered
+			fmt.Fprintf(conn, "JOIN %s\r\n", c.Channel)
+		case "433": // nick in use
+			nick += "_"
+			fmt.Fprintf(conn, "NICK %s\r\n", nick)
+		case "JOIN":
+			if len(params) > 0 && strings.EqualFold(params[0], c.Channel) && strings.EqualFold(ircNick(prefix), nick) {
+				c.mu.Lock()
+				c.conn = conn
+				c.mu.Unlock()
+			}
+		case "ERROR":
+			return fmt.Errorf("server closed the connection: %s", strings.Join(params, " "))
+		case "PRIVMSG":
+			if len(params) < 2 || !strings.EqualFold(params[0], c.Channel) {
+				continue
+			}
+			text := params[1]
+			if action, ok := strings.CutPrefix(text, "\x01ACTION "); ok {
+				text = "* " + strings.TrimSuffix(action, "\x01")
+			} else if strings.HasPrefix(text, "\x01") {
+				continue // other CTCP requests
+			}
+			recv(ircNick(prefix), text)
+		case "403", "405", "471", "473", "474", "475": // no such channel, too many, full, invite-only, banned, needs a key
+			return fmt.Errorf("cannot join %s: %s", c.Channel, params[len(params)-1])
+		}
+	}
+}
+
+// Send posts text to the channel as "<from> text", split into lines that
+// fit in a PRIVMSG, giving up on a server that doesn't take it within
+// sendTimeout
+func (c *IRC) Send(from, text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errNotConnected
+	}
+	// A stray CR or LF would end the PRIVMSG and start a command
+	from = strings.NewReplacer("\r", "", "\n", "").Replace(from)
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.ReplaceAll(line, "\r", "")
+		for _, chunk := range splitBytes(fmt.Sprintf("<%s> %s", from, line), ircMaxText) {
+			fmt.Fprintf(&b, "PRIVMSG %s :%s\r\n", c.Channel, chunk)
+		}
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		// A line cut off would run into the next; Run reconnects
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// parseIRC splits a line into its prefix (without the colon), command and
+// parameters, the trailing one included
+func parseIRC(line string) (prefix, cmd string, params []string) {
+	if rest, ok := strings.CutPrefix(line, ":"); ok {
+		prefix, line, _ = strings.Cut(rest, " ")
+	}
+	line, trailing, hasTrailing := strings.Cut(line, " :")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return prefix, "", nil
+	}
+	cmd, params = strings.ToUpper(fields[0]), fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return prefix, cmd, params
+}
+
+// ircNick is the nick in a nick!user@host prefix
+func ircNick(prefix string) string {
+	nick, _, _ := strings.Cut(prefix, "!")
+	return nick
+}
+
+// splitBytes cuts s into pieces of at most n bytes without splitting a rune
+func splitBytes(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		cut := n
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		out = append(out, s[:cut])
+		s = s[cut:]
+	}
+	return append(out, s)
+}
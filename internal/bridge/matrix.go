@@ -0,0 +1,164 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// matrixPoll is how long the server may hold a /sync open waiting for news
+const matrixPoll = 30 * time.Second
+
+// Matrix is one room on a Matrix homeserver, reached through the
+// client-server API with an account's access token. The account should be
+// a bot of its own: it ignores what it sent itself.
+type Matrix struct {
+	Homeserver string // base URL, e.g. https://matrix.org
+	Token      string // access token
+	Room       string // room ID (!abc:example.org) or alias (#team:example.org)
+
+	client http.Client // Timeout must outlast matrixPoll; see matrixConfig
+	self   string      // our user ID, from whoami
+	roomID atomic.Value
+	txn    atomic.Int64
+}
+
+// Name is "matrix <room>"
+func (m *Matrix) Name() string { return "matrix " + m.Room }
+
+// Run joins the room and delivers its new text messages to recv until a
+// request fails
+func (m *Matrix) Run(recv func(from, text string)) error {
+	var who struct {
+		UserID string `json:"user_id"`
+	}
+	if err := m.call("GET", "/account/whoami", nil, &who); err != nil {
+		return err
+	}
+	m.self = who.UserID
+	var joined struct {
+		RoomID string `json:"room_id"`
+	}
+	if err := m.call("POST", "/join/"+url.PathEscape(m.Room), struct{}{}, &joined); err != nil {
+		return fmt.Errorf("join %s: %w", m.Room, err)
+	}
+	m.roomID.Store(joined.RoomID)
+
+	// The first sync only finds where "now" is; history isn't replayed
+	filter := url.QueryEscape(`{"room":{"rooms":[` + strconv.Quote(joined.RoomID) + `],"timeline":{"limit":0}}}`)
+	var batch matrixSync
+	if err := m.call("GET", "/sync?filter="+filter, nil, &batch); err != nil {
+		return err
+	}
+	filter = url.QueryEscape(`{"room":{"rooms":[` + strconv.Quote(joined.RoomID) + `]}}`)
+	for {
+		since := batch.NextBatch
+		batch = matrixSync{}
+		path := fmt.Sprintf("/sync?filter=%s&since=%s&timeout=%d", filter, url.QueryEscape(since), matrixPoll.Milliseconds())
+		if err := m.call("GET", path, nil, &batch); err != nil {
+			return err
+		}
+		for _, ev := range batch.Rooms.Join[joined.RoomID].Timeline.Events {
+			if ev.Type != "m.room.message" || ev.Sender == m.self {
+				continue
+			}
+			switch ev.Content.MsgType {
+			case "m.text", "m.notice":
+				recv(matrixName(ev.Sender), ev.Content.Body)
+			case "m.emote":
+				recv(matrixName(ev.Sender), "* "+ev.Content.Body)
+			}
+		}
+	}
+}
+
+// Send posts "from: text" to the room; it fails until Run has joined
+func (m *Matrix) Send(from, text string) error {
+	room, _ := m.roomID.Load().(string)
+	if room == "" {
+		return errNotConnected
+	}
+	body := text
+	if from != "" {
+		body = from + ": " + text
+	}
+	// The transaction ID makes a retried PUT idempotent on the server
+	txn := fmt.Sprintf("lanchat-%d-%d", time.Now().UnixNano(), m.txn.Add(1))
+	path := "/rooms/" + url.PathEscape(room) + "/send/m.room.message/" + txn
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return m.callContext(ctx, "PUT", path, map[string]string{"msgtype": "m.text", "body": body}, nil)
+}
+
+// call makes one client-server API request and decodes the reply into out
+func (m *Matrix) call(method, path string, in, out interface{}) error {
+	return m.callContext(context.Background(), method, path, in, out)
+}
+
+// callContext is call, given up on once ctx is done
+func (m *Matrix) callContext(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader = http.NoBody
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(m.Homeserver, "/")+"/_matrix/client/v3"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Code  string `json:"errcode"`
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s: %s %s", resp.Status, e.Code, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// matrixSync is the part of a /sync reply the bridge reads
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []struct {
+					Type    string `json:"type"`
+					Sender  string `json:"sender"`
+					Content struct {
+						MsgType string `json:"msgtype"`
+						Body    string `json:"body"`
+					} `json:"content"`
+				} `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+// matrixName is the localpart of a user ID: bob for @bob:example.org
+func matrixName(id string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(id, "@"), ":")
+	return name
+}
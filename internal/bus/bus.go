@@ -0,0 +1,154 @@
+// Package bus is a typed publish/subscribe channel. Every subscriber gets
+// each event in publish order through its own buffer, and picks what
+// happens when it falls behind: the publisher waits, or events are dropped
+// and counted.
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Policy is what Publish does when a subscriber's buffer is full
+type Policy int
+
+const (
+	// Block makes the publisher wait; for consumers that must see
+	// everything and keep up, like the TUI
+	Block Policy = iota
+	// DropNewest discards the event being published
+	DropNewest
+	// DropOldest discards the oldest buffered event to make room
+	DropOldest
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	}
+	return "unknown"
+}
+
+// Bus delivers events of type T to its subscribers. The zero value is not
+// usable; call New.
+type Bus[T any] struct {
+	mu     sync.Mutex // held for a whole Publish, so events stay in order
+	subs   map[*Subscription[T]]struct{}
+	closed bool
+}
+
+// New is an empty bus
+func New[T any]() *Bus[T] {
+	return &Bus[T]{subs: make(map[*Subscription[T]]struct{})}
+}
+
+// Subscription is one consumer's view of the bus
+type Subscription[T any] struct {
+	bus     *Bus[T]
+	ch      chan T
+	policy  Policy
+	done    chan struct{} // closed by Close, releases a blocked Publish
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// Subscribe starts a subscription to every event published from now on.
+// buffer is how many events may wait unread before policy applies.
+func (b *Bus[T]) Subscribe(buffer int, policy Policy) *Subscription[T] {
+	s := &Subscription[T]{bus: b, ch: make(chan T, max(buffer, 0)), policy: policy, done: make(chan struct{})}
+	// A subscriber that would block on an unbuffered channel can never make
+	// room for DropOldest
+	if policy == DropOldest && buffer <= 0 {
+		s.ch = make(chan T, 1)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.ch)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Publish delivers ev to every subscriber according to its policy
+func (b *Bus[T]) Publish(ev T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	for s := range b.subs {
+		s.deliver(ev)
+	}
+}
+
+// Close ends every subscription; their channels are closed once drained
+func (b *Bus[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for s := range b.subs {
+		close(s.ch)
+		delete(b.subs, s)
+	}
+}
+
+func (s *Subscription[T]) deliver(ev T) {
+	switch s.policy {
+	case Block:
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+		}
+	case DropNewest:
+		select {
+		case s.ch <- ev:
+		default:
+			s.dropped.Add(1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.ch <- ev:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	}
+}
+
+// Events is the channel to read; it is closed by Close or when the bus is
+// closed
+func (s *Subscription[T]) Events() <-chan T { return s.ch }
+
+// Dropped is how many events this subscriber missed by falling behind
+func (s *Subscription[T]) Dropped() uint64 { return s.dropped.Load() }
+
+// Close stops delivery and closes the Events channel. It is safe to call
+// more than once and from any goroutine.
+func (s *Subscription[T]) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		b := s.bus
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[s]; ok {
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package bus
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		buffer  int
+		publish int // events 1..publish, none read meanwhile
+		want    []int
+		dropped uint64
+	}{
+		{"block within the buffer", Block, 5, 5, []int{1, 2, 3, 4, 5}, 0},
+		{"drop newest", DropNewest, 3, 5, []int{1, 2, 3}, 2},
+		{"drop newest unbuffered", DropNewest, 0, 5, nil, 5},
+		{"drop oldest", DropOldest, 3, 5, []int{3, 4, 5}, 2},
+		{"drop oldest unbuffered keeps one", DropOldest, 0, 5, []int{5}, 4},
+		{"drop oldest negative buffer", DropOldest, -1, 2, []int{2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New[int]()
+			s := b.Subscribe(tt.buffer, tt.policy)
+			for i := 1; i <= tt.publish; i++ {
+				b.Publish(i)
+			}
+			b.Close()
+			var got []int
+			for ev := range s.Events() {
+				got = append(got, ev)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+			if d := s.Dropped(); d != tt.dropped {
+				t.Errorf("Dropped() = %d, want %d", d, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestBlockWaitsForReader(t *testing.T) {
+	b := New[int]()
+	s := b.Subscribe(1, Block)
+	const n = 100
+	done := make(chan []int)
+	go func() {
+		var got []int
+		for ev := range s.Events() {
+			got = append(got, ev)
+		}
+		done <- got
+	}()
+	for i := range n {
+		b.Publish(i)
+	}
+	b.Close()
+	got := <-done
+	if len(got) != n {
+		t.Fatalf("got %d events, want %d", len(got), n)
+	}
+	for i, ev := range got {
+		if ev != i {
+			t.Fatalf("event %d = %d: out of order", i, ev)
+		}
+	}
+	if s.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", s.Dropped())
+	}
+}
+
+func TestCloseReleasesPublisher(t *testing.T) {
+	b := New[int]()
+	s := b.Subscribe(0, Block)
+	published := make(chan struct{})
+	go func() {
+		b.Publish(1) // nobody reads it
+		close(published)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s.Close()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish still blocked after the subscription closed")
+	}
+	s.Close() // a second Close does nothing
+	b.Publish(2)
+}
+
+func TestSubscribeAfterClose(t *testing.T) {
+	b := New[string]()
+	b.Close()
+	s := b.Subscribe(1, Block)
+	b.Publish("late")
+	if _, ok := <-s.Events(); ok {
+		t.Error("a subscription to a closed bus got an event")
+	}
+}
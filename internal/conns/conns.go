@@ -0,0 +1,53 @@
+// Package conns tracks the open connections of a simulated host, so they
+// can all be closed when it goes down. memnet and sim both use it.
+package conns
+
+import (
+	"net"
+	"sync"
+)
+
+// Set is the open connections of a host, closed when it goes down: a
+// machine dropping off the LAN takes its connections with it, which peers
+// keeping connections open between requests rely on noticing. The zero
+// value is empty.
+type Set struct {
+	mu    sync.Mutex
+	conns map[*tracked]bool
+}
+
+// Add adds c to the set and returns it wrapped, so that closing it takes
+// it out again
+func (s *Set) Add(c net.Conn) net.Conn {
+	t := &tracked{Conn: c, set: s}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[*tracked]bool)
+	}
+	s.conns[t] = true
+	return t
+}
+
+// CloseAll closes every connection in the set and empties it
+func (s *Set) CloseAll() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+	for t := range conns {
+		t.Conn.Close()
+	}
+}
+
+type tracked struct {
+	net.Conn
+	set *Set
+}
+
+func (t *tracked) Close() error {
+	t.set.mu.Lock()
+	delete(t.set.conns, t)
+	t.set.mu.Unlock()
+	return t.Conn.Close()
+}
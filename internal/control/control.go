@@ -0,0 +1,307 @@
+// Package control is the local control channel of a running instance (TUI,
+// background session or daemon): a unix socket that takes one text command
+// per connection and answers with zero or more result lines followed by
+// "OK" or "ERR <reason>".
+//
+//	PEERS               one line per peer: name<TAB>ip<TAB>secure<TAB>reachable
+//	MSG <peer> <text>   send a chat message; peer is a name or IP, and text is
+//	                    escaped (see Escape) to hold line breaks
+//	SEND <peer> <path>  send a file; path is read by the node, so make it absolute
+//	STATUS              name<TAB>encrypted<TAB>peer count<TAB>download folder
+//	TAG <peer> [tags]   replace a known peer's space-separated tags; none clears them
+//	WATCH               stream "MSG<TAB>sender<TAB>text<TAB>group" and
+//	                    "FILE<TAB>path<TAB>ip" lines as they arrive, until the
+//	                    client hangs up (no OK); group is true for a message
+//	                    sent to everyone
+//	ATTACH <w> <h>      hand the connection to the daemon's TUI: raw terminal
+//	                    input goes in, its screen comes out (no OK)
+//	RESIZE <w> <h>      tell the attached TUI the terminal's new size
+//
+// Tabs, line breaks and backslashes in a field of PEERS, STATUS and WATCH
+// are written \t, \n, \r and \\; Fields splits a line back up.
+//
+// ATTACH and RESIZE need a backend with a TUI (see Terminal); others answer
+// "ERR no TUI to attach to".
+package control
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/crash"
+	"lan-chat/internal/node"
+	"lan-chat/internal/platform"
+)
+
+// Backend is what the control channel drives; *node.Node implements it
+type Backend interface {
+	Peers() []node.PeerInfo
+	Lookup(peer string) (node.PeerInfo, bool)
+	SendChat(ip, text string) error
+	SendFile(ip, path string) error
+	Status() []string
+	SetTags(peer string, tags []string) error
+	Subscribe(buffer int, policy bus.Policy) *bus.Subscription[node.Event]
+}
+
+// Terminal is implemented by backends that keep a TUI to attach to, the
+// daemon's. ServeTerminal owns c from then on; header is the ATTACH or
+// RESIZE line.
+type Terminal interface {
+	ServeTerminal(c net.Conn, header string)
+}
+
+// SocketPath is where the control socket lives by default
+func SocketPath() string {
+	return filepath.Join(platform.RuntimeDir(), "lan-chat.sock")
+}
+
+// Listen opens the control socket, replacing a stale one left by a crashed
+// process. It fails if another node is still answering on it.
+func Listen(path string) (net.Listener, error) {
+	if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		c.Close()
+		return nil, fmt.Errorf("%s is in use by another lan-chat", path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Anyone who can connect can send as us
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Serve answers commands on ln until it is closed
+func Serve(ln net.Listener, b Backend) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go handle(c, b)
+	}
+}
+
+func handle(c net.Conn, b Backend) {
+	defer crash.Recover("control connection")
+	line, err := readLine(c)
+	if err != nil && line == "" {
+		c.Close()
+		return
+	}
+	line = strings.TrimRight(line, "\r")
+	switch cmd, _, _ := strings.Cut(line, " "); strings.ToUpper(cmd) {
+	case "ATTACH", "RESIZE":
+		if t, ok := b.(Terminal); ok {
+			t.ServeTerminal(c, line)
+			return
+		}
+	}
+	defer c.Close()
+	if strings.EqualFold(line, "WATCH") {
+		watch(c, b)
+		return
+	}
+	out, err := run(line, b)
+	for _, l := range out {
+		fmt.Fprintln(c, l)
+	}
+	if err != nil {
+		fmt.Fprintln(c, "ERR "+err.Error())
+		return
+	}
+	fmt.Fprintln(c, "OK")
+}
+
+func run(line string, b Backend) ([]string, error) {
+	cmd, rest, _ := strings.Cut(line, " ")
+	switch strings.ToUpper(cmd) {
+	case "PEERS":
+		var out []string
+		for _, p := range b.Peers() {
+			out = append(out, fmt.Sprintf("%s\t%s\t%t\t%t", escape.Replace(p.Name), escape.Replace(p.IP), p.Secure, p.Reachable))
+		}
+		return out, nil
+	case "STATUS":
+		return []string{joinFields(b.Status())}, nil
+	case "MSG":
+		p, text, err := target(b, rest)
+		if err != nil {
+			return nil, fmt.Errorf("MSG <peer> <text>: %w", err)
+		}
+		return nil, b.SendChat(p.IP, unescape.Replace(text))
+	case "SEND":
+		p, path, err := target(b, rest)
+		if err != nil {
+			return nil, fmt.Errorf("SEND <peer> <path>: %w", err)
+		}
+		return nil, b.SendFile(p.IP, path)
+	case "TAG":
+		f := strings.Fields(rest)
+		if len(f) == 0 {
+			return nil, errors.New("TAG <peer> [tags]: missing argument")
+		}
+		return nil, b.SetTags(f[0], f[1:])
+	case "ATTACH", "RESIZE":
+		return nil, errors.New("no TUI to attach to")
+	case "":
+		return nil, errors.New("empty command")
+	}
+	return nil, fmt.Errorf("unknown command %q", cmd)
+}
+
+// readLine reads the command a byte at a time: after ATTACH the rest of the
+// connection is terminal input, which a buffered reader would swallow
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := r.Read(b); err != nil {
+			return string(line), err
+		}
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+		line = append(line, b[0])
+	}
+}
+
+// watch streams received messages and files to c until it goes away
+func watch(c net.Conn, b Backend) {
+	sub := b.Subscribe(node.DefaultBuffer, bus.DropNewest)
+	defer sub.Close()
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, c) // returns when the client hangs up
+		close(gone)
+	}()
+	for {
+		var line string
+		select {
+		case <-gone:
+			return
+		case ev := <-sub.Events():
+			switch ev := ev.(type) {
+			case node.ChatReceived:
+				if ev.Err == nil {
+					line = fmt.Sprintf("MSG\t%s\t%s\t%t", escape.Replace(ev.Sender), escape.Replace(ev.Text), ev.Group)
+				}
+			case node.FileReceived:
+				// The watcher runs elsewhere, relative paths mean nothing to it
+				path, _ := filepath.Abs(ev.Path)
+				line = "FILE\t" + escape.Replace(path) + "\t" + ev.From
+			}
+		}
+		if line == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(c, line); err != nil {
+			return
+		}
+	}
+}
+
+// A peer's name and text are its own to choose, line breaks and tabs
+// included, so fields are escaped: a peer can't pass for another line or
+// another field
+var (
+	escape   = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	unescape = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r")
+)
+
+// Escape writes the tabs, line breaks and backslashes in s as \t, \n, \r
+// and \\, for a field or MSG's text
+func Escape(s string) string { return escape.Replace(s) }
+
+// joinFields joins fields with tabs, escaped
+func joinFields(fields []string) string {
+	for i, f := range fields {
+		fields[i] = escape.Replace(f)
+	}
+	return strings.Join(fields, "\t")
+}
+
+// Fields splits a result or WATCH line into its unescaped fields
+func Fields(line string) []string {
+	fields := strings.Split(line, "\t")
+	for i := range fields {
+		fields[i] = unescape.Replace(fields[i])
+	}
+	return fields
+}
+
+// target splits "<peer> <argument>" and resolves the peer
+func target(b Backend, args string) (node.PeerInfo, string, error) {
+	peer, arg, _ := strings.Cut(args, " ")
+	if peer == "" || arg == "" {
+		return node.PeerInfo{}, "", errors.New("missing argument")
+	}
+	p, ok := b.Lookup(peer)
+	if !ok {
+		return p, "", fmt.Errorf("no peer named %s", peer)
+	}
+	return p, arg, nil
+}
+
+// Watch runs WATCH on the control socket at path, calling f with the
+// unescaped fields of each line until f returns false or the connection
+// drops
+func Watch(path string, f func(fields []string) bool) error {
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if _, err := fmt.Fprintln(c, "WATCH"); err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(c)
+	for sc.Scan() {
+		if !f(Fields(sc.Text())) {
+			return nil
+		}
+	}
+	return sc.Err()
+}
+
+// Do sends one command to the control socket at path and returns the result
+// lines, or the node's error
+func Do(path, command string) ([]string, error) {
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if _, err := fmt.Fprintln(c, command); err != nil {
+		return nil, err
+	}
+	var out []string
+	sc := bufio.NewScanner(c)
+	for sc.Scan() {
+		switch l := sc.Text(); {
+		case l == "OK":
+			return out, nil
+		case strings.HasPrefix(l, "ERR "):
+			return out, errors.New(strings.TrimPrefix(l, "ERR "))
+		default:
+			out = append(out, l)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return out, err
+	}
+	return out, errors.New("connection closed without a reply")
+}
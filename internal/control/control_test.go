@@ -0,0 +1,121 @@
+package control
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/node"
+)
+
+// backend is a Backend with a fixed roster that records what it is asked
+// to send
+type backend struct {
+	peers  []node.PeerInfo
+	status []string
+	sent   []string // texts passed to SendChat
+}
+
+func (b *backend) Peers() []node.PeerInfo { return b.peers }
+
+func (b *backend) Lookup(peer string) (node.PeerInfo, bool) {
+	i := slices.IndexFunc(b.peers, func(p node.PeerInfo) bool { return p.Name == peer || p.IP == peer })
+	if i < 0 {
+		return node.PeerInfo{}, false
+	}
+	return b.peers[i], true
+}
+
+func (b *backend) SendChat(ip, text string) error {
+	b.sent = append(b.sent, text)
+	return nil
+}
+
+func (b *backend) SendFile(ip, path string) error                          { return nil }
+func (b *backend) Status() []string                                        { return slices.Clone(b.status) }
+func (b *backend) SetTags(peer string, tags []string) error                { return nil }
+func (b *backend) Subscribe(int, bus.Policy) *bus.Subscription[node.Event] { return nil }
+
+func TestFieldsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+	}{
+		{"plain", []string{"alice", "10.0.0.2", "true"}},
+		{"empty fields", []string{"", "", ""}},
+		{"tab", []string{"a\tb", "c"}},
+		{"line breaks", []string{"one\ntwo", "three\r\nfour"}},
+		{"backslashes", []string{`C:\Users\bob`, `\\`}},
+		{"escapes typed literally", []string{`\n is not a line break`, `\t`}},
+		{"backslash before a real tab", []string{"\\\t\\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := joinFields(slices.Clone(tt.fields))
+			if strings.ContainsAny(line, "\n\r") {
+				t.Errorf("joined line %q holds a line break", line)
+			}
+			if n := strings.Count(line, "\t"); n != len(tt.fields)-1 {
+				t.Errorf("joined line %q has %d tabs, want %d", line, n, len(tt.fields)-1)
+			}
+			if got := Fields(line); !slices.Equal(got, tt.fields) {
+				t.Errorf("Fields(%q) = %q, want %q", line, got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	b := &backend{
+		peers: []node.PeerInfo{
+			{Name: "alice", IP: "10.0.0.2", Secure: true, Reachable: true},
+			{Name: "mallory\nbob\t10.0.0.9", IP: "10.0.0.3"},
+		},
+		status: []string{"me\tyou", "10.0.0.1", "3"},
+	}
+	tests := []struct {
+		name string
+		line string
+		want [][]string // each result line, split with Fields
+		sent string     // what reached SendChat, if anything
+		err  bool
+	}{
+		{"peers", "PEERS", [][]string{
+			{"alice", "10.0.0.2", "true", "true"},
+			{"mallory\nbob\t10.0.0.9", "10.0.0.3", "false", "false"},
+		}, "", false},
+		{"status", "status", [][]string{{"me\tyou", "10.0.0.1", "3"}}, "", false},
+		{"msg with escaped line breaks", `MSG alice one\ntwo\\n`, nil, "one\ntwo\\n", false},
+		{"msg to nobody", "MSG carol hi", nil, "", true},
+		{"msg without text", "MSG alice", nil, "", true},
+		{"unknown", "FROB", nil, "", true},
+		{"empty", "", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.sent = nil
+			out, err := run(tt.line, b)
+			if (err != nil) != tt.err {
+				t.Fatalf("run(%q) error = %v, want error %t", tt.line, err, tt.err)
+			}
+			if len(out) != len(tt.want) {
+				t.Fatalf("run(%q) = %d lines %q, want %d", tt.line, len(out), out, len(tt.want))
+			}
+			for i, line := range out {
+				if strings.ContainsAny(line, "\n\r") {
+					t.Errorf("line %d %q holds a line break", i, line)
+				}
+				if got := Fields(line); !slices.Equal(got, tt.want[i]) {
+					t.Errorf("line %d fields = %q, want %q", i, got, tt.want[i])
+				}
+			}
+			if tt.sent != "" && !slices.Equal(b.sent, []string{tt.sent}) {
+				t.Errorf("sent %q, want %q", b.sent, tt.sent)
+			}
+			if tt.sent == "" && len(b.sent) > 0 {
+				t.Errorf("sent %q, want nothing", b.sent)
+			}
+		})
+	}
+}
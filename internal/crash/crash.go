@@ -0,0 +1,103 @@
+// Package crash turns a panic into a report on disk instead of a stack trace
+// lost with the terminal. Goroutines defer Recover; what happens after the
+// report is written is up to the program (see Handle).
+package crash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"lan-chat/internal/platform"
+)
+
+// Report is a recovered panic
+type Report struct {
+	Where string // the goroutine or loop that panicked
+	Value interface{}
+	Stack []byte
+	Time  time.Time
+	Path  string // where Write saved it, once it has
+}
+
+// New records the panic v, recovered in where; call it from the deferred
+// function so the stack is the panicking goroutine's
+func New(where string, v interface{}) Report {
+	return Report{Where: where, Value: v, Stack: debug.Stack(), Time: time.Now()}
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("panic in %s: %v", r.Where, r.Value)
+}
+
+// Dir is where reports are written: crash/ in the log directory, or the
+// temp directory if there is none
+func Dir() string {
+	if dir := platform.LogDir(); dir != "" {
+		return filepath.Join(dir, "crash")
+	}
+	return os.TempDir()
+}
+
+// Write saves r as crash-<time>.log in dir, readable only by the user since
+// the stack can show message text, and sets r.Path
+func (r *Report) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "crash-"+r.Time.Format("20060102-150405")+".log")
+	body := fmt.Sprintf("lan-chat crashed at %s\n\n%s\n\n%s %s/%s, %d goroutines\n\n%s",
+		r.Time.Format(time.RFC3339), r, runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumGoroutine(), r.Stack)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		body += "\n" + info.String()
+	}
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		return err
+	}
+	r.Path = path
+	return nil
+}
+
+var (
+	mu      sync.Mutex
+	handler func(Report)
+)
+
+// Handle sets what a panic caught by Recover does once its report is
+// written. Without a handler the report is printed and the process exits,
+// as the panic would have.
+func Handle(f func(Report)) {
+	mu.Lock()
+	handler = f
+	mu.Unlock()
+}
+
+// Recover stops a panic in the goroutine that defers it, writes a report to
+// Dir and passes it to the handler; the goroutine ends. Defer it directly:
+//
+//	defer crash.Recover("TCP server")
+func Recover(where string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	r := New(where, v)
+	if err := r.Write(Dir()); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing the crash report: %v\n", err)
+	}
+	mu.Lock()
+	f := handler
+	mu.Unlock()
+	if f == nil {
+		fmt.Fprintf(os.Stderr, "lan-chat: %s\n\n%s\n", r, r.Stack)
+		if r.Path != "" {
+			fmt.Fprintf(os.Stderr, "Crash report saved to %s\n", r.Path)
+		}
+		os.Exit(2)
+	}
+	f(r)
+}
@@ -0,0 +1,78 @@
+// Package crypto implements the shared-password encryption used for chats
+// and file transfers, and the fingerprint and salted proof peers exchange
+// to check they hold the same password.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+func deriveKey(password string) []byte {
+	h := sha256.Sum256([]byte(password))
+	return h[:]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext with AES-256-GCM under a key derived from the
+// password and returns base64(nonce || ciphertext)
+func Encrypt(plaintext []byte, password string) (string, error) {
+	return encrypt(plaintext, deriveKey(password))
+}
+
+func encrypt(plaintext, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt reverses Encrypt, and EncryptSalted; a wrong password fails
+// authentication
+func Decrypt(encoded string, password string) ([]byte, error) {
+	if salt, rest, ok := cutSalted(encoded); ok {
+		return decrypt(rest, saltedKey(password, salt).seal)
+	}
+	return decrypt(encoded, deriveKey(password))
+}
+
+func decrypt(encoded string, key []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+}
+
+// Fingerprint is what peers compare in VERIFY instead of the password itself
+func Fingerprint(password string) string {
+	h := sha256.Sum256([]byte("LAN-CHAT-VERIFY:" + password))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An identity is an ed25519 key pair per install. Peers pin the public key
+// to the name the first time they see it, so another machine announcing
+// that name later is noticed. It says nothing about the shared password.
+
+// identityContext is signed ahead of the challenge, so a signature can't be
+// reused for anything else
+const identityContext = "LAN-CHAT-IDENTITY:"
+
+// LoadIdentity reads the private key at path, creating one the first time.
+// The file holds the hex seed and is readable only by the user. unseal, if
+// not nil, turns the file's contents into the seed when it was sealed.
+func LoadIdentity(path string, unseal func(data []byte) ([]byte, error)) (ed25519.PrivateKey, error) {
+	if path == "" {
+		return nil, errors.New("no data directory for the identity key")
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if unseal != nil {
+			if data, err = unseal(data); err != nil {
+				return nil, err
+			}
+		}
+		seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%s: not an identity key", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return priv, os.WriteFile(path, []byte(hex.EncodeToString(priv.Seed())+"\n"), 0600)
+}
+
+// SignIdentity proves to whoever sent challenge that we hold priv
+func SignIdentity(priv ed25519.PrivateKey, challenge []byte) []byte {
+	return ed25519.Sign(priv, append([]byte(identityContext), challenge...))
+}
+
+// VerifyIdentity checks a SignIdentity signature
+func VerifyIdentity(pub ed25519.PublicKey, challenge, sig []byte) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, append([]byte(identityContext), challenge...), sig)
+}
+
+// KeyFingerprint is how a public key is shown to people: the first 16 bytes
+// of its SHA-256 in groups of four hex digits
+func KeyFingerprint(pub ed25519.PublicKey) string {
+	h := sha256.Sum256(pub)
+	s := hex.EncodeToString(h[:16])
+	var groups []string
+	for i := 0; i < len(s); i += 4 {
+		groups = append(groups, s[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
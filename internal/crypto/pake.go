@@ -0,0 +1,167 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"strconv"
+
+	"filippo.io/edwards25519"
+)
+
+// PAKE checks the password with SPAKE2 over edwards25519, so nothing that
+// crosses the network, even to a peer posing as another, lets a guess be
+// tested offline; each run allows one online guess at most. w is the
+// password's Argon2id key for the session salt as a scalar. The client
+// sends X = x·G + w·M, the server Y = y·G + w·N, and both arrive at the
+// same K = 8·x·y·G. Each then proves it holds K with an HMAC over the
+// transcript, the server first, so a client talking to an impostor gives
+// away nothing more. M and N are hashed to the curve from fixed labels, so
+// nobody knows their discrete logs.
+//
+// x and y are new every run and K is a Diffie-Hellman result over
+// Curve25519, so the Session key drawn from it can't be worked out again
+// from the password or anything else once both sides have dropped it.
+
+// ErrPake is a share from the peer that isn't a usable point
+var ErrPake = errors.New("bad PAKE share")
+
+const pakeContext = "LAN-CHAT-SPAKE2"
+
+var (
+	pakeM = hashToPoint(pakeContext + " M")
+	pakeN = hashToPoint(pakeContext + " N")
+)
+
+// hashToPoint is the first of SHA-512(label, counter) that decodes as a
+// point, times the cofactor so it is in the prime-order subgroup
+func hashToPoint(label string) *edwards25519.Point {
+	for i := 0; ; i++ {
+		h := sha512.Sum512([]byte(label + ":" + strconv.Itoa(i)))
+		p, err := new(edwards25519.Point).SetBytes(h[:32])
+		if err != nil {
+			continue
+		}
+		p.MultByCofactor(p)
+		if p.Equal(edwards25519.NewIdentityPoint()) == 0 {
+			return p
+		}
+	}
+}
+
+// Pake is one side of a password check. Create it with NewPake, send
+// Share, pass the peer's to Finish, then trade Confirm and Check.
+type Pake struct {
+	server bool
+	salt   []byte
+	w, x   *edwards25519.Scalar
+	share  []byte
+	mac    []byte // the key of both confirmations, once finished
+	key    []byte // the session key, once finished
+	client []byte // the two shares, in every MAC
+	srv    []byte
+	proven bool // the peer's confirmation checked
+}
+
+// NewPake starts a check of password with the session salt, as the side
+// that asks (the client) or the one that answers
+func NewPake(password string, salt []byte, server bool) (*Pake, error) {
+	k := saltedKey(password, salt)
+	h := sha512.New()
+	h.Write([]byte(pakeContext + " w"))
+	h.Write(k.seal)
+	h.Write(k.proof)
+	w, err := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	random := make([]byte, 64)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	x, err := edwards25519.NewScalar().SetUniformBytes(random)
+	if err != nil {
+		return nil, err
+	}
+	blind := pakeM
+	if server {
+		blind = pakeN
+	}
+	share := new(edwards25519.Point).ScalarBaseMult(x)
+	share.Add(share, new(edwards25519.Point).ScalarMult(w, blind))
+	return &Pake{server: server, salt: salt, w: w, x: x, share: share.Bytes()}, nil
+}
+
+// Share is what to send the peer
+func (p *Pake) Share() []byte { return p.share }
+
+// Finish takes the peer's share and derives the confirmation key
+func (p *Pake) Finish(peer []byte) error {
+	point, err := new(edwards25519.Point).SetBytes(peer)
+	if err != nil {
+		return ErrPake
+	}
+	blind := pakeN
+	if p.server {
+		blind = pakeM
+	}
+	point.Subtract(point, new(edwards25519.Point).ScalarMult(p.w, blind))
+	point.ScalarMult(p.x, point)
+	point.MultByCofactor(point)
+	if point.Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return ErrPake
+	}
+	p.client, p.srv = p.share, peer
+	if p.server {
+		p.client, p.srv = peer, p.share
+	}
+	h := sha512.New()
+	h.Write([]byte(pakeContext))
+	h.Write(p.salt)
+	h.Write(p.client)
+	h.Write(p.srv)
+	h.Write(point.Bytes())
+	sum := h.Sum(nil)
+	p.key, p.mac = sum[:32], sum[32:]
+	return nil
+}
+
+// confirmation is the MAC the client (server false) or the server sends
+func (p *Pake) confirmation(server bool) []byte {
+	mac := hmac.New(sha256.New, p.mac)
+	if server {
+		mac.Write([]byte("server"))
+	} else {
+		mac.Write([]byte("client"))
+	}
+	mac.Write(p.client)
+	mac.Write(p.srv)
+	return mac.Sum(nil)
+}
+
+// Confirm is the proof to send that this side holds the key; call Finish
+// first
+func (p *Pake) Confirm() []byte { return p.confirmation(p.server) }
+
+// Check reports whether the peer's confirmation proves it holds the same
+// key, and so the same password
+func (p *Pake) Check(confirm []byte) bool {
+	p.proven = p.mac != nil && hmac.Equal(confirm, p.confirmation(!p.server))
+	return p.proven
+}
+
+// Session is the key agreed for what the client sends the server, nil
+// until Check has passed. Its ID is drawn from the shares, so both sides
+// name it alike.
+func (p *Pake) Session() *Session {
+	if !p.proven {
+		return nil
+	}
+	h := sha256.New()
+	h.Write([]byte(pakeContext + " id"))
+	h.Write(p.client)
+	h.Write(p.srv)
+	return &Session{ID: h.Sum(nil)[:SessionIDSize], key: p.key}
+}
@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+// What is sealed under a Session names it by its ID, so the receiver can
+// tell which of its keys to open it with: $3$<id>$<base64(nonce ||
+// ciphertext)> for text, and $3$<id> in the header of a stream.
+
+// SessionIDSize is the length of a session's ID
+const SessionIDSize = 16
+
+const sessionPrefix = "$3$"
+
+// Session is a key agreed by a Pake, for one direction between two peers
+type Session struct {
+	ID  []byte
+	key []byte
+}
+
+// Tag names the session in a header: $3$<id>
+func (s *Session) Tag() string { return sessionPrefix + hex.EncodeToString(s.ID) }
+
+// SessionID is the ID of the session a Tag, or text from Session.Encrypt,
+// names; ok is false for anything else
+func SessionID(s string) (id []byte, ok bool) {
+	rest, ok := strings.CutPrefix(s, sessionPrefix)
+	if !ok {
+		return nil, false
+	}
+	field, _, _ := strings.Cut(rest, "$")
+	id, err := hex.DecodeString(field)
+	return id, err == nil && len(id) == SessionIDSize
+}
+
+// Encrypt is crypto.Encrypt under the session key, tagged with its ID
+func (s *Session) Encrypt(plaintext []byte) (string, error) {
+	sealed, err := encrypt(plaintext, s.key)
+	if err != nil {
+		return "", err
+	}
+	return s.Tag() + "$" + sealed, nil
+}
+
+// Decrypt reverses Encrypt
+func (s *Session) Decrypt(encoded string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(encoded, s.Tag()+"$")
+	if !ok {
+		return nil, errors.New("not sealed under this session")
+	}
+	return decrypt(rest, s.key)
+}
+
+// NewWriter is crypto.NewWriter under the session key
+func (s *Session) NewWriter(w io.Writer) (io.WriteCloser, error) { return newWriter(w, s.key) }
+
+// NewReader is crypto.NewReader under the session key
+func (s *Session) NewReader(r io.Reader) (io.Reader, error) { return newReader(r, s.key) }
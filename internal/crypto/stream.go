@@ -0,0 +1,221 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// A file is encrypted as a stream of chunks rather than one sealed blob, so
+// neither side holds more than a chunk of it: an 8-byte random nonce
+// prefix, then every chunk as a 4-byte big-endian length and its AES-256-GCM
+// ciphertext. A chunk's nonce is the prefix followed by its index. The last
+// chunk has the top bit of its length set and is sealed with that flag as
+// additional data, so chunks can't be reordered, dropped or cut off at the
+// end without the reader noticing.
+
+// ChunkSize is the most plaintext one chunk holds
+const ChunkSize = 64 << 10
+
+const (
+	prefixSize = 8
+	lastChunk  = 1 << 31
+)
+
+// ErrDecrypt is a stream that fails authentication: the wrong password, or
+// data altered on the way
+var ErrDecrypt = errors.New("cannot decrypt: wrong password or altered data")
+
+// streamWriter encrypts what is written to it, a chunk at a time
+type streamWriter struct {
+	w      io.Writer
+	gcm    cipher.AEAD
+	nonce  []byte // the prefix, then the chunk index
+	index  uint32
+	buf    []byte // plaintext of the chunk being filled
+	out    []byte // length and ciphertext of the chunk being written
+	closed bool
+}
+
+// NewWriter encrypts what is written to it onto w under a key derived from
+// the password. Close writes the last chunk and must be called; it doesn't
+// close w.
+func NewWriter(w io.Writer, password string) (io.WriteCloser, error) {
+	return newWriter(w, deriveKey(password))
+}
+
+// NewSaltedWriter is NewWriter under the password's Argon2id key for salt
+// (see EncryptSalted)
+func NewSaltedWriter(w io.Writer, password string, salt []byte) (io.WriteCloser, error) {
+	return newWriter(w, saltedKey(password, salt).seal)
+}
+
+func newWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce[:prefixSize]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(nonce[:prefixSize]); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		w:     w,
+		gcm:   gcm,
+		nonce: nonce,
+		buf:   make([]byte, 0, ChunkSize),
+		out:   make([]byte, 4, 4+ChunkSize+gcm.Overhead()),
+	}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to a closed stream")
+	}
+	n := 0
+	for len(p) > 0 {
+		k := copy(s.buf[len(s.buf):ChunkSize], p)
+		s.buf = s.buf[:len(s.buf)+k]
+		p, n = p[k:], n+k
+		if len(s.buf) == ChunkSize {
+			if err := s.flush(false); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes what is left as the last chunk, empty if the plaintext
+// ended on a chunk boundary
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush(true)
+}
+
+func (s *streamWriter) flush(last bool) error {
+	if s.index == math.MaxUint32 {
+		return errors.New("stream too long")
+	}
+	binary.BigEndian.PutUint32(s.nonce[prefixSize:], s.index)
+	s.out = s.gcm.Seal(s.out[:4], s.nonce, s.buf, flag(last))
+	size := uint32(len(s.out) - 4)
+	if last {
+		size |= lastChunk
+	}
+	binary.BigEndian.PutUint32(s.out, size)
+	s.index++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(s.out)
+	return err
+}
+
+// flag is the additional data a chunk is sealed with
+func flag(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// streamReader decrypts a stream from NewWriter, a chunk at a time
+type streamReader struct {
+	r       io.Reader
+	gcm     cipher.AEAD
+	nonce   []byte
+	index   uint32
+	started bool   // the prefix has been read
+	in      []byte // the chunk being read, decrypted in place
+	plain   []byte // what of it hasn't been returned yet
+	done    bool   // the last chunk has been read
+}
+
+// NewReader decrypts a stream written by NewWriter under the same password.
+// Reads fail with ErrDecrypt on the wrong password or altered data, and
+// with io.ErrUnexpectedEOF on a stream that ends before its last chunk.
+func NewReader(r io.Reader, password string) (io.Reader, error) {
+	return newReader(r, deriveKey(password))
+}
+
+// NewSaltedReader decrypts a stream written by NewSaltedWriter under the
+// same password and salt
+func NewSaltedReader(r io.Reader, password string, salt []byte) (io.Reader, error) {
+	return newReader(r, saltedKey(password, salt).seal)
+}
+
+func newReader(r io.Reader, key []byte) (io.Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		r:     r,
+		gcm:   gcm,
+		nonce: make([]byte, gcm.NonceSize()),
+		in:    make([]byte, ChunkSize+gcm.Overhead()),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the next chunk
+func (s *streamReader) next() error {
+	if !s.started {
+		if _, err := io.ReadFull(s.r, s.nonce[:prefixSize]); err != nil {
+			return unexpected(err)
+		}
+		s.started = true
+	}
+	var head [4]byte
+	if _, err := io.ReadFull(s.r, head[:]); err != nil {
+		return unexpected(err)
+	}
+	size := binary.BigEndian.Uint32(head[:])
+	last := size&lastChunk != 0
+	size &^= lastChunk
+	if size < uint32(s.gcm.Overhead()) || size > uint32(len(s.in)) {
+		return ErrDecrypt
+	}
+	chunk := s.in[:size]
+	if _, err := io.ReadFull(s.r, chunk); err != nil {
+		return unexpected(err)
+	}
+	binary.BigEndian.PutUint32(s.nonce[prefixSize:], s.index)
+	plain, err := s.gcm.Open(chunk[:0], s.nonce, chunk, flag(last))
+	if err != nil {
+		return ErrDecrypt
+	}
+	s.index++
+	s.plain, s.done = plain, last
+	return nil
+}
+
+// unexpected is a read error inside the stream; a plain EOF there means it
+// was cut short
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// sealed is plain encrypted as a stream under password
+func sealed(t *testing.T, plain []byte, password string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	salt := bytes.Repeat([]byte{7}, SaltSize)
+	tests := []struct {
+		name   string
+		size   int
+		salted bool
+		writes int // bytes per Write, 0 for all at once
+	}{
+		{"empty", 0, false, 0},
+		{"one byte", 1, false, 0},
+		{"one short of a chunk", ChunkSize - 1, false, 0},
+		{"exactly a chunk", ChunkSize, false, 0},
+		{"a chunk and a byte", ChunkSize + 1, false, 0},
+		{"several chunks in small writes", 3*ChunkSize + 5, false, 1000},
+		{"salted", 2*ChunkSize + 17, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := make([]byte, tt.size)
+			for i := range plain {
+				plain[i] = byte(i * 31)
+			}
+			var buf bytes.Buffer
+			var w io.WriteCloser
+			var err error
+			if tt.salted {
+				w, err = NewSaltedWriter(&buf, "secret", salt)
+			} else {
+				w, err = NewWriter(&buf, "secret")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rest := plain; len(rest) > 0; {
+				n := len(rest)
+				if tt.writes > 0 {
+					n = min(n, tt.writes)
+				}
+				if _, err := w.Write(rest[:n]); err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte("x")); err == nil {
+				t.Error("Write after Close succeeded")
+			}
+			var r io.Reader
+			if tt.salted {
+				r, err = NewSaltedReader(&buf, "secret", salt)
+			} else {
+				r, err = NewReader(&buf, "secret")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("got %d bytes back, want the %d written", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestStreamTamper(t *testing.T) {
+	// Three chunks: two full ones and a short last one
+	plain := bytes.Repeat([]byte("lan-chat"), (2*ChunkSize+10)/8)
+	stream := sealed(t, plain, "secret")
+	full := 4 + ChunkSize + 16 // a full chunk with its length and GCM tag
+	first, second, last := prefixSize, prefixSize+full, prefixSize+2*full
+
+	tests := []struct {
+		name     string
+		password string
+		tamper   func(b []byte) []byte
+		want     error
+	}{
+		{"untouched", "secret", func(b []byte) []byte { return b }, nil},
+		{"wrong password", "guess", func(b []byte) []byte { return b }, ErrDecrypt},
+		{"nonce prefix altered", "secret", func(b []byte) []byte { b[0] ^= 1; return b }, ErrDecrypt},
+		{"ciphertext altered", "secret", func(b []byte) []byte { b[first+4+100] ^= 1; return b }, ErrDecrypt},
+		{"tag altered", "secret", func(b []byte) []byte { b[len(b)-1] ^= 1; return b }, ErrDecrypt},
+		{"chunks swapped", "secret", func(b []byte) []byte {
+			out := append([]byte{}, b[:first]...)
+			out = append(out, b[second:last]...)
+			out = append(out, b[first:second]...)
+			return append(out, b[last:]...)
+		}, ErrDecrypt},
+		{"chunk dropped", "secret", func(b []byte) []byte {
+			return append(b[:second:second], b[last:]...)
+		}, ErrDecrypt},
+		{"last chunk dropped", "secret", func(b []byte) []byte { return b[:last] }, io.ErrUnexpectedEOF},
+		{"cut inside the last chunk", "secret", func(b []byte) []byte { return b[:len(b)-5] }, io.ErrUnexpectedEOF},
+		{"cut inside the prefix", "secret", func(b []byte) []byte { return b[:3] }, io.ErrUnexpectedEOF},
+		{"last flag cleared", "secret", func(b []byte) []byte {
+			size := binary.BigEndian.Uint32(b[last:])
+			binary.BigEndian.PutUint32(b[last:], size&^lastChunk)
+			return b
+		}, ErrDecrypt},
+		{"last flag set early", "secret", func(b []byte) []byte {
+			size := binary.BigEndian.Uint32(b[first:])
+			binary.BigEndian.PutUint32(b[first:], size|lastChunk)
+			return b
+		}, ErrDecrypt},
+		{"oversized length", "secret", func(b []byte) []byte {
+			binary.BigEndian.PutUint32(b[first:], ChunkSize+17)
+			return b
+		}, ErrDecrypt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.tamper(append([]byte{}, stream...))
+			r, err := NewReader(bytes.NewReader(b), tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && !bytes.Equal(got, plain) {
+				t.Error("untouched stream didn't round-trip")
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+// Package discovery finds peers on the LAN. Every node broadcasts
+// "IAM:<name>" on UDP and listens for everyone else's announcements. A
+// node that just started also broadcasts "WHO:<name>" once, which those
+// already running answer with an announcement of their own right away,
+// rather than up to AnnounceInterval later; older versions ignore it.
+//
+// Ahead of each IAM a node also sends "PORT:<port>", the TCP port it takes
+// chats and files on, so peers on other ports can still reach it. Older
+// versions ignore that too; a peer that never sends it is dialed on our
+// own port, as before.
+package discovery
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"lan-chat/internal/platform"
+)
+
+// DefaultPort is the UDP port announcements are broadcast to
+const DefaultPort = "9999"
+
+// Port is the UDP port this process announces on and listens to,
+// DefaultPort unless [network] udp_port says otherwise. Set it before
+// starting a node.
+var Port = DefaultPort
+
+// AnnounceInterval is how often we broadcast our name
+const AnnounceInterval = 3 * time.Second
+
+// OfflineAfter is how long a peer can go unheard before it is taken for
+// gone: five announcements, so a few lost datagrams don't count
+const OfflineAfter = 5 * AnnounceInterval
+
+// answerGap is the least time between announcements made early, so a
+// crowd starting together (or a flood of WHO) costs a few extra
+// datagrams, not one per peer
+const answerGap = 250 * time.Millisecond
+
+// readBuffer is the receive buffer asked for on the discovery socket, room
+// for a burst of announcements from a large LAN while Run is descheduled.
+// The OS may cap it (net.core.rmem_max on Linux).
+const readBuffer = 1 << 20
+
+// Backoff after a failed read, doubling up to maxBackoff while reads keep
+// failing
+const (
+	minBackoff = 10 * time.Millisecond
+	maxBackoff = time.Second
+)
+
+// Peer is a node that announced itself
+type Peer struct {
+	Name string
+	IP   string
+	Port string // the TCP port it announced, "" if it didn't (a version from before PORT)
+}
+
+// Discoverer is the datagram network announcements travel on. UDP is the
+// real one; anything else (an in-memory network for tests) can stand in.
+type Discoverer interface {
+	// Broadcast opens a connection whose writes reach every peer
+	Broadcast() (net.Conn, error)
+	// ListenPackets opens the socket everyone's announcements arrive on
+	ListenPackets() (net.PacketConn, error)
+}
+
+// UDP is the LAN: broadcasts to the addresses platform.BroadcastAddrs gives
+// (255.255.255.255 on Linux) and listens on Port
+type UDP struct{}
+
+func (UDP) Broadcast() (net.Conn, error) {
+	addrs := platform.BroadcastAddrs()
+	if len(addrs) == 1 {
+		addr, _ := net.ResolveUDPAddr("udp4", net.JoinHostPort(addrs[0], Port))
+		return net.DialUDP("udp4", nil, addr)
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	f := &fanout{UDPConn: conn}
+	for _, a := range addrs {
+		addr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(a, Port))
+		if err == nil {
+			f.to = append(f.to, addr)
+		}
+	}
+	return f, nil
+}
+
+// fanout is an unconnected socket whose writes go to every address in to
+type fanout struct {
+	*net.UDPConn
+	to []*net.UDPAddr
+}
+
+// Write succeeds if any one address took the packet; an interface that went
+// down shouldn't stop the others hearing us
+func (f *fanout) Write(b []byte) (int, error) {
+	var err error
+	sent := false
+	for _, addr := range f.to {
+		if _, e := f.WriteToUDP(b, addr); e != nil {
+			err = e
+		} else {
+			sent = true
+		}
+	}
+	if !sent {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (UDP) ListenPackets() (net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp", ":"+Port)
+	if u, ok := conn.(*net.UDPConn); ok {
+		u.SetReadBuffer(readBuffer) // best effort: the default still works
+	}
+	return conn, err
+}
+
+// Announce broadcasts our name on the LAN forever; it returns only if the
+// socket cannot be opened
+func Announce(name string) error { return AnnounceOn(UDP{}, name) }
+
+// AnnounceOn is Announce on any Discoverer
+func AnnounceOn(d Discoverer, name string) error { return NewAnnouncer(d, name).Run() }
+
+// Announcer broadcasts a name every AnnounceInterval, and early when Now
+// is called: to answer a WHO, or to greet a peer just discovered
+type Announcer struct {
+	d    Discoverer
+	name string
+	now  chan struct{}
+	// TCPPort, if set, is announced in a PORT ahead of every IAM. Set it
+	// before Run.
+	TCPPort string
+}
+
+func NewAnnouncer(d Discoverer, name string) *Announcer {
+	return &Announcer{d: d, name: name, now: make(chan struct{}, 1)}
+}
+
+// Now asks for an announcement ahead of the next one. Requests made while
+// one is pending are sent as one; it never blocks.
+func (a *Announcer) Now() {
+	select {
+	case a.now <- struct{}{}:
+	default:
+	}
+}
+
+// Run asks who is there, then announces forever; it returns only if the
+// socket cannot be opened
+func (a *Announcer) Run() error {
+	conn, err := a.d.Broadcast()
+	if err != nil {
+		return err
+	}
+	conn.Write([]byte("WHO:" + a.name))
+	tick := time.NewTicker(AnnounceInterval)
+	defer tick.Stop()
+	for {
+		if a.TCPPort != "" {
+			conn.Write([]byte("PORT:" + a.TCPPort))
+		}
+		conn.Write([]byte("IAM:" + a.name))
+		last := time.Now()
+		select {
+		case <-tick.C:
+		case <-a.now:
+			time.Sleep(answerGap - time.Since(last))
+		}
+	}
+}
+
+// Listener records announcements from other peers
+type Listener struct {
+	conn  net.PacketConn
+	self  string
+	peers sync.Map                              // IP -> name
+	Logf  func(format string, v ...interface{}) // optional debug log
+	// Asked, if set, is called when a peer that just started asks who is
+	// there; normally Announcer.Now
+	Asked func()
+	// Lost, if set, is called with a peer not heard from in OfflineAfter.
+	// It is forgotten, so its next announcement finds it again.
+	Lost func(p Peer, lastSeen time.Time)
+
+	mu    sync.Mutex
+	seen  map[netip.Addr]time.Time // when each peer last announced itself
+	ports map[netip.Addr]string    // the TCP port each announced
+}
+
+// Listen opens the discovery port. self is our own name, whose
+// announcements are ignored.
+func Listen(self string) (*Listener, error) { return ListenOn(UDP{}, self) }
+
+// ListenOn is Listen on any Discoverer
+func ListenOn(d Discoverer, self string) (*Listener, error) {
+	conn, err := d.ListenPackets()
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{conn: conn, self: self, seen: make(map[netip.Addr]time.Time), ports: make(map[netip.Addr]string)}, nil
+}
+
+var (
+	iam     = []byte("IAM:")
+	who     = []byte("WHO:")
+	tcpPort = []byte("PORT:")
+)
+
+// addrPortReader is a socket that reads without allocating an address per
+// packet, as *net.UDPConn does
+type addrPortReader interface {
+	ReadFromUDPAddrPort(b []byte) (int, netip.AddrPort, error)
+}
+
+// Run reads announcements until the socket is closed, calling found once
+// for each new peer, and again for one that comes back after Lost. Every
+// peer announces every few seconds, so a repeat from an address already
+// seen only has its time noted, before anything is allocated.
+// Other read errors (an ICMP error surfacing, a short-lived ENOBUFS) are
+// logged and retried after a growing pause, rather than ending discovery
+// or spinning on them.
+func (l *Listener) Run(found func(Peer)) {
+	buf := make([]byte, 1024)
+	backoff := time.Duration(0)
+	if l.Lost != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go l.expire(done)
+	}
+	for {
+		n, from, err := l.read(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			backoff = min(max(2*backoff, minBackoff), maxBackoff)
+			if l.Logf != nil {
+				l.Logf("Discovery read failed, retrying in %v: %v", backoff, err)
+			}
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+		if port, ok := bytes.CutPrefix(buf[:n], tcpPort); ok {
+			if from.IsValid() {
+				l.setPort(from, port, found)
+			}
+			continue
+		}
+		if name, ok := bytes.CutPrefix(buf[:n], who); ok {
+			if string(name) != l.self && l.Asked != nil {
+				l.Asked()
+			}
+			continue
+		}
+		name, ok := bytes.CutPrefix(buf[:n], iam)
+		if !ok || string(name) == l.self {
+			continue
+		}
+		if !from.IsValid() {
+			continue
+		}
+		l.mu.Lock()
+		_, known := l.seen[from]
+		l.seen[from] = time.Now()
+		port := l.ports[from]
+		l.mu.Unlock()
+		if known {
+			continue
+		}
+		p := Peer{Name: string(name), IP: from.String(), Port: port}
+		if _, seen := l.peers.LoadOrStore(p.IP, p.Name); !seen {
+			if l.Logf != nil {
+				l.Logf("Discovered peer: %s (%s)", p.Name, p.IP)
+			}
+			found(p)
+		}
+	}
+}
+
+// setPort notes the TCP port the peer at from announced. A peer already
+// found that now names another port, restarted on it or announced it late,
+// is found again with it.
+func (l *Listener) setPort(from netip.Addr, port []byte, found func(Peer)) {
+	l.mu.Lock()
+	old, ok := l.ports[from]
+	if ok && old == string(port) {
+		l.mu.Unlock()
+		return
+	}
+	if n, err := strconv.Atoi(string(port)); err != nil || n < 1 || n > 65535 {
+		l.mu.Unlock()
+		return
+	}
+	l.ports[from] = string(port)
+	l.mu.Unlock()
+	name, known := l.peers.Load(from.String())
+	if !known {
+		return
+	}
+	p := Peer{Name: name.(string), IP: from.String(), Port: string(port)}
+	if l.Logf != nil {
+		l.Logf("Peer %s (%s) takes connections on TCP port %s", p.Name, p.IP, p.Port)
+	}
+	found(p)
+}
+
+// expire calls Lost for every peer unheard for OfflineAfter, checking once
+// an AnnounceInterval until done is closed
+func (l *Listener) expire(done <-chan struct{}) {
+	tick := time.NewTicker(AnnounceInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+		}
+		var lost []Peer
+		var when []time.Time
+		l.mu.Lock()
+		for addr, last := range l.seen {
+			if time.Since(last) < OfflineAfter {
+				continue
+			}
+			delete(l.seen, addr)
+			delete(l.ports, addr)
+			if name, ok := l.peers.LoadAndDelete(addr.String()); ok {
+				lost = append(lost, Peer{Name: name.(string), IP: addr.String()})
+				when = append(when, last)
+			}
+		}
+		l.mu.Unlock()
+		for i, p := range lost {
+			if l.Logf != nil {
+				l.Logf("Lost peer: %s (%s), unheard since %s", p.Name, p.IP, when[i].Format(time.TimeOnly))
+			}
+			l.Lost(p, when[i])
+		}
+	}
+}
+
+// read is one packet and the address it came from, invalid if that isn't
+// an IP
+func (l *Listener) read(buf []byte) (int, netip.Addr, error) {
+	if r, ok := l.conn.(addrPortReader); ok {
+		n, from, err := r.ReadFromUDPAddrPort(buf)
+		return n, from.Addr().Unmap(), err
+	}
+	n, rAddr, err := l.conn.ReadFrom(buf)
+	if err != nil {
+		return 0, netip.Addr{}, err
+	}
+	return n, addrIP(rAddr), nil
+}
+
+func addrIP(a net.Addr) netip.Addr {
+	if u, ok := a.(*net.UDPAddr); ok {
+		ip, _ := netip.AddrFromSlice(u.IP)
+		return ip.Unmap()
+	}
+	if ap, err := netip.ParseAddrPort(a.String()); err == nil {
+		return ap.Addr().Unmap()
+	}
+	ip, _ := netip.ParseAddr(a.String())
+	return ip
+}
+
+// Close stops Run
+func (l *Listener) Close() error { return l.conn.Close() }
+
+// Peers lists every peer heard from, less those Lost since
+func (l *Listener) Peers() []Peer {
+	var peers []Peer
+	l.peers.Range(func(k, v interface{}) bool {
+		peers = append(peers, Peer{Name: v.(string), IP: k.(string)})
+		return true
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, p := range peers {
+		if addr, err := netip.ParseAddr(p.IP); err == nil {
+			peers[i].Port = l.ports[addr]
+		}
+	}
+	return peers
+}
@@ -0,0 +1,24 @@
+package discovery
+
+import "time"
+
+// HeartbeatInterval is how often every discovered peer is pinged
+const HeartbeatInterval = 5 * time.Second
+
+// Heartbeat pings every peer the listener has seen and calls changed when a
+// peer's reachability flips (and the first time it is checked), so the UI
+// can show whether a message would actually be delivered. ping is normally
+// protocol.Ping.
+func Heartbeat(l *Listener, ping func(ip string) bool, changed func(ip string, reachable bool)) {
+	reachable := make(map[string]bool)
+	for {
+		time.Sleep(HeartbeatInterval)
+		for _, p := range l.Peers() {
+			ok := ping(p.IP)
+			if prev, seen := reachable[p.IP]; !seen || prev != ok {
+				reachable[p.IP] = ok
+				changed(p.IP, ok)
+			}
+		}
+	}
+}
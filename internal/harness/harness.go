@@ -0,0 +1,123 @@
+// Package harness runs a cluster of nodes on an in-memory network
+// (internal/memnet) in one process, for end-to-end checks of discovery,
+// verification, chat and file transfer without network permissions.
+package harness
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lan-chat/internal/memnet"
+	"lan-chat/internal/node"
+)
+
+// Cluster is N nodes named peer1..peerN at 10.0.0.1..10.0.0.N, each saving
+// received files in its own directory under Dir
+type Cluster struct {
+	Net   *memnet.Network
+	Nodes []*node.Node
+	Dir   string
+
+	logs []*eventLog
+}
+
+// New builds a cluster of n nodes sharing password ("" for plaintext);
+// nothing runs until Start. Close removes Dir.
+func New(n int, password string) (*Cluster, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("need at least one node, got %d", n)
+	}
+	dir, err := os.MkdirTemp("", "lan-chat-harness-")
+	if err != nil {
+		return nil, err
+	}
+	c := &Cluster{Net: memnet.New(), Dir: dir}
+	for i := 1; i <= n; i++ {
+		h := c.Net.Host(fmt.Sprintf("10.0.0.%d", i))
+		nd := node.New(fmt.Sprintf("peer%d", i), password)
+		nd.Dir = filepath.Join(dir, nd.Name)
+		if err := os.Mkdir(nd.Dir, 0755); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		nd.Discoverer, nd.Dialer, nd.Listener = h, h, h
+		c.Nodes = append(c.Nodes, nd)
+		c.logs = append(c.logs, newEventLog())
+	}
+	return c, nil
+}
+
+// Start starts every node and records its events
+func (c *Cluster) Start() {
+	for i, nd := range c.Nodes {
+		go c.logs[i].drain(nd.Events())
+		nd.Start()
+	}
+}
+
+// Host is the network host of node i
+func (c *Cluster) Host(i int) *memnet.Host {
+	return c.Net.Host(fmt.Sprintf("10.0.0.%d", i+1))
+}
+
+// IP is the address of node i
+func (c *Cluster) IP(i int) string { return c.Host(i).IP() }
+
+// Events is everything node i has emitted so far
+func (c *Cluster) Events(i int) []node.Event {
+	l := c.logs[i]
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]node.Event(nil), l.events...)
+}
+
+// WaitFor returns the first event of node i, since it started, that match
+// accepts, waiting up to timeout for it
+func (c *Cluster) WaitFor(i int, timeout time.Duration, match func(node.Event) bool) (node.Event, error) {
+	l := c.logs[i]
+	deadline := time.After(timeout)
+	seen := 0
+	for {
+		l.mu.Lock()
+		events, changed := l.events[seen:], l.changed
+		l.mu.Unlock()
+		for _, ev := range events {
+			if match(ev) {
+				return ev, nil
+			}
+		}
+		seen += len(events)
+		select {
+		case <-changed:
+		case <-deadline:
+			return nil, fmt.Errorf("%s: no matching event after %v", c.Nodes[i].Name, timeout)
+		}
+	}
+}
+
+// Close removes the cluster's directory. The nodes have no way to stop, so
+// a process should build one cluster and exit when done.
+func (c *Cluster) Close() error { return os.RemoveAll(c.Dir) }
+
+// eventLog keeps a node's events; changed is closed and replaced on each
+// append so waiters wake up
+type eventLog struct {
+	mu      sync.Mutex
+	events  []node.Event
+	changed chan struct{}
+}
+
+func newEventLog() *eventLog { return &eventLog{changed: make(chan struct{})} }
+
+func (l *eventLog) drain(events <-chan node.Event) {
+	for ev := range events {
+		l.mu.Lock()
+		l.events = append(l.events, ev)
+		close(l.changed)
+		l.changed = make(chan struct{})
+		l.mu.Unlock()
+	}
+}
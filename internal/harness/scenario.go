@@ -0,0 +1,149 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/node"
+)
+
+// Timeouts for the scenario: discovery is immediate on the first
+// announcement, reachability needs a heartbeat or two
+const (
+	stepTimeout   = 5 * time.Second
+	healthTimeout = 3 * discovery.HeartbeatInterval
+)
+
+// Selftest runs the end-to-end scenario on a fresh cluster of n nodes (at
+// least 2): everyone discovers and verifies everyone, peer1 chats with each
+// peer and then with everyone at once, sends peer2 a file, and sees the
+// last peer go offline. logf reports
+// each step.
+func Selftest(n int, logf func(format string, v ...interface{})) error {
+	if n < 2 {
+		return fmt.Errorf("need at least two peers, got %d", n)
+	}
+	c, err := New(n, "selftest")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	c.Start()
+
+	logf("Discovery and verification between %d peers", n)
+	for i := range c.Nodes {
+		for j := range c.Nodes {
+			if i == j {
+				continue
+			}
+			ip := c.IP(j)
+			if _, err := c.WaitFor(i, stepTimeout, func(ev node.Event) bool {
+				v, ok := ev.(node.PeerVerified)
+				return ok && v.IP == ip && v.Secure
+			}); err != nil {
+				return fmt.Errorf("%s did not verify %s: %v", c.Nodes[i].Name, c.Nodes[j].Name, err)
+			}
+		}
+	}
+
+	from := c.Nodes[0]
+	logf("Encrypted chat from %s to every peer", from.Name)
+	for j := 1; j < n; j++ {
+		text := fmt.Sprintf("hello %s", c.Nodes[j].Name)
+		if err := from.SendChat(c.IP(j), text); err != nil {
+			return fmt.Errorf("chat to %s: %v", c.Nodes[j].Name, err)
+		}
+		ev, err := c.WaitFor(j, stepTimeout, func(ev node.Event) bool {
+			m, ok := ev.(node.ChatReceived)
+			return ok && m.From == c.IP(0) && m.Text == text
+		})
+		if err != nil {
+			return fmt.Errorf("%s missed %q: %v", c.Nodes[j].Name, text, err)
+		}
+		if m := ev.(node.ChatReceived); m.Sender != from.Name || !m.Encrypted || m.Group || m.Err != nil {
+			return fmt.Errorf("%s got %+v", c.Nodes[j].Name, m)
+		}
+	}
+
+	logf("Group chat from %s to everyone", from.Name)
+	for j := 1; j < n; j++ {
+		ip := c.IP(j)
+		if reachable(from, ip) {
+			continue
+		}
+		if _, err := c.WaitFor(0, healthTimeout, func(ev node.Event) bool {
+			h, ok := ev.(node.PeerHealth)
+			return ok && h.IP == ip && h.Reachable
+		}); err != nil {
+			return fmt.Errorf("%s never looked reachable: %v", c.Nodes[j].Name, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	if err := from.SendGroupChat(ctx, "hello everyone"); err != nil {
+		return fmt.Errorf("group chat: %v", err)
+	}
+	for j := 1; j < n; j++ {
+		ev, err := c.WaitFor(j, stepTimeout, func(ev node.Event) bool {
+			m, ok := ev.(node.ChatReceived)
+			return ok && m.From == c.IP(0) && m.Text == "hello everyone"
+		})
+		if err != nil {
+			return fmt.Errorf("%s missed the group chat: %v", c.Nodes[j].Name, err)
+		}
+		if m := ev.(node.ChatReceived); !m.Group || !m.Encrypted || m.Err != nil {
+			return fmt.Errorf("%s got %+v", c.Nodes[j].Name, m)
+		}
+	}
+
+	logf("File transfer from %s to %s", from.Name, c.Nodes[1].Name)
+	content := make([]byte, 256<<10)
+	rand.Read(content)
+	src := filepath.Join(c.Dir, "payload.bin")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		return err
+	}
+	if err := from.SendFile(c.IP(1), src); err != nil {
+		return fmt.Errorf("send file: %v", err)
+	}
+	ev, err := c.WaitFor(1, stepTimeout, func(ev node.Event) bool {
+		f, ok := ev.(node.FileReceived)
+		return ok && f.Name == "payload.bin"
+	})
+	if err != nil {
+		return fmt.Errorf("%s did not receive the file: %v", c.Nodes[1].Name, err)
+	}
+	got, err := os.ReadFile(ev.(node.FileReceived).Path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, content) {
+		return fmt.Errorf("received file differs: %d bytes, want %d", len(got), len(content))
+	}
+
+	last := n - 1
+	logf("%s goes offline", c.Nodes[last].Name)
+	c.Host(last).SetDown(true)
+	if _, err := c.WaitFor(0, healthTimeout, func(ev node.Event) bool {
+		h, ok := ev.(node.PeerHealth)
+		return ok && h.IP == c.IP(last) && !h.Reachable
+	}); err != nil {
+		return fmt.Errorf("%s still looks reachable: %v", c.Nodes[last].Name, err)
+	}
+	if err := from.SendChat(c.IP(last), "anyone there?"); err == nil {
+		return fmt.Errorf("chat to offline %s succeeded", c.Nodes[last].Name)
+	}
+	return nil
+}
+
+// reachable reports whether n has seen ip answer a heartbeat already
+func reachable(n *node.Node, ip string) bool {
+	p, ok := n.Lookup(ip)
+	return ok && p.Reachable
+}
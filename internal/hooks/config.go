@@ -0,0 +1,176 @@
+package hooks
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"lan-chat/internal/store"
+)
+
+// configKeys maps [hooks] keys in config.toml to hook points
+var configKeys = map[string]string{
+	"on_message":          MessageReceived,
+	"on_message_received": MessageReceived,
+	"on_file_received":    FileReceived,
+	"on_peer_discovered":  PeerDiscovered,
+}
+
+// placeholders are what a command template can use; each is replaced inside
+// a single argument, so values with spaces or quotes stay one argument
+var placeholders = map[string]func(e Event) string{
+	"event":  func(e Event) string { return e.Event },
+	"sender": func(e Event) string { return e.Peer },
+	"peer":   func(e Event) string { return e.Peer },
+	"ip":     func(e Event) string { return e.IP },
+	"text":   func(e Event) string { return e.Text },
+	"name":   func(e Event) string { return e.Name },
+	"path":   func(e Event) string { return e.Path },
+}
+
+var placeholderRe = regexp.MustCompile(`\{[A-Za-z0-9_]+\}`)
+
+// New is a Runner for the hooks directory and the [hooks] section of the
+// config file at configPath (a missing file means no commands)
+func New(configPath string) (*Runner, error) {
+	r := &Runner{Dir: Dir(), Commands: make(map[string]string), Webhooks: make(map[string][]string), Timeout: DefaultTimeout}
+	if configPath == "" {
+		return r, nil
+	}
+	values, err := store.ParseFile(configPath)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		if key, ok := strings.CutPrefix(k, "webhooks."); ok {
+			point, ok := configKeys[key]
+			if !ok {
+				return nil, fmt.Errorf("webhooks.%s: unknown event (use on_message, on_file_received or on_peer_discovered)", key)
+			}
+			for _, raw := range strings.Split(v, ",") {
+				raw = strings.TrimSpace(raw)
+				if raw == "" {
+					continue
+				}
+				if u, err := url.Parse(raw); err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+					return nil, fmt.Errorf("webhooks.%s: %q is not an http(s) URL", key, raw)
+				}
+				r.Webhooks[point] = append(r.Webhooks[point], raw)
+			}
+			continue
+		}
+		key, ok := strings.CutPrefix(k, "hooks.")
+		if !ok || key == "timeout" {
+			continue
+		}
+		point, ok := configKeys[key]
+		if !ok {
+			return nil, fmt.Errorf("hooks.%s: unknown hook (use on_message, on_file_received or on_peer_discovered)", key)
+		}
+		if _, err := expand(v, Event{}); err != nil {
+			return nil, fmt.Errorf("hooks.%s: %v", key, err)
+		}
+		r.Commands[point] = v
+	}
+	if v, ok := values["hooks.timeout"]; ok {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			return nil, fmt.Errorf("hooks.timeout: must be a number of seconds, got %q", v)
+		}
+		r.Timeout = time.Duration(secs) * time.Second
+	}
+	return r, nil
+}
+
+// expand is the command for a hook template and event
+func expand(tmpl string, e Event) ([]string, error) {
+	return Expand(tmpl, func(name string) (string, bool) {
+		f, ok := placeholders[name]
+		if !ok {
+			return "", false
+		}
+		return f(e), true
+	})
+}
+
+// Expand splits a command template into arguments the way a shell would
+// (spaces separate, quotes group, backslash escapes), then fills in each
+// {placeholder} with value and a leading ~/ with the home directory. No
+// shell is involved, so a message text can never become part of a command.
+// A placeholder value doesn't know is an error.
+func Expand(tmpl string, value func(name string) (string, bool)) ([]string, error) {
+	words, err := splitWords(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	home, _ := os.UserHomeDir()
+	var bad string
+	for i, w := range words {
+		if rest, ok := strings.CutPrefix(w, "~/"); ok && home != "" {
+			w = filepath.Join(home, rest)
+		}
+		words[i] = placeholderRe.ReplaceAllStringFunc(w, func(ph string) string {
+			v, ok := value(ph[1 : len(ph)-1])
+			if !ok {
+				bad = ph
+				return ph
+			}
+			return v
+		})
+	}
+	if bad != "" {
+		return nil, fmt.Errorf("unknown placeholder %s", bad)
+	}
+	return words, nil
+}
+
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,181 @@
+// Package hooks runs the user's programs on node events. An executable in
+// the hooks directory named after an event, and the command configured for
+// it in config.toml, are started for each occurrence with the event as JSON
+// on stdin, so auto-responders, archivers and alert integrations can be
+// written in any language. Webhook URLs configured for an event get the
+// same JSON as a POST.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/node"
+	"lan-chat/internal/platform"
+)
+
+// Hook points, which are also the executable names
+const (
+	MessageReceived = "on-message-received"
+	FileReceived    = "on-file-received"
+	PeerDiscovered  = "on-peer-discovered"
+)
+
+// DefaultTimeout is how long a hook may run before it is killed, unless
+// hooks.timeout says otherwise
+const DefaultTimeout = 30 * time.Second
+
+// Event is the JSON a hook reads on stdin; fields not used by an event are
+// left out
+type Event struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Peer      string    `json:"peer,omitempty"` // sender or discovered peer name
+	IP        string    `json:"ip,omitempty"`
+	Text      string    `json:"text,omitempty"`
+	Name      string    `json:"name,omitempty"` // file name as sent
+	Path      string    `json:"path,omitempty"` // absolute path it was saved to
+	Encrypted bool      `json:"encrypted,omitempty"`
+	Group     bool      `json:"group,omitempty"` // a message sent to everyone rather than to us alone
+}
+
+// Backend is what hooks listen to; *node.Node implements it
+type Backend interface {
+	Lookup(peer string) (node.PeerInfo, bool)
+	Subscribe(buffer int, policy bus.Policy) *bus.Subscription[node.Event]
+}
+
+// Dir is where hook executables live by default
+func Dir() string {
+	if dir := platform.ConfigDir(); dir != "" {
+		return filepath.Join(dir, "hooks")
+	}
+	return ""
+}
+
+// Runner starts hook executables from Dir and the commands from the
+// [hooks] config section, and posts to the URLs from [webhooks]
+type Runner struct {
+	Dir      string
+	Commands map[string]string   // hook point -> command template
+	Webhooks map[string][]string // hook point -> URLs
+	Timeout  time.Duration
+	Logf     func(format string, v ...interface{}) // optional debug log
+
+	mu sync.RWMutex // guards the fields above against Reload
+}
+
+// Reload replaces the commands, webhooks and timeout with those in the
+// config file at configPath. Hooks already running finish as they were
+// started; on error nothing changes.
+func (r *Runner) Reload(configPath string) error {
+	next, err := New(configPath)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.Commands, r.Webhooks, r.Timeout = next.Commands, next.Webhooks, next.Timeout
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Runner) logf(format string, v ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, v...)
+	}
+}
+
+// Start runs hooks for b's events in the background until the process
+// exits. Call it before the node starts so no event is missed. The
+// subscription blocks rather than drop events: each hook runs in its own
+// goroutine, so the loop never waits.
+func (r *Runner) Start(b Backend) {
+	sub := b.Subscribe(node.DefaultBuffer, bus.Block)
+	go func() {
+		for ev := range sub.Events() {
+			if e, ok := toEvent(b, ev); ok {
+				go r.Run(e)
+			}
+		}
+	}()
+}
+
+func toEvent(b Backend, ev node.Event) (Event, bool) {
+	now := time.Now()
+	switch ev := ev.(type) {
+	case node.ChatReceived:
+		if ev.Err != nil {
+			return Event{}, false
+		}
+		return Event{Event: MessageReceived, Time: now, Peer: ev.Sender, IP: ev.From, Text: ev.Text, Encrypted: ev.Encrypted, Group: ev.Group}, true
+	case node.FileReceived:
+		path, _ := filepath.Abs(ev.Path)
+		e := Event{Event: FileReceived, Time: now, IP: ev.From, Name: ev.Name, Path: path, Encrypted: ev.Encrypted}
+		if p, ok := b.Lookup(ev.From); ok {
+			e.Peer = p.Name
+		}
+		return e, true
+	case node.PeerFound:
+		return Event{Event: PeerDiscovered, Time: now, Peer: ev.Peer.Name, IP: ev.Peer.IP}, true
+	}
+	return Event{}, false
+}
+
+// Run starts the hooks for e, the executable in Dir and the configured
+// command, posts the webhooks alongside, and waits for them all
+func (r *Runner) Run(e Event) {
+	r.mu.RLock()
+	tmpl, hasCmd := r.Commands[e.Event]
+	urls, timeout := r.Webhooks[e.Event], r.Timeout
+	r.mu.RUnlock()
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() { r.post(e, urls, timeout) }) // a slow command doesn't hold up the webhooks
+	defer wg.Wait()
+	if r.Dir != "" {
+		path := filepath.Join(r.Dir, e.Event)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() && fi.Mode()&0111 != 0 {
+			r.exec(e, []string{path}, timeout)
+		}
+	}
+	if hasCmd {
+		argv, err := expand(tmpl, e)
+		if err != nil {
+			r.logf("Hook %s: %v", e.Event, err)
+			return
+		}
+		r.exec(e, argv, timeout)
+	}
+}
+
+func (r *Runner) exec(e Event, argv []string, timeout time.Duration) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "LANCHAT_EVENT="+e.Event)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		r.logf("Hook %s: %s", e.Event, bytes.TrimSpace(out))
+	}
+	switch {
+	case ctx.Err() != nil:
+		r.logf("Hook %s killed after %v", e.Event, timeout)
+	case err != nil:
+		r.logf("Hook %s failed: %v", e.Event, err)
+	}
+}
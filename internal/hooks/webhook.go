@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// webhookPayload is what url receives for e: the hook JSON, or a text
+// message for the chat services that only take their own format
+func webhookPayload(u *url.URL, e Event) ([]byte, error) {
+	switch {
+	case u.Host == "hooks.slack.com":
+		return json.Marshal(map[string]string{"text": summary(e)})
+	case (u.Host == "discord.com" || u.Host == "discordapp.com") && strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return json.Marshal(map[string]string{"content": summary(e)})
+	}
+	return json.Marshal(e)
+}
+
+// summary is e as one line for a chat channel
+func summary(e Event) string {
+	who := e.Peer
+	if who == "" {
+		who = e.IP
+	}
+	switch e.Event {
+	case MessageReceived:
+		if e.Group {
+			who += " to everyone"
+		}
+		return who + ": " + e.Text
+	case FileReceived:
+		return fmt.Sprintf("%s sent %s (saved as %s)", who, e.Name, e.Path)
+	case PeerDiscovered:
+		return fmt.Sprintf("%s (%s) joined", who, e.IP)
+	}
+	return e.Event
+}
+
+// post sends e to each of urls and waits for the answers
+func (r *Runner) post(e Event, urls []string, timeout time.Duration) {
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue // checked when the config was read
+		}
+		payload, err := webhookPayload(u, e)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		req, err := http.NewRequestWithContext(ctx, "POST", raw, bytes.NewReader(payload))
+		if err != nil {
+			cancel()
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "lan-chat")
+		resp, err := http.DefaultClient.Do(req)
+		switch {
+		case err != nil:
+			r.logf("Webhook %s to %s: %v", e.Event, u.Host, err)
+		case resp.StatusCode >= 300:
+			r.logf("Webhook %s to %s: %s", e.Event, u.Host, resp.Status)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,230 @@
+// Package logging builds the structured (log/slog) logger used by the TUI
+// and the daemon: text or JSON records, a minimum level, and an optional
+// log file that is rotated by size and age.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the rotated log file
+const (
+	DefaultMaxSize    = 5 << 20 // bytes
+	DefaultMaxBackups = 3
+)
+
+// Options picks the output format, level and destination
+type Options struct {
+	Format string     // "text" (default) or "json"
+	Level  slog.Level // records below this are dropped
+	Path   string     // log file; empty for the writer passed to New
+	Limits
+}
+
+// Limits bound a log file and its rotated copies
+type Limits struct {
+	MaxSize    int64         // rotate before the file grows past this; 0 for DefaultMaxSize
+	MaxBackups int           // rotated files kept as Path.1 ... Path.N; 0 for DefaultMaxBackups
+	MaxAge     time.Duration // rotate a file this old and delete older copies; 0 for no limit
+	MaxTotal   int64         // delete the oldest copies while all of them take more; 0 for no limit
+}
+
+// ParseLevel reads a --log-level value (debug, info, warn or error)
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", s)
+	}
+	return l, nil
+}
+
+// CheckFormat rejects anything but text and json
+func CheckFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q (use text or json)", format)
+}
+
+// New is a logger writing to opts.Path, or to w when opts has no path. The
+// closer releases the log file (it does nothing for w).
+func New(w io.Writer, opts Options) (*slog.Logger, io.Closer, error) {
+	if err := CheckFormat(opts.Format); err != nil {
+		return nil, nil, err
+	}
+	var closer io.Closer = io.NopCloser(nil)
+	if opts.Path != "" {
+		f, err := OpenFile(opts.Path, opts.Limits)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closer = f, f
+	}
+	return slog.New(Handler(w, opts.Format, opts.Level)), closer, nil
+}
+
+// Handler is the slog handler for format, dropping records below level
+func Handler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	ho := &slog.HandlerOptions{Level: level}
+	if strings.ToLower(format) == "json" {
+		return slog.NewJSONHandler(w, ho)
+	}
+	return slog.NewTextHandler(w, ho)
+}
+
+// File is a log file that moves itself aside to Path.1 (and Path.1 to
+// Path.2, and so on) once it reaches its size or age limit. It is appended
+// to across runs; it is safe for concurrent writes.
+type File struct {
+	Path string
+	Limits
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	started time.Time // roughly when the first record in the file was written
+}
+
+// OpenFile opens path for appending, creating it if needed. Zero size and
+// backup limits mean the defaults. A file already past MaxAge is rotated
+// first.
+func OpenFile(path string, limits Limits) (*File, error) {
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = DefaultMaxSize
+	}
+	if limits.MaxBackups <= 0 {
+		limits.MaxBackups = DefaultMaxBackups
+	}
+	lf := &File{Path: path, Limits: limits}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	if lf.tooOld() {
+		if err := lf.rotate(); err != nil {
+			lf.Close()
+			return nil, err
+		}
+	} else {
+		lf.prune()
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(lf.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(lf.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.f, lf.size, lf.started = f, fi.Size(), time.Now()
+	// The file was started when the one before it stopped being written
+	if prev, err := os.Stat(lf.Path + ".1"); err == nil && fi.Size() > 0 {
+		lf.started = prev.ModTime()
+	} else if fi.Size() > 0 {
+		lf.started = fi.ModTime()
+	}
+	return nil
+}
+
+func (lf *File) tooOld() bool {
+	return lf.MaxAge > 0 && lf.size > 0 && time.Since(lf.started) > lf.MaxAge
+}
+
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if lf.size > 0 && lf.size+int64(len(p)) > lf.MaxSize || lf.tooOld() {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// Rotate starts a new file now, keeping the current one as Path.1
+func (lf *File) Rotate() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return os.ErrClosed
+	}
+	if lf.size == 0 {
+		return nil
+	}
+	return lf.rotate()
+}
+
+func (lf *File) rotate() error {
+	lf.f.Close()
+	lf.f = nil
+	os.Remove(fmt.Sprintf("%s.%d", lf.Path, lf.MaxBackups))
+	for i := lf.MaxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", lf.Path, i), fmt.Sprintf("%s.%d", lf.Path, i+1))
+	}
+	if err := os.Rename(lf.Path, lf.Path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := lf.open(); err != nil {
+		return err
+	}
+	lf.prune()
+	return nil
+}
+
+// prune deletes rotated copies older than MaxAge, then the oldest ones
+// while the file and its copies together take more than MaxTotal
+func (lf *File) prune() {
+	total := lf.size
+	for i := 1; i <= lf.MaxBackups; i++ {
+		name := fmt.Sprintf("%s.%d", lf.Path, i)
+		fi, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		tooOld := lf.MaxAge > 0 && time.Since(fi.ModTime()) > lf.MaxAge
+		if total += fi.Size(); tooOld || lf.MaxTotal > 0 && total > lf.MaxTotal {
+			os.Remove(name)
+		}
+	}
+}
+
+// Close closes the file; later writes fail
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
+
+// Printf adapts l to the printf-style Logf hooks of node and hooks, logging
+// each line at level
+func Printf(l *slog.Logger, level slog.Level) func(format string, v ...interface{}) {
+	return func(format string, v ...interface{}) {
+		l.Log(context.Background(), level, fmt.Sprintf(format, v...))
+	}
+}
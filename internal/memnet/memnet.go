@@ -0,0 +1,298 @@
+// Package memnet is an in-memory LAN for running many nodes in one process.
+// Each Host has its own IP and implements discovery.Discoverer and
+// protocol.Dialer / protocol.Listener, so a node.Node runs on it unchanged
+// but without opening real sockets.
+package memnet
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"lan-chat/internal/conns"
+)
+
+// Ports the hosts pretend to use, for addresses only
+const (
+	udpPort = 9999
+	tcpPort = 8080
+)
+
+// PacketBuffer is how many announcements a host holds unread; like UDP,
+// more are dropped. The simulator's hosts hold as many.
+const PacketBuffer = 64
+
+// Network is one broadcast domain. The zero value is not usable; call New.
+type Network struct {
+	mu    sync.Mutex
+	hosts map[string]*Host
+}
+
+// New is an empty network
+func New() *Network {
+	return &Network{hosts: make(map[string]*Host)}
+}
+
+// Host returns the host with ip, adding it the first time
+func (nw *Network) Host(ip string) *Host {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if h, ok := nw.hosts[ip]; ok {
+		return h
+	}
+	h := &Host{nw: nw, ip: net.ParseIP(ip)}
+	nw.hosts[ip] = h
+	return h
+}
+
+func (nw *Network) lookup(ip string) *Host {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return nw.hosts[ip]
+}
+
+func (nw *Network) all() []*Host {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	hosts := make([]*Host, 0, len(nw.hosts))
+	for _, h := range nw.hosts {
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// Host is one machine on the network
+type Host struct {
+	nw *Network
+	ip net.IP
+
+	mu      sync.Mutex
+	down    bool
+	packets *packetConn
+	server  *listener
+	conns   conns.Set // both ends of its connections
+}
+
+// IP is the host's address
+func (h *Host) IP() string { return h.ip.String() }
+
+// SetDown takes the host off the network (true) or back on: while down it
+// sends and receives no announcements, and connections to or from it fail,
+// open ones included
+func (h *Host) SetDown(down bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.down = down
+	if down {
+		h.conns.CloseAll()
+	}
+}
+
+func (h *Host) isDown() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.down
+}
+
+// Broadcast opens a connection whose writes reach every host that is
+// listening for packets, this one included
+func (h *Host) Broadcast() (net.Conn, error) {
+	return &broadcastConn{h: h, done: make(chan struct{})}, nil
+}
+
+// ListenPackets opens the host's discovery socket; there is one per host
+func (h *Host) ListenPackets() (net.PacketConn, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.packets != nil {
+		return nil, opError("listen", "udp", h.addr(udpPort), syscall.EADDRINUSE)
+	}
+	h.packets = &packetConn{h: h, in: make(chan datagram, PacketBuffer), done: make(chan struct{})}
+	return h.packets, nil
+}
+
+// Dial connects to the server of the host at ip
+func (h *Host) Dial(ip string) (net.Conn, error) {
+	to := h.nw.lookup(ip)
+	remote := &net.TCPAddr{IP: net.ParseIP(ip), Port: tcpPort}
+	if h.isDown() || to == nil || to.isDown() {
+		return nil, opError("dial", "tcp", remote, syscall.EHOSTUNREACH)
+	}
+	to.mu.Lock()
+	srv := to.server
+	to.mu.Unlock()
+	if srv == nil {
+		return nil, opError("dial", "tcp", remote, syscall.ECONNREFUSED)
+	}
+	client, server := net.Pipe()
+	local := h.addr(0)
+	sc := to.conns.Add(&conn{Conn: server, local: remote, remote: local})
+	select {
+	case srv.accept <- sc:
+	case <-srv.done:
+		sc.Close()
+		return nil, opError("dial", "tcp", remote, syscall.ECONNREFUSED)
+	}
+	return h.conns.Add(&conn{Conn: client, local: local, remote: remote}), nil
+}
+
+// Listen opens the host's server socket; there is one per host
+func (h *Host) Listen() (net.Listener, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.server != nil {
+		return nil, opError("listen", "tcp", h.addr(tcpPort), syscall.EADDRINUSE)
+	}
+	h.server = &listener{h: h, accept: make(chan net.Conn), done: make(chan struct{})}
+	return h.server, nil
+}
+
+func (h *Host) addr(port int) *net.TCPAddr { return &net.TCPAddr{IP: h.ip, Port: port} }
+
+func opError(op, network string, addr net.Addr, err error) error {
+	return &net.OpError{Op: op, Net: network, Addr: addr, Err: os.NewSyscallError(op, err)}
+}
+
+// conn is one side of a net.Pipe with the hosts' addresses, so
+// protocol.RemoteIP sees the peer's IP
+type conn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+type listener struct {
+	h      *Host
+	accept chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+		l.h.mu.Lock()
+		l.h.server = nil
+		l.h.mu.Unlock()
+	})
+	return nil
+}
+
+func (l *listener) Addr() net.Addr { return l.h.addr(tcpPort) }
+
+type datagram struct {
+	data []byte
+	from net.Addr
+}
+
+type packetConn struct {
+	h    *Host
+	in   chan datagram
+	done chan struct{}
+	once sync.Once
+}
+
+func (p *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case d := <-p.in:
+		return copy(b, d.data), d.from, nil
+	case <-p.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// WriteTo delivers to one host, for completeness; discovery only reads
+func (p *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0, err
+	}
+	if to := p.h.nw.lookup(host); to != nil {
+		to.deliver(b, p.LocalAddr())
+	}
+	return len(b), nil
+}
+
+func (p *packetConn) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+		p.h.mu.Lock()
+		p.h.packets = nil
+		p.h.mu.Unlock()
+	})
+	return nil
+}
+
+func (p *packetConn) LocalAddr() net.Addr                { return &net.UDPAddr{IP: p.h.ip, Port: udpPort} }
+func (p *packetConn) SetDeadline(t time.Time) error      { return nil }
+func (p *packetConn) SetReadDeadline(t time.Time) error  { return nil }
+func (p *packetConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// deliver queues a datagram for the host, dropping it if the host is down,
+// not listening or not keeping up
+func (h *Host) deliver(b []byte, from net.Addr) {
+	h.mu.Lock()
+	p, down := h.packets, h.down
+	h.mu.Unlock()
+	if p == nil || down {
+		return
+	}
+	select {
+	case p.in <- datagram{data: append([]byte(nil), b...), from: from}:
+	default:
+	}
+}
+
+// broadcastConn is the write-only end Announce uses
+type broadcastConn struct {
+	h    *Host
+	done chan struct{}
+	once sync.Once
+}
+
+var errWriteOnly = errors.New("memnet: broadcast connection is write-only")
+
+func (b *broadcastConn) Write(p []byte) (int, error) {
+	select {
+	case <-b.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	if b.h.isDown() {
+		return len(p), nil // lost on the wire, like UDP
+	}
+	from := &net.UDPAddr{IP: b.h.ip, Port: udpPort}
+	for _, h := range b.h.nw.all() {
+		h.deliver(p, from)
+	}
+	return len(p), nil
+}
+
+func (b *broadcastConn) Read(p []byte) (int, error) { return 0, errWriteOnly }
+
+func (b *broadcastConn) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return nil
+}
+
+func (b *broadcastConn) LocalAddr() net.Addr { return &net.UDPAddr{IP: b.h.ip, Port: udpPort} }
+func (b *broadcastConn) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: udpPort}
+}
+func (b *broadcastConn) SetDeadline(t time.Time) error      { return nil }
+func (b *broadcastConn) SetReadDeadline(t time.Time) error  { return nil }
+func (b *broadcastConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"lan-chat/internal/store"
+)
+
+var configKeys = map[string]bool{"broker": true, "tls": true, "username": true, "password": true, "client_id": true, "prefix": true}
+
+// New is the bridge configured in the [mqtt] section of the config file at
+// configPath, for the instance called name. Without a file or an
+// mqtt.broker, Broker is "" and Start does nothing.
+func New(configPath, name string) (*Bridge, error) {
+	br := &Bridge{ClientID: "lan-chat-" + name, Prefix: "lan-chat/" + name}
+	if configPath == "" {
+		return br, nil
+	}
+	values, err := store.ParseFile(configPath)
+	if os.IsNotExist(err) {
+		return br, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for k := range values {
+		if key, ok := strings.CutPrefix(k, "mqtt."); ok && !configKeys[key] {
+			return nil, fmt.Errorf("%s: unknown key", k)
+		}
+	}
+	broker, ok := values["mqtt.broker"]
+	if !ok {
+		return br, nil
+	}
+	if _, _, err := net.SplitHostPort(broker); err != nil {
+		return nil, fmt.Errorf("mqtt.broker: must be host:port, got %q", broker)
+	}
+	br.Broker = broker
+	if v, ok := values["mqtt.tls"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("mqtt.tls: must be true or false, got %q", v)
+		}
+		br.TLS = b
+	}
+	br.Username, br.Password = values["mqtt.username"], values["mqtt.password"]
+	if v := values["mqtt.client_id"]; v != "" {
+		br.ClientID = v
+	}
+	if v, ok := values["mqtt.prefix"]; ok {
+		v = strings.TrimSuffix(v, "/")
+		if v == "" || strings.ContainsAny(v, "#+") {
+			return nil, fmt.Errorf("mqtt.prefix: must be a topic without wildcards, got %q", values["mqtt.prefix"])
+		}
+		br.Prefix = v
+	}
+	return br, nil
+}
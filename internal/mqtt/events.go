@@ -0,0 +1,91 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"lan-chat/internal/node"
+)
+
+// File is the payload on <prefix>/file
+type File struct {
+	Time      time.Time `json:"time"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"` // absolute path it was saved to
+	Peer      string    `json:"peer,omitempty"`
+	IP        string    `json:"ip"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// Transfer is the payload on <prefix>/transfer
+type Transfer struct {
+	Peer  string `json:"peer,omitempty"`
+	IP    string `json:"ip"`
+	Name  string `json:"name"`
+	Sent  int64  `json:"sent"`
+	Total int64  `json:"total"`
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// Error is the payload on <prefix>/error
+type Error struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+func errorPayload(err error) []byte {
+	b, _ := json.Marshal(Error{Time: time.Now(), Error: err.Error()})
+	return b
+}
+
+// toMessage is the topic (under the prefix, without it) and payload for a
+// node event, or false for ones that aren't published
+func toMessage(b Backend, ev node.Event) (string, []byte, bool) {
+	name := func(ip string) string {
+		if p, ok := b.Lookup(ip); ok {
+			return p.Name
+		}
+		return ""
+	}
+	peer := func(ip string) node.PeerInfo {
+		if p, ok := b.Lookup(ip); ok {
+			return p
+		}
+		return node.PeerInfo{IP: ip}
+	}
+	var topic string
+	var v interface{}
+	switch ev := ev.(type) {
+	case node.PeerFound:
+		topic, v = "peer", peer(ev.Peer.IP)
+	case node.PeerVerified:
+		topic, v = "peer", peer(ev.IP)
+	case node.PeerHealth:
+		topic, v = "peer", peer(ev.IP)
+	case node.ChatReceived:
+		if ev.Err != nil {
+			topic, v = "error", Error{Time: time.Now(), Error: "message from " + ev.Sender + ": " + ev.Err.Error()}
+			break
+		}
+		topic, v = "message", node.Message{Time: ev.Time, Peer: ev.Sender, IP: ev.From, Text: ev.Text, Encrypted: ev.Encrypted, Group: ev.Group}
+	case node.ChatSent:
+		topic, v = "message", ev.Message
+	case node.FileReceived:
+		path, _ := filepath.Abs(ev.Path)
+		topic, v = "file", File{Time: time.Now(), Name: ev.Name, Path: path, Peer: name(ev.From), IP: ev.From, Encrypted: ev.Encrypted}
+	case node.TransferProgress:
+		t := Transfer{Peer: name(ev.IP), IP: ev.IP, Name: ev.Name, Sent: ev.Sent, Total: ev.Total, Done: ev.Done}
+		if ev.Err != nil {
+			t.Error = ev.Err.Error()
+		}
+		topic, v = "transfer", t
+	case node.ServerError:
+		topic, v = "error", Error{Time: time.Now(), Error: ev.Err.Error()}
+	default:
+		return "", nil, false
+	}
+	payload, err := json.Marshal(v)
+	return topic, payload, err == nil
+}
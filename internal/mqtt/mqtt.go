@@ -0,0 +1,243 @@
+// Package mqtt publishes node events to an MQTT broker and takes outgoing
+// messages and files from a command topic, so lan-chat can take part in
+// existing LAN automation (Home Assistant, Node-RED). It speaks just enough
+// MQTT 3.1.1 for that: QoS 0 publishes, one subscription, keepalive pings.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/node"
+)
+
+// Connection timing: dialing, the keepalive we ask the broker for, and the
+// reconnect backoff
+const (
+	dialTimeout = 10 * time.Second
+	keepAlive   = 60 * time.Second
+	retryMin    = 5 * time.Second
+	retryMax    = 5 * time.Minute
+)
+
+var errNotConnected = errors.New("not connected")
+
+// Backend is the node being bridged; *node.Node implements it
+type Backend interface {
+	Lookup(peer string) (node.PeerInfo, bool)
+	SendChat(ip, text string) error
+	SendFile(ip, path string) error
+	Subscribe(buffer int, policy bus.Policy) *bus.Subscription[node.Event]
+}
+
+// Bridge is the connection to one broker. Topics are under Prefix:
+//
+//	<prefix>/status    "online", or "offline" once we're gone (retained)
+//	<prefix>/peer      a peer was found, verified or changed reachability
+//	<prefix>/message   a chat message sent or received
+//	<prefix>/file      a file received
+//	<prefix>/transfer  progress of a file being sent
+//	<prefix>/error     something failed, including a bad command
+//	<prefix>/send      commands: {"peer": "alice", "text": "hi"} or
+//	                   {"peer": "alice", "file": "/abs/path"}
+type Bridge struct {
+	Broker   string // host:port, "" for no bridge
+	TLS      bool
+	Username string
+	Password string
+	ClientID string
+	Prefix   string
+	Logf     func(format string, v ...interface{}) // optional debug log
+
+	mu   sync.Mutex
+	conn net.Conn // set while connected
+}
+
+// Command is a message on <prefix>/send
+type Command struct {
+	Peer string `json:"peer"` // name or IP
+	Text string `json:"text,omitempty"`
+	File string `json:"file,omitempty"` // absolute path, read by the instance
+}
+
+func (br *Bridge) logf(format string, v ...interface{}) {
+	if br.Logf != nil {
+		br.Logf(format, v...)
+	}
+}
+
+// Start connects to the broker and publishes b's events in the background
+// until the process exits; it does nothing without a Broker. Events that
+// happen while the broker is unreachable are dropped, and so are events the
+// connection can't keep up with: the node never waits for the broker.
+func (br *Bridge) Start(b Backend) {
+	if br.Broker == "" {
+		return
+	}
+	sub := b.Subscribe(node.DefaultBuffer, bus.DropNewest)
+	go func() {
+		for ev := range sub.Events() {
+			if topic, payload, ok := toMessage(b, ev); ok {
+				br.publish(br.Prefix+"/"+topic, payload)
+			}
+		}
+	}()
+	go func() {
+		delay := retryMin
+		for {
+			start := time.Now()
+			err := br.run(b)
+			if time.Since(start) > retryMax {
+				delay = retryMin
+			}
+			br.logf("MQTT %s: %v; reconnecting in %v", br.Broker, err, delay)
+			time.Sleep(delay)
+			delay = min(delay*2, retryMax)
+		}
+	}()
+}
+
+// run connects, subscribes to the command topic and handles commands until
+// the connection fails
+func (br *Bridge) run(b Backend) error {
+	d := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if br.TLS {
+		host, _, _ := net.SplitHostPort(br.Broker)
+		conn, err = tls.DialWithDialer(d, "tcp", br.Broker, &tls.Config{ServerName: host})
+	} else {
+		conn, err = d.Dial("tcp", br.Broker)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	status := br.Prefix + "/status"
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	hello := connectPacket(br.ClientID, br.Username, br.Password, status, "offline", uint16(keepAlive/time.Second))
+	if _, err := conn.Write(hello.encode()); err != nil {
+		return err
+	}
+	ack, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if ack.kind != typeConnack || len(ack.body) < 2 {
+		return fmt.Errorf("expected CONNACK, got packet type %d", ack.kind)
+	}
+	if code := int(ack.body[1]); code != 0 {
+		if code < len(connackErrors) {
+			return fmt.Errorf("broker refused the connection: %s", connackErrors[code])
+		}
+		return fmt.Errorf("broker refused the connection: code %d", code)
+	}
+	conn.SetDeadline(time.Time{})
+	if _, err := conn.Write(subscribePacket(1, br.Prefix+"/send").encode()); err != nil {
+		return err
+	}
+
+	br.mu.Lock()
+	br.conn = conn
+	br.mu.Unlock()
+	defer func() {
+		br.mu.Lock()
+		br.conn = nil
+		br.mu.Unlock()
+	}()
+	br.logf("MQTT %s: connected, publishing under %s/", br.Broker, br.Prefix)
+	br.publishRetained(status, []byte("online"))
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		t := time.NewTicker(keepAlive / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				br.write(packet{kind: typePingreq})
+			}
+		}
+	}()
+
+	for {
+		// The broker drops us after 1.5 keepalives without a packet, and
+		// our pings get answered, so silence this long means it's gone
+		conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		p, err := readPacket(r)
+		if err != nil {
+			return err
+		}
+		if p.kind != typePublish {
+			continue // SUBACK, PINGRESP, PUBACK
+		}
+		topic, id, payload, err := parsePublish(p)
+		if err != nil {
+			return err
+		}
+		if id != 0 { // QoS 1 from a broker that upgraded us
+			br.write(packet{kind: typePuback, body: []byte{byte(id >> 8), byte(id)}})
+		}
+		if topic == br.Prefix+"/send" {
+			go br.command(b, payload)
+		}
+	}
+}
+
+// command runs one message from the command topic
+func (br *Bridge) command(b Backend, payload []byte) {
+	var c Command
+	err := json.Unmarshal(payload, &c)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("bad command: %v", err)
+	case c.Peer == "" || (c.Text == "") == (c.File == ""):
+		err = errors.New(`bad command: need "peer" and one of "text" or "file"`)
+	default:
+		p, ok := b.Lookup(c.Peer)
+		if !ok {
+			err = fmt.Errorf("no peer named %q", c.Peer)
+		} else if c.Text != "" {
+			err = b.SendChat(p.IP, c.Text)
+		} else {
+			err = b.SendFile(p.IP, c.File)
+		}
+	}
+	if err != nil {
+		br.publish(br.Prefix+"/error", errorPayload(err))
+	}
+}
+
+// publish sends a QoS 0 message, dropping it while disconnected
+func (br *Bridge) publish(topic string, payload []byte) {
+	if err := br.write(publishPacket(topic, payload, false)); err != nil && err != errNotConnected {
+		br.logf("MQTT publish %s: %v", topic, err)
+	}
+}
+
+func (br *Bridge) publishRetained(topic string, payload []byte) {
+	br.write(publishPacket(topic, payload, true))
+}
+
+func (br *Bridge) write(p packet) error {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if br.conn == nil {
+		return errNotConnected
+	}
+	br.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err := br.conn.Write(p.encode())
+	return err
+}
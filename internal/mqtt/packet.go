@@ -0,0 +1,152 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The MQTT 3.1.1 control packets the bridge sends or reads
+const (
+	typeConnect   = 1
+	typeConnack   = 2
+	typePublish   = 3
+	typePuback    = 4
+	typeSubscribe = 8
+	typeSuback    = 9
+	typePingreq   = 12
+	typePingresp  = 13
+)
+
+// maxPacket bounds what we read from the broker; commands are small
+const maxPacket = 1 << 20
+
+// packet is one control packet: the fixed header's type and flags, and
+// everything after the remaining length
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+func (p packet) encode() []byte {
+	out := []byte{p.kind<<4 | p.flags}
+	n := len(p.body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, p.body...)
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return packet{}, errors.New("malformed remaining length")
+		}
+	}
+	if n > maxPacket {
+		return packet{}, fmt.Errorf("packet of %d bytes is too big", n)
+	}
+	p := packet{kind: first >> 4, flags: first & 0x0f, body: make([]byte, n)}
+	_, err = io.ReadFull(r, p.body)
+	return p, err
+}
+
+// str appends an MQTT string: a two-byte length, then the bytes
+func str(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// connectPacket logs in with a clean session and a retained will
+func connectPacket(clientID, username, password, willTopic, willPayload string, keepAlive uint16) packet {
+	flags := byte(0x02 | 0x04 | 0x20) // clean session, will, will retain
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+	b := str(nil, "MQTT")
+	b = append(b, 4, flags) // protocol level 4 is 3.1.1
+	b = binary.BigEndian.AppendUint16(b, keepAlive)
+	b = str(b, clientID)
+	b = str(b, willTopic)
+	b = str(b, willPayload)
+	if username != "" {
+		b = str(b, username)
+	}
+	if password != "" {
+		b = str(b, password)
+	}
+	return packet{kind: typeConnect, body: b}
+}
+
+// publishPacket is a QoS 0 publish
+func publishPacket(topic string, payload []byte, retain bool) packet {
+	var flags byte
+	if retain {
+		flags = 0x01
+	}
+	return packet{kind: typePublish, flags: flags, body: append(str(nil, topic), payload...)}
+}
+
+// subscribePacket asks for topic at QoS 0
+func subscribePacket(id uint16, topic string) packet {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	b = append(str(b, topic), 0)
+	return packet{kind: typeSubscribe, flags: 0x02, body: b}
+}
+
+// parsePublish splits an incoming publish into topic, packet ID (0 for
+// QoS 0) and payload
+func parsePublish(p packet) (topic string, id uint16, payload []byte, err error) {
+	b := p.body
+	if len(b) < 2 {
+		return "", 0, nil, errors.New("short publish")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", 0, nil, errors.New("short publish")
+	}
+	topic, b = string(b[2:2+n]), b[2+n:]
+	if qos := p.flags >> 1 & 0x03; qos > 0 {
+		if len(b) < 2 {
+			return "", 0, nil, errors.New("short publish")
+		}
+		id, b = binary.BigEndian.Uint16(b), b[2:]
+	}
+	return topic, id, b, nil
+}
+
+// connackErrors are the CONNACK return codes after 0 (accepted)
+var connackErrors = []string{
+	1: "unacceptable protocol version",
+	2: "client ID rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
@@ -0,0 +1,714 @@
+// Package node runs one LAN-CHAT peer without any user interface:
+// discovery, the heartbeat, password checks and the TCP server. Front ends
+// (the TUI, the headless daemon) read its events and send through it.
+package node
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/crash"
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/protocol"
+	"lan-chat/internal/store"
+)
+
+// Event is one of the types below, published in order on the node's bus
+type Event interface{ nodeEvent() }
+
+func (ListenerUp) nodeEvent()       {}
+func (PeerFound) nodeEvent()        {}
+func (PeerLost) nodeEvent()         {}
+func (PeerVerified) nodeEvent()     {}
+func (PeerIdentified) nodeEvent()   {}
+func (PeerTagged) nodeEvent()       {}
+func (PeerHealth) nodeEvent()       {}
+func (PeerLatency) nodeEvent()      {}
+func (ChatReceived) nodeEvent()     {}
+func (FileReceived) nodeEvent()     {}
+func (ChatSent) nodeEvent()         {}
+func (TransferProgress) nodeEvent() {}
+func (ReceiveProgress) nodeEvent()  {}
+func (FileOffered) nodeEvent()      {}
+func (OfferExpired) nodeEvent()     {}
+func (ServerError) nodeEvent()      {}
+
+// DefaultBuffer is a good Subscribe buffer for API streams: enough for a
+// burst of discovery and transfer progress
+const DefaultBuffer = 256
+
+// ListenerUp reports whether a listening socket ("UDP" discovery or "TCP"
+// server) could be opened; Err is nil when it is up
+type ListenerUp struct {
+	Proto string
+	Port  string
+	Err   error
+}
+
+// PeerFound is a newly discovered peer, or one back after PeerLost
+type PeerFound struct{ Peer discovery.Peer }
+
+// PeerLost is a peer that stopped announcing itself for
+// discovery.OfflineAfter: it quit or left the network. It is gone from
+// Peers until it announces itself again.
+type PeerLost struct {
+	Peer     discovery.Peer
+	LastSeen time.Time
+}
+
+// PeerVerified is the result of the password check with a peer
+type PeerVerified struct {
+	IP     string
+	Secure bool
+}
+
+// PeerIdentified is the result of the identity key check with a peer.
+// Changed means its name is pinned to a different key: lan-chat was
+// reinstalled there, or someone else is using the name.
+type PeerIdentified struct {
+	IP, Name string
+	Key      string // fingerprint of the key the peer holds
+	Pinned   string // fingerprint pinned to the name, set when Changed
+	Changed  bool
+}
+
+// PeerTagged is a known peer's tags being replaced by SetTags
+type PeerTagged struct {
+	Name string
+	Tags []string
+}
+
+// PeerHealth reports a peer's reachability whenever it changes
+type PeerHealth struct {
+	IP        string
+	Reachable bool
+}
+
+// PeerLatency reports the smoothed round trip of a reachable peer's
+// heartbeat ping, every HeartbeatInterval
+type PeerLatency struct {
+	IP  string
+	RTT time.Duration
+}
+
+// ChatReceived and FileReceived are what the TCP server received
+type ChatReceived struct{ protocol.Chat }
+type FileReceived struct{ protocol.File }
+
+// ChatSent is a message we sent, from any front end
+type ChatSent struct{ Message }
+
+// TransferProgress reports an outgoing file every progressInterval and once
+// more when it finishes (Done, with Err set if it failed)
+type TransferProgress struct {
+	IP, Name    string
+	Sent, Total int64
+	Done        bool
+	Err         error
+}
+
+// ReceiveProgress reports an incoming file every progressInterval while
+// it arrives; FileReceived, or ServerError with a *protocol.FileError, ends
+// it. Total is the size the sender announced, -1 from an older one.
+type ReceiveProgress struct {
+	IP, Name        string
+	Received, Total int64
+}
+
+// FileOffered is an incoming file waiting to be accepted or declined with
+// AnswerOffer; nothing of it is read until then. Exists is a file already
+// saved under its name, which it can replace or be kept beside.
+type FileOffered struct {
+	ID int
+	protocol.Offer
+	Exists bool
+}
+
+// Answer is what AnswerOffer does with a FileOffered
+type Answer int
+
+const (
+	Decline Answer = iota
+	Accept         // under a numbered name if one is saved under its own
+	Replace        // over a file saved under the same name
+)
+
+// OfferExpired is a FileOffered nobody answered within OfferTimeout; the
+// file was refused
+type OfferExpired struct{ ID int }
+
+// OfferTimeout is how long a FileOffered waits for AnswerOffer
+const OfferTimeout = 2 * time.Minute
+
+// progressInterval throttles TransferProgress events
+const progressInterval = 200 * time.Millisecond
+
+// ServerError is a failure on an incoming connection, usually a
+// *protocol.FileError
+type ServerError struct{ Err error }
+
+// PeerInfo is what the node knows about a peer
+type PeerInfo struct {
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	Port      string `json:"port,omitempty"` // the TCP port it announced, "" for protocol.Port
+	Secure    bool   `json:"secure"`         // password verified, traffic is encrypted
+	Reachable bool   `json:"reachable"`      // answered the last heartbeat
+	// Identity key fingerprint once checked, and whether it differs from
+	// the one pinned to the name
+	Key        string   `json:"key,omitempty"`
+	KeyChanged bool     `json:"key_changed,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	// Smoothed heartbeat round trip, zero until measured or while
+	// unreachable
+	RTT time.Duration `json:"rtt_ns,omitempty"`
+
+	pub string // the key itself, hex, for TrustKey
+}
+
+// Message is a chat message the node sent or received
+type Message = store.Message
+
+// historyLimit bounds the history kept without a DB; older messages are
+// dropped
+const historyLimit = 1000
+
+// Node is a running peer. Create it with New and call Start once.
+type Node struct {
+	Name     string
+	Password string
+	Dir      string                                // where received files are saved, "" for the working directory
+	DirFor   func(name string) string              // optional: the folder for a received file by its name, "" for Dir
+	Logf     func(format string, v ...interface{}) // optional debug log
+	Identity ed25519.PrivateKey                    // answers peers' identity checks; nil answers none
+	DB       *store.DB                             // history, transfers and known peers; nil keeps recent history in memory and no peers
+	// NoHistory keeps messages in memory and transfers nowhere, as
+	// without a DB, while the DB still holds the known peers
+	NoHistory bool
+	// FilePolicy is what files from a peer without a Files preference get:
+	// "accept" (or ""), "ask" or "refuse"
+	FilePolicy string
+	// Collision is what a received file whose name is taken does:
+	// "rename" (or "") to a numbered name, "overwrite" the old one, or
+	// "ask" with a FileOffered
+	Collision string
+
+	// The network the node runs on; nil means the real UDP and TCP
+	// sockets. Set them before Start, e.g. to an in-memory network.
+	Discoverer discovery.Discoverer
+	Dialer     protocol.Dialer
+	Listener   protocol.Listener
+
+	fingerprint string
+	pool        *protocol.Pool // connections to peers kept between requests
+	bus         *bus.Bus[Event]
+	events      *bus.Subscription[Event]
+	started     time.Time
+
+	mu      sync.Mutex
+	peers   map[string]*PeerInfo // by IP
+	history []Message
+	known   []store.KnownPeer   // the roster, in the order first seen
+	offers  map[int]chan Answer // files waiting for AnswerOffer, by ID
+	offerID int                 // the last FileOffered's
+}
+
+// New prepares a node; nothing is opened until Start
+func New(name, password string) *Node {
+	n := &Node{Name: name, Password: password, pool: protocol.NewPool(), bus: bus.New[Event](), peers: make(map[string]*PeerInfo), started: time.Now()}
+	n.events = n.bus.Subscribe(64, bus.Block)
+	if password != "" {
+		n.fingerprint = crypto.Fingerprint(password)
+	}
+	return n
+}
+
+// Events is the front end's own subscription, open from New so nothing
+// is missed before it starts reading. It blocks: once its buffer is full
+// the network goroutines wait until events are taken.
+func (n *Node) Events() <-chan Event { return n.events.Events() }
+
+// Subscribe returns a copy of every event from now on, for extra consumers
+// such as API streams and hooks. policy says what happens when the
+// subscriber falls behind; bus.Block stalls the node, so only use it for
+// consumers that never wait on anything else. Close the subscription when
+// done.
+func (n *Node) Subscribe(buffer int, policy bus.Policy) *bus.Subscription[Event] {
+	return n.bus.Subscribe(buffer, policy)
+}
+
+func (n *Node) emit(ev Event) { n.bus.Publish(ev) }
+
+func (n *Node) logf(format string, v ...interface{}) {
+	if n.Logf != nil {
+		n.Logf(format, v...)
+	}
+}
+
+func (n *Node) discoverer() discovery.Discoverer {
+	if n.Discoverer != nil {
+		return n.Discoverer
+	}
+	return discovery.UDP{}
+}
+
+func (n *Node) client() protocol.Client {
+	if n.Dialer != nil {
+		return protocol.Client{Dialer: n.Dialer, Pool: n.pool}
+	}
+	return protocol.Client{Dialer: protocol.TCP{}, Pool: n.pool}
+}
+
+func (n *Node) listen() (net.Listener, error) {
+	if n.Listener != nil {
+		return n.Listener.Listen()
+	}
+	return protocol.Listen()
+}
+
+// Start announces the node and opens the discovery and TCP listeners in the
+// background
+func (n *Node) Start() {
+	if n.DB != nil {
+		n.known = n.DB.Peers()
+	}
+	announcer := discovery.NewAnnouncer(n.discoverer(), n.Name)
+	if n.Listener == nil {
+		announcer.TCPPort = protocol.Port
+	}
+	go func() {
+		defer crash.Recover("UDP discovery")
+		l, err := discovery.ListenOn(n.discoverer(), n.Name)
+		n.emit(ListenerUp{Proto: "UDP", Port: discovery.Port, Err: err})
+		if err != nil {
+			return
+		}
+		l.Logf, l.Asked, l.Lost = n.Logf, announcer.Now, n.lost
+		go func() {
+			defer crash.Recover("heartbeat")
+			discovery.Heartbeat(l, n.ping, func(ip string, reachable bool) {
+				n.update(ip, func(p *PeerInfo) {
+					if p.Reachable = reachable; !reachable {
+						p.RTT = 0
+					}
+				})
+				n.emit(PeerHealth{IP: ip, Reachable: reachable})
+			})
+		}()
+		l.Run(func(p discovery.Peer) {
+			if p.Name == store.Everyone {
+				n.logf("Ignoring peer %s named like the group conversation", p.IP)
+				return
+			}
+			protocol.SetPeerPort(p.IP, p.Port)
+			n.mu.Lock()
+			n.peers[p.IP] = &PeerInfo{Name: p.Name, IP: p.IP, Port: p.Port, Reachable: true}
+			n.seen(p)
+			n.mu.Unlock()
+			n.savePeer(p.Name)
+			n.emit(PeerFound{Peer: p})
+			// It may have just started, and not heard from us yet
+			announcer.Now()
+			go func() {
+				n.identify(p.IP)
+				if n.fingerprint != "" {
+					n.verify(p.IP)
+				} else {
+					n.logf("No password set, skipping verification for %s", p.Name)
+				}
+			}()
+		})
+	}()
+	go func() {
+		defer crash.Recover("TCP server")
+		ln, err := n.listen()
+		n.emit(ListenerUp{Proto: "TCP", Port: protocol.Port, Err: err})
+		// Announce only once peers can connect, or the VERIFY they send
+		// on discovery is refused and we stay unverified
+		go announcer.Run()
+		if err != nil {
+			return
+		}
+		srv := &protocol.Server{Password: n.Password, Fingerprint: n.fingerprint, Identity: n.Identity, Handler: handler{n}, Dir: n.Dir, Accept: n.acceptFile, Progress: n.receiving, Logf: n.Logf}
+		srv.Serve(ln)
+	}()
+}
+
+func (n *Node) verify(ip string) {
+	defer crash.Recover("verify")
+	n.logf("Verifying peer %s...", ip)
+	c := n.client()
+	match, err := c.Pake(ip, n.Password)
+	pake := err == nil
+	if errors.Is(err, protocol.ErrNoPake) {
+		if n.knowsPake(ip) {
+			// Someone between us may be hanging up to get a check they
+			// can test guesses against
+			n.logf("%s answered PAKE before, not falling back to the older checks", ip)
+		} else {
+			match, err = c.VerifySalted(ip, n.Password)
+		}
+	}
+	if err != nil {
+		n.logf("Verify failed for %s: %v", ip, err)
+	} else {
+		n.logf("Verify result for %s: match=%v", ip, match)
+	}
+	name := ""
+	n.update(ip, func(p *PeerInfo) {
+		p.Secure, name = match, p.Name
+		if k := n.knownPeer(p.Name); k != nil {
+			k.Verified = match
+			k.Pake = k.Pake || pake
+		}
+	})
+	n.savePeer(name)
+	n.emit(PeerVerified{IP: ip, Secure: match})
+}
+
+// knowsPake reports whether the peer at ip has answered PAKE before
+func (n *Node) knowsPake(ip string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	p, ok := n.peers[ip]
+	if !ok {
+		return false
+	}
+	k := n.knownPeer(p.Name)
+	return k != nil && k.Pake
+}
+
+func (n *Node) update(ip string, f func(p *PeerInfo)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if p, ok := n.peers[ip]; ok {
+		f(p)
+	}
+}
+
+// ping is the heartbeat's ping: it times the round trip too and folds it
+// into PeerInfo.RTT, weighting the newest measurement by a quarter so one
+// slow answer doesn't reorder a list sorted by latency
+func (n *Node) ping(ip string) bool {
+	rtt, err := n.client().RTT(ip)
+	if err != nil {
+		return false
+	}
+	var smoothed time.Duration
+	n.update(ip, func(p *PeerInfo) {
+		if p.RTT == 0 {
+			p.RTT = rtt
+		} else {
+			p.RTT = (3*p.RTT + rtt) / 4
+		}
+		smoothed = p.RTT
+	})
+	if smoothed > 0 {
+		n.emit(PeerLatency{IP: ip, RTT: smoothed})
+	}
+	return true
+}
+
+// handler forwards what the TCP server receives as events
+type handler struct{ n *Node }
+
+func (h handler) Chat(c protocol.Chat) {
+	c.Time = h.n.stamp(c.Time)
+	if c.Err == nil {
+		// Filed under the peer at its address, not the name it claims
+		peer := c.From
+		if p, ok := h.n.Lookup(c.From); ok {
+			peer = p.Name
+		}
+		h.n.record(Message{Time: c.Time, Peer: peer, IP: c.From, Text: c.Text, Encrypted: c.Encrypted, Group: c.Group})
+	}
+	h.n.emit(ChatReceived{c})
+}
+
+// maxClockSkew is how far a sender's clock may be from ours for a message
+// to keep the time it was sent at
+const maxClockSkew = 5 * time.Minute
+
+// stamp is the time to keep a received message under: the sender's, so
+// both sides agree, unless it has none, or its clock is more than
+// maxClockSkew out or puts the message before this node started, in the
+// history of an earlier run; then it is now
+func (n *Node) stamp(sent time.Time) time.Time {
+	now := time.Now()
+	if sent.IsZero() || sent.After(now.Add(maxClockSkew)) || sent.Before(now.Add(-maxClockSkew)) || sent.Before(n.started) {
+		return now
+	}
+	return sent
+}
+
+func (h handler) File(f protocol.File) {
+	t := store.Transfer{IP: f.From, Name: f.Name, Path: f.Path, Encrypted: f.Encrypted}
+	if fi, err := os.Stat(f.Path); err == nil {
+		t.Size = fi.Size()
+	}
+	h.n.recordTransfer(t)
+	h.n.emit(FileReceived{f})
+}
+
+func (h handler) Error(err error) { h.n.emit(ServerError{err}) }
+
+func (n *Node) receiving(o protocol.Offer, received int64) {
+	n.emit(ReceiveProgress{IP: o.From, Name: o.Name, Received: received, Total: o.Size})
+}
+
+// Peers lists the discovered peers by name
+func (n *Node) Peers() []PeerInfo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	peers := make([]PeerInfo, 0, len(n.peers))
+	for _, p := range n.peers {
+		peers = append(peers, *p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return strings.ToLower(peers[i].Name) < strings.ToLower(peers[j].Name) })
+	return peers
+}
+
+// Lookup finds a peer by name (case-insensitive) or IP
+func (n *Node) Lookup(peer string) (PeerInfo, bool) {
+	for _, p := range n.Peers() {
+		if p.IP == peer || strings.EqualFold(p.Name, peer) {
+			return p, true
+		}
+	}
+	return PeerInfo{}, false
+}
+
+// Status is the control socket's STATUS fields: name, whether --pass is
+// set, how many peers have been discovered and the absolute path of Dir
+func (n *Node) Status() []string {
+	dir, _ := filepath.Abs(n.Dir)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return []string{n.Name, strconv.FormatBool(n.Password != ""), strconv.Itoa(len(n.peers)), dir}
+}
+
+// password is what to encrypt with for ip: ours once the peer is verified,
+// otherwise "" to send in the clear like the TUI does
+func (n *Node) password(ip string) string {
+	if p, ok := n.Lookup(ip); ok && p.Secure {
+		return n.Password
+	}
+	return ""
+}
+
+// SendChat sends a chat message to the peer at ip
+func (n *Node) SendChat(ip, text string) error {
+	return n.SendChatContext(context.Background(), ip, text)
+}
+
+// SendChatContext is SendChat, given up on once ctx is done
+func (n *Node) SendChatContext(ctx context.Context, ip, text string) error {
+	password, at := n.password(ip), time.Now()
+	if err := n.client().SendChatContext(ctx, ip, n.Name, text, password, at); err != nil {
+		return err
+	}
+	name := ip
+	if p, ok := n.Lookup(ip); ok {
+		name = p.Name
+	}
+	n.emit(ChatSent{n.record(Message{Time: at, Peer: name, IP: ip, Sent: true, Text: text, Encrypted: password != ""})})
+	return nil
+}
+
+// ErrNoPeers is a group message with nobody reachable to send it to
+var ErrNoPeers = errors.New("no peer is reachable")
+
+// SendGroupChat sends text to every reachable peer at once, each encrypted
+// as SendChat would, and records it once in the Everyone conversation. It
+// counts as sent if any peer got it; the others are in the error, joined,
+// each naming its peer.
+func (n *Node) SendGroupChat(ctx context.Context, text string) error {
+	var peers []PeerInfo
+	for _, p := range n.Peers() {
+		if p.Reachable {
+			peers = append(peers, p)
+		}
+	}
+	if len(peers) == 0 {
+		return ErrNoPeers
+	}
+	errs := make([]error, len(peers))
+	at := time.Now()
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.client().SendGroupChatContext(ctx, p.IP, n.Name, text, n.password(p.IP), at); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", p.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	// Encrypted only if every copy was
+	sent, encrypted := 0, true
+	for i, p := range peers {
+		if errs[i] == nil {
+			sent++
+			encrypted = encrypted && n.password(p.IP) != ""
+		}
+	}
+	if sent > 0 {
+		n.emit(ChatSent{n.record(Message{Time: at, Peer: store.Everyone, Sent: true, Text: text, Encrypted: encrypted, Group: true})})
+	}
+	return errors.Join(errs...)
+}
+
+// keepsHistory reports whether messages and transfers go to the DB
+func (n *Node) keepsHistory() bool { return n.DB != nil && !n.NoHistory }
+
+// record keeps m in the history, stamped now unless it has a time
+func (n *Node) record(m Message) Message {
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	if n.keepsHistory() {
+		if err := n.DB.AddMessage(m); err != nil {
+			n.logf("Saving message: %v", err)
+		}
+		return m
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.history = append(n.history, m)
+	if len(n.history) > historyLimit {
+		n.history = n.history[len(n.history)-historyLimit:]
+	}
+	return m
+}
+
+// recordTransfer saves a finished transfer to the DB, naming the peer
+func (n *Node) recordTransfer(t store.Transfer) {
+	if !n.keepsHistory() {
+		return
+	}
+	t.Time, t.Peer = time.Now(), t.IP
+	if p, ok := n.Lookup(t.IP); ok {
+		t.Peer = p.Name
+	}
+	if err := n.DB.AddTransfer(t); err != nil {
+		n.logf("Saving transfer: %v", err)
+	}
+}
+
+// History is the messages exchanged with peer (a name or IP, or
+// store.Everyone for the group's), or every message if peer is "", oldest
+// first
+func (n *Node) History(peer string) []Message {
+	if n.keepsHistory() {
+		return n.DB.Messages(peer)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var out []Message
+	for _, m := range n.history {
+		if m.With(peer) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Search is the History messages containing every word of query, ignoring
+// case
+func (n *Node) Search(peer, query string) []Message {
+	if n.keepsHistory() {
+		return n.DB.Search(peer, query)
+	}
+	var out []Message
+	for _, m := range n.History(peer) {
+		if store.ContainsWords(m.Text, query) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Transfers is the files sent to and received from peer, or everyone if
+// peer is "", oldest first; they are only kept with a DB
+func (n *Node) Transfers(peer string) []store.Transfer {
+	if !n.keepsHistory() {
+		return nil
+	}
+	return n.DB.Transfers(peer)
+}
+
+// SendFile sends the file at path to the peer at ip, emitting
+// TransferProgress as it goes
+func (n *Node) SendFile(ip, path string) error {
+	return n.SendFileContext(context.Background(), ip, path, nil)
+}
+
+// SendFileContext is SendFile, given up on once ctx is done. progress, if
+// set, is also called with each TransferProgress, on the sending goroutine.
+func (n *Node) SendFileContext(ctx context.Context, ip, path string, progress func(TransferProgress)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pr := &progressReader{f: f, n: n, ev: TransferProgress{IP: ip, Name: fi.Name(), Total: fi.Size()}, progress: progress}
+	password := n.password(ip)
+	err = n.client().SendFileContext(ctx, ip, fi.Name(), pr, password)
+	pr.ev.Done, pr.ev.Err = true, err
+	pr.report()
+	t := store.Transfer{IP: ip, Sent: true, Name: fi.Name(), Size: fi.Size(), Encrypted: password != ""}
+	if err != nil {
+		t.Error = err.Error()
+	}
+	n.recordTransfer(t)
+	return err
+}
+
+// progressReader counts what Client.SendFile reads from the file
+type progressReader struct {
+	f        *os.File
+	n        *Node
+	ev       TransferProgress
+	progress func(TransferProgress)
+	last     time.Time
+}
+
+func (p *progressReader) report() {
+	p.n.emit(p.ev)
+	if p.progress != nil {
+		p.progress(p.ev)
+	}
+}
+
+// Size is the file's, for the client to announce
+func (p *progressReader) Size() int64 { return p.ev.Total }
+
+// ReadAt reads the file without counting it, for the client's checksum
+func (p *progressReader) ReadAt(b []byte, off int64) (int, error) { return p.f.ReadAt(b, off) }
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	k, err := p.f.Read(b)
+	p.ev.Sent += int64(k)
+	if time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.report()
+	}
+	return k, err
+}
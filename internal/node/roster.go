@@ -0,0 +1,308 @@
+package node
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"lan-chat/internal/crash"
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/protocol"
+	"lan-chat/internal/store"
+)
+
+// maxIPs bounds the addresses remembered per known peer
+const maxIPs = 4
+
+// savePeer writes the roster entry for name to the DB, if there is one
+func (n *Node) savePeer(name string) {
+	if n.DB == nil {
+		return
+	}
+	// Under the lock, so two saves of the same peer land in order
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if k := n.knownPeer(name); k != nil {
+		if err := n.DB.PutPeer(*k); err != nil {
+			n.logf("Saving known peer %s: %v", name, err)
+		}
+	}
+}
+
+// knownPeer is the roster entry for name, nil if there is none. Call it
+// with n.mu held.
+func (n *Node) knownPeer(name string) *store.KnownPeer {
+	for i := range n.known {
+		if strings.EqualFold(n.known[i].Name, name) {
+			return &n.known[i]
+		}
+	}
+	return nil
+}
+
+// seen records a discovered peer in the roster and gives its PeerInfo the
+// tags from there. Call it with n.mu held.
+func (n *Node) seen(p discovery.Peer) {
+	now := time.Now()
+	k := n.knownPeer(p.Name)
+	if k == nil {
+		n.known = append(n.known, store.KnownPeer{Name: p.Name, FirstSeen: now})
+		k = &n.known[len(n.known)-1]
+	}
+	ips := slices.DeleteFunc(slices.Clone(k.IPs), func(ip string) bool { return ip == p.IP })
+	if ips = append(ips, p.IP); len(ips) > maxIPs {
+		ips = ips[len(ips)-maxIPs:]
+	}
+	k.IPs, k.LastSeen = ips, now
+	if info, ok := n.peers[p.IP]; ok {
+		info.Tags = k.Tags
+	}
+}
+
+// identify checks the peer's identity key and pins it to the name the first
+// time. A peer without one (an older version) is left unidentified.
+func (n *Node) identify(ip string) {
+	defer crash.Recover("identify")
+	pub, err := n.client().Identify(ip)
+	if err != nil {
+		n.logf("Identity check with %s: %v", ip, err)
+		return
+	}
+	key := hex.EncodeToString(pub)
+	ev := PeerIdentified{IP: ip, Key: crypto.KeyFingerprint(pub)}
+	n.mu.Lock()
+	p, ok := n.peers[ip]
+	if !ok {
+		n.mu.Unlock()
+		return
+	}
+	ev.Name = p.Name
+	if k := n.knownPeer(p.Name); k != nil {
+		if k.Key == "" {
+			k.Key = key
+		} else if k.Key != key {
+			ev.Changed, ev.Pinned = true, fingerprintHex(k.Key)
+		}
+	}
+	p.Key, p.KeyChanged, p.pub = ev.Key, ev.Changed, key
+	n.mu.Unlock()
+	if ev.Changed {
+		n.logf("Identity key of %s (%s) changed: pinned %s, now %s", ev.Name, ip, ev.Pinned, ev.Key)
+	}
+	n.savePeer(ev.Name)
+	n.emit(ev)
+}
+
+func fingerprintHex(key string) string {
+	pub, err := hex.DecodeString(key)
+	if err != nil {
+		return key
+	}
+	return crypto.KeyFingerprint(ed25519.PublicKey(pub))
+}
+
+// Known lists the roster: every peer seen on this or an earlier run, with
+// its pinned key and tags, in the order first seen
+func (n *Node) Known() []store.KnownPeer {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return slices.Clone(n.known)
+}
+
+// TrustKey pins the key the peer (a name or IP) holds now in place of the
+// old one, after a PeerIdentified with Changed
+func (n *Node) TrustKey(peer string) error {
+	p, ok := n.Lookup(peer)
+	if !ok {
+		return fmt.Errorf("no peer %s", peer)
+	}
+	if p.pub == "" {
+		return errors.New(p.Name + " has no identity key")
+	}
+	n.mu.Lock()
+	if k := n.knownPeer(p.Name); k != nil {
+		k.Key = p.pub
+	}
+	for _, info := range n.peers {
+		if strings.EqualFold(info.Name, p.Name) {
+			info.KeyChanged = info.pub != p.pub
+		}
+	}
+	n.mu.Unlock()
+	n.savePeer(p.Name)
+	return nil
+}
+
+// SetTags replaces the tags of a known peer, a name or the IP of a
+// discovered one
+func (n *Node) SetTags(peer string, tags []string) error {
+	name := peer
+	if p, ok := n.Lookup(peer); ok {
+		name = p.Name
+	}
+	n.mu.Lock()
+	k := n.knownPeer(name)
+	if k == nil {
+		n.mu.Unlock()
+		return fmt.Errorf("no known peer %s", peer)
+	}
+	k.Tags = slices.Clone(tags)
+	for _, info := range n.peers {
+		if strings.EqualFold(info.Name, name) {
+			info.Tags = k.Tags
+		}
+	}
+	ev := PeerTagged{Name: k.Name, Tags: k.Tags}
+	n.mu.Unlock()
+	n.savePeer(name)
+	n.emit(ev)
+	return nil
+}
+
+// Prefs are the per-peer settings of a known peer, a name or the IP of a
+// discovered one; zero when there are none
+func (n *Node) Prefs(peer string) store.PeerPrefs {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if k := n.knownPeer(n.nameOf(peer)); k != nil {
+		return k.Prefs
+	}
+	return store.PeerPrefs{}
+}
+
+// SetPrefs replaces the per-peer settings of a known peer
+func (n *Node) SetPrefs(peer string, prefs store.PeerPrefs) error {
+	n.mu.Lock()
+	name := n.nameOf(peer)
+	k := n.knownPeer(name)
+	if k == nil {
+		n.mu.Unlock()
+		return fmt.Errorf("no known peer %s", peer)
+	}
+	k.Prefs = prefs
+	n.mu.Unlock()
+	n.savePeer(name)
+	return nil
+}
+
+// nameOf is the name of the discovered peer at IP peer, or peer itself.
+// Call it with n.mu held.
+func (n *Node) nameOf(peer string) string {
+	if p, ok := n.peers[peer]; ok {
+		return p.Name
+	}
+	return peer
+}
+
+// acceptFile is where the offered file is saved: the peer's own download
+// folder if it has one, else the folder DirFor picks for the file, else
+// Dir, and whether it replaces a file of the same name there. ok is false
+// when its files are refused, by the peer's Files preference or
+// FilePolicy, or when asked about it.
+func (n *Node) acceptFile(o protocol.Offer) (t protocol.Target, ok bool) {
+	prefs := n.Prefs(o.From)
+	policy := prefs.Files
+	if policy == "" {
+		policy = n.FilePolicy
+	}
+	if policy == "refuse" {
+		return protocol.Target{}, false
+	}
+	t.Dir = n.downloadDir(prefs, o)
+	_, err := os.Lstat(protocol.SavedPath(t.Dir, o.Name))
+	exists := err == nil
+	if policy != "ask" && !(exists && n.Collision == "ask") {
+		t.Overwrite = n.Collision == "overwrite"
+		return t, true
+	}
+	switch n.ask(o, exists) {
+	case Accept:
+		return t, true
+	case Replace:
+		t.Overwrite = true
+		return t, true
+	}
+	return protocol.Target{}, false
+}
+
+// downloadDir is the folder the offered file goes to, made if need be
+func (n *Node) downloadDir(prefs store.PeerPrefs, o protocol.Offer) string {
+	dir := prefs.DownloadDir
+	if dir == "" && n.DirFor != nil {
+		dir = n.DirFor(o.Name)
+	}
+	if dir == "" {
+		return n.Dir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		n.logf("Download folder for %s from %s: %v", o.Name, o.From, err)
+		return n.Dir
+	}
+	return dir
+}
+
+// ask emits FileOffered and waits for AnswerOffer, declining the file
+// when nobody answers within OfferTimeout
+func (n *Node) ask(o protocol.Offer, exists bool) Answer {
+	answer := make(chan Answer, 1)
+	n.mu.Lock()
+	if n.offers == nil {
+		n.offers = make(map[int]chan Answer)
+	}
+	n.offerID++
+	id := n.offerID
+	n.offers[id] = answer
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.offers, id)
+		n.mu.Unlock()
+	}()
+	n.logf("Asking about %s (%d bytes) from %s", o.Name, o.Size, o.From)
+	n.emit(FileOffered{ID: id, Offer: o, Exists: exists})
+	timeout := time.NewTimer(OfferTimeout)
+	defer timeout.Stop()
+	select {
+	case a := <-answer:
+		return a
+	case <-timeout.C:
+		n.logf("Nobody answered for %s from %s", o.Name, o.From)
+		n.emit(OfferExpired{ID: id})
+		return Decline
+	}
+}
+
+// AnswerOffer accepts, replaces with or declines the file of a
+// FileOffered. It returns false when the offer is no longer waiting.
+func (n *Node) AnswerOffer(id int, a Answer) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	answer, ok := n.offers[id]
+	if ok {
+		delete(n.offers, id)
+		answer <- a
+	}
+	return ok
+}
+
+// lost drops a peer that stopped announcing itself, noting in the roster
+// when it was last heard from
+func (n *Node) lost(p discovery.Peer, lastSeen time.Time) {
+	if p.Name == store.Everyone {
+		return // never found either
+	}
+	n.mu.Lock()
+	delete(n.peers, p.IP)
+	if k := n.knownPeer(p.Name); k != nil {
+		k.LastSeen = lastSeen
+	}
+	n.mu.Unlock()
+	n.savePeer(p.Name)
+	n.emit(PeerLost{Peer: p, LastSeen: lastSeen})
+}
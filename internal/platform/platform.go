@@ -0,0 +1,314 @@
+// Package platform keeps what differs between Linux, macOS and Windows in
+// one place: where lan-chat's files go, how a file is opened, a
+// notification shown or a secret kept, and where a discovery broadcast has
+// to be sent to reach the whole LAN. The rest of lan-chat asks here rather
+// than assume Linux.
+package platform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const appName = "lan-chat"
+
+// Profile is the --profile in use, "" for the default one. A profile has
+// its own config, data, state, log and cache directories
+// (lan-chat/profiles/<name> in each) and its own sockets, so two profiles
+// never share a file. Set it with SetProfile at startup.
+var Profile string
+
+// SetProfile switches to the named profile; "" is the default one
+func SetProfile(name string) error {
+	if name != "" && (strings.HasPrefix(name, ".") || strings.ContainsFunc(name, func(r rune) bool {
+		return !(r == '-' || r == '_' || r == '.' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+	})) {
+		return fmt.Errorf("profile %q: use letters, digits, '-', '_' and '.'", name)
+	}
+	Profile = name
+	return nil
+}
+
+// appDir is lan-chat's directory inside an OS directory, for the profile
+func appDir() string {
+	if Profile != "" {
+		return filepath.Join(appName, "profiles", Profile)
+	}
+	return appName
+}
+
+// LimitedBroadcast is the all-ones address; on Linux it reaches every host
+// on the LAN
+const LimitedBroadcast = "255.255.255.255"
+
+// Directories from [paths] in the config, each replacing the OS default of
+// DataDir, StateDir or LogDir when set. Set them at startup, before anything
+// opens a file.
+var (
+	DataDirOverride  string
+	StateDirOverride string
+	LogDirOverride   string
+)
+
+// ConfigDir is where config.toml, hooks/ and the other files the user edits
+// live: $XDG_CONFIG_HOME
+// (~/.config) on Linux, ~/Library/Application Support on macOS and
+// %AppData% on Windows, each with a lan-chat directory. It is "" if the OS
+// has no config directory.
+func ConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, appDir())
+}
+
+// DataDir is for what lan-chat accumulates rather than what the user edits,
+// the API token and exported chats: $XDG_DATA_HOME (~/.local/share) on
+// Linux, ~/Library/Application Support on macOS and %LocalAppData% on
+// Windows. "" if there is no home directory.
+func DataDir() string {
+	if DataDirOverride != "" {
+		return DataDirOverride
+	}
+	if dir := dataDir(); dir != "" {
+		return filepath.Join(dir, appDir())
+	}
+	return ""
+}
+
+// StateDir is for what carries over from one run to the next but isn't
+// worth a backup, state.toml and the session snapshot: $XDG_STATE_HOME
+// (~/.local/state) on Linux, the DataDir elsewhere
+func StateDir() string {
+	if StateDirOverride != "" {
+		return StateDirOverride
+	}
+	if dir := stateDir(); dir != "" {
+		return filepath.Join(dir, appDir())
+	}
+	return ""
+}
+
+// LogDir is where the debug log and crash reports go: the StateDir on
+// Linux, as XDG has it, ~/Library/Logs/lan-chat on macOS and a logs folder
+// in %LocalAppData%\lan-chat on Windows
+func LogDir() string {
+	if LogDirOverride != "" {
+		return LogDirOverride
+	}
+	return logDir()
+}
+
+// CacheDir is for what can be thrown away: $XDG_CACHE_HOME (~/.cache),
+// ~/Library/Caches or %LocalAppData%, or "" if the OS has none
+func CacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, appDir())
+}
+
+// RuntimeDir is where sockets go: $XDG_RUNTIME_DIR on Linux, which only the
+// user can read, and otherwise the temp directory (already per user on
+// macOS and Windows). A profile gets a lan-chat-<name> directory in it.
+func RuntimeDir() string {
+	dir := runtimeDir()
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if Profile != "" {
+		dir = filepath.Join(dir, appName+"-"+Profile)
+		os.MkdirAll(dir, 0700) // a failure shows when a socket is made there
+	}
+	return dir
+}
+
+// DownloadDir is the user's downloads folder: the XDG download directory on
+// Linux, ~/Downloads on macOS and Windows. Without one it is the home
+// directory, and "" if there is no home either.
+func DownloadDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	dir := downloadDir(home)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return home
+	}
+	return dir
+}
+
+// ExpandHome turns a leading ~/ in a path from the config file or the TUI
+// into the home directory
+func ExpandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// MoveOld moves what an earlier version kept at old to dest, unless dest
+// already exists, so an upgrade keeps it. Nothing at old is not an error.
+func MoveOld(old, dest string) error {
+	if old == dest || dest == "" {
+		return nil
+	}
+	if _, err := os.Lstat(old); err != nil {
+		return nil
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	return os.Rename(old, dest)
+}
+
+// ErrLocked is returned by Lock when another process holds the lock
+var ErrLocked = errors.New("locked by another process")
+
+// Lock takes an exclusive lock on f without waiting, held until f is closed
+// or the process exits, crash included
+func Lock(f *os.File) error { return lockFile(f) }
+
+// Open opens path, a file or a directory, in the desktop's default
+// application and returns without waiting for it
+func Open(path string) error {
+	cmd := openCmd(path)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// Notify shows a desktop notification and returns once it was handed to
+// the notifier: notify-send on Linux, osascript on macOS, a toast through
+// PowerShell on Windows. Title and body are passed as arguments, never as
+// code, so message text can't run anything.
+func Notify(title, body string) error {
+	out, err := notifyCmd(title, body).CombinedOutput()
+	if msg := bytes.TrimSpace(out); err != nil && len(msg) > 0 {
+		return fmt.Errorf("%v: %s", err, msg)
+	}
+	return err
+}
+
+// MachineID is a stable ID of this machine, the same for every user and
+// across reboots: /etc/machine-id on Linux, the IOPlatformUUID on macOS and
+// the MachineGuid in the registry on Windows
+func MachineID() (string, error) {
+	id, err := machineID()
+	if err != nil {
+		return "", fmt.Errorf("machine ID: %w", err)
+	}
+	if id = strings.TrimSpace(id); id == "" {
+		return "", errors.New("machine ID: empty")
+	}
+	return id, nil
+}
+
+// ErrNotInKeyring is a keyring with nothing stored under the name
+var ErrNotInKeyring = errors.New("not in the keyring")
+
+// keyringService is what lan-chat's keyring entries are filed under, one
+// per profile
+func keyringService() string {
+	if Profile != "" {
+		return appName + "-" + Profile
+	}
+	return appName
+}
+
+// KeyringGet is the secret stored under name in the OS keyring: the Secret
+// Service through secret-tool on Linux, the login keychain through security
+// on macOS and the Credential Locker through PowerShell on Windows. It is
+// ErrNotInKeyring if there is none.
+func KeyringGet(name string) (string, error) {
+	secret, err := keyringGet(keyringService(), name)
+	if err != nil && !errors.Is(err, ErrNotInKeyring) {
+		return "", fmt.Errorf("keyring: %w", err)
+	}
+	return secret, err
+}
+
+// KeyringSet stores secret under name in the OS keyring, replacing what was
+// there. The secret goes to the tool on its stdin, never in its arguments.
+func KeyringSet(name, secret string) error {
+	if err := keyringSet(keyringService(), name, secret); err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+	return nil
+}
+
+// KeyringDelete removes what is stored under name; nothing there is
+// ErrNotInKeyring
+func KeyringDelete(name string) error {
+	err := keyringDelete(keyringService(), name)
+	if err != nil && !errors.Is(err, ErrNotInKeyring) {
+		return fmt.Errorf("keyring: %w", err)
+	}
+	return err
+}
+
+// runKeyring runs a keyring tool with stdin and returns its stdout, or an
+// error carrying what it wrote to stderr
+func runKeyring(cmd *exec.Cmd, stdin string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stdin, cmd.Stderr = strings.NewReader(stdin), &stderr
+	out, err := cmd.Output()
+	if msg := bytes.TrimSpace(stderr.Bytes()); err != nil && len(msg) > 0 {
+		return out, fmt.Errorf("%w: %s", err, msg)
+	}
+	return out, err
+}
+
+// BroadcastAddrs are the IPv4 addresses a discovery announcement is sent to.
+// Linux routes the limited broadcast out of every LAN; Windows and macOS send
+// it out of one interface only, so there each interface gets its own
+// directed broadcast.
+func BroadcastAddrs() []string { return broadcastAddrs() }
+
+// directedBroadcasts is the broadcast address of every IPv4 network on an
+// interface that is up and can broadcast, or the limited broadcast if there
+// are none
+func directedBroadcasts() []string {
+	var out []string
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipnet.IP.To4()
+			if ip == nil || len(ipnet.Mask) != net.IPv4len {
+				continue
+			}
+			b := make(net.IP, net.IPv4len)
+			for i := range b {
+				b[i] = ip[i] | ^ipnet.Mask[i]
+			}
+			out = append(out, b.String())
+		}
+	}
+	if len(out) == 0 {
+		return []string{LimitedBroadcast}
+	}
+	return out
+}
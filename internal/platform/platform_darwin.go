@@ -0,0 +1,102 @@
+package platform
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+func dataDir() string {
+	dir, _ := os.UserConfigDir() // ~/Library/Application Support
+	return dir
+}
+
+func stateDir() string { return dataDir() }
+
+func logDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, "Library", "Logs", appDir())
+	}
+	return ""
+}
+
+// runtimeDir is the temp directory, which launchd already makes per user
+func runtimeDir() string { return "" }
+
+func downloadDir(home string) string { return filepath.Join(home, "Downloads") }
+
+func openCmd(path string) *exec.Cmd { return exec.Command("open", path) }
+
+// notifyCmd hands title and body to the script as argv rather than pasting
+// them into it
+func notifyCmd(title, body string) *exec.Cmd {
+	return exec.Command("osascript",
+		"-e", "on run argv",
+		"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+		"-e", "end run",
+		title, body)
+}
+
+func broadcastAddrs() []string { return directedBroadcasts() }
+
+func machineID() (string, error) {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if _, v, ok := strings.Cut(line, `"IOPlatformUUID" = `); ok {
+			return strings.Trim(v, `" `), nil
+		}
+	}
+	return "", nil
+}
+
+// errSecItemNotFound is how security exits when there is no such item
+const errSecItemNotFound = 44
+
+func keyringGet(service, name string) (string, error) {
+	out, err := runKeyring(exec.Command("security", "find-generic-password", "-s", service, "-a", name, "-w"), "")
+	if notFound(err) {
+		return "", ErrNotInKeyring
+	}
+	return strings.TrimSuffix(string(out), "\n"), err
+}
+
+// keyringSet gives the command to security's interactive mode on stdin, as
+// -w on the command line would show the secret to ps
+func keyringSet(service, name, secret string) error {
+	if strings.ContainsAny(secret, "\r\n") {
+		return errors.New("a line break can't go into the keychain")
+	}
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	_, err := runKeyring(exec.Command("security", "-i"),
+		"add-generic-password -U -s "+quote(service)+" -a "+quote(name)+" -w "+quote(secret)+"\n")
+	return err
+}
+
+func keyringDelete(service, name string) error {
+	_, err := runKeyring(exec.Command("security", "delete-generic-password", "-s", service, "-a", name), "")
+	if notFound(err) {
+		return ErrNotInKeyring
+	}
+	return err
+}
+
+func notFound(err error) bool {
+	var exit *exec.ExitError
+	return errors.As(err, &exit) && exit.ExitCode() == errSecItemNotFound
+}
+
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	return err
+}
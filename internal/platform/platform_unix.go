@@ -0,0 +1,110 @@
+//go:build !windows && !darwin
+
+package platform
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+func dataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share")
+	}
+	return ""
+}
+
+func stateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state")
+	}
+	return ""
+}
+
+func logDir() string { return StateDir() }
+
+func runtimeDir() string { return os.Getenv("XDG_RUNTIME_DIR") }
+
+// downloadDir is XDG_DOWNLOAD_DIR, from the environment or from
+// user-dirs.dirs as xdg-user-dirs writes it ("$HOME/Downloads", quoted)
+func downloadDir(home string) string {
+	dir := os.Getenv("XDG_DOWNLOAD_DIR")
+	if dir == "" {
+		config := os.Getenv("XDG_CONFIG_HOME")
+		if !filepath.IsAbs(config) {
+			config = filepath.Join(home, ".config")
+		}
+		if f, err := os.Open(filepath.Join(config, "user-dirs.dirs")); err == nil {
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if v, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "XDG_DOWNLOAD_DIR="); ok {
+					dir = strings.Trim(v, `"`)
+				}
+			}
+			f.Close()
+		}
+	}
+	if rest, ok := strings.CutPrefix(dir, "$HOME"); ok {
+		dir = home + rest
+	}
+	if !filepath.IsAbs(dir) {
+		return filepath.Join(home, "Downloads")
+	}
+	return dir
+}
+
+func openCmd(path string) *exec.Cmd { return exec.Command("xdg-open", path) }
+
+func notifyCmd(title, body string) *exec.Cmd {
+	return exec.Command("notify-send", "--app-name="+appName, "--", title, body)
+}
+
+func broadcastAddrs() []string { return []string{LimitedBroadcast} }
+
+func machineID() (string, error) {
+	data, err := os.ReadFile("/etc/machine-id")
+	if os.IsNotExist(err) {
+		data, err = os.ReadFile("/var/lib/dbus/machine-id")
+	}
+	return string(data), err
+}
+
+// keyringGet asks secret-tool, which exits 1 and says nothing when there is
+// no such secret
+func keyringGet(service, name string) (string, error) {
+	out, err := runKeyring(exec.Command("secret-tool", "lookup", "service", service, "account", name), "")
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 && len(out) == 0 {
+		return "", ErrNotInKeyring
+	}
+	return strings.TrimSuffix(string(out), "\n"), err
+}
+
+func keyringSet(service, name, secret string) error {
+	_, err := runKeyring(exec.Command("secret-tool", "store", "--label="+service+" "+name, "service", service, "account", name), secret)
+	return err
+}
+
+func keyringDelete(service, name string) error {
+	_, err := runKeyring(exec.Command("secret-tool", "clear", "service", service, "account", name), "")
+	return err
+}
+
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package platform
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+func dataDir() string {
+	dir, _ := os.UserCacheDir() // %LocalAppData%
+	return dir
+}
+
+func stateDir() string { return dataDir() }
+
+func logDir() string {
+	if dir := dataDir(); dir != "" {
+		return filepath.Join(dir, appDir(), "logs")
+	}
+	return ""
+}
+
+// runtimeDir is %TEMP%, which is per user
+func runtimeDir() string { return "" }
+
+func downloadDir(home string) string { return filepath.Join(home, "Downloads") }
+
+// openCmd goes through the shell's file associations; "start" would need
+// cmd.exe and its quoting
+func openCmd(path string) *exec.Cmd {
+	return exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+}
+
+// toastScript shows a toast as PowerShell, an app Windows already lets show
+// them; the text comes in through the environment, not the script
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName('text')
+$x.Item(0).AppendChild($t.CreateTextNode($env:LANCHAT_TITLE)) > $null
+$x.Item(1).AppendChild($t.CreateTextNode($env:LANCHAT_BODY)) > $null
+$app = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($app).Show([Windows.UI.Notifications.ToastNotification]::new($t))`
+
+func notifyCmd(title, body string) *exec.Cmd {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "LANCHAT_TITLE="+title, "LANCHAT_BODY="+body)
+	return cmd
+}
+
+func broadcastAddrs() []string { return directedBroadcasts() }
+
+func machineID() (string, error) {
+	out, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+	if err != nil {
+		return "", err
+	}
+	// "    MachineGuid    REG_SZ    <guid>"
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) == 3 && f[0] == "MachineGuid" {
+			return f[2], nil
+		}
+	}
+	return "", nil
+}
+
+// vaultScript loads the Credential Locker's PasswordVault; the service and
+// name come in through the environment and a secret on stdin
+const vaultScript = `[Windows.Security.Credentials.PasswordVault, Windows.Security.Credentials, ContentType = WindowsRuntime] > $null
+$v = New-Object Windows.Security.Credentials.PasswordVault
+`
+
+// vaultMissing is the scripts' exit 3, no such credential
+const vaultMissing = 3
+
+func vaultCmd(script, service, name string) *exec.Cmd {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", vaultScript+script)
+	cmd.Env = append(os.Environ(), "LANCHAT_SERVICE="+service, "LANCHAT_NAME="+name)
+	return cmd
+}
+
+func keyringGet(service, name string) (string, error) {
+	out, err := runKeyring(vaultCmd(`try { $c = $v.Retrieve($env:LANCHAT_SERVICE, $env:LANCHAT_NAME) } catch { exit 3 }
+$c.RetrievePassword()
+[Console]::Out.Write($c.Password)`, service, name), "")
+	if vaultNotFound(err) {
+		return "", ErrNotInKeyring
+	}
+	return string(out), err
+}
+
+func keyringSet(service, name, secret string) error {
+	_, err := runKeyring(vaultCmd(`try { $v.Remove($v.Retrieve($env:LANCHAT_SERVICE, $env:LANCHAT_NAME)) } catch {}
+$v.Add((New-Object Windows.Security.Credentials.PasswordCredential($env:LANCHAT_SERVICE, $env:LANCHAT_NAME, [Console]::In.ReadToEnd())))`, service, name), secret)
+	return err
+}
+
+func keyringDelete(service, name string) error {
+	_, err := runKeyring(vaultCmd(`try { $c = $v.Retrieve($env:LANCHAT_SERVICE, $env:LANCHAT_NAME) } catch { exit 3 }
+$v.Remove($c)`, service, name), "")
+	if vaultNotFound(err) {
+		return ErrNotInKeyring
+	}
+	return err
+}
+
+func vaultNotFound(err error) bool {
+	var exit *exec.ExitError
+	return errors.As(err, &exit) && exit.ExitCode() == vaultMissing
+}
+
+func lockFile(f *os.File) error {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, new(windows.Overlapped))
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return ErrLocked
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A chat goes as a frame rather than the CHAT:<sender>:<text> line, which
+// ended at the first line break and split the sender from the text at the
+// first colon. FRAME:<length> is followed by that many bytes of JSON, a
+// frame, with a version in it. The server answers every frame, pooled or
+// not: OK, or UNSUPPORTED for a version or type it doesn't know. A peer
+// from before frames hangs up on it without an answer, and is sent CHAT
+// and ECHAT as before; so is one that answers UNSUPPORTED, without
+// counting as one that doesn't take frames. A frame sealed under a session
+// key the server doesn't have is answered REKEY (see session.go).
+//
+// A frame's type is "chat" for a message to the peer alone, or "gchat" for
+// one sent to everyone, which the peer shows in its group room. It carries
+// the time the sender sent it, so both sides keep the message under the
+// same time; a peer from before timestamps ignores the field, and leaves
+// it out of what it sends.
+
+// frameVersion is the frame version written and read
+const frameVersion = 1
+
+// maxFrame bounds the JSON of a frame; a server hangs up on a longer one
+const maxFrame = 1 << 20
+
+// frame is the body of a FRAME request. A chat carries its text in Text,
+// or sealed with crypto.Encrypt in Sealed; the sender and the time are in
+// the clear either way, as in ECHAT.
+type frame struct {
+	V      int       `json:"v"`
+	Type   string    `json:"type"` // "chat" or "gchat"
+	Sender string    `json:"sender"`
+	Time   time.Time `json:"time,omitzero"`
+	Text   string    `json:"text,omitempty"`
+	Sealed string    `json:"sealed,omitempty"`
+}
+
+// errUnframed is a peer that hung up on a frame without an answer
+var errUnframed = errors.New("peer doesn't take frames")
+
+// errUnsupported is a peer that answered a frame UNSUPPORTED: it takes
+// frames, but not of this version or type
+var errUnsupported = errors.New("peer doesn't take this frame")
+
+// sendFrame writes f and waits for its answer. Any end of the connection
+// before an answer is errUnframed; a deadline passing isn't, since an old
+// peer hangs up at once.
+func (c *conn) sendFrame(f frame) error {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if len(body) > maxFrame {
+		return fmt.Errorf("message too long: %d bytes, at most %d", len(body), maxFrame)
+	}
+	// One write, so the header doesn't go in a packet of its own
+	msg := make([]byte, 0, len(body)+16)
+	msg = append(strconv.AppendInt(append(msg, "FRAME:"...), int64(len(body)), 10), '\n')
+	if _, err := c.Write(append(msg, body...)); err != nil {
+		return err
+	}
+	c.SetReadDeadline(time.Now().Add(DialTimeout))
+	resp, err := c.readLine()
+	switch strings.TrimSpace(resp) {
+	case "OK":
+		return nil
+	case "UNSUPPORTED":
+		return errUnsupported
+	case "REKEY":
+		return errRekey
+	}
+	var ne net.Error
+	if err != nil && !(errors.As(err, &ne) && ne.Timeout()) {
+		return errUnframed
+	}
+	if err == nil {
+		err = errNoAnswer
+	}
+	return err
+}
+
+// readFrame reads the body of a FRAME:<length> header from r. ok is false
+// for a length out of bounds or a connection that ends first; a frame
+// that isn't JSON is returned with V 0.
+func readFrame(r *bufio.Reader, length []byte) (f frame, ok bool) {
+	size, err := strconv.Atoi(strings.TrimSpace(string(length)))
+	if err != nil || size < 0 || size > maxFrame {
+		return frame{}, false
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return frame{}, false
+	}
+	if json.Unmarshal(body, &f) != nil {
+		return frame{}, true
+	}
+	return f, true
+}
@@ -0,0 +1,430 @@
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"lan-chat/internal/crypto"
+)
+
+// A connection opened with POOL stays open for more requests after the
+// first: the server answers POOLED and reads header after header until the
+// client hangs up. On such a connection CHAT and ECHAT are acknowledged
+// with OK, as FRAME always is, and IDENT without a key with NOIDENT, so
+// the client knows where each answer ends. A file with its size, SFILE or
+// SEFILE, ends where the server knows, which answers SAVED once it has it
+// and goes on; FILE and EFILE run to EOF and still end their connection.
+// A peer that doesn't know POOL closes the connection unanswered and is
+// dialed per request, as before.
+//
+// While it is idle the OS probes a pooled connection with TCP keepalives,
+// so one to a peer that vanished without hanging up fails rather than
+// hangs. A peer that can't be dialed is redialed for heartbeats only after
+// a backoff, doubling from redialMin to redialMax; requests a person made
+// dial it regardless, and any dial that succeeds ends the backoff.
+
+// IdleTimeout is how long a pooled connection is kept unused before it is
+// closed. The heartbeat uses a reachable peer's connection every few
+// seconds, so that one stays open.
+const IdleTimeout = 60 * time.Second
+
+// serverIdleTimeout is how long the server waits for the next request on a
+// pooled connection, longer than IdleTimeout so the client hangs up first
+const serverIdleTimeout = 2 * IdleTimeout
+
+// maxIdle bounds the connections kept open per peer
+const maxIdle = 2
+
+// plainRetry is how long a peer that didn't answer POOL is dialed per
+// request before POOL is offered again, in case it was updated
+const plainRetry = 10 * time.Minute
+
+// redialMin and redialMax bound how long heartbeats wait before dialing a
+// peer whose last dial failed
+const (
+	redialMin = 5 * time.Second
+	redialMax = time.Minute
+)
+
+// keepAlive is how a pooled connection is probed while idle: after 15
+// seconds without traffic, then every 5, given up after 3 unanswered
+var keepAlive = net.KeepAliveConfig{Enable: true, Idle: 15 * time.Second, Interval: 5 * time.Second, Count: 3}
+
+// ErrBackoff is a heartbeat not sent because the peer's last dial failed
+// and the backoff since hasn't passed
+var ErrBackoff = errors.New("peer unreachable, waiting to redial")
+
+// errNoAnswer is a pooled connection that ended before the answer came
+var errNoAnswer = errors.New("connection closed before the answer")
+
+// Pool keeps connections to peers open between requests, so a chat, a
+// heartbeat or a verification doesn't pay for a dial every time. A
+// Client with a Pool uses it for every request; the zero value is not
+// usable, call NewPool.
+type Pool struct {
+	mu    sync.Mutex
+	idle  map[string][]*conn   // by IP, most recently used last
+	plain map[string]time.Time // peers without POOL, and when they were found out
+	// Peers that hung up on FRAME, and when; like plain, they are tried
+	// again after plainRetry
+	unframed map[string]time.Time
+	down     map[string]redial  // peers whose last dial failed
+	salts    map[string][]byte  // the session salt of peers that answered SVERIFY or PAKE
+	sessions map[string]session // the keys agreed with peers that answered SESSION
+	closed   bool
+}
+
+// redial is the backoff of a peer that couldn't be dialed
+type redial struct {
+	wait time.Duration // doubled on every failed dial
+	at   time.Time     // when heartbeats may dial it again
+}
+
+// NewPool is an empty pool
+func NewPool() *Pool {
+	return &Pool{idle: make(map[string][]*conn), plain: make(map[string]time.Time), unframed: make(map[string]time.Time), down: make(map[string]redial), salts: make(map[string][]byte), sessions: make(map[string]session)}
+}
+
+// Close closes every idle connection; connections in use are closed when
+// they are done
+func (p *Pool) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle, p.closed = make(map[string][]*conn), true
+	p.mu.Unlock()
+	for _, conns := range idle {
+		for _, c := range conns {
+			c.timer.Stop()
+			c.Conn.Close()
+		}
+	}
+}
+
+// take is an idle connection to ip that still looks open, nil if there is
+// none
+func (p *Pool) take(ip string) *conn {
+	for {
+		p.mu.Lock()
+		conns := p.idle[ip]
+		if len(conns) == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		c := conns[len(conns)-1]
+		p.idle[ip] = conns[:len(conns)-1]
+		p.mu.Unlock()
+		if !c.timer.Stop() {
+			continue // being closed for idling
+		}
+		if c.alive() {
+			c.reused = true
+			return c
+		}
+		c.Conn.Close()
+	}
+}
+
+// put keeps c for the next request to its peer
+func (p *Pool) put(c *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.idle[c.ip]) >= maxIdle {
+		c.Conn.Close()
+		return
+	}
+	p.idle[c.ip] = append(p.idle[c.ip], c)
+	if c.timer == nil {
+		c.timer = time.AfterFunc(IdleTimeout, func() { p.expire(c) })
+	} else {
+		c.timer.Reset(IdleTimeout)
+	}
+}
+
+// expire closes c after IdleTimeout unused
+func (p *Pool) expire(c *conn) {
+	p.mu.Lock()
+	conns := p.idle[c.ip]
+	for i := range conns {
+		if conns[i] == c {
+			p.idle[c.ip] = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+	c.Conn.Close()
+}
+
+// pools reports whether ip is worth offering POOL to
+func (p *Pool) pools(ip string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	since, ok := p.plain[ip]
+	return !ok || time.Since(since) > plainRetry
+}
+
+func (p *Pool) setPlain(ip string, plain bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if plain {
+		p.plain[ip] = time.Now()
+	} else {
+		delete(p.plain, ip)
+	}
+}
+
+// frames reports whether ip is worth sending a frame to
+func (p *Pool) frames(ip string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	since, ok := p.unframed[ip]
+	return !ok || time.Since(since) > plainRetry
+}
+
+func (p *Pool) setUnframed(ip string, unframed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if unframed {
+		p.unframed[ip] = time.Now()
+	} else {
+		delete(p.unframed, ip)
+	}
+}
+
+// salt is the session salt ip's password was verified with, nil for a
+// peer that isn't verified or only knows VERIFY
+func (p *Pool) salt(ip string) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.salts[ip]
+}
+
+func (p *Pool) setSalt(ip string, salt []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if salt != nil {
+		p.salts[ip] = salt
+	} else {
+		delete(p.salts, ip)
+	}
+}
+
+// session is the key agreed with ip, ok false if there is none
+func (p *Pool) session(ip string) (s session, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok = p.sessions[ip]
+	return s, ok
+}
+
+// setSession keeps key, agreed with ip under salt, or forgets ip's with nil
+func (p *Pool) setSession(ip string, key *crypto.Session, salt []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key != nil {
+		p.sessions[ip] = session{key: key, salt: salt, at: time.Now()}
+	} else {
+		delete(p.sessions, ip)
+	}
+}
+
+// dialed records whether a dial to ip worked, starting or growing its
+// backoff when it didn't
+func (p *Pool) dialed(ip string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ok {
+		delete(p.down, ip)
+		return
+	}
+	r := p.down[ip]
+	r.wait = min(max(2*r.wait, redialMin), redialMax)
+	r.at = time.Now().Add(r.wait)
+	p.down[ip] = r
+}
+
+// backingOff reports whether heartbeats should leave ip alone for now
+func (p *Pool) backingOff(ip string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, ok := p.down[ip]
+	return ok && time.Now().Before(r.at)
+}
+
+// conn is a connection to a peer for one request: a pooled one, read
+// through the reader kept with it, or one dialed for this request alone
+type conn struct {
+	net.Conn
+	ip     string
+	pool   *Pool         // nil when not pooled
+	r      *bufio.Reader // pooled only
+	reused bool          // taken from the pool rather than dialed for this request
+	timer  *time.Timer   // closes it once idle too long
+	stop   func() bool   // ends the watch on the request's context
+}
+
+// alive checks an idle connection without a round trip: a read that
+// times out at once means the peer is still there, EOF that it hung up
+func (c *conn) alive() bool {
+	c.SetReadDeadline(time.Now())
+	_, err := c.r.Peek(1)
+	c.SetReadDeadline(time.Time{})
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// readLine is the peer's one-line answer
+func (c *conn) readLine() (string, error) {
+	if c.r == nil {
+		return readLine(c.Conn)
+	}
+	return c.r.ReadString('\n')
+}
+
+// ack waits for the OK a pooled connection answers a chat with; other
+// connections end without one
+func (c *conn) ack() error {
+	if c.pool == nil {
+		return nil
+	}
+	c.SetReadDeadline(time.Now().Add(DialTimeout))
+	resp, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(resp) != "OK" {
+		return errNoAnswer
+	}
+	return nil
+}
+
+// saved waits for the SAVED a pooled connection answers a sized file
+// with. A peer from before that hangs up instead, and the connection can't
+// be kept then.
+func (c *conn) saved() bool {
+	c.SetReadDeadline(time.Now().Add(DialTimeout))
+	resp, err := c.readLine()
+	return err == nil && strings.TrimSpace(resp) == "SAVED"
+}
+
+// release is the end of a request that went well: a pooled connection
+// goes back to the pool, any other is closed
+func (c *conn) release() {
+	if !c.stop() || c.pool == nil {
+		// The context broke the connection's deadline, or it is single-use
+		c.Conn.Close()
+		return
+	}
+	c.SetDeadline(time.Time{})
+	c.pool.put(c)
+}
+
+// Close ends the connection for good
+func (c *conn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// watch makes any read or write on c fail once ctx is done, until the
+// request ends
+func (c *conn) watch(ctx context.Context) {
+	// A deadline in the past wakes up whatever is blocked on the connection
+	c.stop = context.AfterFunc(ctx, func() { c.SetDeadline(time.Unix(1, 0)) })
+}
+
+// open is a connection to ip for one request: from the pool when reuse is
+// set and there is one, else newly dialed and offered POOL
+func (c Client) open(ctx context.Context, ip string, reuse bool) (*conn, error) {
+	if c.Pool != nil && reuse {
+		if pc := c.Pool.take(ip); pc != nil {
+			pc.watch(ctx)
+			return pc, nil
+		}
+	}
+	raw, err := c.connect(ctx, ip)
+	if c.Pool != nil && ctx.Err() == nil {
+		c.Pool.dialed(ip, err == nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pc := &conn{Conn: raw, ip: ip}
+	pc.watch(ctx)
+	if c.Pool == nil || !c.Pool.pools(ip) {
+		return pc, nil
+	}
+	pooled, err := pc.handshake()
+	if err != nil {
+		pc.Close()
+		return nil, opError(ctx, "dial", err)
+	}
+	if pooled {
+		c.Pool.setPlain(ip, false)
+		pc.pool = c.Pool
+		return pc, nil
+	}
+	// An older peer: it hung up on POOL, so dial again for the request
+	pc.Close()
+	c.Pool.setPlain(ip, true)
+	return c.open(ctx, ip, false)
+}
+
+// handshake offers POOL on a new connection. It isn't pooled if the peer
+// hangs up or answers anything else; err is a connection that failed.
+func (c *conn) handshake() (pooled bool, err error) {
+	c.SetDeadline(time.Now().Add(DialTimeout))
+	if _, err := c.Write([]byte("POOL\n")); err != nil {
+		return false, err
+	}
+	c.r = bufio.NewReader(c.Conn)
+	resp, err := c.r.ReadString('\n')
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	c.SetDeadline(time.Time{})
+	if strings.TrimSpace(resp) != "POOLED" {
+		return false, nil
+	}
+	setKeepAlive(c.Conn)
+	return true, nil
+}
+
+// setKeepAlive turns on keepAlive for c when it is TCP
+func setKeepAlive(c net.Conn) {
+	if tc, ok := c.(*net.TCPConn); ok {
+		tc.SetKeepAliveConfig(keepAlive)
+	}
+}
+
+// request runs f, which writes a request and reads its answer, on a
+// connection to ip. A pooled connection the peer has hung up on since its
+// last use shows up as f failing; f then gets one more go on a new
+// connection. f's errors are the connection's, so f must not fail on an
+// answer it understood.
+func (c Client) request(ctx context.Context, ip string, f func(pc *conn) error) error {
+	pc, err := c.open(ctx, ip, true)
+	if err != nil {
+		return err
+	}
+	if err = f(pc); err != nil && pc.reused && ctx.Err() == nil {
+		pc.Close()
+		if pc, err = c.open(ctx, ip, false); err != nil {
+			return err
+		}
+		err = f(pc)
+	}
+	if err != nil {
+		pc.Close()
+		return err
+	}
+	pc.release()
+	return nil
+}
@@ -0,0 +1,767 @@
+// Package protocol is the TCP wire format between peers. Every connection
+// starts with one header line naming the request:
+//
+//	FRAME:<length>               chat or group message as <length> bytes
+//	                             of JSON, answered with OK (see frame.go)
+//	CHAT:<sender>:<text>         plaintext chat message, to older peers
+//	ECHAT:<sender>:<ciphertext>  encrypted chat message, to older peers
+//	FILE:<name>                  plaintext file, raw bytes follow ACCEPTED;
+//	                             REFUSED ends the connection instead
+//	EFILE:<name>                 encrypted file, ciphertext follows ACCEPTED
+//	PING                         heartbeat, answered with PONG
+//	SESSION:<salt>:<share>       PAKE that also agrees on a session key
+//	                             (see session.go)
+//	PAKE:<salt>:<share>          password check by SPAKE2, answered with
+//	                             PAKE:<share>:<confirmation>, then
+//	                             PAKE:<confirmation> with VMATCH / VNOMATCH
+//	SVERIFY:<salt>:<proof>       password check with a session salt,
+//	                             answered with VMATCH / VNOMATCH, to older peers
+//	VERIFY:<fingerprint>         password check, to peers older still
+//	IDENT:<challenge>            identity key check, answered with
+//	                             IDENTITY:<public key>:<signature> (hex), or
+//	                             nothing by peers without a key
+//	POOL                         keep the connection for more requests,
+//	                             answered with POOLED (see pool.go)
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lan-chat/internal/crypto"
+)
+
+// DefaultPort is the TCP port every peer listens on for chats and files
+const DefaultPort = "8080"
+
+// Port is the TCP port this process listens on, and dials unless the peer
+// announced another (see SetPeerPort), DefaultPort unless --tcp-port or
+// [network] tcp_port says otherwise. Set it before anything listens or
+// dials.
+var Port = DefaultPort
+
+// LegacySalted lets a peer that hangs up on PAKE be checked with SVERIFY
+// instead (see VerifySalted). Hanging up is all it takes to get one, and
+// its proof lets whoever did test guesses offline, so it is off unless
+// [network] legacy_salted, or legacy_verify, turns it on; without it such
+// peers stay unverified.
+var LegacySalted = false
+
+// LegacyVerify lets VerifySalted fall back to VERIFY for a peer that hangs
+// up on SVERIFY. VERIFY puts the unsalted fingerprint on the wire for
+// anyone announcing themselves to collect and crack, so it is off unless
+// [network] legacy_verify turns it on; without it such peers stay
+// unverified.
+var LegacyVerify = false
+
+// MaxFileSize is the largest file taken from a peer, in bytes, or 0 for any
+// size: [downloads] max_size_mb. An offer of more is refused, and a stream
+// that runs past it is cut off.
+var MaxFileSize int64
+
+// maxBlob bounds an EFILE, which is held in memory whole, base64 and all,
+// to decrypt it, whatever MaxFileSize allows
+const maxBlob = 64 << 20
+
+// peerPorts are the TCP ports peers announced, by IP
+var peerPorts sync.Map
+
+// SetPeerPort records the TCP port the peer at ip announced in discovery;
+// "" forgets it, and the peer is dialed on Port
+func SetPeerPort(ip, port string) {
+	if port == "" {
+		peerPorts.Delete(ip)
+		return
+	}
+	peerPorts.Store(ip, port)
+}
+
+// PeerPort is the TCP port to dial the peer at ip on
+func PeerPort(ip string) string {
+	if port, ok := peerPorts.Load(ip); ok {
+		return port.(string)
+	}
+	return Port
+}
+
+// DialTimeout bounds how long we wait for a peer to accept a connection
+const DialTimeout = 2 * time.Second
+
+// OpError reports which step of a send failed, so callers can explain it
+type OpError struct {
+	Op  string // "dial", "read", "encrypt" or "write"
+	Err error
+}
+
+func (e *OpError) Error() string { return e.Op + ": " + e.Err.Error() }
+func (e *OpError) Unwrap() error { return e.Err }
+
+// Dialer connects to the server of the peer at ip
+type Dialer interface {
+	Dial(ip string) (net.Conn, error)
+}
+
+// ContextDialer is a Dialer that can give up on a dial when its context is
+// done; Client falls back to Dial for Dialers without it
+type ContextDialer interface {
+	DialContext(ctx context.Context, ip string) (net.Conn, error)
+}
+
+// Listener opens the socket our server accepts peers on
+type Listener interface {
+	Listen() (net.Listener, error)
+}
+
+// TCP is the real network: each peer on its PeerPort, dials bounded by
+// DialTimeout
+type TCP struct{}
+
+func (TCP) Dial(ip string) (net.Conn, error) {
+	return net.DialTimeout("tcp", net.JoinHostPort(ip, PeerPort(ip)), DialTimeout)
+}
+
+func (TCP) DialContext(ctx context.Context, ip string) (net.Conn, error) {
+	d := net.Dialer{Timeout: DialTimeout}
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(ip, PeerPort(ip)))
+}
+
+func (TCP) Listen() (net.Listener, error) {
+	return net.Listen("tcp", ":"+Port)
+}
+
+// Client makes requests to peers through a Dialer; the package-level
+// functions are a Client on TCP
+type Client struct {
+	Dialer Dialer
+	Pool   *Pool // optional: connections kept open between requests
+}
+
+var tcpClient = Client{Dialer: TCP{}}
+
+// connect dials ip, giving up once ctx is done
+func (c Client) connect(ctx context.Context, ip string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if d, ok := c.Dialer.(ContextDialer); ok {
+		conn, err = d.DialContext(ctx, ip)
+	} else {
+		conn, err = c.Dialer.Dial(ip)
+	}
+	if err == nil && ctx.Err() != nil {
+		conn.Close()
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, opError(ctx, "dial", err)
+	}
+	return conn, nil
+}
+
+// opError is an OpError for step op, reporting ctx's error rather than the
+// deadline it caused once ctx is done
+func opError(ctx context.Context, op string, err error) error {
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return &OpError{op, err}
+}
+
+// SendChat delivers one chat message, encrypted when password is set
+func SendChat(ip, sender, text, password string) error {
+	return tcpClient.SendChat(ip, sender, text, password)
+}
+
+// SendFile streams r to the peer under name, encrypted when password is set
+func SendFile(ip, name string, r io.Reader, password string) error {
+	return tcpClient.SendFile(ip, name, r, password)
+}
+
+// Ping reports whether the peer's TCP server answers
+func Ping(ip string) bool { return tcpClient.Ping(ip) }
+
+// Verify asks the peer whether it holds the password with this fingerprint
+func Verify(ip, fingerprint string) (bool, error) { return tcpClient.Verify(ip, fingerprint) }
+
+// VerifyPassword asks the peer whether it holds password: by PAKE, or
+// with a salted proof or the fingerprint to a peer from before that if
+// LegacySalted or LegacyVerify allows it
+func VerifyPassword(ip, password string) (bool, error) {
+	return tcpClient.VerifyPassword(ip, password)
+}
+
+// ErrNoIdentity is a peer that didn't answer IDENT, such as an older
+// version without identity keys
+var ErrNoIdentity = errors.New("peer has no identity key")
+
+// ErrRefused is a file the peer won't take from us
+var ErrRefused = errors.New("peer refused the file")
+
+// ErrNoPake is a peer that hung up on PAKE: a version from before it,
+// which can only be verified with SVERIFY or VERIFY
+var ErrNoPake = errors.New("peer doesn't take PAKE")
+
+// ErrLegacySalted is a peer that doesn't take PAKE, while LegacySalted and
+// LegacyVerify are off
+var ErrLegacySalted = errors.New("peer doesn't take PAKE, and the older checks are turned off")
+
+// ErrLegacyVerify is a peer that only takes VERIFY, while LegacyVerify is
+// off
+var ErrLegacyVerify = errors.New("peer only takes the unsalted VERIFY, which is turned off")
+
+// errOldPeer is a peer that hung up on SEFILE without an answer: a version
+// from before streamed encryption, which is sent EFILE instead
+var errOldPeer = errors.New("peer doesn't take streamed files")
+
+// Identify asks the peer for its identity key and checks that it holds it
+func Identify(ip string) (ed25519.PublicKey, error) { return tcpClient.Identify(ip) }
+
+// SendChat is the package-level SendChat through c's Dialer
+func (c Client) SendChat(ip, sender, text, password string) error {
+	return c.SendChatContext(context.Background(), ip, sender, text, password, time.Now())
+}
+
+// SendChatContext is SendChat, given up on once ctx is done, for a message
+// sent at at. The message goes as a frame (see frame.go), or as a CHAT or
+// ECHAT line to a peer that doesn't take frames, with its line breaks made
+// spaces and without the time.
+func (c Client) SendChatContext(ctx context.Context, ip, sender, text, password string, at time.Time) error {
+	return c.chat(ctx, ip, frame{Type: "chat", Sender: sender, Time: at, Text: text}, password)
+}
+
+// SendGroupChatContext is SendChatContext for a message to everyone, which
+// the peer can tell from one to it alone. A peer from before group frames
+// gets it as a direct message.
+func (c Client) SendGroupChatContext(ctx context.Context, ip, sender, text, password string, at time.Time) error {
+	return c.chat(ctx, ip, frame{Type: "gchat", Sender: sender, Time: at, Text: text}, password)
+}
+
+// chat sends f, or a CHAT or ECHAT line to a peer that doesn't take it,
+// and again under a new session key to a peer that answers REKEY
+func (c Client) chat(ctx context.Context, ip string, f frame, password string) error {
+	err := c.sendChat(ctx, ip, f, password)
+	if err == errRekey {
+		if err = c.rekey(ip, password); err == nil {
+			err = c.sendChat(ctx, ip, f, password)
+		}
+	}
+	return err
+}
+
+func (c Client) sendChat(ctx context.Context, ip string, f frame, password string) error {
+	f.V = frameVersion
+	header := "CHAT:" + f.Sender + ":" + oneLine(f.Text)
+	if password != "" {
+		seal, err := c.sealing(ip, password)
+		if err != nil {
+			return &OpError{"encrypt", err}
+		}
+		sealed, err := seal.encrypt([]byte(f.Text))
+		if err != nil {
+			return &OpError{"encrypt", err}
+		}
+		f.Text, f.Sealed = "", sealed
+		header = "ECHAT:" + f.Sender + ":" + sealed
+	}
+	if c.Pool == nil || c.Pool.frames(ip) {
+		err := c.request(ctx, ip, func(conn *conn) error {
+			err := conn.sendFrame(f)
+			if err != nil && err != errUnframed && err != errUnsupported && err != errRekey {
+				err = opError(ctx, "write", err)
+			}
+			return err
+		})
+		if err == errUnsupported {
+			// It takes frames, only not this type
+			err = c.line(ctx, ip, header)
+		}
+		if err != errUnframed {
+			if err == nil && c.Pool != nil {
+				c.Pool.setUnframed(ip, false)
+			}
+			return err
+		}
+		if c.Pool != nil {
+			c.Pool.setUnframed(ip, true)
+		}
+	}
+	return c.line(ctx, ip, header)
+}
+
+// line sends a chat as a CHAT or ECHAT header
+func (c Client) line(ctx context.Context, ip, header string) error {
+	return c.request(ctx, ip, func(conn *conn) error {
+		if _, err := fmt.Fprintln(conn, header); err != nil {
+			return opError(ctx, "write", err)
+		}
+		if err := conn.ack(); err != nil {
+			return opError(ctx, "write", err)
+		}
+		return nil
+	})
+}
+
+// oneLine is text for a CHAT line, which ends at the first line break
+func oneLine(text string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text)
+}
+
+// SendFile is the package-level SendFile through c's Dialer
+func (c Client) SendFile(ip, name string, r io.Reader, password string) error {
+	return c.SendFileContext(context.Background(), ip, name, r, password)
+}
+
+// SendFileContext is SendFile, given up on once ctx is done; the peer is
+// left with a partial file. The size is announced when r tells it (see
+// sizeOf), as SFILE, so the peer can show how much is left, with the
+// SHA-256 of the content when r is also an io.ReaderAt, so the peer can
+// check it. With a password the file is sent as SEFILE, encrypted a chunk
+// at a time (see crypto.NewWriter), or as one sealed EFILE blob to a peer
+// too old for that. SEFILE isn't given the hash, which would tell anyone
+// listening which file it is; to a peer verified with SESSION it carries
+// the session key's tag instead, SEFILE:<size>:$3$<id>:<name>, and to one
+// verified with SVERIFY or PAKE the salt, SEFILE:<size>:<salt>:<name>. A
+// peer that answers REKEY is offered it again under a new session key. A sized file on a pooled connection is
+// done once the peer answers SAVED, and the connection is kept.
+func (c Client) SendFileContext(ctx context.Context, ip, name string, r io.Reader, password string) error {
+	// As the peer would clean it, and so a line break can't end the header
+	name = SafeName(name)
+	size := sizeOf(r)
+	header, seal, err := c.fileHeader(ip, name, r, size, password)
+	if err != nil {
+		return err
+	}
+	conn, err := c.offer(ctx, ip, header)
+	if err == errRekey {
+		if err = c.rekey(ip, password); err != nil {
+			return &OpError{"encrypt", err}
+		}
+		if header, seal, err = c.fileHeader(ip, name, r, size, password); err != nil {
+			return err
+		}
+		conn, err = c.offer(ctx, ip, header)
+	}
+	// Sent as FILE, its bytes run to EOF and the peer can't tell where the
+	// next request would start
+	sized := header != "FILE:"+name
+	if errors.Is(err, errOldPeer) {
+		if password != "" {
+			return c.sendSealed(ctx, ip, name, r, password)
+		}
+		conn, err = c.offer(ctx, ip, "FILE:"+name)
+		sized = false
+	}
+	if err != nil {
+		return err
+	}
+	if err := stream(conn, r, size, seal); err != nil {
+		conn.Close()
+		return opError(ctx, "write", err)
+	}
+	if sized && conn.pool != nil && conn.saved() {
+		conn.release()
+	} else {
+		conn.Close()
+	}
+	return nil
+}
+
+// fileHeader is the header that offers r, and how it is to be encrypted
+func (c Client) fileHeader(ip, name string, r io.Reader, size int64, password string) (string, sealing, error) {
+	if password != "" {
+		seal, err := c.sealing(ip, password)
+		if err != nil {
+			return "", seal, &OpError{"encrypt", err}
+		}
+		if field := seal.field(); field != "" {
+			return "SEFILE:" + sizeField(size) + ":" + field + ":" + name, seal, nil
+		}
+		return "SEFILE:" + sizeField(size) + ":" + name, seal, nil
+	}
+	if size < 0 {
+		return "FILE:" + name, sealing{}, nil
+	}
+	hash, err := hashOf(r, size)
+	if err != nil {
+		return "", sealing{}, err
+	}
+	return "SFILE:" + sizeField(size) + ":" + hash + ":" + name, sealing{}, nil
+}
+
+// stream writes the file after its header: size bytes of r, or all of it
+// without a size, or all of it in chunks with a password
+func stream(conn *conn, r io.Reader, size int64, seal sealing) error {
+	if seal.password == "" {
+		if size >= 0 {
+			// Not a byte past the size, which would be read as the next
+			// header on a pooled connection
+			r = io.LimitReader(r, size)
+		}
+		_, err := io.Copy(conn, r)
+		return err
+	}
+	w, err := seal.writer(conn)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		// Without the last chunk the peer knows the file is cut short
+		return err
+	}
+	return w.Close()
+}
+
+// sizeOf is how many bytes r holds, -1 if it doesn't tell: a regular file,
+// or a reader with a Size like *bytes.Reader, not yet read from
+func sizeOf(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case interface{ Stat() (fs.FileInfo, error) }:
+		if fi, err := r.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	return -1
+}
+
+// hashOf is the hex SHA-256 of the size bytes of r, read with ReadAt so r
+// is still unread after; "" for a reader without ReadAt
+func hashOf(r io.Reader, size int64) (string, error) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return "", nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(ra, 0, size)); err != nil {
+		return "", &OpError{"read", err}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sizeField is the size in a header, empty when it isn't known
+func sizeField(size int64) string {
+	if size < 0 {
+		return ""
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// sendSealed sends the file as EFILE, the whole of it sealed at once, so it
+// is read into memory first
+func (c Client) sendSealed(ctx context.Context, ip, name string, r io.Reader, password string) error {
+	conn, err := c.offer(ctx, ip, "EFILE:"+name)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return &OpError{"read", err}
+	}
+	encrypted, err := crypto.Encrypt(content, password)
+	if err != nil {
+		return &OpError{"encrypt", err}
+	}
+	if _, err := conn.Write([]byte(encrypted)); err != nil {
+		return opError(ctx, "write", err)
+	}
+	return nil
+}
+
+// readers are the buffered readers connections are read through, kept
+// between connections rather than allocating 4 KiB for every one
+var readers = sync.Pool{New: func() any { return bufio.NewReader(nil) }}
+
+func getReader(r io.Reader) *bufio.Reader {
+	br := readers.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+func putReader(br *bufio.Reader) {
+	br.Reset(nil) // don't keep the connection alive from the pool
+	readers.Put(br)
+}
+
+// readLine is the one line a peer answers a request with
+func readLine(conn net.Conn) (string, error) {
+	br := getReader(conn)
+	defer putReader(br)
+	return br.ReadString('\n')
+}
+
+// offer sends a file header and waits for the answer, on a connection
+// taken for the file alone. Like request, it tries once more on a new
+// connection when a pooled one turns out to be closed.
+func (c Client) offer(ctx context.Context, ip, header string) (*conn, error) {
+	for reuse := true; ; reuse = false {
+		conn, err := c.open(ctx, ip, reuse)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(conn, header)
+		err = accepted(conn, strings.HasPrefix(header, "SFILE:") || strings.HasPrefix(header, "SEFILE:"))
+		if err == nil {
+			return conn, nil
+		}
+		conn.Close()
+		if !conn.reused || err == ErrRefused || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+}
+
+// accepted waits for the answer to a file header. A peer that keeps
+// connections always answers; an older one might not, so only REFUSED is
+// taken as a no from it. Every peer that knows SFILE and SEFILE answers
+// them, so hanging up on one instead (sized) is errOldPeer.
+func accepted(conn *conn, sized bool) error {
+	resp, err := conn.readLine()
+	switch strings.TrimSpace(resp) {
+	case "REFUSED":
+		return ErrRefused
+	case "ACCEPTED":
+		return nil
+	case "REKEY":
+		return errRekey
+	}
+	if sized && resp == "" && errors.Is(err, io.EOF) {
+		return errOldPeer
+	}
+	if err != nil && conn.pool != nil {
+		return &OpError{"write", err}
+	}
+	return nil
+}
+
+// Ping is the package-level Ping through c's Dialer
+func (c Client) Ping(ip string) bool {
+	_, err := c.RTT(ip)
+	return err == nil
+}
+
+// RTT pings the peer and times PING to PONG. The dial, when there is no
+// pooled connection to reuse, isn't counted, so the first measurement is
+// comparable with the rest. With a Pool, a peer whose last dial failed
+// isn't dialed again until its backoff has passed, and fails with
+// ErrBackoff meanwhile.
+func (c Client) RTT(ip string) (time.Duration, error) {
+	if c.Pool != nil && c.Pool.backingOff(ip) {
+		return 0, ErrBackoff
+	}
+	var rtt time.Duration
+	err := c.request(context.Background(), ip, func(conn *conn) error {
+		conn.SetDeadline(time.Now().Add(DialTimeout))
+		start := time.Now()
+		fmt.Fprintln(conn, "PING")
+		resp, err := conn.readLine()
+		if err == nil && strings.TrimSpace(resp) != "PONG" {
+			err = errNoAnswer
+		}
+		rtt = time.Since(start)
+		return err
+	})
+	return rtt, err
+}
+
+// Verify is the package-level Verify through c's Dialer
+func (c Client) Verify(ip, fingerprint string) (bool, error) {
+	var match bool
+	err := c.request(context.Background(), ip, func(conn *conn) error {
+		fmt.Fprintf(conn, "VERIFY:%s\n", fingerprint)
+		resp, err := conn.readLine()
+		match = strings.TrimSpace(resp) == "VMATCH"
+		return err
+	})
+	return match, err
+}
+
+// VerifyPassword is the package-level VerifyPassword through c's Dialer:
+// Pake, or VerifySalted with a peer that answers it ErrNoPake
+func (c Client) VerifyPassword(ip, password string) (bool, error) {
+	match, err := c.Pake(ip, password)
+	if errors.Is(err, ErrNoPake) {
+		return c.VerifySalted(ip, password)
+	}
+	return match, err
+}
+
+// Pake checks that the peer holds password by SPAKE2 (see crypto.Pake),
+// which gives someone watching, or posing as the peer, nothing to test
+// guesses against. The server answers the client's share with its own and
+// its confirmation, or VNOMATCH without a password; the client sends its
+// confirmation back, empty if the server's didn't check, and the server
+// answers VMATCH or VNOMATCH. It is tried as SESSION first (see
+// session.go), and a match keeps the session key in c's Pool; a peer that
+// only takes PAKE has the salt kept, as VerifySalted's is.
+func (c Client) Pake(ip, password string) (bool, error) {
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return false, err
+	}
+	match, err := c.pake(ip, password, salt, "SESSION")
+	if errors.Is(err, ErrNoPake) {
+		// From before session keys
+		match, err = c.pake(ip, password, salt, "PAKE")
+	}
+	return match, err
+}
+
+// pake runs verb, PAKE or SESSION, with salt, and keeps what a match
+// leaves to encrypt with in c's Pool
+func (c Client) pake(ip, password string, salt []byte, verb string) (bool, error) {
+	p, err := crypto.NewPake(password, salt, false)
+	if err != nil {
+		return false, err
+	}
+	var first string
+	match := false
+	err = c.request(context.Background(), ip, func(conn *conn) error {
+		conn.SetDeadline(time.Now().Add(DialTimeout))
+		fmt.Fprintf(conn, "%s:%x:%x\n", verb, salt, p.Share())
+		var err error
+		if first, err = conn.readLine(); err != nil {
+			return err
+		}
+		answer, ok := strings.CutPrefix(strings.TrimSpace(first), "PAKE:")
+		if !ok {
+			return nil // VNOMATCH
+		}
+		mine := ""
+		field, confirm, _ := strings.Cut(answer, ":")
+		share, err1 := hex.DecodeString(field)
+		theirs, err2 := hex.DecodeString(confirm)
+		if err1 == nil && err2 == nil && p.Finish(share) == nil && p.Check(theirs) {
+			mine = hex.EncodeToString(p.Confirm())
+		}
+		fmt.Fprintf(conn, "PAKE:%s\n", mine)
+		resp, err := conn.readLine()
+		match = mine != "" && strings.TrimSpace(resp) == "VMATCH"
+		return err
+	})
+	if err != nil && first == "" && !errors.As(err, new(*OpError)) {
+		return false, ErrNoPake
+	}
+	if c.Pool != nil {
+		c.Pool.setSalt(ip, nil)
+		c.Pool.setSession(ip, nil, nil)
+		switch {
+		case !match:
+		case verb == "SESSION":
+			c.Pool.setSession(ip, p.Session(), salt)
+		default:
+			c.Pool.setSalt(ip, salt)
+		}
+	}
+	return match, err
+}
+
+// VerifySalted checks the password with a peer from before PAKE, if
+// LegacySalted or LegacyVerify allows it, else it is ErrLegacySalted. A match
+// with SVERIFY is kept in c's Pool, if it has one, and what is sealed for
+// ip from then on uses its salt. A peer that hangs up on SVERIFY is asked
+// VERIFY and sent what crypto.Encrypt seals, as before, if LegacyVerify
+// allows it, else it is ErrLegacyVerify.
+func (c Client) VerifySalted(ip, password string) (bool, error) {
+	if !LegacySalted && !LegacyVerify {
+		if c.Pool != nil {
+			c.Pool.setSalt(ip, nil)
+			c.Pool.setSession(ip, nil, nil)
+		}
+		return false, ErrLegacySalted
+	}
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return false, err
+	}
+	proof := crypto.Proof(password, salt)
+	var resp string
+	err = c.request(context.Background(), ip, func(conn *conn) error {
+		fmt.Fprintf(conn, "SVERIFY:%x:%s\n", salt, proof)
+		var err error
+		resp, err = conn.readLine()
+		return err
+	})
+	if err != nil && resp == "" && !errors.As(err, new(*OpError)) {
+		// Hung up on: a peer from before SVERIFY
+		if c.Pool != nil {
+			c.Pool.setSalt(ip, nil)
+			c.Pool.setSession(ip, nil, nil)
+		}
+		if !LegacyVerify {
+			return false, ErrLegacyVerify
+		}
+		return c.Verify(ip, crypto.Fingerprint(password))
+	}
+	match := err == nil && strings.TrimSpace(resp) == "VMATCH"
+	if c.Pool != nil {
+		if !match {
+			salt = nil
+		}
+		c.Pool.setSalt(ip, salt)
+		c.Pool.setSession(ip, nil, nil)
+	}
+	return match, err
+}
+
+// Identify is the package-level Identify through c's Dialer
+func (c Client) Identify(ip string) (ed25519.PublicKey, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	var resp string
+	var local string
+	err := c.request(context.Background(), ip, func(conn *conn) error {
+		conn.SetDeadline(time.Now().Add(DialTimeout))
+		fmt.Fprintf(conn, "IDENT:%x\n", challenge)
+		var err error
+		resp, err = conn.readLine()
+		local = localIP(conn)
+		return err
+	})
+	if err != nil {
+		if errors.As(err, new(*OpError)) {
+			return nil, err
+		}
+		return nil, ErrNoIdentity
+	}
+	if strings.TrimSpace(resp) == "NOIDENT" {
+		return nil, ErrNoIdentity
+	}
+	key, sig, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(resp), "IDENTITY:"), ":")
+	pub, err1 := hex.DecodeString(key)
+	rawSig, err2 := hex.DecodeString(sig)
+	if !ok || err1 != nil || err2 != nil || !crypto.VerifyIdentity(pub, identityProof(challenge, local), rawSig) {
+		return nil, errors.New("bad identity proof")
+	}
+	return pub, nil
+}
+
+// identityProof is what IDENTITY signs: the challenge and the address the
+// challenge came from, so a peer relaying our challenge to someone else
+// can't pass their answer off as its own
+func identityProof(challenge []byte, requester string) []byte {
+	return append(append([]byte{}, challenge...), requester...)
+}
+
+func localIP(c net.Conn) string {
+	host, _, err := net.SplitHostPort(c.LocalAddr().String())
+	if err != nil {
+		return c.LocalAddr().String()
+	}
+	return host
+}
@@ -0,0 +1,706 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lan-chat/internal/crash"
+	"lan-chat/internal/crypto"
+)
+
+// ErrNoPassword means a peer sent encrypted data but we run without --pass
+var ErrNoPassword = errors.New("encrypted data received but no password set")
+
+// ErrIncomplete is a file that didn't arrive or couldn't be saved whole:
+// the connection broke off, or writing it failed
+var ErrIncomplete = errors.New("file not received whole")
+
+// ErrMismatch is a file whose content doesn't hash to what its offer said,
+// reported wrapped in ErrIncomplete
+var ErrMismatch = errors.New("content doesn't match the offered checksum")
+
+// ErrTooLarge is a file that turned out larger than MaxFileSize, or than
+// an EFILE may be
+var ErrTooLarge = errors.New("file larger than the size limit")
+
+// Offer is an incoming file as its header announces it, before any of it
+// is read. Older senders announce only the name.
+type Offer struct {
+	From string // sender IP
+	Name string
+	Size int64  // -1 when not announced
+	Hash string // hex SHA-256 of the content, "" when not announced
+}
+
+// Target is where an accepted file is saved
+type Target struct {
+	Dir string // "" for the working directory
+	// Overwrite replaces a file already saved under the same name; without
+	// it the new one gets a number added to its name
+	Overwrite bool
+}
+
+// maxCopies bounds the numbers tried for the name of a file that is taken
+const maxCopies = 1000
+
+// progressInterval throttles Server.Progress
+const progressInterval = 200 * time.Millisecond
+
+// Chat is an incoming chat message. Err is set when an encrypted message
+// could not be read: ErrNoPassword, or the decryption error.
+type Chat struct {
+	From      string // sender IP
+	Sender    string
+	Time      time.Time // when the sender sent it, by its clock; zero from a peer before timestamps
+	Text      string
+	Encrypted bool
+	Group     bool // sent to everyone rather than to us alone
+	Err       error
+}
+
+// File is a completed incoming transfer
+type File struct {
+	From      string // sender IP
+	Name      string
+	Path      string // where it was saved
+	Encrypted bool
+}
+
+// FileError is an incoming transfer that could not be saved
+type FileError struct {
+	From string // sender IP
+	Name string
+	Err  error // ErrNoPassword, ErrIncomplete or the decryption error
+}
+
+func (e *FileError) Error() string { return e.Name + ": " + e.Err.Error() }
+func (e *FileError) Unwrap() error { return e.Err }
+
+// Handler receives what arrives on the server. Methods are called from the
+// connection goroutines.
+type Handler interface {
+	Chat(c Chat)
+	File(f File)
+	Error(err error)
+}
+
+// Server answers peers: it stores files, decrypts chats and answers
+// heartbeats and password checks
+type Server struct {
+	Password    string
+	Fingerprint string             // crypto.Fingerprint(Password), "" without a password
+	Identity    ed25519.PrivateKey // answers IDENT when set
+	Handler     Handler
+	Dir         string                                // where received files are saved, "" for the working directory
+	Accept      func(o Offer) (t Target, ok bool)     // optional: where the offered file is saved, or not ok to refuse it; it may wait for a person to decide
+	Progress    func(o Offer, received int64)         // optional: bytes of a file read so far, every progressInterval while it arrives
+	Logf        func(format string, v ...interface{}) // optional debug log
+
+	sessMu   sync.Mutex
+	sessions map[string]*serverSession // keys agreed with SESSION, by ID
+}
+
+// Listen opens the TCP port peers connect to
+func Listen() (net.Listener, error) { return TCP{}.Listen() }
+
+// accept answers a file header: ACCEPTED with where to save it, or
+// REFUSED
+func (s *Server) accept(c net.Conn, o Offer) (Target, bool) {
+	if MaxFileSize > 0 && o.Size > MaxFileSize {
+		s.logf("Refused file %s from %s: %d bytes, over the limit of %d", o.Name, o.From, o.Size, MaxFileSize)
+		fmt.Fprintln(c, "REFUSED")
+		return Target{}, false
+	}
+	t := Target{Dir: s.Dir}
+	if s.Accept != nil {
+		var ok bool
+		if t, ok = s.Accept(o); !ok {
+			s.logf("Refused file %s from %s", o.Name, o.From)
+			fmt.Fprintln(c, "REFUSED")
+			return Target{}, false
+		}
+	}
+	fmt.Fprintln(c, "ACCEPTED")
+	return t, true
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, v...)
+	}
+}
+
+// Serve handles connections on ln until it is closed
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if err != nil {
+			s.logf("TCP accept error: %v", err)
+			continue
+		}
+		go s.handle(conn)
+	}
+}
+
+var colon = []byte(":")
+
+// readHeader is the header line of a connection. It points into r's buffer
+// unless it didn't fit there, so it is only good until r is read again.
+func readHeader(r *bufio.Reader) []byte {
+	header, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// A long chat message: copy out what fits before reading the rest
+		// over it
+		header = append([]byte{}, header...)
+		more, _ := r.ReadBytes('\n')
+		header = append(header, more...)
+	}
+	return header
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer crash.Recover("TCP connection")
+	defer c.Close()
+	reader := getReader(c)
+	defer putReader(reader)
+	header := readHeader(reader)
+	if !bytes.Equal(bytes.TrimSpace(header), []byte("POOL")) {
+		s.request(c, reader, header, false)
+		return
+	}
+	// A connection kept for more requests: serve them until the client
+	// hangs up or stops asking
+	fmt.Fprintln(c, "POOLED")
+	setKeepAlive(c)
+	for {
+		c.SetReadDeadline(time.Now().Add(serverIdleTimeout))
+		if header = readHeader(reader); len(header) == 0 {
+			return
+		}
+		c.SetReadDeadline(time.Time{})
+		if !s.request(c, reader, header, true) {
+			return
+		}
+	}
+}
+
+// request answers one header read from c through r. On a pooled
+// connection chats are acknowledged and every answer is sent, so the
+// client knows it is done; keep is whether the connection can take
+// another request.
+func (s *Server) request(c net.Conn, r *bufio.Reader, header []byte, pooled bool) (keep bool) {
+	// The header is parsed in place; only what is kept becomes a string
+	verb, rest, _ := bytes.Cut(header, colon)
+	switch string(verb) {
+	case "FILE":
+		o := Offer{From: RemoteIP(c), Name: SafeName(string(bytes.TrimSpace(rest))), Size: -1}
+		t, ok := s.accept(c, o)
+		if !ok {
+			return false
+		}
+		path, err := s.save(t, o, s.progress(capped(r, MaxFileSize), o))
+		if err != nil {
+			s.logf("Receiving %s from %s: %v", o.Name, o.From, err)
+			s.Handler.Error(&FileError{From: o.From, Name: o.Name, Err: err})
+			return false
+		}
+		s.Handler.File(File{From: o.From, Name: o.Name, Path: path})
+		return false // the file ran to EOF
+	case "SFILE":
+		o := offerOf(c, rest, true)
+		if o.Size < 0 {
+			// Without it there's no telling where the file ends
+			s.logf("Refused file %s from %s: no size in the header", o.Name, o.From)
+			fmt.Fprintln(c, "REFUSED")
+			return false
+		}
+		t, ok := s.accept(c, o)
+		if !ok {
+			return false
+		}
+		path, err := s.save(t, o, s.progress(io.LimitReader(r, o.Size), o))
+		if err != nil {
+			s.logf("Receiving %s from %s: %v", o.Name, o.From, err)
+			s.Handler.Error(&FileError{From: o.From, Name: o.Name, Err: err})
+			return false
+		}
+		s.Handler.File(File{From: o.From, Name: o.Name, Path: path})
+		return s.saved(c, pooled)
+	case "EFILE":
+		o := Offer{From: RemoteIP(c), Name: SafeName(string(bytes.TrimSpace(rest))), Size: -1}
+		t, ok := s.accept(c, o)
+		if !ok {
+			return false
+		}
+		s.logf("Receiving encrypted file: %s", o.Name)
+		var encoded strings.Builder
+		if _, err := io.Copy(&encoded, s.progress(capped(r, blobLimit()), o)); err != nil {
+			s.logf("Receiving %s from %s: %v", o.Name, o.From, err)
+			s.Handler.Error(&FileError{From: o.From, Name: o.Name, Err: fmt.Errorf("%w: %w", ErrIncomplete, err)})
+			return false
+		}
+		if s.Password == "" {
+			s.logf("Encrypted file received but no password set: %s", o.Name)
+			s.Handler.Error(&FileError{From: o.From, Name: o.Name, Err: ErrNoPassword})
+			return false
+		}
+		plaintext, err := crypto.Decrypt(encoded.String(), s.Password)
+		if err != nil {
+			s.logf("File decryption failed for %s: %v", o.Name, err)
+			s.Handler.Error(&FileError{From: o.From, Name: o.Name, Err: err})
+			return false
+		}
+		s.logf("File decrypted successfully: %s", o.Name)
+		path, err := s.save(t, o, bytes.NewReader(plaintext))
+		if err != nil {
+			s.logf("Saving %s: %v", o.Name, err)
+			s.Handler.Error(&FileError{From: o.From, Name: o.Name, Err: err})
+			return false
+		}
+		s.Handler.File(File{From: o.From, Name: o.Name, Path: path, Encrypted: true})
+		return false
+	case "SEFILE":
+		field, rest := cutKey(rest)
+		if s.unknownSession(field) {
+			s.logf("File from %s under a session key we don't have", c.RemoteAddr())
+			fmt.Fprintln(c, "REKEY")
+			return pooled
+		}
+		o := offerOf(c, rest, false)
+		t, ok := s.accept(c, o)
+		if !ok {
+			return false
+		}
+		if s.Password == "" {
+			// Nothing to decrypt it with, so don't wait for it
+			s.logf("Encrypted file received but no password set: %s", o.Name)
+			s.Handler.Error(&FileError{From: o.From, Name: o.Name, Err: ErrNoPassword})
+			return false
+		}
+		s.logf("Receiving encrypted file: %s", o.Name)
+		plain, err := s.reader(r, field)
+		if err == nil {
+			// Counted once decrypted, so it adds up to the announced size
+			var path string
+			if path, err = s.save(t, o, s.progress(capped(plain, MaxFileSize), o)); err == nil {
+				s.Handler.File(File{From: o.From, Name: o.Name, Path: path, Encrypted: true})
+				return s.saved(c, pooled)
+			}
+		}
+		if errors.Is(err, crypto.ErrDecrypt) {
+			// The wrong password rather than a transfer cut short
+			err = crypto.ErrDecrypt
+		}
+		s.logf("Receiving %s from %s: %v", o.Name, o.From, err)
+		s.Handler.Error(&FileError{From: o.From, Name: o.Name, Err: err})
+		return false
+	case "CHAT":
+		sender, text, ok := bytes.Cut(rest, colon)
+		if !ok {
+			return false
+		}
+		s.Handler.Chat(Chat{From: RemoteIP(c), Sender: string(sender), Text: string(bytes.TrimSpace(text))})
+		if pooled {
+			fmt.Fprintln(c, "OK")
+		}
+	case "ECHAT":
+		sender, ciphertext, ok := bytes.Cut(rest, colon)
+		if !ok {
+			return false
+		}
+		s.Handler.Chat(s.open(Chat{From: RemoteIP(c), Sender: string(sender)}, string(bytes.TrimSpace(ciphertext))))
+		if pooled {
+			fmt.Fprintln(c, "OK")
+		}
+	case "FRAME":
+		f, ok := readFrame(r, rest)
+		if !ok {
+			return false
+		}
+		if f.V != frameVersion || (f.Type != "chat" && f.Type != "gchat") {
+			s.logf("Unsupported frame from %s: version %d, type %q", c.RemoteAddr(), f.V, f.Type)
+			fmt.Fprintln(c, "UNSUPPORTED")
+			return pooled
+		}
+		if s.unknownSession(f.Sealed) {
+			s.logf("Frame from %s under a session key we don't have", c.RemoteAddr())
+			fmt.Fprintln(c, "REKEY")
+			return pooled
+		}
+		msg := Chat{From: RemoteIP(c), Sender: f.Sender, Time: f.Time, Text: f.Text, Group: f.Type == "gchat"}
+		if f.Sealed != "" {
+			msg = s.open(msg, f.Sealed)
+		}
+		s.Handler.Chat(msg)
+		fmt.Fprintln(c, "OK")
+	case "VERIFY":
+		if s.Fingerprint != "" && subtle.ConstantTimeCompare(bytes.TrimSpace(rest), []byte(s.Fingerprint)) == 1 {
+			s.logf("VERIFY from %s: passwords match", c.RemoteAddr())
+			fmt.Fprintln(c, "VMATCH")
+		} else {
+			s.logf("VERIFY from %s: passwords do not match", c.RemoteAddr())
+			fmt.Fprintln(c, "VNOMATCH")
+		}
+	case "PAKE", "SESSION":
+		return s.pake(c, r, rest, string(verb) == "SESSION")
+	case "SVERIFY":
+		field, proof, _ := bytes.Cut(bytes.TrimSpace(rest), colon)
+		salt, err := crypto.ParseSalt(string(field))
+		if s.Password != "" && err == nil && crypto.CheckProof(s.Password, salt, string(proof)) {
+			s.logf("SVERIFY from %s: passwords match", c.RemoteAddr())
+			fmt.Fprintln(c, "VMATCH")
+		} else {
+			s.logf("SVERIFY from %s: passwords do not match", c.RemoteAddr())
+			fmt.Fprintln(c, "VNOMATCH")
+		}
+	case "IDENT":
+		challenge, err := hex.DecodeString(string(bytes.TrimSpace(rest)))
+		if s.Identity == nil || err != nil || len(challenge) == 0 || len(challenge) > 64 {
+			if pooled {
+				fmt.Fprintln(c, "NOIDENT")
+			}
+			return pooled
+		}
+		pub := s.Identity.Public().(ed25519.PublicKey)
+		fmt.Fprintf(c, "IDENTITY:%x:%x\n", pub, crypto.SignIdentity(s.Identity, identityProof(challenge, RemoteIP(c))))
+	default:
+		if !bytes.HasPrefix(header, []byte("PING")) {
+			return false
+		}
+		fmt.Fprintln(c, "PONG")
+	}
+	return true
+}
+
+// pake answers PAKE:<salt>:<share> (see Client.Pake), or SESSION, which
+// keeps the session key on a match; keep is false when the client's
+// confirmation doesn't come
+func (s *Server) pake(c net.Conn, r *bufio.Reader, rest []byte, session bool) (keep bool) {
+	field, share, _ := bytes.Cut(bytes.TrimSpace(rest), colon)
+	salt, err := crypto.ParseSalt(string(field))
+	var p *crypto.Pake
+	if s.Password != "" && err == nil {
+		p, err = crypto.NewPake(s.Password, salt, true)
+	}
+	if s.Password != "" && err == nil {
+		var theirs []byte
+		if theirs, err = hex.DecodeString(string(share)); err == nil {
+			err = p.Finish(theirs)
+		}
+	}
+	if s.Password == "" || err != nil {
+		s.logf("PAKE from %s: no password, or a bad request", c.RemoteAddr())
+		fmt.Fprintln(c, "VNOMATCH")
+		return true
+	}
+	fmt.Fprintf(c, "PAKE:%x:%x\n", p.Share(), p.Confirm())
+	c.SetReadDeadline(time.Now().Add(DialTimeout))
+	line, err := r.ReadString('\n')
+	c.SetReadDeadline(time.Time{})
+	if err != nil {
+		return false
+	}
+	confirm, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(line), "PAKE:"))
+	if err == nil && p.Check(confirm) {
+		s.logf("PAKE from %s: passwords match", c.RemoteAddr())
+		if session {
+			s.addSession(p.Session())
+		}
+		fmt.Fprintln(c, "VMATCH")
+	} else {
+		s.logf("PAKE from %s: passwords do not match", c.RemoteAddr())
+		fmt.Fprintln(c, "VNOMATCH")
+	}
+	return true
+}
+
+// saved ends a sized file that was saved: on a pooled connection the
+// client is told, and the connection goes on, since the file's end was
+// known and nothing of it is left to read
+func (s *Server) saved(c net.Conn, pooled bool) (keep bool) {
+	if pooled {
+		fmt.Fprintln(c, "SAVED")
+	}
+	return pooled
+}
+
+// blobLimit is how much of an EFILE is read: maxBlob, or MaxFileSize if
+// smaller, as base64 with room for the salt, nonce and tag
+func blobLimit() int64 {
+	limit := int64(maxBlob)
+	if MaxFileSize > 0 {
+		limit = min(limit, MaxFileSize)
+	}
+	return int64(base64.StdEncoding.EncodedLen(int(limit))) + 1024
+}
+
+// capped reads r, failing with ErrTooLarge once more than max bytes come;
+// max 0 leaves r as it is
+func capped(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &capReader{r: r, left: max}
+}
+
+type capReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (c *capReader) Read(p []byte) (int, error) {
+	// One byte past the limit is enough to tell
+	if int64(len(p)) > c.left+1 {
+		p = p[:c.left+1]
+	}
+	n, err := c.r.Read(p)
+	if int64(n) > c.left {
+		n = int(c.left)
+		c.left = 0
+		return n, ErrTooLarge
+	}
+	c.left -= int64(n)
+	return n, err
+}
+
+// open decrypts the text of an encrypted chat into msg
+func (s *Server) open(msg Chat, sealed string) Chat {
+	msg.Encrypted = true
+	s.logf("Received encrypted chat from %s", msg.Sender)
+	if s.Password == "" {
+		s.logf("Encrypted chat from %s but no password set", msg.Sender)
+		msg.Err = ErrNoPassword
+	} else if plaintext, err := s.decrypt(sealed); err != nil {
+		s.logf("Chat decryption failed from %s: %v", msg.Sender, err)
+		msg.Err = err
+	} else {
+		s.logf("Chat decrypted successfully from %s", msg.Sender)
+		msg.Text = string(plaintext)
+	}
+	return msg
+}
+
+// decrypt opens a chat's sealed text, under its session key if it names
+// one
+func (s *Server) decrypt(sealed string) ([]byte, error) {
+	if id, ok := crypto.SessionID(sealed); ok {
+		k := s.session(id)
+		if k == nil {
+			return nil, errNoSession
+		}
+		return k.Decrypt(sealed)
+	}
+	return crypto.Decrypt(sealed, s.Password)
+}
+
+// SafeName is a file name a peer sent made safe to save: its last path
+// element, whichever separator the sender's OS uses, with control
+// characters and those Windows doesn't allow in a name replaced, and
+// never empty, "." or ".."
+func SafeName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	// Windows drops trailing dots and spaces, so two names would be one
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// SavedPath is where a file of that name is saved in dir, unless that is
+// taken and it isn't overwritten
+func SavedPath(dir, name string) string {
+	return filepath.Join(dir, "received_"+name)
+}
+
+// save writes a received file as SavedPath(t.Dir, o.Name), or under a
+// numbered name when that is taken and t doesn't overwrite it. It goes to
+// a temporary file first and is renamed once whole, so two transfers of
+// the same name don't write into each other and one that breaks off leaves
+// nothing behind. One shorter than its offer's size, or not matching its
+// hash, has broken off too. Errors wrap ErrIncomplete.
+func (s *Server) save(t Target, o Offer, src io.Reader) (string, error) {
+	path := SavedPath(t.Dir, o.Name)
+	f, err := os.CreateTemp(filepath.Dir(path), ".received_"+o.Name+".*")
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrIncomplete, err)
+	}
+	// CreateTemp makes it private; os.Create didn't
+	f.Chmod(0644)
+	var dst io.Writer = f
+	h := sha256.New()
+	if o.Hash != "" {
+		dst = io.MultiWriter(f, h)
+	}
+	n, err := io.Copy(dst, src)
+	switch {
+	case err != nil:
+	case o.Size >= 0 && n < o.Size:
+		err = io.ErrUnexpectedEOF
+	case o.Hash != "" && hex.EncodeToString(h.Sum(nil)) != o.Hash:
+		err = ErrMismatch
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		path, err = place(f.Name(), path, t.Overwrite)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("%w: %w", ErrIncomplete, err)
+	}
+	return path, nil
+}
+
+// place renames the temporary file tmp to path, or to the first of
+// "name (1).ext", "name (2).ext"... that is free unless overwrite. It
+// returns the path it went to.
+func place(tmp, path string, overwrite bool) (string, error) {
+	if overwrite {
+		return path, os.Rename(tmp, path)
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 0; i < maxCopies; i++ {
+		candidate := path
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
+		// A link fails rather than replace a file that appeared meanwhile
+		err := os.Link(tmp, candidate)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			// No hard links here (FAT, some network shares): check, then rename
+			if _, serr := os.Lstat(candidate); serr == nil {
+				continue
+			}
+			return candidate, os.Rename(tmp, candidate)
+		}
+		return candidate, os.Remove(tmp)
+	}
+	return "", fmt.Errorf("%s and %d numbered copies exist", path, maxCopies-1)
+}
+
+// offerOf reads the <size>:<sha256>:<name> of an SFILE header, or the
+// <size>:<name> of an SEFILE one without hashed. A size that is missing or
+// not a number is -1, and a hash that isn't one is dropped.
+func offerOf(c net.Conn, rest []byte, hashed bool) Offer {
+	o := Offer{From: RemoteIP(c), Size: -1}
+	field, rest, _ := bytes.Cut(rest, colon)
+	if size, err := strconv.ParseInt(string(field), 10, 64); err == nil && size >= 0 {
+		o.Size = size
+	}
+	if hashed {
+		field, rest, _ = bytes.Cut(rest, colon)
+		if len(field) == 2*sha256.Size {
+			if _, err := hex.Decode(make([]byte, sha256.Size), field); err == nil {
+				o.Hash = strings.ToLower(string(field))
+			}
+		}
+	}
+	o.Name = SafeName(string(bytes.TrimSpace(rest)))
+	return o
+}
+
+// cutKey takes the field saying which key a stream is under out of the
+// rest of a SEFILE header, <size>:<salt>:<name> or <size>:$3$<id>:<name>,
+// leaving <size>:<name>; the rest of one without it is returned as it is,
+// with field ""
+func cutKey(rest []byte) (field string, out []byte) {
+	size, after, _ := bytes.Cut(rest, colon)
+	key, name, ok := bytes.Cut(after, colon)
+	if !ok {
+		return "", rest
+	}
+	if _, err := crypto.ParseSalt(string(key)); err != nil {
+		if _, ok := crypto.SessionID(string(key)); !ok {
+			return "", rest
+		}
+	}
+	return string(key), append(append(size[:len(size):len(size)], ':'), name...)
+}
+
+// reader decrypts a SEFILE stream under the key its field names
+func (s *Server) reader(r io.Reader, field string) (io.Reader, error) {
+	if id, ok := crypto.SessionID(field); ok {
+		k := s.session(id)
+		if k == nil {
+			return nil, errNoSession
+		}
+		return k.NewReader(r)
+	}
+	if field != "" {
+		salt, err := crypto.ParseSalt(field)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.NewSaltedReader(r, s.Password, salt)
+	}
+	return crypto.NewReader(r, s.Password)
+}
+
+// progress is r reporting what has been read of the offered file to
+// s.Progress, or r itself without one
+func (s *Server) progress(r io.Reader, o Offer) io.Reader {
+	if s.Progress == nil {
+		return r
+	}
+	return &progressReader{r: r, report: func(n int64) { s.Progress(o, n) }}
+}
+
+// progressReader counts the bytes of an incoming file
+type progressReader struct {
+	r      io.Reader
+	n      int64
+	last   time.Time
+	report func(received int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	k, err := p.r.Read(b)
+	p.n += int64(k)
+	if time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.report(p.n)
+	}
+	return k, err
+}
+
+// RemoteIP is the peer address of a connection, without the port
+func RemoteIP(c net.Conn) string {
+	host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+	if err != nil {
+		return c.RemoteAddr().String()
+	}
+	return host
+}
@@ -0,0 +1,190 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"lan-chat/internal/crypto"
+)
+
+// SESSION is PAKE that also leaves both sides with a key of their own for
+// what the client sends from then on (see crypto.Session), rather than one
+// worked out from the password, so traffic recorded now can't be read
+// later by someone who learns the password. The client agrees on a new one
+// once its key is older than RekeyAfter, with the same salt, which costs
+// one round trip and no Argon2id. The server keeps the keys in memory only,
+// and forgets one unused for sessionIdle; a chat frame or SEFILE sealed
+// under a key it doesn't have is answered REKEY, and the client agrees on
+// a new one and sends it again. A peer from before SESSION hangs up on it
+// and is checked with PAKE, and sealed for with the salt as before.
+
+// RekeyAfter is how long a client seals under one session key before it
+// agrees on the next
+const RekeyAfter = time.Hour
+
+// sessionIdle is how long the server keeps a session key nobody uses
+const sessionIdle = 15 * time.Minute
+
+// maxSessions bounds the session keys a server keeps; the least recently
+// used goes first
+const maxSessions = 1024
+
+// ErrSession is a peer that lost our session key, or let it run out, and
+// then didn't agree on a new one: the passwords no longer match
+var ErrSession = errors.New("peer no longer verifies, no session key to encrypt with")
+
+// errRekey is a peer that answered REKEY
+var errRekey = errors.New("peer doesn't have the session key")
+
+// errNoSession is something sealed under a session key the server doesn't
+// have, which it can't ask to be sent again
+var errNoSession = errors.New("encrypted under a session key we don't have")
+
+// session is a key the client agreed on with a peer
+type session struct {
+	key  *crypto.Session
+	salt []byte // to agree on the next with
+	at   time.Time
+}
+
+// sealing is what is sent to a peer is encrypted with: nothing without a
+// password; else the session key agreed with it by SESSION, the salt it
+// was verified with by SVERIFY or PAKE, a salt of its own without a Pool
+// to keep those in, or for peers verified with VERIFY the password alone
+type sealing struct {
+	password string
+	salt     []byte
+	session  *crypto.Session
+}
+
+// sealing is how to encrypt for ip with password, agreeing on a new
+// session key first when the one in the Pool is older than RekeyAfter.
+// Without a Pool each message or file gets a new salt, which it carries,
+// so the unsalted key is never used for a peer that wasn't checked with it.
+func (c Client) sealing(ip, password string) (sealing, error) {
+	s := sealing{password: password}
+	if password == "" {
+		return s, nil
+	}
+	if c.Pool == nil {
+		var err error
+		s.salt, err = crypto.NewSalt()
+		return s, err
+	}
+	if ss, ok := c.Pool.session(ip); ok {
+		if time.Since(ss.at) > RekeyAfter {
+			if err := c.rekey(ip, password); err != nil {
+				return s, err
+			}
+			ss, _ = c.Pool.session(ip)
+		}
+		s.session = ss.key
+		return s, nil
+	}
+	s.salt = c.Pool.salt(ip)
+	return s, nil
+}
+
+// rekey agrees on a new session key with ip, with the salt of the last
+func (c Client) rekey(ip, password string) error {
+	ss, ok := c.Pool.session(ip)
+	salt := ss.salt
+	if !ok {
+		var err error
+		if salt, err = crypto.NewSalt(); err != nil {
+			return err
+		}
+	}
+	match, err := c.pake(ip, password, salt, "SESSION")
+	if errors.Is(err, ErrNoPake) || (err == nil && !match) {
+		return ErrSession
+	}
+	return err
+}
+
+func (s sealing) encrypt(plaintext []byte) (string, error) {
+	switch {
+	case s.session != nil:
+		return s.session.Encrypt(plaintext)
+	case s.salt != nil:
+		return crypto.EncryptSalted(plaintext, s.password, s.salt)
+	}
+	return crypto.Encrypt(plaintext, s.password)
+}
+
+// writer encrypts a file's stream onto w
+func (s sealing) writer(w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case s.session != nil:
+		return s.session.NewWriter(w)
+	case s.salt != nil:
+		return crypto.NewSaltedWriter(w, s.password, s.salt)
+	}
+	return crypto.NewWriter(w, s.password)
+}
+
+// field is what SEFILE carries ahead of the name to say which key the
+// stream is under, "" for the password's
+func (s sealing) field() string {
+	switch {
+	case s.session != nil:
+		return s.session.Tag()
+	case s.salt != nil:
+		return hex.EncodeToString(s.salt)
+	}
+	return ""
+}
+
+// serverSession is a key the server agreed on with a client
+type serverSession struct {
+	key  *crypto.Session
+	used time.Time
+}
+
+// addSession keeps a key a client agreed on, dropping those unused for
+// sessionIdle, or the least recently used when there are maxSessions
+func (s *Server) addSession(k *crypto.Session) {
+	s.sessMu.Lock()
+	defer s.sessMu.Unlock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]*serverSession)
+	}
+	var oldest string
+	for id, ss := range s.sessions {
+		if time.Since(ss.used) > sessionIdle {
+			delete(s.sessions, id)
+		} else if oldest == "" || ss.used.Before(s.sessions[oldest].used) {
+			oldest = id
+		}
+	}
+	if len(s.sessions) >= maxSessions {
+		delete(s.sessions, oldest)
+	}
+	s.sessions[string(k.ID)] = &serverSession{key: k, used: time.Now()}
+}
+
+// session is the key with that ID, nil if there is none or it went unused
+// for sessionIdle
+func (s *Server) session(id []byte) *crypto.Session {
+	s.sessMu.Lock()
+	defer s.sessMu.Unlock()
+	ss, ok := s.sessions[string(id)]
+	if !ok {
+		return nil
+	}
+	if time.Since(ss.used) > sessionIdle {
+		delete(s.sessions, string(id))
+		return nil
+	}
+	ss.used = time.Now()
+	return ss.key
+}
+
+// unknownSession reports whether sealed, a chat's text or a SEFILE key
+// field, is under a session key we don't have
+func (s *Server) unknownSession(sealed string) bool {
+	id, ok := crypto.SessionID(sealed)
+	return ok && s.session(id) == nil
+}
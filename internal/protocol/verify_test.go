@@ -0,0 +1,153 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/memnet"
+)
+
+// oldPeer answers the password checks of a peer from before PAKE: it hangs
+// up on the verbs in hangUp, and on anything newer, and answers SVERIFY and
+// VERIFY for password
+type oldPeer struct {
+	password string
+	hangUp   []string
+
+	mu    sync.Mutex
+	asked []string // verbs received, in order
+}
+
+func (p *oldPeer) serve(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(c)
+	}
+}
+
+func (p *oldPeer) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		verb, rest, _ := strings.Cut(strings.TrimSpace(line), ":")
+		if verb == "POOL" {
+			return // newer than it: hung up on, and not counted
+		}
+		p.mu.Lock()
+		p.asked = append(p.asked, verb)
+		p.mu.Unlock()
+		if slices.Contains(p.hangUp, verb) {
+			return
+		}
+		match := false
+		switch verb {
+		case "SVERIFY":
+			field, proof, _ := strings.Cut(rest, ":")
+			salt, err := hex.DecodeString(field)
+			match = err == nil && crypto.CheckProof(p.password, salt, proof)
+		case "VERIFY":
+			match = rest == crypto.Fingerprint(p.password)
+		default:
+			return
+		}
+		if match {
+			fmt.Fprintln(c, "VMATCH")
+		} else {
+			fmt.Fprintln(c, "VNOMATCH")
+		}
+	}
+}
+
+func (p *oldPeer) verbs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.asked)
+}
+
+func TestVerifyPassword(t *testing.T) {
+	pakeVerbs := []string{"SESSION", "PAKE"}
+	tests := []struct {
+		name         string
+		peer         string // "current", "salted" (before PAKE) or "unsalted" (before SVERIFY)
+		peerPassword string
+		legacySalted bool
+		legacyVerify bool
+		match        bool
+		err          error
+		asked        []string // verbs an older peer was sent
+	}{
+		{name: "pake match", peer: "current", peerPassword: "secret", match: true},
+		{name: "pake mismatch", peer: "current", peerPassword: "other"},
+		{name: "pake with legacy allowed", peer: "current", peerPassword: "secret", legacySalted: true, legacyVerify: true, match: true},
+		{name: "downgrade refused", peer: "salted", peerPassword: "secret",
+			err: ErrLegacySalted, asked: pakeVerbs},
+		{name: "salted allowed", peer: "salted", peerPassword: "secret", legacySalted: true,
+			match: true, asked: append(pakeVerbs, "SVERIFY")},
+		{name: "salted mismatch", peer: "salted", peerPassword: "other", legacySalted: true,
+			asked: append(pakeVerbs, "SVERIFY")},
+		{name: "unsalted refused", peer: "unsalted", peerPassword: "secret", legacySalted: true,
+			err: ErrLegacyVerify, asked: append(pakeVerbs, "SVERIFY")},
+		{name: "unsalted allowed", peer: "unsalted", peerPassword: "secret", legacyVerify: true,
+			match: true, asked: append(pakeVerbs, "SVERIFY", "VERIFY")},
+		{name: "unsalted mismatch", peer: "unsalted", peerPassword: "other", legacyVerify: true,
+			asked: append(pakeVerbs, "SVERIFY", "VERIFY")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			salted, verify := LegacySalted, LegacyVerify
+			LegacySalted, LegacyVerify = tt.legacySalted, tt.legacyVerify
+			t.Cleanup(func() { LegacySalted, LegacyVerify = salted, verify })
+
+			nw := memnet.New()
+			server := nw.Host("10.0.0.2")
+			ln, err := server.Listen()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			var old *oldPeer
+			switch tt.peer {
+			case "current":
+				s := &Server{Password: tt.peerPassword, Fingerprint: crypto.Fingerprint(tt.peerPassword)}
+				go s.Serve(ln)
+			case "salted":
+				old = &oldPeer{password: tt.peerPassword, hangUp: pakeVerbs}
+			case "unsalted":
+				old = &oldPeer{password: tt.peerPassword, hangUp: append(pakeVerbs, "SVERIFY")}
+			}
+			if old != nil {
+				go old.serve(ln)
+			}
+
+			c := Client{Dialer: nw.Host("10.0.0.1"), Pool: NewPool()}
+			match, err := c.VerifyPassword("10.0.0.2", "secret")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("VerifyPassword error = %v, want %v", err, tt.err)
+			}
+			if match != tt.match {
+				t.Errorf("VerifyPassword match = %t, want %t", match, tt.match)
+			}
+			if old != nil && !slices.Equal(old.verbs(), tt.asked) {
+				t.Errorf("peer was asked %q, want %q", old.verbs(), tt.asked)
+			}
+			if !match && c.Pool.salt("10.0.0.2") != nil {
+				t.Error("a failed check left a salt to seal with")
+			}
+		})
+	}
+}
@@ -0,0 +1,1035 @@
+// Control API of a running lan-chat instance, served over a unix socket
+// with --grpc. Regenerate the Go code with `make proto`.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: lanchat.proto
+
+package lanchatpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Peer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Ip            string                 `protobuf:"bytes,2,opt,name=ip,proto3" json:"ip,omitempty"`
+	Secure        bool                   `protobuf:"varint,3,opt,name=secure,proto3" json:"secure,omitempty"`       // password verified, traffic is encrypted
+	Reachable     bool                   `protobuf:"varint,4,opt,name=reachable,proto3" json:"reachable,omitempty"` // answered the last heartbeat
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Peer) Reset() {
+	*x = Peer{}
+	mi := &file_lanchat_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Peer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Peer) ProtoMessage() {}
+
+func (x *Peer) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Peer.ProtoReflect.Descriptor instead.
+func (*Peer) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Peer) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Peer) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Peer) GetSecure() bool {
+	if x != nil {
+		return x.Secure
+	}
+	return false
+}
+
+func (x *Peer) GetReachable() bool {
+	if x != nil {
+		return x.Reachable
+	}
+	return false
+}
+
+type Message struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Peer          string                 `protobuf:"bytes,2,opt,name=peer,proto3" json:"peer,omitempty"` // the other side's name
+	Ip            string                 `protobuf:"bytes,3,opt,name=ip,proto3" json:"ip,omitempty"`
+	Sent          bool                   `protobuf:"varint,4,opt,name=sent,proto3" json:"sent,omitempty"` // we sent it
+	Text          string                 `protobuf:"bytes,5,opt,name=text,proto3" json:"text,omitempty"`
+	Encrypted     bool                   `protobuf:"varint,6,opt,name=encrypted,proto3" json:"encrypted,omitempty"`
+	Group         bool                   `protobuf:"varint,7,opt,name=group,proto3" json:"group,omitempty"` // sent to everyone, in the Everyone conversation
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_lanchat_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Message) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Message) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *Message) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Message) GetSent() bool {
+	if x != nil {
+		return x.Sent
+	}
+	return false
+}
+
+func (x *Message) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *Message) GetEncrypted() bool {
+	if x != nil {
+		return x.Encrypted
+	}
+	return false
+}
+
+func (x *Message) GetGroup() bool {
+	if x != nil {
+		return x.Group
+	}
+	return false
+}
+
+type FileReceived struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"` // where it was saved
+	FromIp        string                 `protobuf:"bytes,3,opt,name=from_ip,json=fromIp,proto3" json:"from_ip,omitempty"`
+	Encrypted     bool                   `protobuf:"varint,4,opt,name=encrypted,proto3" json:"encrypted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileReceived) Reset() {
+	*x = FileReceived{}
+	mi := &file_lanchat_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileReceived) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileReceived) ProtoMessage() {}
+
+func (x *FileReceived) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileReceived.ProtoReflect.Descriptor instead.
+func (*FileReceived) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *FileReceived) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileReceived) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FileReceived) GetFromIp() string {
+	if x != nil {
+		return x.FromIp
+	}
+	return ""
+}
+
+func (x *FileReceived) GetEncrypted() bool {
+	if x != nil {
+		return x.Encrypted
+	}
+	return false
+}
+
+type TransferProgress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Peer          string                 `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Sent          int64                  `protobuf:"varint,3,opt,name=sent,proto3" json:"sent,omitempty"` // bytes read from the file so far
+	Total         int64                  `protobuf:"varint,4,opt,name=total,proto3" json:"total,omitempty"`
+	Done          bool                   `protobuf:"varint,5,opt,name=done,proto3" json:"done,omitempty"`
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"` // set when the transfer failed
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TransferProgress) Reset() {
+	*x = TransferProgress{}
+	mi := &file_lanchat_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TransferProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransferProgress) ProtoMessage() {}
+
+func (x *TransferProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransferProgress.ProtoReflect.Descriptor instead.
+func (*TransferProgress) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TransferProgress) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *TransferProgress) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *TransferProgress) GetSent() int64 {
+	if x != nil {
+		return x.Sent
+	}
+	return 0
+}
+
+func (x *TransferProgress) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *TransferProgress) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+func (x *TransferProgress) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Time  *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	// Types that are valid to be assigned to Kind:
+	//
+	//	*Event_PeerFound
+	//	*Event_PeerUpdated
+	//	*Event_Message
+	//	*Event_FileReceived
+	//	*Event_TransferProgress
+	//	*Event_Error
+	Kind          isEvent_Kind `protobuf_oneof:"kind"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_lanchat_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetKind() isEvent_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return nil
+}
+
+func (x *Event) GetPeerFound() *Peer {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_PeerFound); ok {
+			return x.PeerFound
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetPeerUpdated() *Peer {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_PeerUpdated); ok {
+			return x.PeerUpdated
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetMessage() *Message {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_Message); ok {
+			return x.Message
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetFileReceived() *FileReceived {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_FileReceived); ok {
+			return x.FileReceived
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetTransferProgress() *TransferProgress {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_TransferProgress); ok {
+			return x.TransferProgress
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetError() string {
+	if x != nil {
+		if x, ok := x.Kind.(*Event_Error); ok {
+			return x.Error
+		}
+	}
+	return ""
+}
+
+type isEvent_Kind interface {
+	isEvent_Kind()
+}
+
+type Event_PeerFound struct {
+	PeerFound *Peer `protobuf:"bytes,2,opt,name=peer_found,json=peerFound,proto3,oneof"`
+}
+
+type Event_PeerUpdated struct {
+	PeerUpdated *Peer `protobuf:"bytes,3,opt,name=peer_updated,json=peerUpdated,proto3,oneof"` // verification or reachability changed
+}
+
+type Event_Message struct {
+	Message *Message `protobuf:"bytes,4,opt,name=message,proto3,oneof"` // received or sent
+}
+
+type Event_FileReceived struct {
+	FileReceived *FileReceived `protobuf:"bytes,5,opt,name=file_received,json=fileReceived,proto3,oneof"`
+}
+
+type Event_TransferProgress struct {
+	TransferProgress *TransferProgress `protobuf:"bytes,6,opt,name=transfer_progress,json=transferProgress,proto3,oneof"`
+}
+
+type Event_Error struct {
+	Error string `protobuf:"bytes,7,opt,name=error,proto3,oneof"`
+}
+
+func (*Event_PeerFound) isEvent_Kind() {}
+
+func (*Event_PeerUpdated) isEvent_Kind() {}
+
+func (*Event_Message) isEvent_Kind() {}
+
+func (*Event_FileReceived) isEvent_Kind() {}
+
+func (*Event_TransferProgress) isEvent_Kind() {}
+
+func (*Event_Error) isEvent_Kind() {}
+
+type ListPeersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPeersRequest) Reset() {
+	*x = ListPeersRequest{}
+	mi := &file_lanchat_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPeersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPeersRequest) ProtoMessage() {}
+
+func (x *ListPeersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPeersRequest.ProtoReflect.Descriptor instead.
+func (*ListPeersRequest) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{5}
+}
+
+type ListPeersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Peers         []*Peer                `protobuf:"bytes,1,rep,name=peers,proto3" json:"peers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPeersResponse) Reset() {
+	*x = ListPeersResponse{}
+	mi := &file_lanchat_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPeersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPeersResponse) ProtoMessage() {}
+
+func (x *ListPeersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPeersResponse.ProtoReflect.Descriptor instead.
+func (*ListPeersResponse) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListPeersResponse) GetPeers() []*Peer {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+type SendMessageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Peer          string                 `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer,omitempty"` // name or IP
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendMessageRequest) Reset() {
+	*x = SendMessageRequest{}
+	mi := &file_lanchat_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendMessageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendMessageRequest) ProtoMessage() {}
+
+func (x *SendMessageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendMessageRequest.ProtoReflect.Descriptor instead.
+func (*SendMessageRequest) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SendMessageRequest) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *SendMessageRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type SendMessageResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendMessageResponse) Reset() {
+	*x = SendMessageResponse{}
+	mi := &file_lanchat_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendMessageResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendMessageResponse) ProtoMessage() {}
+
+func (x *SendMessageResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendMessageResponse.ProtoReflect.Descriptor instead.
+func (*SendMessageResponse) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{8}
+}
+
+type SendFileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Peer          string                 `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer,omitempty"` // name or IP
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"` // absolute, read by lan-chat
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendFileRequest) Reset() {
+	*x = SendFileRequest{}
+	mi := &file_lanchat_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendFileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendFileRequest) ProtoMessage() {}
+
+func (x *SendFileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendFileRequest.ProtoReflect.Descriptor instead.
+func (*SendFileRequest) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SendFileRequest) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *SendFileRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+type SendFileResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendFileResponse) Reset() {
+	*x = SendFileResponse{}
+	mi := &file_lanchat_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendFileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendFileResponse) ProtoMessage() {}
+
+func (x *SendFileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendFileResponse.ProtoReflect.Descriptor instead.
+func (*SendFileResponse) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{10}
+}
+
+type GetHistoryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Peer          string                 `protobuf:"bytes,1,opt,name=peer,proto3" json:"peer,omitempty"`    // name or IP; empty for everyone
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"` // newest N; 0 for all
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetHistoryRequest) Reset() {
+	*x = GetHistoryRequest{}
+	mi := &file_lanchat_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetHistoryRequest) ProtoMessage() {}
+
+func (x *GetHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetHistoryRequest.ProtoReflect.Descriptor instead.
+func (*GetHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetHistoryRequest) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GetHistoryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*Message             `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetHistoryResponse) Reset() {
+	*x = GetHistoryResponse{}
+	mi := &file_lanchat_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetHistoryResponse) ProtoMessage() {}
+
+func (x *GetHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetHistoryResponse.ProtoReflect.Descriptor instead.
+func (*GetHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetHistoryResponse) GetMessages() []*Message {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+type StreamEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_lanchat_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lanchat_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_lanchat_proto_rawDescGZIP(), []int{13}
+}
+
+var File_lanchat_proto protoreflect.FileDescriptor
+
+const file_lanchat_proto_rawDesc = "" +
+	"\n" +
+	"\rlanchat.proto\x12\n" +
+	"lanchat.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"`\n" +
+	"\x04Peer\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02ip\x18\x02 \x01(\tR\x02ip\x12\x16\n" +
+	"\x06secure\x18\x03 \x01(\bR\x06secure\x12\x1c\n" +
+	"\treachable\x18\x04 \x01(\bR\treachable\"\xb9\x01\n" +
+	"\aMessage\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x12\n" +
+	"\x04peer\x18\x02 \x01(\tR\x04peer\x12\x0e\n" +
+	"\x02ip\x18\x03 \x01(\tR\x02ip\x12\x12\n" +
+	"\x04sent\x18\x04 \x01(\bR\x04sent\x12\x12\n" +
+	"\x04text\x18\x05 \x01(\tR\x04text\x12\x1c\n" +
+	"\tencrypted\x18\x06 \x01(\bR\tencrypted\x12\x14\n" +
+	"\x05group\x18\a \x01(\bR\x05group\"m\n" +
+	"\fFileReceived\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x17\n" +
+	"\afrom_ip\x18\x03 \x01(\tR\x06fromIp\x12\x1c\n" +
+	"\tencrypted\x18\x04 \x01(\bR\tencrypted\"\x8e\x01\n" +
+	"\x10TransferProgress\x12\x12\n" +
+	"\x04peer\x18\x01 \x01(\tR\x04peer\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04sent\x18\x03 \x01(\x03R\x04sent\x12\x14\n" +
+	"\x05total\x18\x04 \x01(\x03R\x05total\x12\x12\n" +
+	"\x04done\x18\x05 \x01(\bR\x04done\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\"\x80\x03\n" +
+	"\x05Event\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x121\n" +
+	"\n" +
+	"peer_found\x18\x02 \x01(\v2\x10.lanchat.v1.PeerH\x00R\tpeerFound\x125\n" +
+	"\fpeer_updated\x18\x03 \x01(\v2\x10.lanchat.v1.PeerH\x00R\vpeerUpdated\x12/\n" +
+	"\amessage\x18\x04 \x01(\v2\x13.lanchat.v1.MessageH\x00R\amessage\x12?\n" +
+	"\rfile_received\x18\x05 \x01(\v2\x18.lanchat.v1.FileReceivedH\x00R\ffileReceived\x12K\n" +
+	"\x11transfer_progress\x18\x06 \x01(\v2\x1c.lanchat.v1.TransferProgressH\x00R\x10transferProgress\x12\x16\n" +
+	"\x05error\x18\a \x01(\tH\x00R\x05errorB\x06\n" +
+	"\x04kind\"\x12\n" +
+	"\x10ListPeersRequest\";\n" +
+	"\x11ListPeersResponse\x12&\n" +
+	"\x05peers\x18\x01 \x03(\v2\x10.lanchat.v1.PeerR\x05peers\"<\n" +
+	"\x12SendMessageRequest\x12\x12\n" +
+	"\x04peer\x18\x01 \x01(\tR\x04peer\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\"\x15\n" +
+	"\x13SendMessageResponse\"9\n" +
+	"\x0fSendFileRequest\x12\x12\n" +
+	"\x04peer\x18\x01 \x01(\tR\x04peer\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\"\x12\n" +
+	"\x10SendFileResponse\"=\n" +
+	"\x11GetHistoryRequest\x12\x12\n" +
+	"\x04peer\x18\x01 \x01(\tR\x04peer\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"E\n" +
+	"\x12GetHistoryResponse\x12/\n" +
+	"\bmessages\x18\x01 \x03(\v2\x13.lanchat.v1.MessageR\bmessages\"\x15\n" +
+	"\x13StreamEventsRequest2\xfd\x02\n" +
+	"\aLanChat\x12H\n" +
+	"\tListPeers\x12\x1c.lanchat.v1.ListPeersRequest\x1a\x1d.lanchat.v1.ListPeersResponse\x12N\n" +
+	"\vSendMessage\x12\x1e.lanchat.v1.SendMessageRequest\x1a\x1f.lanchat.v1.SendMessageResponse\x12E\n" +
+	"\bSendFile\x12\x1b.lanchat.v1.SendFileRequest\x1a\x1c.lanchat.v1.SendFileResponse\x12K\n" +
+	"\n" +
+	"GetHistory\x12\x1d.lanchat.v1.GetHistoryRequest\x1a\x1e.lanchat.v1.GetHistoryResponse\x12D\n" +
+	"\fStreamEvents\x12\x1f.lanchat.v1.StreamEventsRequest\x1a\x11.lanchat.v1.Event0\x01B!Z\x1flan-chat/internal/rpc/lanchatpbb\x06proto3"
+
+var (
+	file_lanchat_proto_rawDescOnce sync.Once
+	file_lanchat_proto_rawDescData []byte
+)
+
+func file_lanchat_proto_rawDescGZIP() []byte {
+	file_lanchat_proto_rawDescOnce.Do(func() {
+		file_lanchat_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_lanchat_proto_rawDesc), len(file_lanchat_proto_rawDesc)))
+	})
+	return file_lanchat_proto_rawDescData
+}
+
+var file_lanchat_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_lanchat_proto_goTypes = []any{
+	(*Peer)(nil),                  // 0: lanchat.v1.Peer
+	(*Message)(nil),               // 1: lanchat.v1.Message
+	(*FileReceived)(nil),          // 2: lanchat.v1.FileReceived
+	(*TransferProgress)(nil),      // 3: lanchat.v1.TransferProgress
+	(*Event)(nil),                 // 4: lanchat.v1.Event
+	(*ListPeersRequest)(nil),      // 5: lanchat.v1.ListPeersRequest
+	(*ListPeersResponse)(nil),     // 6: lanchat.v1.ListPeersResponse
+	(*SendMessageRequest)(nil),    // 7: lanchat.v1.SendMessageRequest
+	(*SendMessageResponse)(nil),   // 8: lanchat.v1.SendMessageResponse
+	(*SendFileRequest)(nil),       // 9: lanchat.v1.SendFileRequest
+	(*SendFileResponse)(nil),      // 10: lanchat.v1.SendFileResponse
+	(*GetHistoryRequest)(nil),     // 11: lanchat.v1.GetHistoryRequest
+	(*GetHistoryResponse)(nil),    // 12: lanchat.v1.GetHistoryResponse
+	(*StreamEventsRequest)(nil),   // 13: lanchat.v1.StreamEventsRequest
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+}
+var file_lanchat_proto_depIdxs = []int32{
+	14, // 0: lanchat.v1.Message.time:type_name -> google.protobuf.Timestamp
+	14, // 1: lanchat.v1.Event.time:type_name -> google.protobuf.Timestamp
+	0,  // 2: lanchat.v1.Event.peer_found:type_name -> lanchat.v1.Peer
+	0,  // 3: lanchat.v1.Event.peer_updated:type_name -> lanchat.v1.Peer
+	1,  // 4: lanchat.v1.Event.message:type_name -> lanchat.v1.Message
+	2,  // 5: lanchat.v1.Event.file_received:type_name -> lanchat.v1.FileReceived
+	3,  // 6: lanchat.v1.Event.transfer_progress:type_name -> lanchat.v1.TransferProgress
+	0,  // 7: lanchat.v1.ListPeersResponse.peers:type_name -> lanchat.v1.Peer
+	1,  // 8: lanchat.v1.GetHistoryResponse.messages:type_name -> lanchat.v1.Message
+	5,  // 9: lanchat.v1.LanChat.ListPeers:input_type -> lanchat.v1.ListPeersRequest
+	7,  // 10: lanchat.v1.LanChat.SendMessage:input_type -> lanchat.v1.SendMessageRequest
+	9,  // 11: lanchat.v1.LanChat.SendFile:input_type -> lanchat.v1.SendFileRequest
+	11, // 12: lanchat.v1.LanChat.GetHistory:input_type -> lanchat.v1.GetHistoryRequest
+	13, // 13: lanchat.v1.LanChat.StreamEvents:input_type -> lanchat.v1.StreamEventsRequest
+	6,  // 14: lanchat.v1.LanChat.ListPeers:output_type -> lanchat.v1.ListPeersResponse
+	8,  // 15: lanchat.v1.LanChat.SendMessage:output_type -> lanchat.v1.SendMessageResponse
+	10, // 16: lanchat.v1.LanChat.SendFile:output_type -> lanchat.v1.SendFileResponse
+	12, // 17: lanchat.v1.LanChat.GetHistory:output_type -> lanchat.v1.GetHistoryResponse
+	4,  // 18: lanchat.v1.LanChat.StreamEvents:output_type -> lanchat.v1.Event
+	14, // [14:19] is the sub-list for method output_type
+	9,  // [9:14] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_lanchat_proto_init() }
+func file_lanchat_proto_init() {
+	if File_lanchat_proto != nil {
+		return
+	}
+	file_lanchat_proto_msgTypes[4].OneofWrappers = []any{
+		(*Event_PeerFound)(nil),
+		(*Event_PeerUpdated)(nil),
+		(*Event_Message)(nil),
+		(*Event_FileReceived)(nil),
+		(*Event_TransferProgress)(nil),
+		(*Event_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_lanchat_proto_rawDesc), len(file_lanchat_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_lanchat_proto_goTypes,
+		DependencyIndexes: file_lanchat_proto_depIdxs,
+		MessageInfos:      file_lanchat_proto_msgTypes,
+	}.Build()
+	File_lanchat_proto = out.File
+	file_lanchat_proto_goTypes = nil
+	file_lanchat_proto_depIdxs = nil
+}
@@ -0,0 +1,294 @@
+// Control API of a running lan-chat instance, served over a unix socket
+// with --grpc. Regenerate the Go code with `make proto`.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: lanchat.proto
+
+package lanchatpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LanChat_ListPeers_FullMethodName    = "/lanchat.v1.LanChat/ListPeers"
+	LanChat_SendMessage_FullMethodName  = "/lanchat.v1.LanChat/SendMessage"
+	LanChat_SendFile_FullMethodName     = "/lanchat.v1.LanChat/SendFile"
+	LanChat_GetHistory_FullMethodName   = "/lanchat.v1.LanChat/GetHistory"
+	LanChat_StreamEvents_FullMethodName = "/lanchat.v1.LanChat/StreamEvents"
+)
+
+// LanChatClient is the client API for LanChat service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LanChatClient interface {
+	// Peers discovered so far
+	ListPeers(ctx context.Context, in *ListPeersRequest, opts ...grpc.CallOption) (*ListPeersResponse, error)
+	// Send a chat message; encrypted once the peer is verified
+	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error)
+	// Send a file by path, returning once it is sent; progress arrives on
+	// StreamEvents meanwhile
+	SendFile(ctx context.Context, in *SendFileRequest, opts ...grpc.CallOption) (*SendFileResponse, error)
+	// Recent chat history, oldest first
+	GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (*GetHistoryResponse, error)
+	// Everything that happens from now on, until the client hangs up. A
+	// client that falls behind gets an error event counting what it missed.
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type lanChatClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLanChatClient(cc grpc.ClientConnInterface) LanChatClient {
+	return &lanChatClient{cc}
+}
+
+func (c *lanChatClient) ListPeers(ctx context.Context, in *ListPeersRequest, opts ...grpc.CallOption) (*ListPeersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPeersResponse)
+	err := c.cc.Invoke(ctx, LanChat_ListPeers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lanChatClient) SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendMessageResponse)
+	err := c.cc.Invoke(ctx, LanChat_SendMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lanChatClient) SendFile(ctx context.Context, in *SendFileRequest, opts ...grpc.CallOption) (*SendFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendFileResponse)
+	err := c.cc.Invoke(ctx, LanChat_SendFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lanChatClient) GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (*GetHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetHistoryResponse)
+	err := c.cc.Invoke(ctx, LanChat_GetHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lanChatClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LanChat_ServiceDesc.Streams[0], LanChat_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LanChat_StreamEventsClient = grpc.ServerStreamingClient[Event]
+
+// LanChatServer is the server API for LanChat service.
+// All implementations must embed UnimplementedLanChatServer
+// for forward compatibility.
+type LanChatServer interface {
+	// Peers discovered so far
+	ListPeers(context.Context, *ListPeersRequest) (*ListPeersResponse, error)
+	// Send a chat message; encrypted once the peer is verified
+	SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error)
+	// Send a file by path, returning once it is sent; progress arrives on
+	// StreamEvents meanwhile
+	SendFile(context.Context, *SendFileRequest) (*SendFileResponse, error)
+	// Recent chat history, oldest first
+	GetHistory(context.Context, *GetHistoryRequest) (*GetHistoryResponse, error)
+	// Everything that happens from now on, until the client hangs up. A
+	// client that falls behind gets an error event counting what it missed.
+	StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedLanChatServer()
+}
+
+// UnimplementedLanChatServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLanChatServer struct{}
+
+func (UnimplementedLanChatServer) ListPeers(context.Context, *ListPeersRequest) (*ListPeersResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListPeers not implemented")
+}
+func (UnimplementedLanChatServer) SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedLanChatServer) SendFile(context.Context, *SendFileRequest) (*SendFileResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SendFile not implemented")
+}
+func (UnimplementedLanChatServer) GetHistory(context.Context, *GetHistoryRequest) (*GetHistoryResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetHistory not implemented")
+}
+func (UnimplementedLanChatServer) StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Error(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedLanChatServer) mustEmbedUnimplementedLanChatServer() {}
+func (UnimplementedLanChatServer) testEmbeddedByValue()                 {}
+
+// UnsafeLanChatServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LanChatServer will
+// result in compilation errors.
+type UnsafeLanChatServer interface {
+	mustEmbedUnimplementedLanChatServer()
+}
+
+func RegisterLanChatServer(s grpc.ServiceRegistrar, srv LanChatServer) {
+	// If the following call panics, it indicates UnimplementedLanChatServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LanChat_ServiceDesc, srv)
+}
+
+func _LanChat_ListPeers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPeersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LanChatServer).ListPeers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LanChat_ListPeers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LanChatServer).ListPeers(ctx, req.(*ListPeersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LanChat_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LanChatServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LanChat_SendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LanChatServer).SendMessage(ctx, req.(*SendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LanChat_SendFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LanChatServer).SendFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LanChat_SendFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LanChatServer).SendFile(ctx, req.(*SendFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LanChat_GetHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LanChatServer).GetHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LanChat_GetHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LanChatServer).GetHistory(ctx, req.(*GetHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LanChat_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LanChatServer).StreamEvents(m, &grpc.GenericServerStream[StreamEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LanChat_StreamEventsServer = grpc.ServerStreamingServer[Event]
+
+// LanChat_ServiceDesc is the grpc.ServiceDesc for LanChat service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LanChat_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lanchat.v1.LanChat",
+	HandlerType: (*LanChatServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPeers",
+			Handler:    _LanChat_ListPeers_Handler,
+		},
+		{
+			MethodName: "SendMessage",
+			Handler:    _LanChat_SendMessage_Handler,
+		},
+		{
+			MethodName: "SendFile",
+			Handler:    _LanChat_SendFile_Handler,
+		},
+		{
+			MethodName: "GetHistory",
+			Handler:    _LanChat_GetHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _LanChat_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "lanchat.proto",
+}
@@ -0,0 +1,206 @@
+// Package rpc serves the gRPC control API (lanchatpb/lanchat.proto) on a
+// unix socket, for alternative frontends. It offers what the REST API does
+// plus a stream of node events.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/control"
+	"lan-chat/internal/node"
+	"lan-chat/internal/platform"
+	"lan-chat/internal/rpc/lanchatpb"
+)
+
+// Backend is what the service drives; *node.Node implements it
+type Backend interface {
+	Peers() []node.PeerInfo
+	Lookup(peer string) (node.PeerInfo, bool)
+	SendChat(ip, text string) error
+	SendFile(ip, path string) error
+	History(peer string) []node.Message
+	Subscribe(buffer int, policy bus.Policy) *bus.Subscription[node.Event]
+}
+
+// SocketPath is where the gRPC socket lives by default
+func SocketPath() string {
+	return filepath.Join(platform.RuntimeDir(), "lan-chat-grpc.sock")
+}
+
+// Listen opens the socket with the same rules as the control socket: user
+// only, stale sockets replaced
+func Listen(path string) (net.Listener, error) {
+	return control.Listen(path)
+}
+
+// Serve runs the service on ln until it is closed
+func Serve(ln net.Listener, b Backend) error {
+	s := grpc.NewServer()
+	lanchatpb.RegisterLanChatServer(s, &service{b: b})
+	return s.Serve(ln)
+}
+
+type service struct {
+	lanchatpb.UnimplementedLanChatServer
+	b Backend
+}
+
+func (s *service) ListPeers(ctx context.Context, _ *lanchatpb.ListPeersRequest) (*lanchatpb.ListPeersResponse, error) {
+	resp := &lanchatpb.ListPeersResponse{}
+	for _, p := range s.b.Peers() {
+		resp.Peers = append(resp.Peers, peerPB(p))
+	}
+	return resp, nil
+}
+
+func (s *service) SendMessage(ctx context.Context, req *lanchatpb.SendMessageRequest) (*lanchatpb.SendMessageResponse, error) {
+	if req.Text == "" {
+		return nil, status.Error(codes.InvalidArgument, "text is empty")
+	}
+	p, err := s.lookup(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.b.SendChat(p.IP, req.Text); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &lanchatpb.SendMessageResponse{}, nil
+}
+
+func (s *service) SendFile(ctx context.Context, req *lanchatpb.SendFileRequest) (*lanchatpb.SendFileResponse, error) {
+	if !filepath.IsAbs(req.Path) {
+		return nil, status.Error(codes.InvalidArgument, "path must be absolute")
+	}
+	p, err := s.lookup(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.b.SendFile(p.IP, req.Path); err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &lanchatpb.SendFileResponse{}, nil
+}
+
+func (s *service) GetHistory(ctx context.Context, req *lanchatpb.GetHistoryRequest) (*lanchatpb.GetHistoryResponse, error) {
+	history := s.b.History(req.Peer)
+	if req.Limit > 0 {
+		history = history[max(len(history)-int(req.Limit), 0):]
+	}
+	resp := &lanchatpb.GetHistoryResponse{}
+	for _, m := range history {
+		resp.Messages = append(resp.Messages, messagePB(m))
+	}
+	return resp, nil
+}
+
+func (s *service) StreamEvents(_ *lanchatpb.StreamEventsRequest, stream grpc.ServerStreamingServer[lanchatpb.Event]) error {
+	sub := s.b.Subscribe(node.DefaultBuffer, bus.DropNewest)
+	defer sub.Close()
+	var dropped uint64
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev := <-sub.Events():
+			// A client that can't keep up is told how much it missed
+			if n := sub.Dropped(); n > dropped {
+				missed := &lanchatpb.Event{Time: timestamppb.Now(), Kind: &lanchatpb.Event_Error{
+					Error: fmt.Sprintf("stream fell behind, %d events dropped", n-dropped),
+				}}
+				dropped = n
+				if err := stream.Send(missed); err != nil {
+					return err
+				}
+			}
+			if pb := s.eventPB(ev); pb != nil {
+				if err := stream.Send(pb); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (s *service) lookup(peer string) (node.PeerInfo, error) {
+	p, ok := s.b.Lookup(peer)
+	if !ok {
+		return p, status.Errorf(codes.NotFound, "no peer named %s", peer)
+	}
+	return p, nil
+}
+
+// eventPB converts a node event, or returns nil for ones the API doesn't carry
+func (s *service) eventPB(ev node.Event) *lanchatpb.Event {
+	out := &lanchatpb.Event{Time: timestamppb.New(time.Now())}
+	// Peer events carry the node's full view of the peer
+	peer := func(ip string) *lanchatpb.Peer {
+		if p, ok := s.b.Lookup(ip); ok {
+			return peerPB(p)
+		}
+		return &lanchatpb.Peer{Ip: ip}
+	}
+	switch ev := ev.(type) {
+	case node.PeerFound:
+		out.Kind = &lanchatpb.Event_PeerFound{PeerFound: peer(ev.Peer.IP)}
+	case node.PeerVerified:
+		out.Kind = &lanchatpb.Event_PeerUpdated{PeerUpdated: peer(ev.IP)}
+	case node.PeerHealth:
+		out.Kind = &lanchatpb.Event_PeerUpdated{PeerUpdated: peer(ev.IP)}
+	case node.ChatReceived:
+		if ev.Err != nil {
+			out.Kind = &lanchatpb.Event_Error{Error: "message from " + ev.Sender + ": " + ev.Err.Error()}
+			break
+		}
+		out.Kind = &lanchatpb.Event_Message{Message: &lanchatpb.Message{
+			Time: timestamppb.New(ev.Time), Peer: ev.Sender, Ip: ev.From, Text: ev.Text, Encrypted: ev.Encrypted, Group: ev.Group,
+		}}
+	case node.ChatSent:
+		out.Kind = &lanchatpb.Event_Message{Message: messagePB(ev.Message)}
+	case node.FileReceived:
+		out.Kind = &lanchatpb.Event_FileReceived{FileReceived: &lanchatpb.FileReceived{
+			Name: ev.Name, Path: ev.Path, FromIp: ev.From, Encrypted: ev.Encrypted,
+		}}
+	case node.TransferProgress:
+		tp := &lanchatpb.TransferProgress{Peer: peer(ev.IP).Name, Name: ev.Name, Sent: ev.Sent, Total: ev.Total, Done: ev.Done}
+		if ev.Err != nil {
+			tp.Error = ev.Err.Error()
+		}
+		out.Kind = &lanchatpb.Event_TransferProgress{TransferProgress: tp}
+	case node.ServerError:
+		out.Kind = &lanchatpb.Event_Error{Error: ev.Err.Error()}
+	case node.ListenerUp:
+		if ev.Err == nil {
+			return nil
+		}
+		out.Kind = &lanchatpb.Event_Error{Error: ev.Proto + " port " + ev.Port + ": " + ev.Err.Error()}
+	default:
+		return nil
+	}
+	return out
+}
+
+func peerPB(p node.PeerInfo) *lanchatpb.Peer {
+	return &lanchatpb.Peer{Name: p.Name, Ip: p.IP, Secure: p.Secure, Reachable: p.Reachable}
+}
+
+func messagePB(m node.Message) *lanchatpb.Message {
+	return &lanchatpb.Message{
+		Time: timestamppb.New(m.Time), Peer: m.Peer, Ip: m.IP, Sent: m.Sent, Text: m.Text, Encrypted: m.Encrypted, Group: m.Group,
+	}
+}
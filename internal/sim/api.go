@@ -0,0 +1,76 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"lan-chat/internal/node"
+)
+
+// API is the target's REST API (lan-chat --api), the simulator's view of
+// what the target saw
+type API struct {
+	URL   string // e.g. http://192.168.1.20:8787
+	Token string
+
+	client http.Client
+}
+
+// Peers is the target's peer list
+func (a *API) Peers(ctx context.Context) ([]node.PeerInfo, error) {
+	var peers []node.PeerInfo
+	return peers, a.do(ctx, "GET", "/v1/peers", nil, &peers)
+}
+
+// Messages is the target's history with peer, a name or IP, oldest first
+func (a *API) Messages(ctx context.Context, peer string) ([]node.Message, error) {
+	var messages []node.Message
+	return messages, a.do(ctx, "GET", "/v1/messages?peer="+url.QueryEscape(peer), nil, &messages)
+}
+
+// Transfer has the target send the file at path, on its machine, to peer
+func (a *API) Transfer(ctx context.Context, peer, path string) error {
+	return a.do(ctx, "POST", "/v1/transfers", map[string]string{"peer": peer, "path": path}, nil)
+}
+
+func (a *API) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(a.URL, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct{ Error string }
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&e)
+		if e.Error == "" {
+			e.Error = resp.Status
+		}
+		return fmt.Errorf("%s %s: %s", method, path, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,380 @@
+// Package sim runs simulated peers on real sockets against a running
+// lan-chat instance, the target, for soak tests before a release. Each peer
+// is a node.Node on a local address of its own; a script says when it
+// joins, chats, sends files and drops offline, and the target's REST API
+// is asked what actually arrived.
+//
+// The peers need port 8080 on their own addresses, which a lan-chat on the
+// same machine holds on all of them, so the target runs on another machine
+// (or in another network namespace).
+package sim
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lan-chat/internal/conns"
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/memnet"
+	"lan-chat/internal/protocol"
+)
+
+// Network is the simulator's side of the LAN: the hosts the peers run on
+// and the one discovery socket they share. Only the target's announcements
+// are passed on, so other instances on the LAN are left alone.
+type Network struct {
+	Target string // the target's IP
+
+	conn  net.PacketConn
+	mu    sync.Mutex
+	hosts []*Host
+}
+
+// Listen opens the discovery port for hosts talking to target
+func Listen(target string) (*Network, error) {
+	conn, err := net.ListenPacket("udp4", ":"+discovery.Port)
+	if err != nil {
+		return nil, fmt.Errorf("%w (is lan-chat running on this machine? the target has to run elsewhere)", err)
+	}
+	nw := &Network{Target: target, conn: conn}
+	go nw.run()
+	return nw, nil
+}
+
+func (nw *Network) run() {
+	buf := make([]byte, 1024)
+	for {
+		n, from, err := nw.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if u, ok := from.(*net.UDPAddr); !ok || u.IP.String() != nw.Target {
+			continue
+		}
+		nw.mu.Lock()
+		hosts := append([]*Host(nil), nw.hosts...)
+		nw.mu.Unlock()
+		for _, h := range hosts {
+			h.deliver(buf[:n], from)
+		}
+	}
+}
+
+// Close stops passing on announcements
+func (nw *Network) Close() error { return nw.conn.Close() }
+
+// Host is a peer's address on the network. It implements
+// discovery.Discoverer and protocol.Dialer / protocol.Listener, announcing
+// to the target only and binding every socket to its own IP.
+type Host struct {
+	nw *Network
+	ip net.IP
+
+	mu      sync.Mutex
+	down    bool
+	packets *packetConn
+	server  *listener
+	conns   conns.Set // dialed and accepted
+}
+
+// Host adds a host on ip, which must be an address of this machine that the
+// target can reach
+func (nw *Network) Host(ip string) (*Host, error) {
+	addr := net.ParseIP(ip).To4()
+	if addr == nil {
+		return nil, fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+	h := &Host{nw: nw, ip: addr}
+	nw.mu.Lock()
+	nw.hosts = append(nw.hosts, h)
+	nw.mu.Unlock()
+	return h, nil
+}
+
+// IP is the host's address
+func (h *Host) IP() string { return h.ip.String() }
+
+// SetDown takes the host off the network (true) or back on. While down it
+// sends and hears no announcements, its dials fail and its server port is
+// closed, so the target's heartbeat is refused. Its open connections are
+// closed too.
+func (h *Host) SetDown(down bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.down == down {
+		return nil
+	}
+	h.down = down
+	if down {
+		h.conns.CloseAll()
+	}
+	if h.server == nil {
+		return nil
+	}
+	if down {
+		h.server.stop()
+		return nil
+	}
+	return h.server.resume()
+}
+
+func (h *Host) isDown() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.down
+}
+
+// Broadcast sends announcements straight to the target; a real broadcast
+// from a secondary address would leave from the primary one
+func (h *Host) Broadcast() (net.Conn, error) {
+	to := &net.UDPAddr{IP: net.ParseIP(h.nw.Target), Port: udpPort()}
+	conn, err := net.DialUDP("udp4", &net.UDPAddr{IP: h.ip}, to)
+	if err != nil {
+		return nil, err
+	}
+	return &announceConn{UDPConn: conn, h: h}, nil
+}
+
+// ListenPackets gives the host its copy of the target's announcements
+func (h *Host) ListenPackets() (net.PacketConn, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.packets != nil {
+		return nil, errors.New("sim: " + h.IP() + " is already listening for announcements")
+	}
+	h.packets = &packetConn{h: h, in: make(chan datagram, memnet.PacketBuffer), done: make(chan struct{})}
+	return h.packets, nil
+}
+
+func (h *Host) Dial(ip string) (net.Conn, error) {
+	return h.DialContext(context.Background(), ip)
+}
+
+func (h *Host) DialContext(ctx context.Context, ip string) (net.Conn, error) {
+	if h.isDown() {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("simulated peer is offline")}
+	}
+	d := net.Dialer{Timeout: protocol.DialTimeout, LocalAddr: &net.TCPAddr{IP: h.ip}}
+	c, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, protocol.Port))
+	if err != nil {
+		return nil, err
+	}
+	return h.conns.Add(c), nil
+}
+
+// Listen opens the host's server socket on its IP
+func (h *Host) Listen() (net.Listener, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.server != nil {
+		return nil, errors.New("sim: " + h.IP() + " already has a server")
+	}
+	l := &listener{addr: &net.TCPAddr{IP: h.ip, Port: tcpPort()}, conns: &h.conns}
+	if !h.down {
+		if err := l.resume(); err != nil {
+			return nil, err
+		}
+	} else {
+		l.wake = make(chan struct{})
+	}
+	h.server = l
+	return l, nil
+}
+
+func udpPort() int { return port(discovery.Port) }
+func tcpPort() int { return port(protocol.Port) }
+
+func port(s string) int {
+	p, _ := strconv.Atoi(s)
+	return p
+}
+
+// deliver queues an announcement for the host, dropping it if the host is
+// down, not listening or not keeping up
+func (h *Host) deliver(b []byte, from net.Addr) {
+	h.mu.Lock()
+	p, down := h.packets, h.down
+	h.mu.Unlock()
+	if p == nil || down {
+		return
+	}
+	select {
+	case p.in <- datagram{data: append([]byte(nil), b...), from: from}:
+	default:
+	}
+}
+
+// listener is a server socket that closes while its host is down and opens
+// again when it comes back; Accept waits across the gap
+type listener struct {
+	addr  *net.TCPAddr
+	conns *conns.Set // its host's
+
+	mu     sync.Mutex
+	ln     net.Listener  // nil while down
+	wake   chan struct{} // closed when ln opens again
+	closed bool
+}
+
+func (l *listener) resume() error {
+	ln, err := net.ListenTCP("tcp4", l.addr)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.ln = ln
+	if l.wake != nil {
+		close(l.wake)
+		l.wake = nil
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *listener) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ln != nil {
+		l.ln.Close()
+		l.ln = nil
+		l.wake = make(chan struct{})
+	}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		l.mu.Lock()
+		ln, wake, closed := l.ln, l.wake, l.closed
+		l.mu.Unlock()
+		if closed {
+			return nil, net.ErrClosed
+		}
+		if ln == nil {
+			<-wake
+			continue
+		}
+		c, err := ln.Accept()
+		if err == nil {
+			return l.conns.Add(c), nil
+		}
+		l.mu.Lock()
+		stopped := l.ln != ln
+		l.mu.Unlock()
+		if !stopped {
+			return nil, err
+		}
+	}
+}
+
+func (l *listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.wake != nil {
+		close(l.wake)
+		l.wake = nil
+	}
+	if l.ln != nil {
+		return l.ln.Close()
+	}
+	return nil
+}
+
+func (l *listener) Addr() net.Addr { return l.addr }
+
+// announceConn drops announcements while its host is down, as the wire
+// would
+type announceConn struct {
+	*net.UDPConn
+	h *Host
+}
+
+func (c *announceConn) Write(b []byte) (int, error) {
+	if c.h.isDown() {
+		return len(b), nil
+	}
+	return c.UDPConn.Write(b)
+}
+
+type datagram struct {
+	data []byte
+	from net.Addr
+}
+
+// packetConn is a host's read end of the shared discovery socket
+type packetConn struct {
+	h    *Host
+	in   chan datagram
+	done chan struct{}
+	once sync.Once
+}
+
+func (p *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case d := <-p.in:
+		return copy(b, d.data), d.from, nil
+	case <-p.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// WriteTo is not needed: discovery only reads, and announces on Broadcast
+func (p *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return 0, errors.New("sim: discovery socket is read-only")
+}
+
+func (p *packetConn) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+		p.h.mu.Lock()
+		p.h.packets = nil
+		p.h.mu.Unlock()
+	})
+	return nil
+}
+
+func (p *packetConn) LocalAddr() net.Addr                { return &net.UDPAddr{IP: p.h.ip, Port: udpPort()} }
+func (p *packetConn) SetDeadline(t time.Time) error      { return nil }
+func (p *packetConn) SetReadDeadline(t time.Time) error  { return nil }
+func (p *packetConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// maxAddrs bounds an address range, against typos like 10.0.0.1-10.0.9.1
+const maxAddrs = 1024
+
+// ParseAddrs reads a comma-separated list of IPv4 addresses and ranges,
+// like "192.168.1.201-192.168.1.220,192.168.1.230"
+func ParseAddrs(spec string) ([]string, error) {
+	var out []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		lo, hi := net.ParseIP(from).To4(), net.ParseIP(to).To4()
+		if !isRange {
+			hi = lo
+		}
+		if lo == nil || hi == nil {
+			return nil, fmt.Errorf("%q is not an IPv4 address or range", part)
+		}
+		a, b := binary.BigEndian.Uint32(lo), binary.BigEndian.Uint32(hi)
+		if b < a || b-a >= maxAddrs {
+			return nil, fmt.Errorf("bad address range %q", part)
+		}
+		for ip := a; ip <= b; ip++ {
+			out = append(out, net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip)).String())
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no addresses")
+	}
+	return out, nil
+}
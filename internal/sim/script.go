@@ -0,0 +1,181 @@
+package sim
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultScript is what every peer runs without --script: join, chat a
+// while, send a file, drop offline long enough to be noticed and come back
+const DefaultScript = `join
+wait 1s-3s
+repeat 20
+	chat hello from {peer}, message {seq}
+	wait 500ms-2s
+end
+transfer 64K
+offline 20s
+chat {peer} is back, message {seq}
+`
+
+// Step is one line of a script:
+//
+//	join                 start the node: announce, serve, heartbeat
+//	chat <text>          send text to the target; {peer} and {seq} are filled in
+//	transfer <size>      send a file of random bytes, e.g. 512, 64K, 2M
+//	offline [<duration>] drop off the network, coming back after duration if given
+//	online               come back
+//	wait <duration>      pause; <min>-<max> picks a random time between
+//	repeat <n> ... end   run the steps in between n times
+//
+// Blank lines and lines starting with # are skipped.
+type Step struct {
+	Line     int
+	Op       string
+	Text     string        // chat
+	Size     int64         // transfer
+	Min, Max time.Duration // wait, offline
+	Count    int           // repeat
+	Steps    []Step        // repeat
+}
+
+// Pause is how long a wait or timed offline lasts this time
+func (s Step) Pause() time.Duration {
+	if s.Max <= s.Min {
+		return s.Min
+	}
+	return s.Min + rand.N(s.Max-s.Min)
+}
+
+// ParseScript reads a script. The first step that does anything must be
+// join, since a peer that hasn't joined has no node to chat or go offline
+// with.
+func ParseScript(r io.Reader) ([]Step, error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	steps, err := parseBlock(scanner, &line, false)
+	if err != nil {
+		return nil, err
+	}
+	if op := firstAction(steps); op != "" && op != "join" {
+		return nil, fmt.Errorf("script: %s before join", op)
+	}
+	return steps, scanner.Err()
+}
+
+// firstAction is the op of the first step that isn't a wait
+func firstAction(steps []Step) string {
+	for _, s := range steps {
+		switch s.Op {
+		case "wait":
+		case "repeat":
+			if op := firstAction(s.Steps); op != "" {
+				return op
+			}
+		default:
+			return s.Op
+		}
+	}
+	return ""
+}
+
+func parseBlock(scanner *bufio.Scanner, line *int, inRepeat bool) ([]Step, error) {
+	var steps []Step
+	for scanner.Scan() {
+		*line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		op, arg, _ := strings.Cut(text, " ")
+		arg = strings.TrimSpace(arg)
+		s := Step{Line: *line, Op: op}
+		bad := func(format string, v ...interface{}) ([]Step, error) {
+			return nil, fmt.Errorf("script line %d: %s: %s", s.Line, op, fmt.Sprintf(format, v...))
+		}
+		var err error
+		switch op {
+		case "join", "online":
+			if arg != "" {
+				return bad("takes no argument")
+			}
+		case "chat":
+			if arg == "" {
+				return bad("needs the text to send")
+			}
+			s.Text = arg
+		case "transfer":
+			if s.Size, err = parseSize(arg); err != nil {
+				return bad("%v", err)
+			}
+		case "wait":
+			if s.Min, s.Max, err = parseRange(arg); err != nil {
+				return bad("%v", err)
+			}
+		case "offline":
+			if arg != "" {
+				if s.Min, s.Max, err = parseRange(arg); err != nil {
+					return bad("%v", err)
+				}
+			}
+		case "repeat":
+			if s.Count, err = strconv.Atoi(arg); err != nil || s.Count < 1 {
+				return bad("needs a count of at least 1")
+			}
+			if s.Steps, err = parseBlock(scanner, line, true); err != nil {
+				return nil, err
+			}
+		case "end":
+			if !inRepeat {
+				return bad("without repeat")
+			}
+			return steps, nil
+		default:
+			return nil, fmt.Errorf("script line %d: unknown step %q", s.Line, op)
+		}
+		steps = append(steps, s)
+	}
+	if inRepeat {
+		return nil, fmt.Errorf("script: repeat without end")
+	}
+	return steps, nil
+}
+
+// parseRange reads "2s" or "500ms-3s"
+func parseRange(arg string) (lo, hi time.Duration, err error) {
+	a, b, isRange := strings.Cut(arg, "-")
+	if lo, err = time.ParseDuration(a); err != nil {
+		return 0, 0, err
+	}
+	hi = lo
+	if isRange {
+		if hi, err = time.ParseDuration(b); err != nil {
+			return 0, 0, err
+		}
+	}
+	if lo < 0 || hi < lo {
+		return 0, 0, fmt.Errorf("bad range %q", arg)
+	}
+	return lo, hi, nil
+}
+
+// parseSize reads a byte count with an optional K or M (binary) suffix
+func parseSize(arg string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(arg, "K"):
+		mult, arg = 1<<10, strings.TrimSuffix(arg, "K")
+	case strings.HasSuffix(arg, "M"):
+		mult, arg = 1<<20, strings.TrimSuffix(arg, "M")
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("needs a size like 512, 64K or 2M")
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,477 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/node"
+)
+
+// Timings of the checks. A drop shorter than noticeTime may fall between
+// two heartbeats and isn't held against the target.
+const (
+	pollInterval  = time.Second
+	settle        = 3 * time.Second
+	bounceTimeout = 30 * time.Second
+	bounceTries   = 3
+	noticeTime    = 3 * discovery.HeartbeatInterval
+)
+
+// Config is a simulation run
+type Config struct {
+	Target    string   // IP of the instance under test
+	Addrs     []string // a local address per peer
+	Prefix    string   // peers are named Prefix1, Prefix2...
+	Password  string
+	Script    []Step
+	Stagger   time.Duration // between one peer starting the script and the next
+	Duration  time.Duration // run the script again until this has passed; 0 runs it once
+	API       *API          // the target's REST API; nil skips the checks that need it
+	TargetDir string        // where the target saves files; with API, each transfer is sent back and compared
+	Logf      func(format string, v ...interface{})
+}
+
+func (c *Config) logf(format string, v ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, v...)
+	}
+}
+
+// Peer is a simulated peer and its tally
+type Peer struct {
+	Name string
+	Host *Host
+	Node *node.Node
+
+	cfg *Config
+
+	mu       sync.Mutex
+	joined   time.Time
+	found    time.Duration // from join to the target listing the peer; 0 until then
+	downAt   time.Time     // when the current drop started, zero while online
+	noticed  bool          // the target saw the current drop
+	seq      int
+	pending  []string // chats the target accepted since the last check
+	waiters  map[string]chan node.FileReceived
+	Chats    Tally
+	Files    Tally
+	Drops    Tally
+	Failures []string
+}
+
+// Tally counts one kind of step: how many were done, how many of those the
+// target was seen to get right and how many failed. Without the API only
+// failures to send are known.
+type Tally struct{ Done, OK, Bad int }
+
+// Run starts a peer per address and runs the script on each until it ends,
+// Duration passes or ctx is done, then checks the last messages. The peers'
+// nodes can't be stopped: run once per process.
+func Run(ctx context.Context, c *Config) ([]*Peer, error) {
+	if len(c.Addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for the peers")
+	}
+	nw, err := Listen(c.Target)
+	if err != nil {
+		return nil, err
+	}
+	defer nw.Close()
+	dir, err := os.MkdirTemp("", "lanchat-sim-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var peers []*Peer
+	for i, addr := range c.Addrs {
+		h, err := nw.Host(addr)
+		if err != nil {
+			return nil, err
+		}
+		p := &Peer{Name: c.Prefix + strconv.Itoa(i+1), Host: h, cfg: c, waiters: make(map[string]chan node.FileReceived)}
+		p.Node = node.New(p.Name, c.Password)
+		p.Node.Dir = filepath.Join(dir, p.Name)
+		if err := os.Mkdir(p.Node.Dir, 0755); err != nil {
+			return nil, err
+		}
+		p.Node.Discoverer, p.Node.Dialer, p.Node.Listener = h, h, h
+		go p.watch()
+		peers = append(peers, p)
+	}
+
+	if c.API != nil {
+		pollCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go poll(pollCtx, c, peers)
+	}
+
+	var deadline time.Time
+	if c.Duration > 0 {
+		deadline = time.Now().Add(c.Duration)
+	}
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !sleep(ctx, time.Duration(i)*c.Stagger) {
+				return
+			}
+			for round := 1; ; round++ {
+				p.run(ctx, c.Script)
+				p.check(context.WithoutCancel(ctx))
+				if ctx.Err() != nil || deadline.IsZero() || time.Now().After(deadline) {
+					return
+				}
+				c.logf("%s: round %d done", p.Name, round)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, p := range peers {
+		p.mu.Lock()
+		if c.API != nil && !p.joined.IsZero() && p.found == 0 {
+			p.fail("never listed by the target")
+		}
+		p.mu.Unlock()
+	}
+	return peers, nil
+}
+
+// Failed reports whether any peer found something wrong
+func Failed(peers []*Peer) bool {
+	for _, p := range peers {
+		if len(p.Failures) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records a problem; p.mu is held
+func (p *Peer) fail(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	p.Failures = append(p.Failures, msg)
+	p.cfg.logf("%s: FAIL %s", p.Name, msg)
+}
+
+// Found is how long the target took to list the peer after it joined, or 0
+func (p *Peer) Found() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.found
+}
+
+// watch drains the node's events, handing received files to transfer
+func (p *Peer) watch() {
+	for ev := range p.Node.Events() {
+		f, ok := ev.(node.FileReceived)
+		if !ok {
+			continue
+		}
+		p.mu.Lock()
+		ch := p.waiters[f.Name]
+		delete(p.waiters, f.Name)
+		p.mu.Unlock()
+		if ch != nil {
+			ch <- f
+		}
+	}
+}
+
+func (p *Peer) run(ctx context.Context, steps []Step) {
+	for _, s := range steps {
+		if ctx.Err() != nil {
+			return
+		}
+		switch s.Op {
+		case "join":
+			p.mu.Lock()
+			first := p.joined.IsZero()
+			if first {
+				p.joined = time.Now()
+			}
+			p.mu.Unlock()
+			if first {
+				p.cfg.logf("%s: joins on %s", p.Name, p.Host.IP())
+				p.Node.Start()
+			}
+		case "chat":
+			p.chat(s.Text)
+		case "transfer":
+			p.transfer(ctx, s.Size)
+		case "offline":
+			p.setDown(true)
+			if s.Min > 0 {
+				if !sleep(ctx, s.Pause()) {
+					p.setDown(false)
+					return
+				}
+				p.setDown(false)
+			}
+		case "online":
+			p.setDown(false)
+		case "wait":
+			if !sleep(ctx, s.Pause()) {
+				return
+			}
+		case "repeat":
+			for range s.Count {
+				p.run(ctx, s.Steps)
+			}
+		}
+	}
+}
+
+func (p *Peer) chat(text string) {
+	if p.Host.isDown() {
+		return
+	}
+	p.mu.Lock()
+	p.seq++
+	text = strings.NewReplacer("{peer}", p.Name, "{seq}", strconv.Itoa(p.seq)).Replace(text)
+	p.mu.Unlock()
+	err := p.Node.SendChat(p.cfg.Target, text)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Chats.Done++
+	if err != nil {
+		p.Chats.Bad++
+		p.fail("chat %q: %v", text, err)
+		return
+	}
+	p.pending = append(p.pending, text)
+}
+
+// transfer sends size random bytes and, if it can, has the target send them
+// back to compare
+func (p *Peer) transfer(ctx context.Context, size int64) {
+	if p.Host.isDown() {
+		return
+	}
+	p.mu.Lock()
+	p.Files.Done++
+	name := fmt.Sprintf("%s-%d.bin", p.Name, p.Files.Done)
+	p.mu.Unlock()
+	data := make([]byte, size)
+	rand.Read(data)
+	src := filepath.Join(p.Node.Dir, name)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		p.mu.Lock()
+		p.fail("writing %s: %v", name, err)
+		p.mu.Unlock()
+		return
+	}
+	defer os.Remove(src)
+	p.cfg.logf("%s: sends %s (%d bytes)", p.Name, name, size)
+	if err := p.Node.SendFile(p.cfg.Target, src); err != nil {
+		p.mu.Lock()
+		p.Files.Bad++
+		p.fail("send %s: %v", name, err)
+		p.mu.Unlock()
+		return
+	}
+	if p.cfg.API == nil || p.cfg.TargetDir == "" {
+		return
+	}
+
+	// The target may still be writing the last bytes when the send returns,
+	// so a short file back is tried again
+	saved := "received_" + name
+	var got []byte
+	var err error
+	for try := 1; try <= bounceTries; try++ {
+		if !sleep(ctx, time.Second) {
+			return
+		}
+		got, err = p.bounce(ctx, path.Join(p.cfg.TargetDir, saved))
+		if err == nil && bytes.Equal(got, data) {
+			break
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case err != nil:
+		p.Files.Bad++
+		p.fail("getting %s back: %v", name, err)
+	case !bytes.Equal(got, data):
+		p.Files.Bad++
+		p.fail("%s came back different: %d bytes, sent %d", name, len(got), len(data))
+	default:
+		p.Files.OK++
+	}
+}
+
+// bounce asks the target to send the file at remote back and returns what
+// arrived
+func (p *Peer) bounce(ctx context.Context, remote string) ([]byte, error) {
+	ch := make(chan node.FileReceived, 1)
+	name := path.Base(remote)
+	p.mu.Lock()
+	p.waiters[name] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiters, name)
+		p.mu.Unlock()
+	}()
+	if err := p.cfg.API.Transfer(ctx, p.Host.IP(), remote); err != nil {
+		return nil, err
+	}
+	select {
+	case f := <-ch:
+		defer os.Remove(f.Path)
+		return os.ReadFile(f.Path)
+	case <-time.After(bounceTimeout):
+		return nil, fmt.Errorf("nothing after %v", bounceTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// setDown drops the peer or brings it back; a drop long enough for the
+// heartbeat must have been seen by the target by the time it ends
+func (p *Peer) setDown(down bool) {
+	if p.Host.isDown() == down {
+		return
+	}
+	if err := p.Host.SetDown(down); err != nil {
+		p.mu.Lock()
+		p.fail("coming back online: %v", err)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if down {
+		p.cfg.logf("%s: goes offline", p.Name)
+		p.downAt, p.noticed = time.Now(), false
+		p.Drops.Done++
+		return
+	}
+	lasted := time.Since(p.downAt)
+	p.cfg.logf("%s: back online after %.1fs", p.Name, lasted.Seconds())
+	p.downAt = time.Time{}
+	if p.cfg.API == nil || lasted < noticeTime {
+		return
+	}
+	if !p.noticed {
+		p.Drops.Bad++
+		p.fail("the target still listed it as reachable after %.1fs offline", lasted.Seconds())
+	} else {
+		p.Drops.OK++
+	}
+}
+
+// check waits for the last chats to land and compares what the target
+// received from the peer with what it accepted, newest first: an earlier
+// run's messages may still be in the target's history before them
+func (p *Peer) check(ctx context.Context) {
+	p.mu.Lock()
+	sent := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if p.cfg.API == nil || len(sent) == 0 {
+		return
+	}
+	sleep(ctx, settle)
+	history, err := p.cfg.API.Messages(ctx, p.Host.IP())
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.fail("reading the target's history: %v", err)
+		return
+	}
+	var got []string
+	for _, m := range history {
+		if !m.Sent {
+			got = append(got, m.Text)
+		}
+	}
+	pos := len(got) - 1
+	lost, reordered := 0, 0
+	for i := len(sent) - 1; i >= 0; i-- {
+		j := lastIndex(got[:pos+1], sent[i])
+		switch {
+		case j >= 0:
+			p.Chats.OK++
+			pos = j - 1
+		case lastIndex(got, sent[i]) >= 0:
+			reordered++
+		default:
+			lost++
+		}
+	}
+	p.Chats.Bad += lost + reordered
+	if lost > 0 {
+		p.fail("%d of %d messages never reached the target", lost, len(sent))
+	}
+	if reordered > 0 {
+		p.fail("%d of %d messages arrived out of order", reordered, len(sent))
+	}
+}
+
+func lastIndex(list []string, s string) int {
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// poll watches the target's peer list: when each peer first appears, and
+// whether a dropped peer is marked unreachable
+func poll(ctx context.Context, c *Config, peers []*Peer) {
+	for sleep(ctx, pollInterval) {
+		list, err := c.API.Peers(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logf("Target peer list: %v", err)
+			}
+			continue
+		}
+		byIP := make(map[string]node.PeerInfo, len(list))
+		for _, info := range list {
+			byIP[info.IP] = info
+		}
+		for _, p := range peers {
+			info, listed := byIP[p.Host.IP()]
+			p.mu.Lock()
+			if listed && p.found == 0 && !p.joined.IsZero() {
+				p.found = time.Since(p.joined)
+				c.logf("%s: listed by the target after %.1fs", p.Name, p.found.Seconds())
+			}
+			if listed && !p.downAt.IsZero() && !info.Reachable && !p.noticed {
+				p.noticed = true
+				c.logf("%s: the target noticed it offline after %.1fs", p.Name, time.Since(p.downAt).Seconds())
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// sleep waits d, or less if ctx is done first; it reports whether ctx is
+// still running
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
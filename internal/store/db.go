@@ -0,0 +1,474 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+
+	"lan-chat/internal/platform"
+)
+
+// DB keeps chat history, transfer records and the known-peer roster in one
+// bbolt file, db.bolt in the data directory: a bucket each for messages,
+// transfers and peers, keyed by the order they were added in, and a meta
+// bucket with the schema version. Each record is written in a transaction
+// of its own as it happens. Transfers and peers are also held in memory,
+// and each conversation keeps its newest messages there, memoryWindow of
+// them; reading further back reads the file, so a long-running instance
+// doesn't grow with its history.
+//
+// One process has it open at a time: the running instance, which holds
+// bbolt's lock on the file until Close. Everything else goes through that
+// instance's control socket; OpenDB refuses a second one.
+type DB struct {
+	path string
+
+	mu        sync.Mutex
+	bolt      *bolt.DB         // nil once closed
+	convs     map[string]*ring // newest messages, by lower-case peer name
+	spilled   int              // messages only in the file
+	transfers []Transfer
+	peers     []KnownPeer // in the order first seen
+	peerKeys  []uint64    // each peer's key in the peers bucket
+	obsolete  []string    // files migrations replaced, removed once they are committed
+	retention Retention
+	stop      chan struct{} // ends the hourly pruning, closed by Close
+}
+
+// Message is a chat message that was sent or received
+type Message struct {
+	Time      time.Time `json:"time"`
+	Peer      string    `json:"peer"` // the other side's name; Everyone for a group message we sent
+	IP        string    `json:"ip"`
+	Sent      bool      `json:"sent"`
+	Text      string    `json:"text"`
+	Encrypted bool      `json:"encrypted"`
+	Group     bool      `json:"group,omitempty"` // sent to everyone, in the Everyone conversation
+}
+
+// Everyone is the name of the group conversation, the messages sent to
+// every peer at once. The node ignores a peer announcing itself under it.
+const Everyone = "*"
+
+// With reports whether m belongs to the conversation with peer: a name or
+// IP for the messages with that peer alone, Everyone for the group's, or
+// "" for every message
+func (m Message) With(peer string) bool {
+	switch {
+	case peer == "":
+		return true
+	case peer == Everyone:
+		return m.Group
+	}
+	return !m.Group && matches(peer, m.Peer, m.IP)
+}
+
+// Transfer is a file that was sent or received, recorded when it finished
+type Transfer struct {
+	Time      time.Time `json:"time"`
+	Peer      string    `json:"peer"`
+	IP        string    `json:"ip"`
+	Sent      bool      `json:"sent"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path,omitempty"` // where a received file was saved
+	Size      int64     `json:"size"`
+	Encrypted bool      `json:"encrypted"`
+	Error     string    `json:"error,omitempty"` // why a send failed
+}
+
+// record is one line of db.jsonl, the append log the database was kept in
+// before bbolt; exactly one field is set
+type record struct {
+	Message  *Message   `json:"message,omitempty"`
+	Transfer *Transfer  `json:"transfer,omitempty"`
+	Peer     *KnownPeer `json:"peer,omitempty"`
+}
+
+// The buckets, and the meta bucket's key for the schema version
+var (
+	metaBucket     = []byte("meta")
+	messageBucket  = []byte("messages")
+	transferBucket = []byte("transfers")
+	peerBucket     = []byte("peers")
+	schemaKey      = []byte("schema")
+)
+
+// migrations bring a database from schema version i to i+1; the index is
+// the version they start from. Append to it, never change an entry.
+var migrations = []func(db *DB, tx *bolt.Tx) error{
+	importRoster, // 0 → 1: peers.json from before there was a database
+	importLog,    // 1 → 2: db.jsonl from before the database was bbolt
+}
+
+// schema is the version this build writes
+var schema = len(migrations)
+
+// lockWait is how long OpenDB waits for another process to close the
+// database before giving up
+const lockWait = 100 * time.Millisecond
+
+// DBPath is the default location of the database
+func DBPath() string {
+	if dir := platform.DataDir(); dir != "" {
+		return filepath.Join(dir, "db.bolt")
+	}
+	return ""
+}
+
+// OpenDB opens the database at path, creating it the first time and
+// migrating one written by an older version. It fails while another
+// process has the database open.
+func OpenDB(path string) (*DB, error) {
+	if path == "" {
+		return nil, errors.New("no data directory for the database")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	b, err := bolt.Open(path, 0600, &bolt.Options{Timeout: lockWait})
+	if errors.Is(err, berrors.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another lan-chat", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	db := &DB{path: path, bolt: b, convs: make(map[string]*ring)}
+	if err := db.open(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, old := range db.obsolete {
+		os.Remove(old)
+	}
+	return db, nil
+}
+
+// open creates the buckets and migrates them, in one transaction, then
+// loads them into memory
+func (db *DB) open() error {
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{messageBucket, transferBucket, peerBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		version := 0
+		if v := meta.Get(schemaKey); len(v) == 8 {
+			version = int(binary.BigEndian.Uint64(v))
+		}
+		if version > schema {
+			return fmt.Errorf("schema %d is from a newer lan-chat (this one reads up to %d)", version, schema)
+		}
+		for v := version; v < schema; v++ {
+			if err := migrations[v](db, tx); err != nil {
+				return fmt.Errorf("migrating to schema %d: %w", v+1, err)
+			}
+		}
+		if version == schema {
+			return nil
+		}
+		return meta.Put(schemaKey, key(uint64(schema)))
+	})
+	if err != nil {
+		return err
+	}
+	return db.bolt.View(db.load)
+}
+
+// load reads the peers, the transfers and each conversation's newest
+// messages into memory
+func (db *DB) load(tx *bolt.Tx) error {
+	err := tx.Bucket(peerBucket).ForEach(func(k, v []byte) error {
+		var p KnownPeer
+		if err := json.Unmarshal(v, &p); err != nil {
+			return fmt.Errorf("peer %d: %w", seqOf(k), err)
+		}
+		db.peers = append(db.peers, p)
+		db.peerKeys = append(db.peerKeys, seqOf(k))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(transferBucket).ForEach(func(k, v []byte) error {
+		var t Transfer
+		if err := json.Unmarshal(v, &t); err != nil {
+			return fmt.Errorf("transfer %d: %w", seqOf(k), err)
+		}
+		db.transfers = append(db.transfers, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return scan(tx, db.remember)
+}
+
+// key is the bucket key for seq, big-endian so keys sort in order
+func key(seq uint64) []byte { return binary.BigEndian.AppendUint64(nil, seq) }
+
+func seqOf(k []byte) uint64 { return binary.BigEndian.Uint64(k) }
+
+// put stores v as JSON in bucket under seq, or under the bucket's next key
+// when seq is 0, and returns the key
+func put(tx *bolt.Tx, bucket []byte, seq uint64, v any) (uint64, error) {
+	b := tx.Bucket(bucket)
+	if seq == 0 {
+		var err error
+		if seq, err = b.NextSequence(); err != nil {
+			return 0, err
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return seq, b.Put(key(seq), data)
+}
+
+// putPeer stores p, replacing the peer with the same name
+func putPeer(tx *bolt.Tx, p KnownPeer) error {
+	var seq uint64
+	tx.Bucket(peerBucket).ForEach(func(k, v []byte) error {
+		var old KnownPeer
+		if json.Unmarshal(v, &old) == nil && strings.EqualFold(old.Name, p.Name) {
+			seq = seqOf(k)
+		}
+		return nil
+	})
+	_, err := put(tx, peerBucket, seq, p)
+	return err
+}
+
+// write stores v in bucket, as put does, in a transaction of its own. Call
+// it with db.mu held.
+func (db *DB) write(bucket []byte, seq uint64, v any) (uint64, error) {
+	if db.bolt == nil {
+		return 0, errors.New("database is closed")
+	}
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		seq, err = put(tx, bucket, seq, v)
+		return err
+	})
+	return seq, err
+}
+
+func (db *DB) peerIndex(name string) int {
+	return slices.IndexFunc(db.peers, func(p KnownPeer) bool { return strings.EqualFold(p.Name, name) })
+}
+
+// Close closes the database; it can't be written after
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.stop != nil {
+		close(db.stop)
+		db.stop = nil
+	}
+	var err error
+	if db.bolt != nil {
+		err = db.bolt.Close() // and lets the next instance open it
+		db.bolt = nil
+	}
+	return err
+}
+
+// AddMessage records a chat message
+func (db *DB) AddMessage(m Message) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	seq, err := db.write(messageBucket, 0, m)
+	if err != nil {
+		return err
+	}
+	db.remember(seq, m)
+	return nil
+}
+
+// AddTransfer records a finished transfer
+func (db *DB) AddTransfer(t Transfer) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, err := db.write(transferBucket, 0, t); err != nil {
+		return err
+	}
+	db.transfers = append(db.transfers, t)
+	return nil
+}
+
+// PutPeer saves a known peer, replacing the record with the same name
+func (db *DB) PutPeer(p KnownPeer) error {
+	p.IPs, p.Tags = slices.Clone(p.IPs), slices.Clone(p.Tags)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	i := db.peerIndex(p.Name)
+	var seq uint64
+	if i >= 0 {
+		seq = db.peerKeys[i]
+	}
+	seq, err := db.write(peerBucket, seq, p)
+	if err != nil {
+		return err
+	}
+	if i >= 0 {
+		db.peers[i] = p
+	} else {
+		db.peers = append(db.peers, p)
+		db.peerKeys = append(db.peerKeys, seq)
+	}
+	return nil
+}
+
+// matches reports whether a record with this name and IP belongs to peer,
+// a name or IP; "" matches everyone
+func matches(peer, name, ip string) bool {
+	return peer == "" || ip == peer || strings.EqualFold(name, peer)
+}
+
+// Messages is the history with peer (a name or IP, or Everyone for the
+// group's), or every message if peer is "", oldest first
+func (db *DB) Messages(peer string) []Message {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.find(peer, func(m Message, _ string) bool { return m.With(peer) })
+}
+
+// Search is the messages with peer ("" for everyone) containing every word
+// of query, ignoring case, oldest first
+func (db *DB) Search(peer, query string) []Message {
+	words := strings.Fields(strings.ToLower(query))
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.find(peer, func(m Message, lower string) bool {
+		return m.With(peer) && containsAll(lower, words)
+	})
+}
+
+// ContainsWords reports whether text contains every word of query, ignoring
+// case, the way Search matches
+func ContainsWords(text, query string) bool {
+	return containsAll(strings.ToLower(text), strings.Fields(strings.ToLower(query)))
+}
+
+func containsAll(lower string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(lower, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Transfers is the transfers with peer, or everyone if peer is "", oldest
+// first
+func (db *DB) Transfers(peer string) []Transfer {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var out []Transfer
+	for _, t := range db.transfers {
+		if matches(peer, t.Peer, t.IP) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Peers is the known-peer roster, in the order first seen
+func (db *DB) Peers() []KnownPeer {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	out := make([]KnownPeer, len(db.peers))
+	for i, p := range db.peers {
+		p.IPs, p.Tags = slices.Clone(p.IPs), slices.Clone(p.Tags)
+		out[i] = p
+	}
+	return out
+}
+
+// importRoster takes the peers from peers.json next to the database, where
+// the roster was kept before
+func importRoster(db *DB, tx *bolt.Tx) error {
+	path := filepath.Join(filepath.Dir(db.path), "peers.json")
+	peers, err := LoadRoster(path)
+	if err != nil {
+		return err
+	}
+	for _, p := range peers {
+		if err := putPeer(tx, p); err != nil {
+			return err
+		}
+	}
+	db.obsolete = append(db.obsolete, path)
+	return nil
+}
+
+// importLog takes the records from db.jsonl next to the database, where
+// they were appended one JSON line each before. Its first line is its own
+// schema version, which needs nothing done: the roster it may be missing
+// was imported the step before. A half-written last line, from a crash, is
+// dropped. An older lan-chat still running on it holds db.jsonl.lock, and
+// the import waits for it to exit.
+func importLog(db *DB, tx *bolt.Tx) error {
+	path := filepath.Join(filepath.Dir(db.path), "db.jsonl")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600); err == nil {
+		defer lock.Close()
+		if errors.Is(platform.Lock(lock), platform.ErrLocked) {
+			return fmt.Errorf("%s is in use by an older lan-chat", path)
+		}
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 16<<20)
+	var h struct {
+		Schema int `json:"schema"`
+	}
+	if !sc.Scan() || json.Unmarshal(sc.Bytes(), &h) != nil {
+		return fmt.Errorf("%s is not a lan-chat database", path)
+	}
+	for line := 2; sc.Scan(); line++ {
+		var r record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			if torn := !bytes.HasSuffix(data, []byte("\n")) && !sc.Scan(); torn {
+				break
+			}
+			return fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		switch {
+		case r.Message != nil:
+			_, err = put(tx, messageBucket, 0, r.Message)
+		case r.Transfer != nil:
+			_, err = put(tx, transferBucket, 0, r.Transfer)
+		case r.Peer != nil:
+			err = putPeer(tx, *r.Peer)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	db.obsolete = append(db.obsolete, path, path+".lock")
+	return nil
+}
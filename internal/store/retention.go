@@ -0,0 +1,160 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Retention bounds what the DB keeps. A zero field keeps everything.
+type Retention struct {
+	MaxAge     time.Duration // messages older than this are deleted
+	MaxPerPeer int           // messages kept per conversation, the newest
+	Transfers  bool          // transfer records older than MaxAge are deleted too
+}
+
+// retentionInterval is how often a running DB applies its retention again
+const retentionInterval = time.Hour
+
+// SetRetention makes r the policy, applies it now and then every hour
+// until the DB is closed
+func (db *DB) SetRetention(r Retention) error {
+	db.mu.Lock()
+	db.retention = r
+	start := db.stop == nil && db.bolt != nil && r != (Retention{})
+	if start {
+		db.stop = make(chan struct{})
+	}
+	stop := db.stop
+	db.mu.Unlock()
+	if start {
+		go db.retain(stop)
+	}
+	_, err := db.Prune()
+	return err
+}
+
+// retain prunes on every tick until stop is closed. A failed prune is rolled
+// back whole and tried again on the next one.
+func (db *DB) retain(stop chan struct{}) {
+	t := time.NewTicker(retentionInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			db.Prune()
+		}
+	}
+}
+
+// Prune deletes what the retention policy no longer keeps, in one
+// transaction, and returns how many records went
+func (db *DB) Prune() (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.bolt == nil {
+		return 0, errors.New("database is closed")
+	}
+	var (
+		messages  []entry
+		transfers []Transfer
+		removedM  int
+		removedT  int
+	)
+	now := time.Now()
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		var err error
+		if messages, removedM, err = db.pruneMessages(tx, now); err != nil {
+			return err
+		}
+		transfers, removedT, err = db.pruneTransfers(tx, now)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if removedM > 0 {
+		db.setMessages(messages)
+	}
+	if removedT > 0 {
+		db.transfers = transfers
+	}
+	return removedM + removedT, nil
+}
+
+// expired reports whether a record from t is older than the policy keeps
+func (r Retention) expired(now, t time.Time) bool {
+	return r.MaxAge > 0 && t.Before(now.Add(-r.MaxAge))
+}
+
+// pruneMessages deletes the messages the policy doesn't keep from tx and
+// returns the ones it does, the whole history, and how many went. Call it
+// with db.mu held.
+func (db *DB) pruneMessages(tx *bolt.Tx, now time.Time) ([]entry, int, error) {
+	r := db.retention
+	if r.MaxAge == 0 && r.MaxPerPeer == 0 {
+		return nil, 0, nil
+	}
+	var messages []entry
+	err := scan(tx, func(seq uint64, m Message) { messages = append(messages, entry{Message: m, seq: seq}) })
+	if err != nil {
+		return nil, 0, err
+	}
+	b := tx.Bucket(messageBucket)
+	keep := make([]bool, len(messages))
+	kept := map[string]int{} // per conversation, counting from the newest
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		peer := conversation(m.Message)
+		if r.expired(now, m.Time) || (r.MaxPerPeer > 0 && kept[peer] >= r.MaxPerPeer) {
+			if err := b.Delete(key(m.seq)); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		kept[peer]++
+		keep[i] = true
+	}
+	out := messages[:0]
+	for i, m := range messages {
+		if keep[i] {
+			out = append(out, m)
+		}
+	}
+	return out, len(messages) - len(out), nil
+}
+
+// pruneTransfers deletes the expired transfer records from tx, when the
+// policy covers them, and returns the ones kept and how many went. Call it
+// with db.mu held.
+func (db *DB) pruneTransfers(tx *bolt.Tx, now time.Time) ([]Transfer, int, error) {
+	r := db.retention
+	if !r.Transfers || r.MaxAge == 0 {
+		return nil, 0, nil
+	}
+	b := tx.Bucket(transferBucket)
+	var kept []Transfer
+	var expired [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var t Transfer
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		if r.expired(now, t.Time) {
+			expired = append(expired, k)
+		} else {
+			kept = append(kept, t)
+		}
+		return nil
+	})
+	for _, k := range expired {
+		if err == nil {
+			err = b.Delete(k)
+		}
+	}
+	return kept, len(expired), err
+}
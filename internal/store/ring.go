@@ -0,0 +1,148 @@
+package store
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// memoryWindow is how many of a conversation's newest messages the DB
+// keeps in memory. Older ones are only in the file, and reading them means
+// reading the messages bucket.
+const memoryWindow = 1000
+
+// entry is a message in memory
+type entry struct {
+	Message
+	lower string // the text in lower case, for Search
+	seq   uint64 // its key in the messages bucket, to merge conversations
+}
+
+// ring is one conversation's newest messages, at most memoryWindow,
+// oldest first from start
+type ring struct {
+	buf     []entry
+	start   int
+	spilled int // its messages only in the file
+}
+
+// push adds e, dropping the oldest message when the ring is full
+func (r *ring) push(e entry) {
+	if len(r.buf) < memoryWindow {
+		r.buf = append(r.buf, e)
+		return
+	}
+	r.buf[r.start] = e
+	r.start = (r.start + 1) % len(r.buf)
+	r.spilled++
+}
+
+// each calls f on the messages, oldest first
+func (r *ring) each(f func(e *entry)) {
+	for i := range r.buf {
+		f(&r.buf[(r.start+i)%len(r.buf)])
+	}
+}
+
+// conversation is the key of m's ring
+func conversation(m Message) string {
+	if m.Group {
+		return Everyone
+	}
+	return strings.ToLower(m.Peer)
+}
+
+// remember puts m, stored under seq, in memory. Call it with db.mu held.
+func (db *DB) remember(seq uint64, m Message) {
+	key := conversation(m)
+	r := db.convs[key]
+	if r == nil {
+		r = &ring{}
+		db.convs[key] = r
+	}
+	before := r.spilled
+	r.push(entry{Message: m, lower: strings.ToLower(m.Text), seq: seq})
+	db.spilled += r.spilled - before
+}
+
+// inMemory is how many messages are held in memory
+func (db *DB) inMemory() int {
+	n := 0
+	for _, r := range db.convs {
+		n += len(r.buf)
+	}
+	return n
+}
+
+// spills reports whether some of peer's messages are only in the file. A
+// peer that isn't a conversation's name, an IP, may be in any of them.
+// Call it with db.mu held.
+func (db *DB) spills(peer string) bool {
+	if r, ok := db.convs[strings.ToLower(peer)]; ok && peer != "" {
+		return r.spilled > 0
+	}
+	return db.spilled > 0
+}
+
+// recent is the messages in memory that keep reports true for, oldest
+// first. Call it with db.mu held.
+func (db *DB) recent(keep func(e *entry) bool) []Message {
+	var found []*entry
+	for _, r := range db.convs {
+		r.each(func(e *entry) {
+			if keep(e) {
+				found = append(found, e)
+			}
+		})
+	}
+	slices.SortFunc(found, func(a, b *entry) int { return cmp.Compare(a.seq, b.seq) })
+	out := make([]Message, len(found))
+	for i, e := range found {
+		out[i] = e.Message
+	}
+	return out
+}
+
+// scan calls f on the messages in tx, oldest first, with their keys
+func scan(tx *bolt.Tx, f func(seq uint64, m Message)) error {
+	return tx.Bucket(messageBucket).ForEach(func(k, v []byte) error {
+		var m Message
+		if err := json.Unmarshal(v, &m); err != nil {
+			return err
+		}
+		f(seqOf(k), m)
+		return nil
+	})
+}
+
+// find is the messages keep reports true for, oldest first: from memory
+// when peer's are all there, else from the file. Call it with db.mu held.
+func (db *DB) find(peer string, keep func(m Message, lower string) bool) []Message {
+	if db.spills(peer) && db.bolt != nil {
+		var out []Message
+		err := db.bolt.View(func(tx *bolt.Tx) error {
+			return scan(tx, func(_ uint64, m Message) {
+				if keep(m, strings.ToLower(m.Text)) {
+					out = append(out, m)
+				}
+			})
+		})
+		if err == nil {
+			return out
+		}
+		// The file can't be read: what is in memory is the best there is
+	}
+	return db.recent(func(e *entry) bool { return keep(e.Message, e.lower) })
+}
+
+// setMessages replaces the messages in memory with msgs, keeping each
+// conversation's newest. Call it with db.mu held.
+func (db *DB) setMessages(msgs []entry) {
+	db.convs, db.spilled = make(map[string]*ring), 0
+	for _, e := range msgs {
+		db.remember(e.seq, e.Message)
+	}
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lan-chat/internal/platform"
+)
+
+// KnownPeer is a peer seen on this or an earlier run. The roster of them is
+// kept in the database (see DB), so the peer list and the identity keys
+// pinned to names survive a restart.
+type KnownPeer struct {
+	Name      string    `json:"name"`
+	IPs       []string  `json:"ips"`           // addresses it was seen at, latest last
+	Key       string    `json:"key,omitempty"` // pinned identity public key, hex
+	Tags      []string  `json:"tags,omitempty"`
+	Verified  bool      `json:"verified"`       // passed the password check the last time it was asked
+	Pake      bool      `json:"pake,omitempty"` // has answered PAKE, so isn't asked the older checks again
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Prefs     PeerPrefs `json:"prefs,omitzero"`
+}
+
+// PeerPrefs override the global settings for one peer. The zero value of
+// each field follows them.
+type PeerPrefs struct {
+	DownloadDir string `json:"download_dir,omitempty"` // where their files are saved
+	Files       string `json:"files,omitempty"`        // "accept", "ask" about or "refuse" their files
+	Notify      string `json:"notify,omitempty"`       // "all" (even with do-not-disturb), "silent" (unread count only) or "none"
+	Previews    string `json:"previews,omitempty"`     // "show" or "hide" their previews in the list
+	AutoOpen    bool   `json:"auto_open,omitempty"`    // open their files in the default application on arrival
+}
+
+// Values each PeerPrefs choice can take; "" first, for the global setting
+var (
+	FilePrefs    = []string{"", "accept", "ask", "refuse"}
+	NotifyPrefs  = []string{"", "all", "silent", "none"}
+	PreviewPrefs = []string{"", "show", "hide"}
+)
+
+// IdentityPath is the default location of this install's identity key
+func IdentityPath() string {
+	if dir := platform.DataDir(); dir != "" {
+		return filepath.Join(dir, "identity.key")
+	}
+	return ""
+}
+
+// LoadRoster reads a peers.json roster, the format before the database; a
+// missing file is an empty roster
+func LoadRoster(path string) ([]KnownPeer, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var peers []KnownPeer
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
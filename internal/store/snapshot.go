@@ -0,0 +1,82 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lan-chat/internal/platform"
+)
+
+// Snapshot is the TUI's runtime state at exit, restored on the next launch
+// so the app picks up where it left off. Unlike UIState it is consumed:
+// the app removes it once restored.
+type Snapshot struct {
+	Saved  time.Time      `json:"saved"`
+	Name   string         `json:"name"`           // who was running; another name starts fresh
+	Peer   string         `json:"peer,omitempty"` // open conversation, "" on the peer list
+	IP     string         `json:"ip,omitempty"`
+	Draft  string         `json:"draft,omitempty"` // unsent text in the chat input
+	Unread map[string]int `json:"unread,omitempty"`
+	Outbox []Outgoing     `json:"outbox,omitempty"` // messages and files not yet delivered
+	// Chat pane lines by peer name. Snapshots from before conversations
+	// were kept apart have one mixed "history" instead, which is dropped:
+	// the messages themselves are in the database.
+	Chats map[string][]string `json:"chats,omitempty"`
+}
+
+// Outgoing is a message or file on its way to a peer; exactly one of Text
+// and Path is set
+type Outgoing struct {
+	Peer string `json:"peer"`
+	IP   string `json:"ip"`
+	Text string `json:"text,omitempty"`
+	Path string `json:"path,omitempty"` // absolute
+}
+
+// SnapshotPath is the default location of the snapshot, next to state.toml
+func SnapshotPath() string {
+	if dir := platform.StateDir(); dir != "" {
+		return filepath.Join(dir, "snapshot.json")
+	}
+	return ""
+}
+
+// LoadSnapshot reads the snapshot at path; ok is false if there is none
+func LoadSnapshot(path string) (s Snapshot, ok bool, err error) {
+	if path == "" {
+		return s, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, false, nil
+	} else if err != nil {
+		return s, false, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, false, err
+	}
+	return s, true, nil
+}
+
+// SaveSnapshot writes s to path, readable only by the user: it holds chat
+// history
+func SaveSnapshot(path string, s Snapshot) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename, so a crash mid-write leaves the old snapshot
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,135 @@
+// Package store handles what lan-chat keeps on disk: the config file format,
+// the state it remembers between runs, and exported chat history.
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"lan-chat/internal/platform"
+)
+
+// ParseFile reads a flat TOML subset: [section] headers, key = value
+// pairs (strings quoted, everything else bare) and # comments. Keys are
+// returned as "section.key".
+func ParseFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+		if strings.HasPrefix(val, "\"") {
+			unquoted, err := strconv.Unquote(val)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: bad string for %s: %v", path, n, key, err)
+			}
+			val = unquoted
+		} else if i := strings.Index(val, "#"); i >= 0 {
+			val = strings.TrimSpace(val[:i])
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		values[key] = val
+	}
+	return values, scanner.Err()
+}
+
+// UIState is what the app remembers between runs on its own, kept in
+// state.toml in the state directory so the user's config is never rewritten
+type UIState struct {
+	Sessions       int    // sessions started so far
+	HintsDismissed bool   // tips turned off from the config screen
+	Name           string // the default name as confirmed on the first run
+	// Last choices made in the UI, "" for the config file's: the peer
+	// list's sort order, the theme and the preview mode
+	Sort, Theme, Previews string
+}
+
+// StatePath is the default location of state.toml
+func StatePath() string {
+	if dir := platform.StateDir(); dir != "" {
+		return filepath.Join(dir, "state.toml")
+	}
+	return ""
+}
+
+// LoadUIState reads the state file; a missing or unreadable file is a fresh start
+func LoadUIState(path string) UIState {
+	var st UIState
+	values, err := ParseFile(path)
+	if err != nil {
+		return st
+	}
+	st.Sessions, _ = strconv.Atoi(values["hints.sessions"])
+	st.HintsDismissed, _ = strconv.ParseBool(values["hints.dismissed"])
+	st.Name = values["user.name"]
+	st.Sort, st.Theme, st.Previews = values["ui.sort"], values["ui.theme"], values["ui.previews"]
+	return st
+}
+
+func SaveUIState(path string, st UIState) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data := fmt.Sprintf("# Written by lan-chat, edit config.toml instead\n[hints]\nsessions = %d\ndismissed = %t\n", st.Sessions, st.HintsDismissed)
+	if st.Name != "" {
+		data += fmt.Sprintf("[user]\nname = %q\n", st.Name)
+	}
+	if st.Sort != "" || st.Theme != "" || st.Previews != "" {
+		data += fmt.Sprintf("[ui]\nsort = %q\ntheme = %q\npreviews = %q\n", st.Sort, st.Theme, st.Previews)
+	}
+	return os.WriteFile(path, []byte(data), 0644)
+}
+
+// HistoryDir is where exported chats go: history/ in the data directory,
+// or the working directory without one
+func HistoryDir() string {
+	if dir := platform.DataDir(); dir != "" {
+		return filepath.Join(dir, "history")
+	}
+	return ""
+}
+
+// ExportHistory writes plain-text chat lines to chat_<timestamp>.txt in
+// HistoryDir and returns its path
+func ExportHistory(lines []string) (string, error) {
+	dir := HistoryDir()
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+	}
+	path := filepath.Join(dir, "chat_"+time.Now().Format("20060102-150405")+".txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
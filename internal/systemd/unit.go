@@ -0,0 +1,82 @@
+package systemd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Service describes the lan-chat.service unit install-service writes
+type Service struct {
+	ExecStart []string // the daemon command line, --systemd included
+	Socket    bool     // started with the TCP port from lan-chat.socket
+	User      bool     // a user unit (systemctl --user) rather than a system one
+	RunAs     string   // the account a system unit runs the daemon as, never root
+	// EnvironmentFile is read by systemd into the daemon's environment,
+	// for $LANCHAT_PASSWORD, which ExecStart would show to everyone
+	EnvironmentFile string
+}
+
+// WatchdogSec is the watchdog timeout written into the unit; the daemon
+// pings at half of it
+const WatchdogSec = 30
+
+// Unit is the text of lan-chat.service
+func (s Service) Unit() string {
+	var b strings.Builder
+	b.WriteString("[Unit]\nDescription=LAN-CHAT daemon\nDocumentation=https://github.com/HoldenMorris/LAN-CHAT\n")
+	if s.User {
+		b.WriteString("After=network-online.target\n")
+	} else {
+		b.WriteString("Wants=network-online.target\nAfter=network-online.target\n")
+	}
+	if s.Socket {
+		b.WriteString("Requires=lan-chat.socket\nAfter=lan-chat.socket\n")
+	}
+	b.WriteString("\n[Service]\nType=notify\nNotifyAccess=main\n")
+	if !s.User {
+		fmt.Fprintf(&b, "User=%s\n", s.RunAs)
+	}
+	if s.EnvironmentFile != "" {
+		fmt.Fprintf(&b, "EnvironmentFile=%s\n", strings.ReplaceAll(s.EnvironmentFile, "%", "%%"))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\nWatchdogSec=%d\nRestart=on-failure\nRestartSec=5\n", quoteArgs(s.ExecStart), WatchdogSec)
+	if s.User {
+		b.WriteString("\n[Install]\nWantedBy=default.target\n")
+	} else {
+		b.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+	}
+	return b.String()
+}
+
+// SocketUnit is the text of lan-chat.socket, holding the TCP chat port
+func SocketUnit(port string) string {
+	return fmt.Sprintf("[Unit]\nDescription=LAN-CHAT chat and file port\n\n[Socket]\nListenStream=%s\n\n[Install]\nWantedBy=sockets.target\n", port)
+}
+
+// EnvironmentFile is the text of an EnvironmentFile setting each variable
+// in env, sorted, double-quoted with what systemd would expand escaped
+func EnvironmentFile(env map[string]string) string {
+	var b strings.Builder
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", k, r.Replace(env[k]))
+	}
+	return b.String()
+}
+
+// quoteArgs joins argv for ExecStart, quoting what systemd would split or
+// expand
+func quoteArgs(argv []string) string {
+	out := make([]string, len(argv))
+	for i, a := range argv {
+		if a != "" && !strings.ContainsAny(a, " \t\"'\\$%;") {
+			out[i] = a
+			continue
+		}
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+		out[i] = `"` + r.Replace(a) + `"`
+	}
+	return strings.Join(out, " ")
+}
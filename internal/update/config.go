@@ -0,0 +1,50 @@
+package update
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"lan-chat/internal/store"
+)
+
+// New is the updater configured by the [update] section of the config file
+// at configPath; a missing file or section means no startup check
+func New(configPath string) (*Updater, error) {
+	u := &Updater{Repo: DefaultRepo, API: DefaultAPI, Version: "dev"}
+	if configPath == "" {
+		return u, nil
+	}
+	values, err := store.ParseFile(configPath)
+	if os.IsNotExist(err) {
+		return u, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		key, ok := strings.CutPrefix(k, "update.")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "check":
+			if u.Check, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("%s: must be true or false, got %q", k, v)
+			}
+		case "repo":
+			if owner, name, ok := strings.Cut(v, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+				return nil, fmt.Errorf("%s: must be owner/name, got %q", k, v)
+			}
+			u.Repo = v
+		case "api":
+			if !strings.HasPrefix(v, "https://") && !strings.HasPrefix(v, "http://") {
+				return nil, fmt.Errorf("%s: must be an http(s) URL, got %q", k, v)
+			}
+			u.API = v
+		default:
+			return nil, fmt.Errorf("%s: unknown key", k)
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,315 @@
+// Package update finds newer lan-chat releases on GitHub and replaces the
+// running binary with one, after checking the signature on the release's
+// checksums with the release key built in, and the binary against them.
+//
+// A release has one binary per platform, named like AssetName, plus
+//
+//	checksums.txt      "<sha256 hex>  <asset name>" per line
+//	checksums.txt.sig  base64 ed25519 signature of checksums.txt
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for update.repo and update.api
+const (
+	DefaultRepo = "HoldenMorris/LAN-CHAT"
+	DefaultAPI  = "https://api.github.com"
+)
+
+// maxAsset bounds a download; the binary is a few tens of MB. checkTimeout
+// bounds the startup check, which must never hold anything up.
+const (
+	maxAsset     = 200 << 20
+	checkTimeout = 10 * time.Second
+)
+
+// PublicKey is the hex ed25519 key release checksums are signed with. It is
+// set at build time (see the Makefile); a build without it can't check a
+// release, and Apply refuses to install one unless Insecure is set.
+var PublicKey string
+
+// Errors from Apply when the signature can't be checked
+var (
+	ErrNoKey    = errors.New("this build has no release key to check the signature with")
+	ErrUnsigned = errors.New("release is not signed")
+)
+
+// Release is the latest release of the repository
+type Release struct {
+	Version string            // tag, e.g. "v1.4.0"
+	URL     string            // release page
+	Assets  map[string]string // download URL by file name
+}
+
+// Updater looks for releases of Repo
+type Updater struct {
+	Check    bool                                  // look for a newer release at startup
+	Repo     string                                // owner/name on GitHub
+	API      string                                // GitHub API base URL
+	Version  string                                // of the running binary; "dev" for unreleased builds
+	Insecure bool                                  // install without checking the signature, only the checksum
+	Logf     func(format string, v ...interface{}) // optional debug log
+
+	client http.Client
+}
+
+func (u *Updater) logf(format string, v ...interface{}) {
+	if u.Logf != nil {
+		u.Logf(format, v...)
+	}
+}
+
+// AssetName is the release file holding the binary for goos/goarch
+func AssetName(goos, goarch string) string {
+	name := "lan-chat_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Latest asks GitHub for the newest release
+func (u *Updater) Latest(ctx context.Context) (Release, error) {
+	var body struct {
+		Tag    string `json:"tag_name"`
+		URL    string `json:"html_url"`
+		Assets []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	data, err := u.get(ctx, strings.TrimSuffix(u.API, "/")+"/repos/"+u.Repo+"/releases/latest", "application/vnd.github+json", 1<<20)
+	if err != nil {
+		return Release{}, err
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return Release{}, fmt.Errorf("reading the release: %w", err)
+	}
+	r := Release{Version: body.Tag, URL: body.URL, Assets: make(map[string]string)}
+	for _, a := range body.Assets {
+		r.Assets[a.Name] = a.URL
+	}
+	return r, nil
+}
+
+// Available returns the latest release if it is newer than the running
+// binary. A "dev" build never hears of one: it can't tell.
+func (u *Updater) Available(ctx context.Context) (Release, bool, error) {
+	if u.Version == "dev" {
+		return Release{}, false, nil
+	}
+	r, err := u.Latest(ctx)
+	if err != nil {
+		return Release{}, false, err
+	}
+	return r, Newer(r.Version, u.Version), nil
+}
+
+// Apply downloads r's binary for this platform, checks it and replaces exe
+// with it. Without Insecure, a build with no release key, a release with no
+// signature or one that doesn't verify is an error and nothing is
+// downloaded beyond the checksums.
+func (u *Updater) Apply(ctx context.Context, r Release, exe string) error {
+	if PublicKey == "" && !u.Insecure {
+		return ErrNoKey
+	}
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	binURL, ok := r.Assets[name]
+	if !ok {
+		return fmt.Errorf("%s has no %s", r.Version, name)
+	}
+	sumsURL, ok := r.Assets["checksums.txt"]
+	if !ok {
+		return fmt.Errorf("%s has no checksums.txt", r.Version)
+	}
+	sums, err := u.get(ctx, sumsURL, "", 1<<20)
+	if err != nil {
+		return err
+	}
+	if !u.Insecure {
+		sigURL, ok := r.Assets["checksums.txt.sig"]
+		if !ok {
+			return ErrUnsigned
+		}
+		sig, err := u.get(ctx, sigURL, "", 4096)
+		if err != nil {
+			return err
+		}
+		if err := verify(sums, sig); err != nil {
+			return err
+		}
+	}
+	want, err := checksum(sums, name)
+	if err != nil {
+		return err
+	}
+	u.logf("Downloading %s", binURL)
+	bin, err := u.get(ctx, binURL, "", maxAsset)
+	if err != nil {
+		return err
+	}
+	if got := sha256.Sum256(bin); hex.EncodeToString(got[:]) != want {
+		return fmt.Errorf("%s does not match its checksum", name)
+	}
+	return replace(exe, bin)
+}
+
+func (u *Updater) get(ctx context.Context, url, accept string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "lan-chat/"+u.Version)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: more than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// verify checks sig, base64, against PublicKey
+func verify(sums, sig []byte) error {
+	key, err := hex.DecodeString(PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("this build's release key is malformed")
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil || !ed25519.Verify(key, sums, raw) {
+		return errors.New("checksums.txt has a bad signature")
+	}
+	return nil
+}
+
+// checksum finds name's line in checksums.txt
+func checksum(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		if len(f) == 2 && strings.TrimPrefix(f[1], "*") == name {
+			return strings.ToLower(f[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksums.txt has no line for %s", name)
+}
+
+// replace writes bin next to exe and renames it over exe, keeping its mode.
+// Windows won't replace a running binary but will rename it, so the old one
+// is moved aside to exe.old first.
+func replace(exe string, bin []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".lan-chat-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old) // left by the previous update
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), exe); err != nil {
+			os.Rename(old, exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+// Newer reports whether version a is after b. Versions are dotted numbers
+// with an optional leading "v"; a pre-release ("1.2.0-rc1") comes before
+// its release.
+func Newer(a, b string) bool {
+	an, apre := parseVersion(a)
+	bn, bpre := parseVersion(b)
+	for i := range max(len(an), len(bn)) {
+		var x, y int
+		if i < len(an) {
+			x = an[i]
+		}
+		if i < len(bn) {
+			y = bn[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return !apre && bpre
+}
+
+func parseVersion(v string) (nums []int, pre bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, pre = strings.Cut(v, "-")
+	for _, part := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(part)
+		nums = append(nums, n)
+	}
+	return nums, pre
+}
+
+// Notify looks for a newer release in the background if Check is on, and
+// calls found with it
+func (u *Updater) Notify(found func(Release)) {
+	if !u.Check {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		defer cancel()
+		r, ok, err := u.Available(ctx)
+		if err != nil {
+			u.logf("Update check: %v", err)
+			return
+		}
+		if ok {
+			found(r)
+		}
+	}()
+}
@@ -0,0 +1,182 @@
+// Package web is the browser frontend enabled with --web: a single page
+// served from the binary, talking to the REST API (internal/api) under
+// /v1/ and to a WebSocket feed of node events at /v1/events. The running
+// instance is the browser user's node.
+package web
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"lan-chat/internal/api"
+	"lan-chat/internal/bus"
+	"lan-chat/internal/node"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// Backend is what the frontend drives; *node.Node implements it
+type Backend interface {
+	api.Backend
+	Subscribe(buffer int, policy bus.Policy) *bus.Subscription[node.Event]
+}
+
+// Event is one WebSocket message; Type says which other field is set
+type Event struct {
+	Type     string         `json:"type"` // peer, message, file, transfer or error
+	Time     time.Time      `json:"time"`
+	Peer     *node.PeerInfo `json:"peer,omitempty"`
+	Message  *node.Message  `json:"message,omitempty"`
+	File     *File          `json:"file,omitempty"`
+	Transfer *Transfer      `json:"transfer,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// File is a received file, saved by the instance
+type File struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	From      string `json:"from"` // sender IP
+	Encrypted bool   `json:"encrypted"`
+}
+
+// Transfer is progress on an outgoing file
+type Transfer struct {
+	Peer  string `json:"peer"`
+	Name  string `json:"name"`
+	Sent  int64  `json:"sent"`
+	Total int64  `json:"total"`
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// Protocol is the WebSocket subprotocol the feed answers with. The browser
+// asks for it alongside "bearer.<token>", the one header a browser lets a
+// WebSocket carry, so the token stays out of the URL and the logs it ends
+// up in.
+const Protocol = "lanchat.v1"
+
+// Handler serves the page, the REST API and the event feed for b. Every
+// API call needs token; the page asks for it once and keeps it in the
+// browser. POST /v1/transfers, which sends any file the instance can read,
+// isn't served: a browser has no business naming files on this machine.
+func Handler(b Backend, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		w.Write(indexHTML)
+	})
+	feed := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			config.Protocol = []string{Protocol}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) { stream(ws, b) },
+	}
+	mux.HandleFunc("GET /v1/events", func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(feedToken(r)), []byte(token)) != 1 {
+			http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+			return
+		}
+		feed.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("POST /v1/transfers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "files can't be sent from the web UI; use --api on a loopback address"})
+	})
+	mux.Handle("/v1/", api.Handler(b, token))
+	return mux
+}
+
+// feedToken is the token among the subprotocols a WebSocket request asks
+// for, as "bearer.<token>"
+func feedToken(r *http.Request) string {
+	for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(h, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(p), "bearer."); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// stream writes node events to ws until the browser goes away
+func stream(ws *websocket.Conn, b Backend) {
+	sub := b.Subscribe(node.DefaultBuffer, bus.DropNewest)
+	defer sub.Close()
+	gone := make(chan struct{})
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		close(gone)
+	}()
+	for {
+		select {
+		case <-gone:
+			return
+		case ev := <-sub.Events():
+			e, ok := toEvent(b, ev)
+			if !ok {
+				continue
+			}
+			if err := websocket.JSON.Send(ws, e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// toEvent converts a node event, or reports false for ones the page
+// doesn't show
+func toEvent(b Backend, ev node.Event) (Event, bool) {
+	e := Event{Time: time.Now()}
+	peer := func(ip string) *node.PeerInfo {
+		if p, ok := b.Lookup(ip); ok {
+			return &p
+		}
+		return &node.PeerInfo{IP: ip}
+	}
+	switch ev := ev.(type) {
+	case node.PeerFound:
+		e.Type, e.Peer = "peer", peer(ev.Peer.IP)
+	case node.PeerVerified:
+		e.Type, e.Peer = "peer", peer(ev.IP)
+	case node.PeerHealth:
+		e.Type, e.Peer = "peer", peer(ev.IP)
+	case node.ChatReceived:
+		if ev.Err != nil {
+			e.Type, e.Error = "error", "message from "+ev.Sender+": "+ev.Err.Error()
+			break
+		}
+		e.Type = "message"
+		e.Message = &node.Message{Time: ev.Time, Peer: ev.Sender, IP: ev.From, Text: ev.Text, Encrypted: ev.Encrypted, Group: ev.Group}
+	case node.ChatSent:
+		m := ev.Message
+		e.Type, e.Message = "message", &m
+	case node.FileReceived:
+		e.Type = "file"
+		e.File = &File{Name: ev.Name, Path: ev.Path, From: ev.From, Encrypted: ev.Encrypted}
+	case node.TransferProgress:
+		t := &Transfer{Peer: peer(ev.IP).Name, Name: ev.Name, Sent: ev.Sent, Total: ev.Total, Done: ev.Done}
+		if ev.Err != nil {
+			t.Error = ev.Err.Error()
+		}
+		e.Type, e.Transfer = "transfer", t
+	case node.ServerError:
+		e.Type, e.Error = "error", ev.Err.Error()
+	default:
+		return e, false
+	}
+	return e, true
+}
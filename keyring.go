@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"lan-chat/internal/platform"
+)
+
+// --pass puts the shared password in shell history and in ps for anyone on
+// the machine to read. --encrypt asks for it on the terminal instead, and
+// --keyring keeps it in the OS keyring (see platform.KeyringGet) so it is
+// asked for once. The TUI hands an answer to its --detach session server in
+// $LANCHAT_PASSWORD, which only the same user can read.
+
+// passwordEnv is the shared password for a process that can't ask for it
+const passwordEnv = "LANCHAT_PASSWORD"
+
+// keyringName is what the shared password is stored under in the keyring
+const keyringName = "password"
+
+// runKeyring is `lan-chat keyring`: store a new shared password in the OS
+// keyring, or remove it with --delete
+func runKeyring(args []string) {
+	fs := flag.NewFlagSet("keyring", flag.ExitOnError)
+	del := fs.Bool("delete", false, "Remove the shared password from the keyring")
+	fs.Usage = func() {
+		fmt.Println("Usage: lan-chat keyring [--delete]")
+		fmt.Println("Asks for the shared password and stores it in the OS keyring for --keyring; without a terminal it reads a line of stdin.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *del {
+		err := platform.KeyringDelete(keyringName)
+		if errors.Is(err, platform.ErrNotInKeyring) {
+			fmt.Println("No shared password in the keyring")
+			return
+		}
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Println("Removed the shared password from the keyring")
+		return
+	}
+	p, err := readPassphrase("Shared password: ", true)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if err := platform.KeyringSet(keyringName, p); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Println("Stored the shared password in the keyring; start with --keyring to use it")
+}
+
+// passForSession asks for the password now, while there is a terminal, if
+// --encrypt or --keyring needs it, and hands it to the session server in
+// the environment
+func (s settings) passForSession(fs *flag.FlagSet, flagValue string) error {
+	if flagGiven(fs, "pass") || !flagOn(fs, "encrypt") && !s.useKeyring(fs) {
+		return nil
+	}
+	p, err := s.resolvePassword(fs, flagValue)
+	if err != nil || p == "" {
+		return err
+	}
+	return os.Setenv(passwordEnv, p)
+}
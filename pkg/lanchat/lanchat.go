@@ -0,0 +1,381 @@
+// Package lanchat lets other Go programs join a LAN-CHAT network: discover
+// peers, chat and send or receive files, encrypted when peers share a
+// password. It is the same peer the lan-chat TUI and daemon run.
+//
+//	c := lanchat.New(lanchat.Config{Name: "build-bot", Password: "secret", Dir: "/srv/inbox"})
+//	if err := c.Connect(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	for ev := range c.Events() {
+//		if m, ok := ev.(lanchat.MessageReceived); ok {
+//			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//			c.Send(ctx, m.Peer, "got it")
+//			cancel()
+//		}
+//	}
+//
+// Calls that reach the network take a context and give up once it is done.
+//
+// The wire protocol and its encryption are also available without a
+// Client (SendMessage, SendFile, Ping, Verify, Encrypt, Decrypt).
+package lanchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/node"
+)
+
+// Peer is another LAN-CHAT instance on the network
+type Peer struct {
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	Secure    bool   `json:"secure"`    // password verified, traffic is encrypted
+	Reachable bool   `json:"reachable"` // answered the last heartbeat
+}
+
+// Message is a chat message the client sent or received
+type Message struct {
+	Time      time.Time `json:"time"`
+	Peer      string    `json:"peer"` // the other side's name
+	IP        string    `json:"ip"`
+	Sent      bool      `json:"sent"` // we sent it
+	Text      string    `json:"text"`
+	Encrypted bool      `json:"encrypted"`
+	Group     bool      `json:"group,omitempty"` // sent to everyone (see SendGroup)
+}
+
+// Transfer is the state of an outgoing file
+type Transfer struct {
+	Peer  Peer
+	Name  string // file name as sent
+	Sent  int64  // bytes read from the file so far
+	Total int64
+	Done  bool
+	Err   error // why it failed, once Done
+}
+
+// Event is one of the event types below
+type Event interface{ lanchatEvent() }
+
+// PeerFound is a peer announcing itself for the first time, or again
+// after PeerLost
+type PeerFound struct{ Peer Peer }
+
+// PeerLost is a peer that stopped announcing itself: it quit or left the
+// network, and is gone from Peers until it is found again
+type PeerLost struct {
+	Peer     Peer
+	LastSeen time.Time
+}
+
+// PeerUpdated is a peer whose verification or reachability changed
+type PeerUpdated struct{ Peer Peer }
+
+// MessageReceived is an incoming chat message
+type MessageReceived struct{ Message }
+
+// FileReceived is an incoming file, already saved at Path
+type FileReceived struct {
+	Name      string
+	Path      string
+	From      Peer
+	Encrypted bool
+}
+
+// TransferProgress reports an outgoing file while it is sent and once more
+// when it is Done
+type TransferProgress struct{ Transfer }
+
+// Error is something that went wrong in the background: a port that could
+// not be opened, a message or file that could not be decrypted
+type Error struct{ Err error }
+
+func (PeerFound) lanchatEvent()        {}
+func (PeerLost) lanchatEvent()         {}
+func (PeerUpdated) lanchatEvent()      {}
+func (MessageReceived) lanchatEvent()  {}
+func (FileReceived) lanchatEvent()     {}
+func (TransferProgress) lanchatEvent() {}
+func (Error) lanchatEvent()            {}
+
+// EventBuffer is how many events Events holds unread before the oldest
+// are dropped
+const EventBuffer = 256
+
+// ErrUnknownPeer is returned for a peer name or IP nobody announced
+var ErrUnknownPeer = errors.New("lanchat: unknown peer")
+
+// Config is what New sets a Client up with
+type Config struct {
+	Name     string // announced to everyone
+	Password string // shared secret; "" sends everything in the clear
+	Dir      string // where received files are saved, "" for the working directory
+}
+
+// Client is one peer on the network. Set the fields, then call Start once.
+type Client struct {
+	Name     string // announced to everyone
+	Password string // shared secret; "" sends everything in the clear
+	Dir      string // where received files are saved, "" for the working directory
+
+	once   sync.Once
+	n      *node.Node
+	events *bus.Subscription[Event]
+}
+
+// New is a client for cfg; nothing is opened until Start or the first call
+// that needs the network
+func New(cfg Config) *Client {
+	return &Client{Name: cfg.Name, Password: cfg.Password, Dir: cfg.Dir}
+}
+
+// NewClient is a client announcing itself as name
+func NewClient(name, password string) *Client {
+	return New(Config{Name: name, Password: password})
+}
+
+// Start opens the discovery and chat ports and begins announcing. Problems
+// opening them arrive as Error events.
+func (c *Client) Start() {
+	c.once.Do(func() {
+		c.setup()
+		c.n.Start()
+	})
+}
+
+// Connect is Start that waits for the discovery and chat ports to open. It
+// returns the error of the first that couldn't, or ctx's once it is done
+// (the client goes on starting). A client already started returns nil.
+func (c *Client) Connect(ctx context.Context) error {
+	var sub *bus.Subscription[node.Event]
+	c.once.Do(func() {
+		c.setup()
+		// Before the ports open, so neither ListenerUp is missed
+		sub = c.n.Subscribe(node.DefaultBuffer, bus.Block)
+		c.n.Start()
+	})
+	if sub == nil {
+		return nil
+	}
+	defer sub.Close()
+	up := make(map[string]bool)
+	for len(up) < 2 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-sub.Events():
+			if l, ok := ev.(node.ListenerUp); ok {
+				if l.Err != nil {
+					return fmt.Errorf("lanchat: %s port %s: %w", l.Proto, l.Port, l.Err)
+				}
+				up[l.Proto] = true
+			}
+		}
+	}
+	return nil
+}
+
+// setup creates the node and passes its events on to Events
+func (c *Client) setup() {
+	c.n = node.New(c.Name, c.Password)
+	c.n.Dir = c.Dir
+	b := bus.New[Event]()
+	c.events = b.Subscribe(EventBuffer, bus.DropOldest)
+	go func() {
+		for ev := range c.n.Events() {
+			if e := c.event(ev); e != nil {
+				b.Publish(e)
+			}
+		}
+	}()
+}
+
+// Events delivers what happens from Start on. A reader that falls more than
+// EventBuffer events behind loses the oldest ones; Dropped counts them.
+func (c *Client) Events() <-chan Event {
+	c.Start()
+	return c.events.Events()
+}
+
+// Dropped is how many events Events lost because nobody read them
+func (c *Client) Dropped() uint64 {
+	c.Start()
+	return c.events.Dropped()
+}
+
+// Peers is everyone discovered so far, sorted by name
+func (c *Client) Peers() []Peer {
+	c.Start()
+	var peers []Peer
+	for _, p := range c.n.Peers() {
+		peers = append(peers, toPeer(p))
+	}
+	return peers
+}
+
+// Discover delivers each peer as it is found, the ones already known first,
+// until ctx is done; then the channel is closed. It starts the client.
+func (c *Client) Discover(ctx context.Context) <-chan Peer {
+	c.Start()
+	sub := c.n.Subscribe(node.DefaultBuffer, bus.DropNewest)
+	out := make(chan Peer)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		seen := make(map[string]bool)
+		send := func(p Peer) bool {
+			if seen[p.IP] {
+				return true
+			}
+			seen[p.IP] = true
+			select {
+			case out <- p:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		// Subscribed first, so nobody found in between is missed
+		for _, p := range c.Peers() {
+			if !send(p) {
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				if f, ok := ev.(node.PeerFound); ok && !send(c.peer(f.Peer.IP)) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Lookup finds a peer by name (case-insensitive) or IP
+func (c *Client) Lookup(peer string) (Peer, bool) {
+	c.Start()
+	p, ok := c.n.Lookup(peer)
+	return toPeer(p), ok
+}
+
+// Send sends text to peer (a name or IP), encrypted once the peer is
+// verified. It gives up once ctx is done.
+func (c *Client) Send(ctx context.Context, peer, text string) error {
+	p, err := c.lookup(peer)
+	if err != nil {
+		return err
+	}
+	return c.n.SendChatContext(ctx, p.IP, text)
+}
+
+// SendGroup sends text to every reachable peer as a group message, which
+// they can tell from one sent to them alone. The error names each peer
+// that didn't get it; the message counts as sent if any peer did.
+func (c *Client) SendGroup(ctx context.Context, text string) error {
+	c.Start()
+	return c.n.SendGroupChat(ctx, text)
+}
+
+// SendMessage is Send bounded only by the dial timeout
+func (c *Client) SendMessage(peer, text string) error {
+	return c.Send(context.Background(), peer, text)
+}
+
+// SendFile sends the file at path to peer (a name or IP) and returns when
+// it is sent, or once ctx is done. progress, if set, is called on the way
+// and once more when the transfer is Done; TransferProgress events report
+// it too.
+func (c *Client) SendFile(ctx context.Context, peer, path string, progress func(Transfer)) error {
+	p, err := c.lookup(peer)
+	if err != nil {
+		return err
+	}
+	var report func(node.TransferProgress)
+	if progress != nil {
+		report = func(ev node.TransferProgress) { progress(c.transfer(ev)) }
+	}
+	return c.n.SendFileContext(ctx, p.IP, path, report)
+}
+
+// History is the messages exchanged with peer (a name or IP, or "*" for
+// the group messages), or every message if peer is "", oldest first. Only
+// this run's messages are kept.
+func (c *Client) History(peer string) []Message {
+	c.Start()
+	var out []Message
+	for _, m := range c.n.History(peer) {
+		out = append(out, Message(m))
+	}
+	return out
+}
+
+func (c *Client) lookup(peer string) (Peer, error) {
+	p, ok := c.Lookup(peer)
+	if !ok {
+		return p, ErrUnknownPeer
+	}
+	return p, nil
+}
+
+func toPeer(p node.PeerInfo) Peer {
+	return Peer{Name: p.Name, IP: p.IP, Secure: p.Secure, Reachable: p.Reachable}
+}
+
+// peer is the client's view of ip, or just the IP if it never announced
+func (c *Client) peer(ip string) Peer {
+	if p, ok := c.n.Lookup(ip); ok {
+		return toPeer(p)
+	}
+	return Peer{IP: ip}
+}
+
+func (c *Client) transfer(ev node.TransferProgress) Transfer {
+	return Transfer{Peer: c.peer(ev.IP), Name: ev.Name, Sent: ev.Sent, Total: ev.Total, Done: ev.Done, Err: ev.Err}
+}
+
+// event converts a node event, or returns nil for ones the API doesn't carry
+func (c *Client) event(ev node.Event) Event {
+	switch ev := ev.(type) {
+	case node.ListenerUp:
+		if ev.Err != nil {
+			return Error{Err: ev.Err}
+		}
+	case node.PeerFound:
+		return PeerFound{Peer: c.peer(ev.Peer.IP)}
+	case node.PeerLost:
+		return PeerLost{Peer: Peer{Name: ev.Peer.Name, IP: ev.Peer.IP}, LastSeen: ev.LastSeen}
+	case node.PeerVerified:
+		return PeerUpdated{Peer: c.peer(ev.IP)}
+	case node.PeerHealth:
+		return PeerUpdated{Peer: c.peer(ev.IP)}
+	case node.ChatReceived:
+		if ev.Err != nil {
+			return Error{Err: fmt.Errorf("message from %s: %w", ev.Sender, ev.Err)}
+		}
+		return MessageReceived{Message{
+			Time: ev.Time, Peer: ev.Sender, IP: ev.From, Text: ev.Text, Encrypted: ev.Encrypted, Group: ev.Group,
+		}}
+	case node.FileReceived:
+		path, _ := filepath.Abs(ev.Path)
+		return FileReceived{Name: ev.Name, Path: path, From: c.peer(ev.From), Encrypted: ev.Encrypted}
+	case node.TransferProgress:
+		return TransferProgress{c.transfer(ev)}
+	case node.ServerError:
+		return Error{Err: ev.Err}
+	}
+	return nil
+}
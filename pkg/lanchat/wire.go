@@ -0,0 +1,58 @@
+package lanchat
+
+import (
+	"io"
+
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/protocol"
+)
+
+// Ports every peer uses: announcements are broadcast on DiscoveryPort
+// (UDP), chats and files go to ChatPort (TCP)
+const (
+	DiscoveryPort = discovery.DefaultPort
+	ChatPort      = protocol.DefaultPort
+)
+
+// ErrNoPassword is the error for encrypted data arriving at a client
+// without a password
+var ErrNoPassword = protocol.ErrNoPassword
+
+// SendMessage delivers one chat message to the peer at ip without a
+// Client, encrypted when password is set. The peer must hold the same
+// password to read it.
+func SendMessage(ip, sender, text, password string) error {
+	return protocol.SendChat(ip, sender, text, password)
+}
+
+// SendFile streams r to the peer at ip, saved there as received_<name>,
+// numbered if that is taken
+func SendFile(ip, name string, r io.Reader, password string) error {
+	return protocol.SendFile(ip, name, r, password)
+}
+
+// Ping reports whether a peer's chat port answers
+func Ping(ip string) bool { return protocol.Ping(ip) }
+
+// Verify asks the peer at ip whether it holds password, by PAKE. A peer
+// from before PAKE, which would need a proof guesses can be tested
+// against, isn't asked and gets an error.
+func Verify(ip, password string) (bool, error) {
+	return protocol.VerifyPassword(ip, password)
+}
+
+// Encrypt is the AES-256-GCM encryption used on the wire, base64 encoded,
+// under the password's Argon2id key for a new salt that goes with it
+func Encrypt(plaintext []byte, password string) (string, error) {
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return "", err
+	}
+	return crypto.EncryptSalted(plaintext, password, salt)
+}
+
+// Decrypt reverses Encrypt
+func Decrypt(encoded, password string) ([]byte, error) {
+	return crypto.Decrypt(encoded, password)
+}
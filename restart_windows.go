@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// restart can't replace the process on Windows, and a child started from
+// here would find our ports still taken
+func restart() error {
+	return errors.New("restarting in place isn't supported on Windows; start lan-chat again")
+}
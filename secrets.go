@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	osuser "os/user"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/platform"
+	"lan-chat/internal/store"
+	"lan-chat/ui"
+)
+
+// The secrets lan-chat keeps in files, the password_file and the identity
+// key, can be sealed by `lan-chat lock-secrets`: with a passphrase, asked
+// once on start (or taken from $LANCHAT_PASSPHRASE when there is no
+// terminal), or with a key from the machine ID, which needs no prompt but
+// only opens on this machine for this user.
+
+// passphraseEnv unlocks passphrase-sealed secrets without a terminal: for
+// the daemon, and for the --detach session server, which gets it from the
+// TUI that started it
+const passphraseEnv = "LANCHAT_PASSPHRASE"
+
+// unlocked is the passphrase once it was asked for, so it is asked only once
+var unlocked string
+
+// runLockSecrets is `lan-chat lock-secrets`: seal the password file and the
+// identity key in place
+func runLockSecrets(args []string) {
+	fs := flag.NewFlagSet("lock-secrets", flag.ExitOnError)
+	machine := fs.Bool("machine", false, "Seal with a key from this machine's ID instead of a passphrase; no prompt on start, but the files only open here")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Path to the config file naming the password file")
+	fs.Parse(args)
+	s := cliSettings(fs, *configFile)
+	// The identity key is created here if this install has none yet
+	if _, err := crypto.LoadIdentity(store.IdentityPath(), unsealSecret); err != nil {
+		fatalf("identity key: %v", err)
+	}
+	var seal func([]byte) (string, error)
+	if *machine {
+		key, err := machineKey()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		seal = func(b []byte) (string, error) { return crypto.SealForMachine(b, key) }
+	} else {
+		p, err := readPassphrase("New passphrase for lan-chat's secrets: ", true)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		seal = func(b []byte) (string, error) { return crypto.Seal(b, p) }
+	}
+	rewriteSecrets(s, func(plain []byte) ([]byte, error) {
+		sealed, err := seal(plain)
+		return []byte(sealed + "\n"), err
+	})
+}
+
+// runUnlockSecrets is `lan-chat unlock-secrets`: turn sealed secrets back
+// into plain files
+func runUnlockSecrets(args []string) {
+	fs := flag.NewFlagSet("unlock-secrets", flag.ExitOnError)
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Path to the config file naming the password file")
+	fs.Parse(args)
+	rewriteSecrets(cliSettings(fs, *configFile), func(plain []byte) ([]byte, error) { return plain, nil })
+}
+
+// rewriteSecrets opens each secret file and writes what encode makes of it
+// in its place, mode 0600
+func rewriteSecrets(s settings, encode func([]byte) ([]byte, error)) {
+	paths := []string{store.IdentityPath()}
+	if s.passwordFile != "" {
+		paths = append(paths, s.passwordFile)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if data, err = unsealSecret(data); err == nil {
+			data, err = encode(data)
+		}
+		if err != nil {
+			fatalf("%s: %v", path, err)
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0600); err != nil {
+			fatalf("%v", err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			fatalf("%v", err)
+		}
+		fmt.Println("Wrote", path)
+	}
+}
+
+// unsealSecret opens a file's contents lock-secrets sealed; anything else
+// is returned as it is
+func unsealSecret(data []byte) ([]byte, error) {
+	sealed := strings.TrimSpace(string(data))
+	switch {
+	case crypto.IsMachineSealed(sealed):
+		key, err := machineKey()
+		if err != nil {
+			return nil, err
+		}
+		plain, err := crypto.OpenForMachine(sealed, key)
+		if errors.Is(err, crypto.ErrPassphrase) {
+			return nil, errors.New("sealed on another machine or by another user, or damaged")
+		}
+		return plain, err
+	case crypto.IsSealed(sealed):
+		p, err := unlockPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		plain, err := crypto.Open(sealed, p)
+		if err != nil {
+			unlocked = "" // ask again for the next one
+		}
+		return plain, err
+	}
+	return data, nil
+}
+
+// unlockPassphrase is the passphrase for sealed secrets: $LANCHAT_PASSPHRASE,
+// else asked on the terminal
+func unlockPassphrase() (string, error) {
+	if unlocked != "" {
+		return unlocked, nil
+	}
+	if p := os.Getenv(passphraseEnv); p != "" {
+		unlocked = p
+		return p, nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return "", fmt.Errorf("sealed with a passphrase: run on a terminal or set $%s", passphraseEnv)
+	}
+	p, err := readPassphrase("Passphrase to unlock lan-chat's secrets: ", false)
+	if err != nil {
+		return "", err
+	}
+	unlocked = p
+	return p, nil
+}
+
+// unlockForSession asks for the passphrase now, while there is a terminal,
+// if a secret needs it, and hands it to the session server in the
+// environment
+func (s settings) unlockForSession() error {
+	for _, path := range []string{store.IdentityPath(), s.passwordFile} {
+		if data, err := os.ReadFile(path); err == nil && crypto.IsSealed(strings.TrimSpace(string(data))) {
+			p, err := unlockPassphrase()
+			if err != nil {
+				return err
+			}
+			return os.Setenv(passphraseEnv, p)
+		}
+	}
+	return nil
+}
+
+// machineKey is what SealForMachine keys on: the machine ID and the user,
+// so another account on the same machine can't open the files either
+func machineKey() (string, error) {
+	id, err := platform.MachineID()
+	if err != nil {
+		return "", err
+	}
+	u, err := osuser.Current()
+	if err != nil {
+		return "", err
+	}
+	return id + ":" + u.Uid, nil
+}
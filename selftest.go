@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"lan-chat/internal/bench"
+	"lan-chat/internal/harness"
+)
+
+// runSelftest is `lan-chat selftest`: the end-to-end scenario on an
+// in-memory network, for CI machines that can't open LAN sockets
+func runSelftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	peers := fs.Int("peers", 3, "Number of simulated peers")
+	fs.Parse(args)
+
+	start := time.Now()
+	err := harness.Selftest(*peers, func(format string, v ...interface{}) {
+		fmt.Printf("[%5.1fs] "+format+"\n", append([]interface{}{time.Since(start).Seconds()}, v...)...)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("PASS (%d peers, %.1fs)\n", *peers, time.Since(start).Seconds())
+}
+
+// runBench is `lan-chat bench`: the crypto, wire format and transfer
+// benchmarks, printed like `go test -bench`
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	run := fs.String("run", "", "Only run benchmarks whose name matches this regular expression, e.g. crypto/")
+	fs.Parse(args)
+
+	var match *regexp.Regexp
+	if *run != "" {
+		var err error
+		if match, err = regexp.Compile(*run); err != nil {
+			fatalf("--run: %v", err)
+		}
+	}
+	if err := bench.Run(match, func(format string, v ...interface{}) { fmt.Printf(format+"\n", v...) }); err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	osuser "os/user"
+	"path/filepath"
+	"strings"
+
+	"lan-chat/internal/platform"
+	"lan-chat/internal/protocol"
+	"lan-chat/internal/systemd"
+	"lan-chat/ui"
+)
+
+// runInstallService is `lan-chat install-service`: writes a systemd unit
+// that runs `lan-chat daemon --systemd`, and optionally a socket unit
+// holding the chat port
+func runInstallService(args []string) {
+	fs := flag.NewFlagSet("install-service", flag.ExitOnError)
+	system := fs.Bool("system", false, "Write a system unit to /etc/systemd/system instead of a user unit")
+	socket := fs.Bool("socket", false, "Also write lan-chat.socket so systemd holds the TCP chat port ("+protocol.DefaultPort+" unless tcp_port under [network] says otherwise)")
+	password := fs.String("pass", "", "Shared password, written to an environment file the unit reads (mode 0600)")
+	keyring := fs.Bool("keyring", false, "Have the daemon take the shared password from the OS keyring (see lan-chat keyring); a user unit only")
+	runAs := fs.String("run-as", "", "Account a --system unit runs the daemon as, never root (default: $SUDO_USER, else you)")
+	addPortFlags(fs)
+	dir := fs.String("dir", "", "Directory received files are saved in (default: dir under [downloads] in the config, or the downloads folder)")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Path to the config file the daemon reads (default for --system: the --run-as account's own)")
+	fs.Usage = func() {
+		fmt.Println("Usage: lan-chat install-service [--system [--run-as=USER]] [--socket] [--pass=PASSWORD|--keyring] [--tcp-port=PORT] [--udp-port=PORT] [--dir=DIR] [--config=PATH] [<yourname>]")
+		fmt.Println("<yourname> defaults to name under [user] in the config file, else to user@host.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	s, err := loadSettings(*configFile)
+	if err == nil {
+		err = s.usePortFlags(fs)
+	}
+	if err != nil {
+		fatalf("config: %v", err)
+	}
+	s.apply()
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		fatalf("%v", err)
+	}
+	unitDir, envDir := "/etc/systemd/system", "/etc/lan-chat"
+	if *system {
+		if *runAs, err = serviceAccount(*runAs); err != nil {
+			fatalf("%v", err)
+		}
+	} else {
+		config, err := os.UserConfigDir()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		unitDir, envDir = filepath.Join(config, "systemd", "user"), platform.ConfigDir()
+	}
+	// A system unit runs as another account, which has a config and a
+	// downloads folder of its own; only what is given here overrides them
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if *dir == "" && !*system {
+		*dir = s.downloadDir
+	}
+	if *dir == "" && !*system {
+		if *dir = platform.DownloadDir(); *dir == "" {
+			fatalf("no home directory; pass --dir")
+		}
+	}
+	if *dir != "" {
+		if *dir, err = filepath.Abs(*dir); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	argv := []string{exe, "daemon", "--systemd"}
+	unit := "lan-chat"
+	if platform.Profile != "" {
+		argv = append([]string{exe, "--profile=" + platform.Profile}, argv[1:]...)
+		unit += "-" + platform.Profile
+	}
+	if *dir != "" {
+		argv = append(argv, "--dir="+*dir)
+	}
+	if *configFile != "" && (given["config"] || !*system) {
+		argv = append(argv, "--config="+*configFile)
+	}
+	if *keyring && *password == "" {
+		argv = append(argv, "--keyring")
+	}
+	for _, name := range []string{"tcp-port", "udp-port"} {
+		if port := fs.Lookup(name).Value.String(); port != "" {
+			argv = append(argv, "--"+name+"="+port)
+		}
+	}
+	// Without a name the daemon reads it from the config, or falls back to
+	// user@host, so changing it there is enough
+	if fs.NArg() > 0 {
+		argv = append(argv, fs.Arg(0))
+	}
+	svc := systemd.Service{ExecStart: argv, Socket: *socket, User: !*system, RunAs: *runAs}
+
+	if *password != "" {
+		// On the command line every local user would see it in ps
+		if strings.ContainsAny(*password, "\r\n") {
+			fatalf("--pass: the password can't hold a line break")
+		}
+		svc.EnvironmentFile = filepath.Join(envDir, unit+".env")
+		if err := os.MkdirAll(envDir, 0700); err != nil {
+			fatalf("%v", err)
+		}
+		env := systemd.EnvironmentFile(map[string]string{passwordEnv: *password})
+		tmp := svc.EnvironmentFile + ".tmp"
+		if err := os.WriteFile(tmp, []byte(env), 0600); err != nil {
+			fatalf("%v", err)
+		}
+		if err := os.Rename(tmp, svc.EnvironmentFile); err != nil {
+			os.Remove(tmp)
+			fatalf("%v", err)
+		}
+		fmt.Println("Wrote", svc.EnvironmentFile)
+	}
+	if err := os.MkdirAll(unitDir, 0755); err != nil {
+		fatalf("%v", err)
+	}
+	path := filepath.Join(unitDir, unit+".service")
+	if err := os.WriteFile(path, []byte(svc.Unit()), 0644); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Println("Wrote", path)
+	if *socket {
+		path := filepath.Join(unitDir, unit+".socket")
+		if err := os.WriteFile(path, []byte(systemd.SocketUnit(protocol.Port)), 0644); err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Println("Wrote", path)
+	}
+
+	ctl := "systemctl --user"
+	if *system {
+		ctl = "systemctl"
+	}
+	fmt.Println("Start it with:")
+	fmt.Printf("  %s daemon-reload\n", ctl)
+	if *socket {
+		fmt.Printf("  %s enable --now %s.socket\n", ctl, unit)
+	}
+	fmt.Printf("  %s enable --now %s.service\n", ctl, unit)
+	if !*system {
+		fmt.Println("and `loginctl enable-linger` to keep it running while you're logged out.")
+	}
+}
+
+// serviceAccount is the account a system unit runs the daemon as: name,
+// else whoever ran sudo, else the current user, but not root, which would
+// save what peers send and run hooks and bots with every privilege
+func serviceAccount(name string) (string, error) {
+	if name == "" {
+		name = os.Getenv("SUDO_USER")
+	}
+	if name == "" {
+		u, err := osuser.Current()
+		if err != nil {
+			return "", err
+		}
+		name = u.Username
+	}
+	u, err := osuser.Lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("--run-as: %w", err)
+	}
+	if u.Uid == "0" {
+		return "", errors.New("--system: the daemon would run as root; give --run-as=USER, a user of its own or yours")
+	}
+	return u.Username, nil
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	osuser "os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/x/term"
+
+	"lan-chat/internal/api"
+	"lan-chat/internal/crash"
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/hooks"
+	"lan-chat/internal/logging"
+	"lan-chat/internal/node"
+	"lan-chat/internal/platform"
+	"lan-chat/internal/protocol"
+	"lan-chat/internal/store"
+)
+
+// settings are the [user], [network], [downloads], [paths], [logging] and
+// [history] sections of the config file: what would otherwise go on every command
+// line, and where lan-chat keeps its files. A flag given on the command line wins over its
+// setting.
+type settings struct {
+	name            string // <yourname> when it isn't given
+	passwordFile    string // file whose first line is the --pass password
+	passwordCommand string // command whose first line of output is
+	keyring         bool   // user.keyring: as --keyring
+	tcpPort         string
+	udpPort         string
+	legacySalted    bool // network.legacy_salted: SVERIFY for peers from before PAKE
+	legacyVerify    bool // network.legacy_verify: VERIFY for peers from before SVERIFY
+	downloadDir     string
+	files           string              // downloads.files: "accept", "ask" or "refuse", "" unset
+	collision       string              // downloads.collision: "rename", "overwrite" or "ask", "" unset
+	maxFileSize     int64               // downloads.max_size_mb in bytes, 0 for any size
+	typeDirs        map[string]string   // file type → folder, from [downloads]
+	fileTypes       map[string][]string // types of the user's own, from [downloads.types]
+	dataDir         string              // platform.DataDir, StateDir and LogDir overrides
+	stateDir        string
+	logDir          string
+	logFile         string // the TUI's debug log, when --log-file isn't given
+	logLimits       logging.Limits
+	debug           bool   // logging.debug: as --debug
+	logFormat       string // logging.format and logging.level, when the flags aren't given
+	logLevel        string
+	retention       store.Retention // [history]
+}
+
+// loadSettings reads the settings from the config file at path; a missing
+// file means none
+func loadSettings(path string) (settings, error) {
+	var s settings
+	if path == "" {
+		return s, nil
+	}
+	values, err := store.ParseFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+	for k, v := range values {
+		section, _, _ := strings.Cut(k, ".")
+		switch k {
+		case "user.name":
+			if v == "" || strings.ContainsAny(v, ":\n") {
+				return s, fmt.Errorf("%s: must be non-empty without ':', got %q", k, v)
+			}
+			s.name = v
+		case "user.password_file":
+			s.passwordFile = platform.ExpandHome(v)
+		case "user.password_command":
+			s.passwordCommand = v
+		case "user.keyring":
+			if s.keyring, err = strconv.ParseBool(v); err != nil {
+				return s, fmt.Errorf("%s: must be true or false, got %q", k, v)
+			}
+		case "network.tcp_port":
+			if s.tcpPort, err = parsePort(k, v); err != nil {
+				return s, err
+			}
+		case "network.udp_port":
+			if s.udpPort, err = parsePort(k, v); err != nil {
+				return s, err
+			}
+		case "network.legacy_salted":
+			if s.legacySalted, err = strconv.ParseBool(v); err != nil {
+				return s, fmt.Errorf("%s: must be true or false, got %q", k, v)
+			}
+		case "network.legacy_verify":
+			if s.legacyVerify, err = strconv.ParseBool(v); err != nil {
+				return s, fmt.Errorf("%s: must be true or false, got %q", k, v)
+			}
+		case "downloads.dir":
+			s.downloadDir = platform.ExpandHome(v)
+		case "downloads.files":
+			if !slices.Contains([]string{"accept", "ask", "refuse"}, v) {
+				return s, fmt.Errorf("%s: must be accept, ask or refuse, got %q", k, v)
+			}
+			s.files = v
+		case "downloads.collision":
+			if !slices.Contains([]string{"rename", "overwrite", "ask"}, v) {
+				return s, fmt.Errorf("%s: must be rename, overwrite or ask, got %q", k, v)
+			}
+			s.collision = v
+		case "downloads.max_size_mb":
+			var mb int
+			if mb, err = parseCount(k, v, 0); err != nil {
+				return s, err
+			}
+			s.maxFileSize = int64(mb) << 20
+		case "paths.data_dir":
+			s.dataDir = platform.ExpandHome(v)
+		case "paths.state_dir":
+			s.stateDir = platform.ExpandHome(v)
+		case "paths.log_dir":
+			s.logDir = platform.ExpandHome(v)
+		case "logging.file":
+			s.logFile = platform.ExpandHome(v)
+		case "logging.debug":
+			if s.debug, err = strconv.ParseBool(v); err != nil {
+				return s, fmt.Errorf("%s: must be true or false, got %q", k, v)
+			}
+		case "logging.format":
+			if err := logging.CheckFormat(v); err != nil {
+				return s, fmt.Errorf("%s: %v", k, err)
+			}
+			s.logFormat = v
+		case "logging.level":
+			if _, err := logging.ParseLevel(v); err != nil {
+				return s, fmt.Errorf("%s: %v", k, err)
+			}
+			s.logLevel = v
+		case "logging.max_size_mb":
+			var mb int
+			if mb, err = parseCount(k, v, 1); err != nil {
+				return s, err
+			}
+			s.logLimits.MaxSize = int64(mb) << 20
+		case "logging.max_backups":
+			if s.logLimits.MaxBackups, err = parseCount(k, v, 1); err != nil {
+				return s, err
+			}
+		case "logging.max_age_days":
+			var days int
+			if days, err = parseCount(k, v, 0); err != nil {
+				return s, err
+			}
+			s.logLimits.MaxAge = time.Duration(days) * 24 * time.Hour
+		case "logging.max_total_mb":
+			var mb int
+			if mb, err = parseCount(k, v, 0); err != nil {
+				return s, err
+			}
+			s.logLimits.MaxTotal = int64(mb) << 20
+		case "history.max_age_days":
+			var days int
+			if days, err = parseCount(k, v, 0); err != nil {
+				return s, err
+			}
+			s.retention.MaxAge = time.Duration(days) * 24 * time.Hour
+		case "history.max_messages":
+			if s.retention.MaxPerPeer, err = parseCount(k, v, 0); err != nil {
+				return s, err
+			}
+		case "history.purge_transfers":
+			if s.retention.Transfers, err = strconv.ParseBool(v); err != nil {
+				return s, fmt.Errorf("%s: must be true or false, got %q", k, v)
+			}
+		default:
+			if t, ok := strings.CutPrefix(k, "downloads.types."); ok {
+				exts, err := parseExts(k, v)
+				if err != nil {
+					return s, err
+				}
+				if s.fileTypes == nil {
+					s.fileTypes = make(map[string][]string)
+				}
+				s.fileTypes[t] = exts
+				continue
+			}
+			if t, ok := strings.CutPrefix(k, "downloads."); ok {
+				if s.typeDirs == nil {
+					s.typeDirs = make(map[string]string)
+				}
+				s.typeDirs[t] = platform.ExpandHome(v)
+				continue
+			}
+			switch section {
+			case "user", "network", "downloads", "paths", "logging", "history":
+				return s, fmt.Errorf("%s: unknown key", k)
+			}
+		}
+	}
+	if s.passwordFile != "" && s.passwordCommand != "" {
+		return s, errors.New("user.password_file and user.password_command: set only one")
+	}
+	if s.keyring && (s.passwordFile != "" || s.passwordCommand != "") {
+		return s, errors.New("user.keyring: the password comes from user.password_file or user.password_command already")
+	}
+	for t := range s.typeDirs {
+		if _, ok := s.fileTypes[t]; !ok && fileTypes[t] == nil {
+			return s, fmt.Errorf("downloads.%s: unknown key or file type (define it under [downloads.types])", t)
+		}
+	}
+	if s.retention.Transfers && s.retention.MaxAge == 0 {
+		return s, errors.New("history.purge_transfers: needs history.max_age_days")
+	}
+	return s, nil
+}
+
+// fileTypes are the file types [downloads] can route without defining them
+var fileTypes = map[string][]string{
+	"images":   {".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".svg", ".heic", ".tif", ".tiff"},
+	"video":    {".mp4", ".mkv", ".mov", ".avi", ".webm", ".m4v"},
+	"audio":    {".mp3", ".flac", ".wav", ".ogg", ".opus", ".m4a", ".aac"},
+	"docs":     {".pdf", ".txt", ".md", ".rtf", ".doc", ".docx", ".odt", ".xls", ".xlsx", ".ods", ".csv", ".ppt", ".pptx", ".odp"},
+	"archives": {".zip", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar"},
+}
+
+// parseExts reads a comma-separated list of extensions, with or without
+// the dot
+func parseExts(k, v string) ([]string, error) {
+	var exts []string
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			exts = append(exts, "."+strings.TrimPrefix(e, "."))
+		}
+	}
+	if len(exts) == 0 {
+		return nil, fmt.Errorf("%s: must list extensions, e.g. \".psd, .fig\", got %q", k, v)
+	}
+	return exts, nil
+}
+
+// parseCount reads a whole number of at least min; 0 means no limit where
+// min allows it
+func parseCount(k, v string, min int) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min {
+		return 0, fmt.Errorf("%s: must be a whole number of at least %d, got %q", k, min, v)
+	}
+	return n, nil
+}
+
+func parsePort(k, v string) (string, error) {
+	if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("%s: must be a port number, got %q", k, v)
+	}
+	return v, nil
+}
+
+// profileEnv names the profile when --profile isn't given. useProfile sets
+// it, so the --detach session server and anything else lan-chat starts stay
+// in the same profile.
+const profileEnv = "LANCHAT_PROFILE"
+
+// useProfile takes --profile=NAME (or --profile NAME) off the front of the
+// command line, before the subcommand, else $LANCHAT_PROFILE, and switches
+// every directory and socket to it
+func useProfile() error {
+	name, given := os.Getenv(profileEnv), false
+	if len(os.Args) > 1 {
+		arg := strings.TrimPrefix(os.Args[1], "-")
+		arg = strings.TrimPrefix(arg, "-")
+		if v, ok := strings.CutPrefix(arg, "profile="); ok {
+			name, given = v, true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		} else if arg == "profile" && len(os.Args) > 2 {
+			name, given = os.Args[2], true
+			os.Args = append(os.Args[:1], os.Args[3:]...)
+		}
+	}
+	if given && name == "" {
+		return errors.New("--profile needs a name")
+	}
+	if err := platform.SetProfile(name); err != nil {
+		return err
+	}
+	if name == "" {
+		return nil
+	}
+	return os.Setenv(profileEnv, name)
+}
+
+// defaultName is the name used when none is given or configured:
+// $USER@hostname, with the hostname cut at its first dot and anything a name
+// can't hold dropped, or whichever half is known
+func defaultName() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = os.Getenv("USERNAME") // Windows
+	}
+	if user == "" {
+		if u, err := osuser.Current(); err == nil {
+			user = u.Username
+		}
+	}
+	if i := strings.LastIndex(user, `\`); i >= 0 {
+		user = user[i+1:] // DOMAIN\user
+	}
+	host, _ := os.Hostname()
+	host, _, _ = strings.Cut(host, ".")
+	clean := func(s string) string {
+		return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+			return r == ':' || unicode.IsSpace(r) || unicode.IsControl(r)
+		}), "")
+	}
+	user, host = clean(user), clean(host)
+	switch {
+	case user != "" && host != "":
+		return user + "@" + host
+	case user != "":
+		return user
+	case host != "":
+		return host
+	}
+	return "lan-chat"
+}
+
+// confirmName asks on the terminal which name to use, suggesting def,
+// which an empty answer keeps
+func confirmName(def string) (string, error) {
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Name to show to peers [%s]: ", def)
+		line, err := in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading the name: %w", err)
+		}
+		switch {
+		case line == "":
+			return def, nil
+		case strings.Contains(line, ":"):
+			fmt.Println("A name can't contain ':'.")
+		default:
+			return line, nil
+		}
+	}
+}
+
+// password is the password from password_file, opened if lock-secrets
+// sealed it, or password_command, empty when neither is set. The command's stderr and stdin stay on the terminal,
+// so tools like pass or gpg can prompt.
+func (s settings) password() (string, error) {
+	var (
+		key string
+		out []byte
+		err error
+	)
+	switch {
+	case s.passwordFile != "":
+		key = "user.password_file"
+		if out, err = os.ReadFile(s.passwordFile); err == nil {
+			out, err = unsealSecret(out)
+		}
+	case s.passwordCommand != "":
+		key = "user.password_command"
+		var argv []string
+		if argv, err = hooks.Expand(s.passwordCommand, func(string) (string, bool) { return "", false }); err == nil {
+			cmd := exec.Command(argv[0], argv[1:]...)
+			cmd.Stdin, cmd.Stderr = os.Stdin, os.Stderr
+			out, err = cmd.Output()
+		}
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	if line = strings.TrimSpace(line); line == "" {
+		return "", fmt.Errorf("%s: empty password", key)
+	}
+	return line, nil
+}
+
+// addPortFlags adds --tcp-port and --udp-port, which usePortFlags reads, to
+// fs
+func addPortFlags(fs *flag.FlagSet) {
+	fs.String("tcp-port", "", "TCP port to take chats and files on, announced to peers (default: tcp_port under [network], else "+protocol.DefaultPort+")")
+	fs.String("udp-port", "", "UDP port to announce on and discover peers on, the same for everyone on the LAN (default: udp_port under [network], else "+discovery.DefaultPort+")")
+}
+
+// usePortFlags puts --tcp-port and --udp-port, where fs has them and they
+// were given, over the configured ports; call it before apply
+func (s *settings) usePortFlags(fs *flag.FlagSet) error {
+	for name, port := range map[string]*string{"tcp-port": &s.tcpPort, "udp-port": &s.udpPort} {
+		f := fs.Lookup(name)
+		if f == nil || f.Value.String() == "" {
+			continue
+		}
+		p, err := parsePort("--"+name, f.Value.String())
+		if err != nil {
+			return err
+		}
+		*port = p
+	}
+	return nil
+}
+
+// apply switches this process to the configured ports, fallbacks from
+// PAKE, file size limit and directories. It has to run before anything
+// listens, dials or opens a file.
+func (s settings) apply() {
+	if s.tcpPort != "" {
+		protocol.Port = s.tcpPort
+	}
+	if s.udpPort != "" {
+		discovery.Port = s.udpPort
+	}
+	protocol.LegacySalted = s.legacySalted
+	protocol.LegacyVerify = s.legacyVerify
+	protocol.MaxFileSize = s.maxFileSize
+	platform.DataDirOverride = s.dataDir
+	platform.StateDirOverride = s.stateDir
+	platform.LogDirOverride = s.logDir
+}
+
+// logOptions is the --log-file flag, else logging.file, with the
+// configured rotation limits
+func (s settings) logOptions(flagValue string) logging.Options {
+	opts := logging.Options{Path: flagValue, Limits: s.logLimits}
+	if opts.Path == "" {
+		opts.Path = s.logFile
+	}
+	return opts
+}
+
+// downloads is where received files are saved: the --dir flag, else
+// downloads.dir, else the OS downloads folder, and the working directory
+// only when there is no home directory
+func (s settings) downloads(flagValue string) string {
+	for _, dir := range []string{flagValue, s.downloadDir, platform.DownloadDir()} {
+		if dir != "" {
+			return dir
+		}
+	}
+	return "."
+}
+
+// dirFor picks the folder a received file goes to by its extension, from
+// the file types routed under [downloads]; nil when none are. A type of the
+// user's own replaces a built-in one of the same name, and wins over a
+// built-in one with the same extension.
+func (s settings) dirFor() func(name string) string {
+	if len(s.typeDirs) == 0 {
+		return nil
+	}
+	byExt := make(map[string]string)
+	for i, types := range []map[string][]string{fileTypes, s.fileTypes} {
+		for _, t := range slices.Sorted(maps.Keys(types)) {
+			if _, redefined := s.fileTypes[t]; i == 0 && redefined {
+				continue
+			}
+			if dir, ok := s.typeDirs[t]; ok {
+				for _, ext := range types[t] {
+					byExt[ext] = dir
+				}
+			}
+		}
+	}
+	return func(name string) string { return byExt[strings.ToLower(filepath.Ext(name))] }
+}
+
+// moveOldFiles moves what earlier versions kept next to config.toml to the
+// data, state and log directories, once
+func moveOldFiles() error {
+	config := platform.ConfigDir()
+	if config == "" {
+		return nil
+	}
+	for old, dest := range map[string]string{
+		"api-token":     api.TokenPath(),
+		"state.toml":    store.StatePath(),
+		"snapshot.json": store.SnapshotPath(),
+		"crash":         crash.Dir(),
+	} {
+		if err := platform.MoveOld(filepath.Join(config, old), dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// persist gives n this install's identity key and the database of history,
+// transfers and known peers from the data directory, pruned by [history]
+func (s settings) persist(n *node.Node) error {
+	id, err := crypto.LoadIdentity(store.IdentityPath(), unsealSecret)
+	if err != nil {
+		return fmt.Errorf("identity key: %w", err)
+	}
+	db, err := store.OpenDB(store.DBPath())
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	if err := db.SetRetention(s.retention); err != nil {
+		db.Close()
+		return fmt.Errorf("history retention: %w", err)
+	}
+	n.Identity, n.DB = id, db
+	return nil
+}
+
+// resolvePassword is the --pass flag when it was given, even empty, and the
+// configured password otherwise. With neither it is $LANCHAT_PASSWORD, then
+// with --keyring what the OS keyring holds, and with --encrypt or --keyring
+// it is asked for on the terminal; --keyring stores the answer.
+func (s settings) resolvePassword(fs *flag.FlagSet, flagValue string) (string, error) {
+	if flagGiven(fs, "pass") {
+		return flagValue, nil
+	}
+	if p, err := s.password(); err != nil || p != "" {
+		return p, err
+	}
+	if p := os.Getenv(passwordEnv); p != "" {
+		return p, nil
+	}
+	keyring := s.useKeyring(fs)
+	if keyring {
+		p, err := platform.KeyringGet(keyringName)
+		if !errors.Is(err, platform.ErrNotInKeyring) {
+			return p, err
+		}
+	}
+	if !keyring && !flagOn(fs, "encrypt") {
+		return "", nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		if keyring {
+			return "", errors.New("no password in the keyring and no terminal to ask for it on: store it with `lan-chat keyring`")
+		}
+		return "", errors.New("no terminal to ask for the password on: use user.password_file or $" + passwordEnv)
+	}
+	p, err := readPassphrase("Shared password: ", keyring)
+	if err != nil {
+		return "", err
+	}
+	if keyring {
+		if err := platform.KeyringSet(keyringName, p); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	return p, nil
+}
+
+// addPasswordFlags adds --encrypt and --keyring, which resolvePassword reads,
+// to fs
+func addPasswordFlags(fs *flag.FlagSet) {
+	fs.Bool("encrypt", false, "Ask for the shared password on the terminal, without echo, when --pass isn't given and none is configured")
+	fs.Bool("keyring", false, "Take the shared password from the OS keyring, asking for it and storing it there the first time")
+}
+
+// useKeyring reports whether the password is kept in the keyring: --keyring
+// where given, else user.keyring
+func (s settings) useKeyring(fs *flag.FlagSet) bool {
+	if flagGiven(fs, "keyring") {
+		return flagOn(fs, "keyring")
+	}
+	return s.keyring
+}
+
+// debugOn is --debug where given, else logging.debug
+func (s settings) debugOn(fs *flag.FlagSet) bool {
+	if flagGiven(fs, "debug") {
+		return flagOn(fs, "debug")
+	}
+	return s.debug
+}
+
+// flagOr is the value of fs's flag name when it was given or configured is
+// empty, else configured
+func flagOr(fs *flag.FlagSet, name, configured string) string {
+	if f := fs.Lookup(name); f != nil && (flagGiven(fs, name) || configured == "") {
+		return f.Value.String()
+	}
+	return configured
+}
+
+// flagOn reports whether a boolean flag of fs is set
+func flagOn(fs *flag.FlagSet, name string) bool {
+	f := fs.Lookup(name)
+	return f != nil && f.Value.String() == "true"
+}
+
+// flagGiven reports whether the flag was set on the command line
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
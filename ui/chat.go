@@ -0,0 +1,285 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"lan-chat/internal/platform"
+	"lan-chat/internal/store"
+)
+
+func (m Model) exportHistoryCmd() tea.Cmd {
+	lines := make([]string, len(m.chatHistory))
+	for i, l := range m.chatHistory {
+		lines[i] = ansi.Strip(l)
+	}
+	return func() tea.Msg {
+		name, err := store.ExportHistory(lines)
+		if err != nil {
+			return errorMsg{
+				title:  tr("err.export.title"),
+				detail: err.Error(),
+				action: tr("err.export.action"),
+			}
+		}
+		return transferStatusMsg(tr("status.exported", name))
+	}
+}
+
+// openFile opens a received file in the desktop's default application
+func (m *Model) openFile(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if err := platform.Open(path); err != nil {
+		errorLog("Opening %s: %v", path, err)
+		m.banner = &errorMsg{title: tr("err.open.title", filepath.Base(path)), detail: err.Error(), action: tr("err.open.action")}
+		m.resizeComponents(m.width, m.height)
+	}
+}
+
+// handleVimKey implements the optional vi keymap. It reports whether the key
+// was consumed; unhandled keys fall through to the default bindings.
+func (m *Model) handleVimKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	key := msg.String()
+	wasPendingG := m.pendingG
+	m.pendingG = false
+
+	switch m.state {
+	case 0:
+		if m.list.FilterState() == list.Filtering {
+			return nil, false
+		}
+		// j/k and / are already list bindings
+		switch key {
+		case "g":
+			if wasPendingG {
+				m.list.Select(0)
+				m.skipSectionHeader(nil)
+			} else {
+				m.pendingG = true
+			}
+			return nil, true
+		case "G":
+			if n := len(m.list.VisibleItems()); n > 0 {
+				m.list.Select(n - 1)
+			}
+			return nil, true
+		}
+	case 3:
+		switch m.vimMode {
+		case "insert":
+			if key == "esc" {
+				m.vimMode = "normal"
+				m.textInput.Blur()
+				return nil, true
+			}
+		case "search":
+			switch key {
+			case "esc":
+				m.vimMode = "normal"
+				m.textInput.Blur()
+				m.textInput.Reset()
+				m.textInput.Placeholder = tr("chat.placeholder")
+				return nil, true
+			case "enter":
+				m.searchChat(m.textInput.Value())
+				m.vimMode = "normal"
+				m.textInput.Blur()
+				m.textInput.Reset()
+				m.textInput.Placeholder = tr("chat.placeholder")
+				return nil, true
+			}
+		default:
+			switch key {
+			case "esc", "ctrl+c":
+				return nil, false
+			case "i":
+				m.vimMode = "insert"
+				return m.textInput.Focus(), true
+			case "/":
+				m.vimMode = "search"
+				m.textInput.Reset()
+				m.textInput.Placeholder = tr("chat.search_placeholder")
+				return m.textInput.Focus(), true
+			case "j", "down":
+				m.chatView.scroll(m.chatHistory, 1)
+			case "k", "up":
+				m.chatView.scroll(m.chatHistory, -1)
+			case "g":
+				if wasPendingG {
+					m.chatView.gotoTop(m.chatHistory)
+				} else {
+					m.pendingG = true
+				}
+			case "G":
+				m.chatView.gotoBottom()
+			}
+			m.markSeen()
+			// Normal mode never types into the input
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// markSeen clears the new-message pill once the user is back at the bottom
+func (m *Model) markSeen() {
+	if m.chatView.atBottom(m.chatHistory) {
+		m.unseen = 0
+	}
+}
+
+// scrollIndicator shows the new-message pill and scroll position while the
+// user is scrolled up in the chat
+func (m Model) scrollIndicator() string {
+	if m.chatView.atBottom(m.chatHistory) {
+		return ""
+	}
+	label := fmt.Sprintf("%3.0f%%", m.chatView.percent(m.chatHistory)*100)
+	if m.unseen > 0 {
+		key := "chat.new_messages"
+		if m.unseen == 1 {
+			key = "chat.new_message"
+		}
+		label = "\u2193 " + tr(key, m.unseen) + " (ctrl+e) | " + label
+	}
+	return label + " | "
+}
+
+// searchChat scrolls the chat viewport to the most recent line containing query
+func (m *Model) searchChat(query string) {
+	if query == "" {
+		return
+	}
+	query = strings.ToLower(query)
+	for i := len(m.chatHistory) - 1; i >= 0; i-- {
+		if strings.Contains(strings.ToLower(m.chatHistory[i]), query) {
+			m.chatView.setTop(m.chatHistory, i)
+			return
+		}
+	}
+}
+
+// vimModeLabel is the mode indicator shown in footers when vim keys are on
+func (m Model) vimModeLabel() string {
+	if !m.vimKeys {
+		return ""
+	}
+	mode := "NORMAL"
+	if m.state == 3 {
+		mode = strings.ToUpper(m.vimMode)
+	}
+	return "-- " + mode + " -- "
+}
+
+// chatLimit bounds the lines kept per conversation; older ones are dropped
+// from memory but stay in the history (`lan-chat history`)
+const chatLimit = 5000
+
+// stamp is the time a message was sent, dim, to go ahead of its line: the
+// hour and minute, after the date when it wasn't today
+func stamp(at time.Time) string {
+	at, now := at.Local(), time.Now()
+	layout := "15:04"
+	switch {
+	case at.Year() != now.Year():
+		layout = "2006-01-02 15:04"
+	case at.YearDay() != now.YearDay():
+		layout = "Jan 2 15:04"
+	}
+	return lipgloss.NewStyle().Foreground(colors.muted).Render(at.Format(layout))
+}
+
+// adoptChat moves what arrived from ip before it announced itself into the
+// conversation with name, the peer it turned out to be
+func (m *Model) adoptChat(ip, name string) {
+	lines, ok := m.chats[ip]
+	if !ok || ip == name {
+		return
+	}
+	delete(m.chats, ip)
+	m.addChat(name, lines...)
+	if n := m.unread[ip]; n > 0 {
+		delete(m.unread, ip)
+		m.unread[name] += n
+	}
+}
+
+// addChat appends lines to the conversation with peer, dropping the oldest
+// past chatLimit. If it is the one in the pane, the pane keeps following
+// when it showed the newest line and counts them as unseen when it didn't.
+func (m *Model) addChat(peer string, lines ...string) {
+	if peer != m.chatPeer {
+		conv := append(m.chats[peer], lines...)
+		if over := len(conv) - chatLimit; over > 0 {
+			conv = slices.Delete(conv, 0, over)
+		}
+		m.chats[peer] = conv
+		return
+	}
+	atBottom := m.chatView.atBottom(m.chatHistory)
+	m.chatHistory = append(m.chatHistory, lines...)
+	if over := len(m.chatHistory) - chatLimit; over > 0 {
+		m.chatHistory = slices.Delete(m.chatHistory, 0, over)
+		m.chatView.top = max(m.chatView.top-over, 0)
+	}
+	if atBottom {
+		m.chatView.gotoBottom()
+	} else {
+		m.unseen += len(lines)
+	}
+}
+
+// backlogLines is how much of a conversation from earlier runs opening it
+// shows
+const backlogLines = 100
+
+// backlog is the end of the conversation with peer before this run, from
+// the node's history, drawn like the lines of this one. Later messages are
+// already in the pane.
+func (m Model) backlog(peer string) []string {
+	if m.node == nil {
+		return nil
+	}
+	var lines []string
+	for _, msg := range m.node.History(peer) {
+		if !msg.Time.Before(m.startTime) {
+			break
+		}
+		if msg.Sent {
+			lines = append(lines, stamp(msg.Time)+" "+avatar(m.userName)+" "+tr("chat.me")+": "+msg.Text)
+		} else {
+			lines = append(lines, stamp(msg.Time)+" "+avatar(msg.Peer)+" "+msg.Peer+": "+msg.Text)
+		}
+	}
+	return lines[max(0, len(lines)-backlogLines):]
+}
+
+// showChat puts the conversation with peer in the chat pane, following its
+// newest line, and keeps the one there until now for when it is opened
+// again
+func (m *Model) showChat(peer string) {
+	if peer == m.chatPeer {
+		return
+	}
+	if len(m.chatHistory) > 0 {
+		m.chats[m.chatPeer] = m.chatHistory
+	}
+	m.chatHistory, m.chatPeer = m.chats[peer], peer
+	delete(m.chats, peer)
+	if !m.backlogged[peer] {
+		m.backlogged[peer] = true
+		m.chatHistory = append(m.backlog(peer), m.chatHistory...)
+	}
+	m.unseen = 0
+	m.chatView.gotoBottom()
+}
@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// chatView draws the part of the chat history that is on screen. The
+// bubbles viewport before it was handed the whole history as one string on
+// every message and resize, and split and measured all of it; this keeps
+// only a position and wraps the messages it shows, so a history of tens of
+// thousands of lines costs no more to draw than a short one.
+//
+// Positions count messages (entries of chatHistory), not wrapped rows, as
+// the viewport's did. Its methods take the history they draw.
+type chatView struct {
+	width, height int
+	top           int  // first message shown, unless following
+	follow        bool // pinned to the newest message
+}
+
+func newChatView(width, height int) chatView {
+	return chatView{width: width, height: height, follow: true}
+}
+
+// rows is one message wrapped to the width
+func (v chatView) rows(msg string) []string {
+	if v.width > 0 {
+		msg = ansi.Wrap(msg, v.width, "")
+	}
+	return strings.Split(msg, "\n")
+}
+
+// bottom is the first message shown when the newest is on the last row
+func (v chatView) bottom(lines []string) int {
+	rows := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		if rows += len(v.rows(lines[i])); rows >= v.height {
+			return i
+		}
+	}
+	return 0
+}
+
+// atBottom reports whether the newest message is on screen
+func (v chatView) atBottom(lines []string) bool {
+	return v.follow || v.top >= v.bottom(lines)
+}
+
+// scroll moves n messages down, or up for a negative n
+func (v *chatView) scroll(lines []string, n int) {
+	bottom := v.bottom(lines)
+	if v.follow {
+		v.top = bottom
+	}
+	v.top = min(max(v.top+n, 0), bottom)
+	v.follow = v.top == bottom
+}
+
+func (v *chatView) gotoTop(lines []string) { v.scroll(lines, -len(lines)) }
+func (v *chatView) gotoBottom()            { v.follow = true }
+
+// setTop scrolls so message i is at the top, or as near as the end allows
+func (v *chatView) setTop(lines []string, i int) {
+	v.follow = false
+	v.top = 0
+	v.scroll(lines, i)
+}
+
+// percent is how far down the history the view is, 0 to 1
+func (v chatView) percent(lines []string) float64 {
+	bottom := v.bottom(lines)
+	if v.follow || bottom == 0 {
+		return 1
+	}
+	return float64(min(v.top, bottom)) / float64(bottom)
+}
+
+// update scrolls on the paging keys. Letters are left alone, since the
+// text input has the keyboard; vim keys scroll in normal mode.
+func (v *chatView) update(lines []string, msg tea.Msg) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return
+	}
+	switch key.String() {
+	case "up":
+		v.scroll(lines, -1)
+	case "down":
+		v.scroll(lines, 1)
+	case "pgup":
+		v.scroll(lines, -v.height)
+	case "pgdown":
+		v.scroll(lines, v.height)
+	case "ctrl+u":
+		v.scroll(lines, -v.height/2)
+	case "ctrl+d":
+		v.scroll(lines, v.height/2)
+	}
+}
+
+// view renders the messages on screen, padded to the view's size
+func (v chatView) view(lines []string) string {
+	var rows []string
+	if v.atBottom(lines) {
+		// From the newest back; the oldest one shown may be cut at the top
+		for i := len(lines) - 1; i >= 0 && len(rows) < v.height; i-- {
+			rows = append(v.rows(lines[i]), rows...)
+		}
+		rows = rows[max(len(rows)-v.height, 0):]
+	} else {
+		for i := v.top; i < len(lines) && len(rows) < v.height; i++ {
+			rows = append(rows, v.rows(lines[i])...)
+		}
+		rows = rows[:min(len(rows), v.height)]
+	}
+	return lipgloss.NewStyle().Width(v.width).Height(v.height).MaxHeight(v.height).Render(strings.Join(rows, "\n"))
+}
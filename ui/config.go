@@ -0,0 +1,221 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/progress"
+
+	"lan-chat/internal/platform"
+	"lan-chat/internal/store"
+)
+
+// Config holds settings loaded from the config file
+type Config struct {
+	templates map[string]string
+	Keymap    string // "default" or "vim"
+	theme     themeConfig
+	// Session info shown on the right of the title bar
+	showClock        bool
+	showUptime       bool
+	showConversation bool
+	showAddress      bool // own LAN address and discovery status, on by default
+	showLatency      bool // each reachable peer's round trip in the list
+	showHints        bool // rotating tips for the first few sessions
+	// Last-message preview in the peer list
+	previewLength int    // characters; 0 shows the whole message
+	previewMode   string // "full", "placeholder" or "hidden"
+	// The conversation open at the last exit, once its peer is back:
+	// "auto" opens it, "ask" selects the peer and offers it, "off" neither
+	reopenChat   string
+	layout       string          // ui.layout: "auto" or "single"
+	hidePreviews map[string]bool // peer names whose previews are never shown
+	// theme.mode and ui.preview_mode as the file has them, before Restore
+	fileTheme, filePreviews string
+	// Received images get an inline thumbnail in the chat; off shows just
+	// the dimensions and size
+	imageThumbnails bool
+	// Idle lock: 0 disables. Unlocks with lockPIN, or the shared password if no PIN
+	idleLockMinutes int
+	lockPIN         string
+	alert           string // "bell", "flash", "both" or "none"
+	desktopNotify   bool   // also a desktop notification, through platform.Notify
+	path            string // where it was read from, for reloading
+	// OnReload, if set, is called when the config is reloaded so the parts
+	// main owns (hooks) can reread the file too
+	OnReload func() error
+}
+
+// themeConfig holds the [theme] section
+type themeConfig struct {
+	mode                  string // "auto" detects the terminal background, or "dark" / "light"
+	progressGradientStart string // gradient fill colors; ignored if progressSolid is set
+	progressGradientEnd   string
+	progressSolid         string // solid fill color
+	progressWidth         int    // 0 stretches the bar to the window width
+}
+
+// newProgress builds the progress bubble from the theme
+func (t themeConfig) newProgress() progress.Model {
+	opts := []progress.Option{progress.WithoutPercentage()}
+	switch {
+	case t.progressSolid != "":
+		opts = append(opts, progress.WithSolidFill(t.progressSolid))
+	case t.progressGradientStart != "" && t.progressGradientEnd != "":
+		opts = append(opts, progress.WithGradient(t.progressGradientStart, t.progressGradientEnd))
+	default:
+		opts = append(opts, progress.WithDefaultGradient())
+	}
+	if t.progressWidth > 0 {
+		opts = append(opts, progress.WithWidth(t.progressWidth))
+	}
+	return progress.New(opts...)
+}
+
+// templateKeys are the configurable title and footer templates. Defaults come
+// from the "tmpl.<key>" catalog entries. Placeholders:
+// {name} {peers} {encryption} {time} {peer} {ip} {addr}
+var templateKeys = []string{"title", "chat_title", "list_footer", "filter_footer", "chat_footer", "picker_footer", "config_footer"}
+
+// DefaultConfigPath is config.toml in the user config directory
+func DefaultConfigPath() string {
+	if dir := platform.ConfigDir(); dir != "" {
+		return filepath.Join(dir, "config.toml")
+	}
+	return ""
+}
+
+// themeModes are the values of theme.mode, in the order t cycles them
+var themeModes = []string{"auto", "dark", "light"}
+
+// Restore puts the choices made in the UI on an earlier run, remembered in
+// st, over the config file's theme and preview mode. A change to the file
+// itself still wins on reload.
+func (c *Config) Restore(st store.UIState) {
+	if slices.Contains(themeModes, st.Theme) {
+		c.theme.mode = st.Theme
+	}
+	if slices.Contains(previewModes, st.Previews) {
+		c.previewMode = st.Previews
+	}
+}
+
+// LoadConfig reads the config file at path. A missing file is not an error.
+func LoadConfig(path string) (Config, error) {
+	cfg := Config{templates: make(map[string]string), Keymap: "default", alert: "bell", showAddress: true, showHints: true,
+		previewLength: 40, previewMode: "full", reopenChat: "auto", layout: "auto", hidePreviews: make(map[string]bool), imageThumbnails: true}
+	cfg.theme.mode = "auto"
+	cfg.path = path
+	values := make(map[string]string)
+	if path != "" {
+		var err error
+		values, err = store.ParseFile(path)
+		if os.IsNotExist(err) {
+			values = make(map[string]string)
+		} else if err != nil {
+			return cfg, err
+		}
+	}
+	// The locale picks the catalog the template defaults below come from
+	setLocale(detectLocale(values["ui.locale"]))
+	for _, k := range templateKeys {
+		cfg.templates[k] = tr("tmpl." + k)
+	}
+	for k, v := range values {
+		if key, ok := strings.CutPrefix(k, "templates."); ok {
+			cfg.templates[key] = v
+		}
+	}
+	if v, ok := values["ui.keymap"]; ok {
+		cfg.Keymap = v
+	}
+	for key, dst := range map[string]*bool{
+		"ui.show_clock":         &cfg.showClock,
+		"ui.show_uptime":        &cfg.showUptime,
+		"ui.show_conversation":  &cfg.showConversation,
+		"ui.show_address":       &cfg.showAddress,
+		"ui.show_latency":       &cfg.showLatency,
+		"ui.image_thumbnails":   &cfg.imageThumbnails,
+		"ui.show_hints":         &cfg.showHints,
+		"notifications.desktop": &cfg.desktopNotify,
+	} {
+		if v, ok := values[key]; ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %v", key, err)
+			}
+			*dst = b
+		}
+	}
+	if v, ok := values["security.idle_lock_minutes"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("security.idle_lock_minutes: %v", err)
+		}
+		cfg.idleLockMinutes = n
+	}
+	if v, ok := values["ui.preview_length"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("ui.preview_length: must be a number of characters, got %q", v)
+		}
+		cfg.previewLength = n
+	}
+	if v, ok := values["ui.preview_mode"]; ok {
+		if v != "full" && v != "placeholder" && v != "hidden" {
+			return cfg, fmt.Errorf("ui.preview_mode: must be full, placeholder or hidden, got %q", v)
+		}
+		cfg.previewMode = v
+	}
+	if v, ok := values["ui.layout"]; ok {
+		if v != "auto" && v != "single" {
+			return cfg, fmt.Errorf("ui.layout: must be auto or single, got %q", v)
+		}
+		cfg.layout = v
+	}
+	if v, ok := values["ui.reopen_chat"]; ok {
+		if v != "auto" && v != "ask" && v != "off" {
+			return cfg, fmt.Errorf("ui.reopen_chat: must be auto, ask or off, got %q", v)
+		}
+		cfg.reopenChat = v
+	}
+	for _, name := range strings.Split(values["ui.hide_previews"], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.hidePreviews[name] = true
+		}
+	}
+	cfg.lockPIN = values["security.lock_pin"]
+	if v, ok := values["notifications.alert"]; ok {
+		switch v {
+		case "bell", "flash", "both", "none":
+			cfg.alert = v
+		default:
+			return cfg, fmt.Errorf("notifications.alert: must be bell, flash, both or none, got %q", v)
+		}
+	}
+	if v, ok := values["theme.mode"]; ok {
+		if !slices.Contains(themeModes, v) {
+			return cfg, fmt.Errorf("theme.mode: must be auto, dark or light, got %q", v)
+		}
+		cfg.theme.mode = v
+	}
+	cfg.theme.progressGradientStart = values["theme.progress_gradient_start"]
+	cfg.theme.progressGradientEnd = values["theme.progress_gradient_end"]
+	cfg.theme.progressSolid = values["theme.progress_solid"]
+	if v, ok := values["theme.progress_width"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("theme.progress_width: %v", err)
+		}
+		cfg.theme.progressWidth = n
+	}
+	cfg.fileTheme, cfg.filePreviews = cfg.theme.mode, cfg.previewMode
+	return cfg, nil
+}
+
+// hintSessions is how many sessions show the tips line under the peer list
+const hintSessions = 5
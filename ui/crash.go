@@ -0,0 +1,99 @@
+package ui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+
+	"lan-chat/internal/crash"
+)
+
+// CrashMsg tells the UI a background goroutine panicked and was stopped;
+// the UI keeps running and offers a restart
+type CrashMsg struct{ Report crash.Report }
+
+// commandPanicMsg is what a guarded command returns instead of panicking
+type commandPanicMsg struct{ report crash.Report }
+
+// Guard runs a Model and catches its panics: in Update the model stays as
+// it was before the bad message and the program quits, so its state can
+// still be saved; in View the report is kept and the panic goes on to
+// Bubble Tea, which restores the terminal.
+type Guard struct {
+	model  Model
+	report *crash.Report
+}
+
+// NewGuard wraps m
+func NewGuard(m Model) *Guard { return &Guard{model: m} }
+
+// Model is the last state Update finished with
+func (g *Guard) Model() Model { return g.model }
+
+// Report is the panic that stopped the program, or nil
+func (g *Guard) Report() *crash.Report { return g.report }
+
+func (g *Guard) Init() tea.Cmd { return g.guard(g.model.Init()) }
+
+func (g *Guard) Update(msg tea.Msg) (model tea.Model, cmd tea.Cmd) {
+	if msg, ok := msg.(commandPanicMsg); ok {
+		g.report = &msg.report
+		return g, tea.Quit
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			r := crash.New("update", v)
+			g.report = &r
+			model, cmd = g, tea.Quit
+		}
+	}()
+	next, cmd := g.model.Update(msg)
+	g.model = next.(Model)
+	return g, g.guard(cmd)
+}
+
+func (g *Guard) View() string {
+	defer func() {
+		if v := recover(); v != nil {
+			r := crash.New("view", v)
+			g.report = &r
+			panic(v)
+		}
+	}()
+	return g.model.View()
+}
+
+// guard makes a panic in cmd, or in the commands of a batch it returns, a
+// commandPanicMsg
+func (g *Guard) guard(cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() (msg tea.Msg) {
+		defer func() {
+			if v := recover(); v != nil {
+				msg = commandPanicMsg{crash.New("command", v)}
+			}
+		}()
+		msg = cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i, c := range batch {
+				batch[i] = g.guard(c)
+			}
+		}
+		return msg
+	}
+}
+
+// Restart reports whether the user asked to restart after a CrashMsg
+func (m Model) Restart() bool { return m.restart }
+
+// crashed shows a goroutine's panic as a banner; ctrl+r then restarts
+func (m *Model) crashed(r crash.Report) {
+	errorLog("%s", r)
+	m.crash = &r
+	detail := tr("err.crash.detail", r.Value)
+	if r.Path != "" {
+		detail = tr("err.crash.detail_saved", r.Value, r.Path)
+	}
+	m.banner = &errorMsg{title: tr("err.crash.title", r.Where), detail: detail, action: tr("err.crash.action")}
+	m.resizeComponents(m.width, m.height)
+}
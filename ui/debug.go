@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"lan-chat/internal/logging"
+	"lan-chat/internal/platform"
+)
+
+var enableDebug bool
+
+// logOpts is how logging was set up by EnableDebug; the runtime toggle on
+// the config screen reuses it. An empty Path is DefaultLogPath.
+var logOpts = logging.Options{Level: slog.LevelDebug}
+
+var (
+	logger  = slog.New(slog.DiscardHandler)
+	logFile *logging.File
+)
+
+func debugLog(format string, v ...interface{}) {
+	if enableDebug {
+		logger.Debug(fmt.Sprintf(format, v...))
+	}
+}
+
+// errorLog records failures the user also sees as a banner, so the log
+// viewer can filter for them
+func errorLog(format string, v ...interface{}) {
+	if enableDebug {
+		logger.Error(fmt.Sprintf(format, v...))
+	}
+}
+
+// DefaultLogPath is debug.log in the log directory, or in the working
+// directory if there is none
+func DefaultLogPath() string {
+	return filepath.Join(platform.LogDir(), "debug.log")
+}
+
+// logPath is the file logged to, or that will be once logging is on
+func logPath() string {
+	if logOpts.Path != "" {
+		return logOpts.Path
+	}
+	return DefaultLogPath()
+}
+
+// SetLogOptions is where and how the config screen's toggle logs, when
+// debug logging isn't on from the start
+func SetLogOptions(opts logging.Options) error {
+	if err := logging.CheckFormat(opts.Format); err != nil {
+		return err
+	}
+	logOpts = opts
+	return nil
+}
+
+// EnableDebug turns on logging to opts.Path (DefaultLogPath if empty),
+// appending to the log of earlier runs like the toggle does
+func EnableDebug(opts logging.Options) error {
+	if err := SetLogOptions(opts); err != nil {
+		return err
+	}
+	if err := openLog(); err != nil {
+		return err
+	}
+	enableDebug = true
+	return nil
+}
+
+// setDebug is the toggle on the config screen; the log file is opened the
+// first time
+func setDebug(on bool) {
+	if on && openLog() != nil {
+		return
+	}
+	enableDebug = on
+}
+
+func openLog() error {
+	if logFile != nil {
+		return nil
+	}
+	logOpts.Path = logPath()
+	f, err := logging.OpenFile(logOpts.Path, logOpts.Limits)
+	if err != nil {
+		return err
+	}
+	logFile = f
+	logger = slog.New(logging.Handler(f, logOpts.Format, logOpts.Level))
+	slog.SetDefault(logger) // stray log.Printf calls land in the file too
+	return nil
+}
+
+// Debugf writes to the log file when debug logging is on
+func Debugf(format string, v ...interface{}) {
+	debugLog(format, v...)
+}
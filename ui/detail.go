@@ -0,0 +1,190 @@
+package ui
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"lan-chat/internal/platform"
+	"lan-chat/internal/store"
+)
+
+// peerDetail is the overlay for one peer: who it is, and the settings that
+// override the global ones for it
+type peerDetail struct {
+	peer  item
+	row   int             // selected entry of detailRows
+	input textinput.Model // the download folder while it is being edited
+}
+
+// detailRows are the editable settings, top to bottom
+var detailRows = []string{"download_dir", "files", "notify", "previews", "auto_open"}
+
+// openPeerDetail shows the detail overlay for p
+func (m *Model) openPeerDetail(p item) {
+	in := textinput.New()
+	in.Placeholder = tr("detail.dir_placeholder")
+	in.CharLimit = 4096
+	m.state = 0
+	m.peerDetail = &peerDetail{peer: p, input: in}
+}
+
+// prefsFor are the per-peer settings of the peer called name
+func (m Model) prefsFor(name string) store.PeerPrefs {
+	if m.node == nil {
+		return store.PeerPrefs{}
+	}
+	return m.node.Prefs(name)
+}
+
+// setPrefs saves the per-peer settings of p, showing a banner when that fails
+func (m *Model) setPrefs(p item, prefs store.PeerPrefs) tea.Cmd {
+	if err := m.node.SetPrefs(p.title, prefs); err != nil {
+		m.banner = &errorMsg{title: tr("err.prefs.title", p.title), detail: err.Error(), action: tr("err.prefs.action")}
+		m.resizeComponents(m.width, m.height)
+		return nil
+	}
+	return m.refreshList()
+}
+
+func (m *Model) updatePeerDetail(msg tea.KeyMsg) tea.Cmd {
+	d := m.peerDetail
+	prefs := m.prefsFor(d.peer.title)
+	if d.input.Focused() {
+		switch msg.String() {
+		case "esc":
+			d.input.Blur()
+			return nil
+		case "enter":
+			d.input.Blur()
+			prefs.DownloadDir = platform.ExpandHome(strings.TrimSpace(d.input.Value()))
+			if prefs.DownloadDir != "" {
+				if abs, err := filepath.Abs(prefs.DownloadDir); err == nil {
+					prefs.DownloadDir = abs
+				}
+			}
+			return m.setPrefs(d.peer, prefs)
+		}
+		var cmd tea.Cmd
+		d.input, cmd = d.input.Update(msg)
+		return cmd
+	}
+	switch msg.String() {
+	case "esc", "q":
+		m.peerDetail = nil
+	case "up", "k":
+		d.row = max(d.row-1, 0)
+	case "down", "j", "tab":
+		d.row = min(d.row+1, len(detailRows)-1)
+	case "enter", " ":
+		switch detailRows[d.row] {
+		case "download_dir":
+			d.input.SetValue(prefs.DownloadDir)
+			d.input.CursorEnd()
+			return d.input.Focus()
+		case "files":
+			prefs.Files = cycle(store.FilePrefs, prefs.Files)
+		case "notify":
+			prefs.Notify = cycle(store.NotifyPrefs, prefs.Notify)
+		case "previews":
+			prefs.Previews = cycle(store.PreviewPrefs, prefs.Previews)
+		case "auto_open":
+			prefs.AutoOpen = !prefs.AutoOpen
+		}
+		return m.setPrefs(d.peer, prefs)
+	}
+	return nil
+}
+
+// detailValue is how a setting reads in the overlay
+func detailValue(row string, prefs store.PeerPrefs) string {
+	value := map[string]string{"files": prefs.Files, "notify": prefs.Notify, "previews": prefs.Previews}[row]
+	switch row {
+	case "download_dir":
+		if prefs.DownloadDir == "" {
+			return tr("detail.default")
+		}
+		return prefs.DownloadDir
+	case "auto_open":
+		if prefs.AutoOpen {
+			return tr("detail.on")
+		}
+		return tr("detail.off")
+	}
+	if value == "" {
+		return tr("detail.default")
+	}
+	return tr("detail." + row + "." + value)
+}
+
+// viewPeerDetail draws the peer detail box over the list
+func (m Model) viewPeerDetail(behind string) string {
+	d := m.peerDetail
+	prefs := m.prefsFor(d.peer.title)
+	label := lipgloss.NewStyle().Foreground(colors.muted).Width(16)
+	rows := []string{
+		lipgloss.NewStyle().Bold(true).Render(d.peer.title),
+		"",
+		label.Render(tr("detail.address")) + d.peer.desc,
+	}
+	if info, ok := m.node.Lookup(d.peer.desc); ok && info.Key != "" {
+		key := info.Key
+		if info.KeyChanged {
+			key = "⚠ " + key
+		}
+		rows = append(rows, label.Render(tr("detail.key"))+key)
+	}
+	if info, ok := m.node.Lookup(d.peer.desc); ok && info.Reachable && info.RTT > 0 {
+		rows = append(rows, label.Render(tr("detail.latency"))+formatRTT(info.RTT))
+	}
+	if tags := m.knownTags(d.peer.title); len(tags) > 0 {
+		rows = append(rows, label.Render(tr("detail.tags"))+"#"+strings.Join(tags, " #"))
+	}
+	rows = append(rows, "")
+	selected := lipgloss.NewStyle().Reverse(true)
+	for i, row := range detailRows {
+		value := detailValue(row, prefs)
+		if row == "download_dir" && d.input.Focused() {
+			value = d.input.View()
+		} else if i == d.row {
+			value = selected.Render(" " + value + " ")
+		} else {
+			value = " " + value
+		}
+		rows = append(rows, label.Render(tr("detail."+row))+value)
+	}
+	rows = append(rows, "", lipgloss.NewStyle().Foreground(colors.muted).Render(tr("detail.footer")))
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(colors.accent).
+		Padding(0, 1).
+		Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+	return overlay(behind, box, m.width, m.height)
+}
+
+// previewsHidden reports whether the list shows no preview for the peer
+// called name: its own setting, else ui.preview_mode and ui.hide_previews
+func (m Model) previewsHidden(name string) bool {
+	switch m.prefsFor(name).Previews {
+	case "show":
+		return false
+	case "hide":
+		return true
+	}
+	return m.previewMode == "hidden" || m.hidePreviews[name]
+}
+
+// togglePreviews flips whether the list shows previews for p, as its own
+// setting so it is kept
+func (m *Model) togglePreviews(p item) tea.Cmd {
+	prefs := m.prefsFor(p.title)
+	if m.previewsHidden(p.title) {
+		prefs.Previews = "show"
+	} else {
+		prefs.Previews = "hide"
+	}
+	return m.setPrefs(p, prefs)
+}
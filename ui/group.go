@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"lan-chat/internal/node"
+	"lan-chat/internal/store"
+)
+
+// groupItem is the Everyone entry at the top of the peer list: its chat
+// goes to every reachable peer and holds the group messages they send.
+// Its conversation, unread count and selectedName are store.Everyone.
+type groupItem struct {
+	online  int    // reachable peers, who a message would go to
+	unread  int    // group messages not yet seen
+	preview string // the last group message, after the preview settings
+}
+
+func (g groupItem) Title() string {
+	title := lipgloss.NewStyle().Foreground(colors.accent).Render("●") + " \U0001F465 " + tr("group.everyone")
+	if g.unread > 0 {
+		title += " (" + strconv.Itoa(g.unread) + ")"
+	}
+	return title
+}
+
+func (g groupItem) Description() string {
+	return joinNonEmpty(" | ", tr("group.online", g.online), g.preview)
+}
+
+func (g groupItem) FilterValue() string { return tr("group.everyone") }
+
+// groupEntry is the Everyone entry as the list shows it now
+func (m Model) groupEntry() groupItem {
+	g := groupItem{unread: m.unread[store.Everyone]}
+	for _, p := range m.roster {
+		if p.reachable {
+			g.online++
+		}
+	}
+	if m.groupLast != "" {
+		g.preview = m.previewFor(item{title: store.Everyone, lastMsg: m.groupLast, message: true})
+	}
+	return g
+}
+
+// inGroup reports whether the chat open is the Everyone one
+func (m Model) inGroup() bool { return m.selectedName == store.Everyone }
+
+// chatName is how the conversation called name is shown: the peer's name,
+// or Everyone's in the user's language
+func chatName(name string) string {
+	if name == store.Everyone {
+		return tr("group.everyone")
+	}
+	return name
+}
+
+// chatAddress is what titles show for the open chat's IP: the peer's, or
+// how many peers a group message would reach
+func (m Model) chatAddress() string {
+	if m.inGroup() {
+		return tr("group.online", m.groupEntry().online)
+	}
+	return m.selectedIP
+}
+
+func (m *Model) openGroup() tea.Cmd {
+	return m.openChat(item{title: store.Everyone})
+}
+
+// sendGroupCmd sends text to everyone through the node. It isn't kept for
+// resending: who it should reach is whoever is there now.
+func (m Model) sendGroupCmd(text string) tea.Cmd {
+	return func() tea.Msg {
+		debugLog("Sending group chat")
+		err := m.node.SendGroupChat(context.Background(), text)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, node.ErrNoPeers):
+			return errorMsg{title: tr("err.send_group.title"), detail: err.Error(), action: tr("err.send_group.nobody")}
+		}
+		return errorMsg{title: tr("err.send_group.title"), detail: err.Error(), action: tr("err.send_chat.action")}
+	}
+}
+
+// groupChat shows a group message in the Everyone chat, counting it unread
+// and alerting as for a direct message from peer, its sender's conversation
+func (m Model) groupChat(msg chatMsg, peer string) (tea.Model, tea.Cmd) {
+	m.addChat(store.Everyone, stamp(msg.at)+" "+avatar(msg.sender)+" "+msg.sender+": "+msg.content)
+	m.groupLast = msg.sender + ": " + msg.content
+	body := m.previewFor(item{title: peer, lastMsg: msg.content, message: true})
+	if body == "" {
+		body = tr("preview.placeholder")
+	}
+	var alertCmd tea.Cmd
+	if !m.showing(store.Everyone) {
+		if m.prefsFor(peer).Notify != "none" {
+			m.unread[store.Everyone]++
+		}
+		alertCmd = m.alertCmd(peer, body)
+	} else if !m.focused {
+		alertCmd = m.alertCmd(peer, body)
+	}
+	return m, tea.Batch(alertCmd, m.refreshList())
+}
@@ -0,0 +1,18 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// hintInterval is how long each tip stays on screen
+const hintInterval = 8 * time.Second
+
+var hintKeys = []string{"hint.1", "hint.2", "hint.3", "hint.4", "hint.5", "hint.6", "hint.7", "hint.8", "hint.9"}
+
+// hint is the current tip; they rotate while the app runs
+func (m Model) hint() string {
+	key := hintKeys[int(time.Since(m.startTime)/hintInterval)%len(hintKeys)]
+	return lipgloss.NewStyle().Foreground(colors.muted).Italic(true).Render("\U0001F4A1 " + tr(key))
+}
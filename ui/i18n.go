@@ -0,0 +1,505 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// catalogs maps a locale to its UI strings. Missing keys fall back to English.
+var catalogs = map[string]map[string]string{
+	"en": {
+		"tmpl.title":         "You are: {name} {encryption}",
+		"tmpl.chat_title":    "Chat with {peer} ({ip}) {encryption}",
+		"tmpl.list_footer":   "(/) Filter | (f) File | (c) Config | (ctrl+p) Commands | (enter) Chat | (esc) Quit",
+		"tmpl.filter_footer": "(enter) Apply | (esc) Cancel",
+		"tmpl.chat_footer":   "(esc) Back",
+		"tmpl.picker_footer": "(enter) Select | (esc) Back",
+		"tmpl.config_footer": "(d) Toggle Debug | (l) Logs | (t) Theme | (h) Tips | (r) Reload | (esc) Back",
+
+		"encrypted":           "Encrypted",
+		"filter.title":        "Filter",
+		"picker.title":        "Select File",
+		"progress.title":      "Sending to %s (%s)%s...",
+		"progress.speed":      "%s/s, %s left",
+		"progress.waiting":    "waiting for %s",
+		"peer.new_connection": "New connection",
+		"peer.connected":      "Connected",
+		"peer.last_seen":      "Last seen %s",
+		"preview.placeholder": "Message received",
+		"info.chat":           "Chat: %s",
+		"info.uptime":         "up %s",
+
+		"self.title":      "This machine",
+		"self.name":       "Name",
+		"self.addresses":  "LAN address",
+		"self.no_address": "no LAN address",
+		"self.chat":       "Chat & files",
+		"self.discovery":  "Discovery",
+		"self.key":        "Identity key",
+		"self.starting":   "(starting)",
+		"self.up":         "(listening)",
+		"self.down":       "(unavailable)",
+		"self.close":      "Press any key to close",
+
+		"detail.address":         "Address",
+		"detail.key":             "Identity key",
+		"detail.tags":            "Tags",
+		"detail.latency":         "Latency",
+		"detail.download_dir":    "Download folder",
+		"detail.files":           "Files",
+		"detail.notify":          "Notifications",
+		"detail.previews":        "Previews",
+		"detail.auto_open":       "Open files",
+		"detail.default":         "default",
+		"detail.on":              "on arrival",
+		"detail.off":             "off",
+		"detail.files.accept":    "accept",
+		"detail.files.ask":       "ask",
+		"detail.files.refuse":    "refuse",
+		"detail.notify.all":      "all, even with do-not-disturb",
+		"detail.notify.silent":   "unread count only",
+		"detail.notify.none":     "none",
+		"detail.previews.show":   "show",
+		"detail.previews.hide":   "hide",
+		"detail.dir_placeholder": "empty for the default",
+		"detail.footer":          "(↑/↓) Move | (enter) Change | (esc) Close",
+
+		"chat.placeholder":        "Type a message...",
+		"chat.search_placeholder": "Search...",
+		"chat.me":                 "Me",
+		"chat.new_message":        "%d new message",
+		"chat.new_messages":       "%d new messages",
+		"chat.decrypt_failed":     "Could not decrypt - password mismatch",
+		"chat.image":              "%s (%d×%d %s, %s)",
+		"chat.none":               "No chat open: pick a peer and press enter",
+		"split.to_chat":           "(tab) Chat | ",
+		"split.to_peers":          "(tab) Peers | ",
+		"chat.no_password":        "Encrypted message - no password set",
+
+		"palette.title":         "Command Palette",
+		"palette.placeholder":   "Type a command...",
+		"palette.footer":        "(enter) Run | (↑/↓) Move | (esc) Close",
+		"switcher.title":        "Switch conversation",
+		"palette.no_matches":    "No matching actions",
+		"palette.open_chat":     "Open chat with %s",
+		"palette.send_file":     "Send file to %s",
+		"palette.export":        "Export chat history",
+		"palette.clear_history": "Clear chat history",
+		"palette.block":         "Block %s",
+		"palette.unblock":       "Unblock %s",
+		"palette.trust_key":     "Trust new identity key for %s",
+		"palette.config":        "Open configuration",
+		"palette.self":          "Show my addresses and ports",
+		"palette.debug":         "Toggle debug logging",
+		"palette.logs":          "View debug log",
+		"palette.reload":        "Reload config file",
+		"palette.open_received": "Open %s",
+		"palette.dnd":           "Toggle do-not-disturb",
+		"palette.preview_mode":  "Message previews: switch to %s",
+		"palette.hide_preview":  "Hide message preview for %s",
+		"palette.show_preview":  "Show message preview for %s",
+		"palette.peer_detail":   "Peer details and settings for %s",
+		"palette.detach":        "Detach (keep running in background)",
+		"palette.stop_session":  "Stop background session",
+		"palette.quit":          "Quit",
+		"palette.dismiss":       "Dismiss error",
+
+		"config.title":      "Configuration",
+		"config.on":         "ON",
+		"config.off":        "OFF",
+		"config.debug":      "Debug Logging: %s",
+		"config.debug_hint": "Press (d) to toggle debug logging",
+		"config.theme":      "Theme: %s",
+		"config.theme_hint": "Press (t) to switch theme (auto, dark, light)",
+		"config.logs_hint":  "Press (l) to view the debug log",
+		"config.hints":      "Tips: %s",
+		"config.hints_hint": "Press (h) to turn the tips under the peer list off for good (or back on)",
+
+		"hint.1":           "Press f to send a file to the selected peer",
+		"hint.2":           "Press ctrl+k to jump to any conversation by name",
+		"hint.3":           "Press ctrl+p to search every action",
+		"hint.4":           "Press o, u or v to show only online, unread or verified peers",
+		"hint.5":           "Press i to see the address colleagues can reach you at",
+		"hint.6":           "Press / to filter peers by name",
+		"hint.7":           "Start with --pass to encrypt chats and files",
+		"hint.8":           "Press c then h to stop showing these tips",
+		"hint.9":           "Press p for a peer's own download folder, notifications and previews",
+		"config.back_hint": "Press (esc) to go back",
+
+		"undo.toast":   "%s - (ctrl+z) Undo (%ds)",
+		"undo.cleared": "Chat history cleared",
+		"undo.blocked": "Blocked %s",
+
+		"log.title":              "Debug log (level: %s+)",
+		"log.footer":             "(l) Level | (/) Search | (G) Follow | (esc) Back",
+		"log.search_placeholder": "filter lines...",
+		"log.search_hint":        "Press / to search",
+		"log.empty":              "No matching log lines",
+		"log.disabled":           "Debug logging is off - press (esc) then (d) to turn it on",
+
+		"lock.title":         "Locked after inactivity",
+		"lock.prompt":        "Unlock: ",
+		"lock.hint_pin":      "Enter your PIN to unlock",
+		"lock.hint_password": "Enter the shared password to unlock",
+		"lock.incorrect":     "Incorrect, try again",
+
+		"banner.dismiss": "Dismiss",
+		"title.unread":   "%d unread",
+
+		"section.encrypted":  "Encrypted",
+		"section.unverified": "Unverified",
+
+		"group.everyone": "Everyone",
+		"group.online":   "%d online",
+
+		"filter.online":   "online",
+		"filter.unread":   "unread",
+		"filter.verified": "verified",
+		"sort.label":      "sort: %s",
+		"sort.name":       "name",
+		"sort.unread":     "unread",
+		"sort.latency":    "latency",
+
+		"update.available": "%s available: lan-chat update",
+		"reopen.offer":     "enter: back to your chat with %s",
+		"receive.progress": "receiving %s from %s: %s",
+		"receive.more":     "+%d more",
+
+		"offer.title":        "%s wants to send %s (%s)",
+		"offer.unknown_size": "size unknown",
+		"offer.no_hash":      "No checksum: the sender is older or the file is encrypted",
+		"offer.accept":       "Accept",
+		"offer.decline":      "Decline",
+		"offer.exists":       "%s is already there",
+		"offer.keep_both":    "Keep both",
+		"offer.replace":      "Replace",
+
+		"status.sent":               "Sent: %s",
+		"status.resuming":           "Resending %d queued item(s) to %s",
+		"status.received":           "Received: %s",
+		"status.received_encrypted": "Received (encrypted): %s",
+		"status.exported":           "Exported history to %s",
+		"status.reloaded":           "Config reloaded",
+
+		"err.export.title":            "Could not export chat history",
+		"err.export.action":           "Check that the current directory is writable.",
+		"err.reload.title":            "Config not reloaded",
+		"err.reload.action":           "Fix the config file and reload again; the previous settings stay in effect.",
+		"err.open.title":              "Could not open %s",
+		"err.open.action":             "Open it from your file manager; the desktop has no default application for it.",
+		"err.crash.title":             "Bug in %s, it was stopped",
+		"err.crash.detail":            "%v",
+		"err.crash.detail_saved":      "%v (report: %s)",
+		"err.crash.action":            "Press ctrl+r to restart; the conversation and queued sends come back.",
+		"err.send_chat.title":         "Message to %s not delivered",
+		"err.send_chat.action":        "Check that the peer is still running and on the same network, then resend.",
+		"err.send_group.title":        "Message to everyone not delivered to all",
+		"err.send_group.nobody":       "No peer is online; send it again once someone shows up in the list.",
+		"err.encrypt_chat.title":      "Could not encrypt message",
+		"err.restart.action":          "Restart lan-chat; if it persists, run with --debug and check debug.log.",
+		"err.open_file.title":         "Could not open file",
+		"err.open_file.action":        "Check the file still exists and that you have permission to read it.",
+		"err.stat_file.title":         "Could not read file",
+		"err.stat_file.action":        "Check that you have permission to read the file.",
+		"err.send_file.title":         "Could not send %s to %s",
+		"err.send_file.action":        "Check that the peer is still running and on the same network, then retry.",
+		"err.read_file.title":         "Could not read %s",
+		"err.read_file.action":        "Check that the file is readable and retry.",
+		"err.encrypt_file.title":      "Could not encrypt %s",
+		"err.transfer.title":          "Transfer of %s interrupted",
+		"err.transfer.action":         "The connection dropped; check the peer is still online and retry.",
+		"err.tcp_listen.title":        "Cannot receive chats or files",
+		"err.udp_listen.title":        "Peer discovery unavailable",
+		"err.listen.detail":           "%s listen on port %s failed: %s",
+		"err.listen.action":           "Another program (or another lan-chat) is using port %s; close it and restart.",
+		"err.decrypt_file.title":      "Failed to decrypt file: %s",
+		"err.decrypt_file.action":     "Ask the sender to confirm you both use the same --pass, then resend.",
+		"err.receive_file.title":      "Could not receive %s",
+		"err.receive_file.action":     "The transfer broke off or couldn't be saved; check the free space in the download folder and ask the sender to resend.",
+		"err.no_password_file.title":  "Encrypted file received but no password set: %s",
+		"err.no_password_file.detail": "The sender encrypted this transfer and it was discarded.",
+		"err.no_password_file.action": "Restart with --pass set to the sender's password to receive encrypted files.",
+		"err.decrypt_chat.title":      "Failed to decrypt message from %s",
+		"err.decrypt_chat.action":     "Ask %s to confirm you both use the same --pass.",
+		"err.key_changed.title":       "%s has a different identity key",
+		"err.key_changed.detail":      "%s: pinned %s, now %s",
+		"err.key_changed.action":      "Ask %s whether lan-chat was reinstalled; if so, trust the new key from ctrl+p.",
+		"err.trust_key.title":         "Could not trust the key of %s",
+		"err.trust_key.action":        "Wait until the peer is discovered again, then retry.",
+		"err.prefs.title":             "Could not save the settings for %s",
+		"err.prefs.action":            "Wait until the peer is discovered, then retry.",
+		"err.refused.title":           "%s does not take files from you: %s",
+		"err.refused.action":          "Ask %s to allow your files in their peer details (p).",
+	},
+	"es": {
+		"tmpl.title":         "Eres: {name} {encryption}",
+		"tmpl.chat_title":    "Chat con {peer} ({ip}) {encryption}",
+		"tmpl.list_footer":   "(/) Filtrar | (f) Archivo | (c) Config | (ctrl+p) Comandos | (enter) Chat | (esc) Salir",
+		"tmpl.filter_footer": "(enter) Aplicar | (esc) Cancelar",
+		"tmpl.chat_footer":   "(esc) Volver",
+		"tmpl.picker_footer": "(enter) Seleccionar | (esc) Volver",
+		"tmpl.config_footer": "(d) Depuración | (l) Registro | (t) Tema | (h) Consejos | (r) Recargar | (esc) Volver",
+
+		"encrypted":           "Cifrado",
+		"filter.title":        "Filtro",
+		"picker.title":        "Seleccionar archivo",
+		"progress.title":      "Enviando a %s (%s)%s...",
+		"progress.speed":      "%s/s, quedan %s",
+		"progress.waiting":    "esperando a %s",
+		"peer.new_connection": "Nueva conexión",
+		"peer.connected":      "Conectado",
+		"peer.last_seen":      "Visto por última vez %s",
+		"preview.placeholder": "Mensaje recibido",
+		"info.chat":           "Chat: %s",
+		"info.uptime":         "activo %s",
+
+		"self.title":      "Este equipo",
+		"self.name":       "Nombre",
+		"self.addresses":  "Dirección LAN",
+		"self.no_address": "sin dirección LAN",
+		"self.chat":       "Chat y archivos",
+		"self.discovery":  "Descubrimiento",
+		"self.key":        "Clave pública",
+		"self.starting":   "(iniciando)",
+		"self.up":         "(escuchando)",
+		"self.down":       "(no disponible)",
+		"self.close":      "Pulsa cualquier tecla para cerrar",
+
+		"detail.address":         "Dirección",
+		"detail.key":             "Clave de identidad",
+		"detail.tags":            "Etiquetas",
+		"detail.latency":         "Latencia",
+		"detail.download_dir":    "Carpeta de descargas",
+		"detail.files":           "Archivos",
+		"detail.notify":          "Avisos",
+		"detail.previews":        "Vistas previas",
+		"detail.auto_open":       "Abrir archivos",
+		"detail.default":         "predeterminado",
+		"detail.on":              "al llegar",
+		"detail.off":             "no",
+		"detail.files.accept":    "aceptar",
+		"detail.files.ask":       "preguntar",
+		"detail.files.refuse":    "rechazar",
+		"detail.notify.all":      "todos, incluso en no molestar",
+		"detail.notify.silent":   "solo el contador de no leídos",
+		"detail.notify.none":     "ninguno",
+		"detail.previews.show":   "mostrar",
+		"detail.previews.hide":   "ocultar",
+		"detail.dir_placeholder": "vacío para la predeterminada",
+		"detail.footer":          "(↑/↓) Mover | (enter) Cambiar | (esc) Cerrar",
+
+		"chat.placeholder":        "Escribe un mensaje...",
+		"chat.search_placeholder": "Buscar...",
+		"chat.me":                 "Yo",
+		"chat.new_message":        "%d mensaje nuevo",
+		"chat.new_messages":       "%d mensajes nuevos",
+		"chat.decrypt_failed":     "No se pudo descifrar - contraseña distinta",
+		"chat.image":              "%s (%d×%d %s, %s)",
+		"chat.none":               "Ningún chat abierto: elige un contacto y pulsa enter",
+		"split.to_chat":           "(tab) Chat | ",
+		"split.to_peers":          "(tab) Contactos | ",
+		"chat.no_password":        "Mensaje cifrado - sin contraseña configurada",
+
+		"palette.title":         "Paleta de comandos",
+		"palette.placeholder":   "Escribe un comando...",
+		"palette.footer":        "(enter) Ejecutar | (↑/↓) Mover | (esc) Cerrar",
+		"switcher.title":        "Cambiar de conversación",
+		"palette.no_matches":    "Ninguna acción coincide",
+		"palette.open_chat":     "Abrir chat con %s",
+		"palette.send_file":     "Enviar archivo a %s",
+		"palette.export":        "Exportar historial del chat",
+		"palette.clear_history": "Borrar historial del chat",
+		"palette.block":         "Bloquear a %s",
+		"palette.unblock":       "Desbloquear a %s",
+		"palette.trust_key":     "Confiar en la nueva clave de identidad de %s",
+		"palette.config":        "Abrir configuración",
+		"palette.self":          "Mostrar mis direcciones y puertos",
+		"palette.debug":         "Activar/desactivar registro de depuración",
+		"palette.logs":          "Ver registro de depuración",
+		"palette.reload":        "Recargar archivo de configuración",
+		"palette.open_received": "Abrir %s",
+		"palette.dnd":           "Activar/desactivar no molestar",
+		"palette.preview_mode":  "Vista previa de mensajes: cambiar a %s",
+		"palette.hide_preview":  "Ocultar vista previa de %s",
+		"palette.show_preview":  "Mostrar vista previa de %s",
+		"palette.peer_detail":   "Detalles y ajustes de %s",
+		"palette.detach":        "Desconectar (seguir en segundo plano)",
+		"palette.stop_session":  "Detener sesión en segundo plano",
+		"palette.quit":          "Salir",
+		"palette.dismiss":       "Descartar error",
+
+		"config.title":      "Configuración",
+		"config.on":         "SÍ",
+		"config.off":        "NO",
+		"config.debug":      "Registro de depuración: %s",
+		"config.debug_hint": "Pulsa (d) para activar/desactivar la depuración",
+		"config.theme":      "Tema: %s",
+		"config.theme_hint": "Pulsa (t) para cambiar el tema (auto, oscuro, claro)",
+		"config.logs_hint":  "Pulsa (l) para ver el registro de depuración",
+		"config.hints":      "Consejos: %s",
+		"config.hints_hint": "Pulsa (h) para ocultar para siempre los consejos bajo la lista (o volver a mostrarlos)",
+
+		"hint.1":           "Pulsa f para enviar un archivo al contacto seleccionado",
+		"hint.2":           "Pulsa ctrl+k para saltar a cualquier conversación por nombre",
+		"hint.3":           "Pulsa ctrl+p para buscar cualquier acción",
+		"hint.4":           "Pulsa o, u o v para ver solo contactos en línea, con no leídos o verificados",
+		"hint.5":           "Pulsa i para ver la dirección a la que pueden conectarse tus colegas",
+		"hint.6":           "Pulsa / para filtrar contactos por nombre",
+		"hint.7":           "Inicia con --pass para cifrar chats y archivos",
+		"hint.8":           "Pulsa c y luego h para dejar de ver estos consejos",
+		"hint.9":           "Pulsa p para la carpeta, los avisos y las vistas previas propios de un contacto",
+		"config.back_hint": "Pulsa (esc) para volver",
+
+		"undo.toast":   "%s - (ctrl+z) Deshacer (%ds)",
+		"undo.cleared": "Historial del chat borrado",
+		"undo.blocked": "%s bloqueado",
+
+		"log.title":              "Registro de depuración (nivel: %s+)",
+		"log.footer":             "(l) Nivel | (/) Buscar | (G) Seguir | (esc) Volver",
+		"log.search_placeholder": "filtrar líneas...",
+		"log.search_hint":        "Pulsa / para buscar",
+		"log.empty":              "Ninguna línea coincide",
+		"log.disabled":           "La depuración está desactivada: pulsa (esc) y luego (d) para activarla",
+
+		"lock.title":         "Bloqueado por inactividad",
+		"lock.prompt":        "Desbloquear: ",
+		"lock.hint_pin":      "Introduce tu PIN para desbloquear",
+		"lock.hint_password": "Introduce la contraseña compartida para desbloquear",
+		"lock.incorrect":     "Incorrecto, inténtalo de nuevo",
+
+		"banner.dismiss": "Descartar",
+		"title.unread":   "%d sin leer",
+
+		"section.encrypted":  "Cifrados",
+		"section.unverified": "Sin verificar",
+
+		"group.everyone": "Todos",
+		"group.online":   "%d conectados",
+
+		"filter.online":   "conectados",
+		"filter.unread":   "sin leer",
+		"filter.verified": "verificados",
+		"sort.label":      "orden: %s",
+		"sort.name":       "nombre",
+		"sort.unread":     "sin leer",
+		"sort.latency":    "latencia",
+
+		"update.available": "%s disponible: lan-chat update",
+		"reopen.offer":     "enter: volver al chat con %s",
+		"receive.progress": "recibiendo %s de %s: %s",
+		"receive.more":     "%d más",
+
+		"offer.title":        "%s quiere enviarte %s (%s)",
+		"offer.unknown_size": "tamaño desconocido",
+		"offer.no_hash":      "Sin suma de comprobación: el remitente es antiguo o el archivo va cifrado",
+		"offer.accept":       "Aceptar",
+		"offer.decline":      "Rechazar",
+		"offer.exists":       "%s ya existe",
+		"offer.keep_both":    "Conservar ambos",
+		"offer.replace":      "Reemplazar",
+
+		"status.sent":               "Enviado: %s",
+		"status.resuming":           "Reenviando %d elemento(s) pendiente(s) a %s",
+		"status.received":           "Recibido: %s",
+		"status.received_encrypted": "Recibido (cifrado): %s",
+		"status.exported":           "Historial exportado a %s",
+		"status.reloaded":           "Configuración recargada",
+
+		"err.export.title":            "No se pudo exportar el historial",
+		"err.export.action":           "Comprueba que el directorio actual tenga permisos de escritura.",
+		"err.reload.title":            "Configuración no recargada",
+		"err.reload.action":           "Corrige el archivo de configuración y recarga de nuevo; sigue en vigor la anterior.",
+		"err.open.title":              "No se pudo abrir %s",
+		"err.open.action":             "Ábrelo desde el gestor de archivos; el escritorio no tiene una aplicación predeterminada para él.",
+		"err.crash.title":             "Error interno en %s, se ha detenido",
+		"err.crash.detail":            "%v",
+		"err.crash.detail_saved":      "%v (informe: %s)",
+		"err.crash.action":            "Pulsa ctrl+r para reiniciar; la conversación y los envíos pendientes se recuperan.",
+		"err.send_chat.title":         "Mensaje a %s no entregado",
+		"err.send_chat.action":        "Comprueba que el contacto siga activo y en la misma red, y reenvía.",
+		"err.send_group.title":        "Mensaje a todos no entregado a todos",
+		"err.send_group.nobody":       "No hay contactos conectados; reenvíalo cuando aparezca alguien en la lista.",
+		"err.encrypt_chat.title":      "No se pudo cifrar el mensaje",
+		"err.restart.action":          "Reinicia lan-chat; si persiste, usa --debug y revisa debug.log.",
+		"err.open_file.title":         "No se pudo abrir el archivo",
+		"err.open_file.action":        "Comprueba que el archivo exista y que tengas permiso de lectura.",
+		"err.stat_file.title":         "No se pudo leer el archivo",
+		"err.stat_file.action":        "Comprueba que tengas permiso de lectura.",
+		"err.send_file.title":         "No se pudo enviar %s a %s",
+		"err.send_file.action":        "Comprueba que el contacto siga activo y en la misma red, y reinténtalo.",
+		"err.read_file.title":         "No se pudo leer %s",
+		"err.read_file.action":        "Comprueba que el archivo se pueda leer y reinténtalo.",
+		"err.encrypt_file.title":      "No se pudo cifrar %s",
+		"err.transfer.title":          "Transferencia de %s interrumpida",
+		"err.transfer.action":         "Se cortó la conexión; comprueba que el contacto siga conectado y reinténtalo.",
+		"err.tcp_listen.title":        "No se pueden recibir chats ni archivos",
+		"err.udp_listen.title":        "Descubrimiento de contactos no disponible",
+		"err.listen.detail":           "Falló la escucha %s en el puerto %s: %s",
+		"err.listen.action":           "Otro programa (u otro lan-chat) usa el puerto %s; ciérralo y reinicia.",
+		"err.decrypt_file.title":      "No se pudo descifrar el archivo: %s",
+		"err.decrypt_file.action":     "Confirma con el remitente que usáis el mismo --pass y pide que reenvíe.",
+		"err.receive_file.title":      "No se pudo recibir %s",
+		"err.receive_file.action":     "La transferencia se cortó o no se pudo guardar; comprueba el espacio libre en la carpeta de descargas y pide que la reenvíen.",
+		"err.no_password_file.title":  "Archivo cifrado recibido sin contraseña: %s",
+		"err.no_password_file.detail": "El remitente cifró esta transferencia y se descartó.",
+		"err.no_password_file.action": "Reinicia con --pass igual al del remitente para recibir archivos cifrados.",
+		"err.decrypt_chat.title":      "No se pudo descifrar el mensaje de %s",
+		"err.decrypt_chat.action":     "Confirma con %s que usáis el mismo --pass.",
+		"err.key_changed.title":       "%s tiene otra clave de identidad",
+		"err.key_changed.detail":      "%s: fijada %s, ahora %s",
+		"err.key_changed.action":      "Pregunta a %s si reinstaló lan-chat; si es así, confía en la nueva clave desde ctrl+p.",
+		"err.trust_key.title":         "No se pudo confiar en la clave de %s",
+		"err.trust_key.action":        "Espera a que se vuelva a descubrir el contacto y reinténtalo.",
+		"err.prefs.title":             "No se pudieron guardar los ajustes de %s",
+		"err.prefs.action":            "Espera a que se descubra el contacto y reinténtalo.",
+		"err.refused.title":           "%s no acepta tus archivos: %s",
+		"err.refused.action":          "Pide a %s que permita tus archivos en sus detalles de contacto (p).",
+	},
+}
+
+var catalog = catalogs["en"]
+
+// detectLocale prefers the configured locale, then LC_ALL, LC_MESSAGES and
+// LANG, reducing values like "es_ES.UTF-8" to "es".
+func detectLocale(configured string) string {
+	candidates := []string{configured, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		parts := strings.FieldsFunc(c, func(r rune) bool { return r == '_' || r == '.' || r == '-' })
+		if len(parts) == 0 {
+			continue
+		}
+		lang := strings.ToLower(parts[0])
+		if _, ok := catalogs[lang]; ok {
+			return lang
+		}
+		if configured != "" && c == configured {
+			debugLog("Unknown locale %q, falling back", configured)
+		}
+	}
+	return "en"
+}
+
+func setLocale(locale string) {
+	if c, ok := catalogs[locale]; ok {
+		catalog = c
+	}
+}
+
+// tr looks up a UI string in the active catalog, formatting it with args
+func tr(key string, args ...interface{}) string {
+	s, ok := catalog[key]
+	if !ok {
+		s, ok = catalogs["en"][key]
+		if !ok {
+			return key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(s, args...)
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Thumbnails are at most this many cells; each cell shows two pixels using
+// the upper half block, so they come out roughly square
+const (
+	thumbCols = 32
+	thumbRows = 12
+	// Larger images only get the placeholder, decoding them would stall the chat
+	thumbMaxPixels = 40_000_000
+)
+
+// imageCardCmd turns a received file into chat lines if it is an image: a
+// header with its dimensions and size, followed by a thumbnail when enabled.
+// Anything that isn't a decodable image produces no lines.
+func imageCardCmd(sender, path string, thumbnails bool) tea.Cmd {
+	return func() tea.Msg {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		cfg, format, err := image.DecodeConfig(f)
+		if err != nil {
+			return nil
+		}
+		var size int64
+		if fi, err := f.Stat(); err == nil {
+			size = fi.Size()
+		}
+		header := avatar(sender) + " " + sender + ": \U0001F5BC " +
+			tr("chat.image", filepath.Base(path), cfg.Width, cfg.Height, strings.ToUpper(format), formatBytes(size))
+		lines := []string{header}
+		if !thumbnails || cfg.Width*cfg.Height > thumbMaxPixels {
+			return imageCardMsg{sender: sender, lines: lines}
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return imageCardMsg{sender: sender, lines: lines}
+		}
+		img, _, err := image.Decode(f)
+		if err != nil {
+			return imageCardMsg{sender: sender, lines: lines}
+		}
+		return imageCardMsg{sender: sender, lines: append(lines, thumbnail(img)...)}
+	}
+}
+
+// thumbnail renders img with nearest-neighbour scaling into half-block cells
+func thumbnail(img image.Image) []string {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return nil
+	}
+	// Fit into thumbCols x (thumbRows*2) pixels, keeping the aspect ratio
+	scale := min(float64(thumbCols)/float64(b.Dx()), float64(thumbRows*2)/float64(b.Dy()), 1)
+	w := max(int(float64(b.Dx())*scale), 1)
+	h := max(int(float64(b.Dy())*scale), 1)
+	hex := func(x, y int) lipgloss.Color {
+		r, g, bl, _ := img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h).RGBA()
+		return lipgloss.Color(fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, bl>>8))
+	}
+	var lines []string
+	for y := 0; y < h; y += 2 {
+		var row strings.Builder
+		row.WriteString("   ")
+		for x := 0; x < w; x++ {
+			cell := lipgloss.NewStyle().Foreground(hex(x, y))
+			if y+1 < h {
+				cell = cell.Background(hex(x, y+1))
+			}
+			row.WriteString(cell.Render("\u2580"))
+		}
+		lines = append(lines, row.String())
+	}
+	return lines
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// item implements list.Item
+type item struct {
+	title, desc, lastMsg string
+	message              bool   // lastMsg is chat content, subject to preview settings
+	preview              string // what the list shows for lastMsg, set by visiblePeers
+	secure               bool
+	reachable            bool
+	offline              bool          // not announcing itself: quit, or not seen yet this run
+	keyChanged           bool          // its identity key isn't the one pinned to the name
+	tags                 []string      // from the known-peer roster
+	rtt                  time.Duration // heartbeat round trip, 0 until measured
+	latency              string        // what the list shows for rtt, set by visiblePeers
+	unread               int           // messages not yet seen, set by visiblePeers
+}
+
+// healthDot is green when verified and reachable, yellow when reachable but
+// unverified, red when the heartbeat can't reach the peer, and grey when
+// it is offline.
+func (i item) healthDot() string {
+	color := colors.danger
+	if i.offline {
+		color = colors.muted
+	} else if i.reachable && i.secure {
+		color = colors.success
+	} else if i.reachable {
+		color = colors.warning
+	}
+	return lipgloss.NewStyle().Foreground(color).Render("\u25CF")
+}
+
+func (i item) Title() string {
+	title := i.title
+	if i.keyChanged {
+		title = "\u26A0 " + title
+	}
+	if i.offline {
+		title = lipgloss.NewStyle().Foreground(colors.muted).Render(title)
+	}
+	if i.unread > 0 {
+		title += " (" + strconv.Itoa(i.unread) + ")"
+	}
+	if i.secure {
+		return i.healthDot() + " " + avatar(i.title) + " \U0001F512 " + title
+	}
+	return i.healthDot() + " " + avatar(i.title) + " " + title
+}
+
+func (i item) Description() string {
+	var tags string
+	if len(i.tags) > 0 {
+		tags = "#" + strings.Join(i.tags, " #")
+	}
+	if i.secure {
+		return joinNonEmpty(" | ", i.desc, i.latency, "\U0001F512 "+tr("encrypted"), tags, i.preview)
+	}
+	return joinNonEmpty(" | ", i.desc, i.latency, tags, i.preview)
+}
+
+func (i item) FilterValue() string { return i.title }
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
+
+// sectionHeader is a non-selectable list row separating encrypted and
+// unverified peers
+type sectionHeader struct {
+	title string
+	count int
+}
+
+func (h sectionHeader) FilterValue() string { return "" }
+
+// sectionDelegate renders section headers and defers peers to the default delegate
+type sectionDelegate struct{ list.DefaultDelegate }
+
+func (d sectionDelegate) Render(w io.Writer, m list.Model, index int, itm list.Item) {
+	h, ok := itm.(sectionHeader)
+	if !ok {
+		d.DefaultDelegate.Render(w, m, index, itm)
+		return
+	}
+	label := fmt.Sprintf("%s (%d)", h.title, h.count)
+	style := lipgloss.NewStyle().Bold(true).Foreground(colors.accent)
+	rule := lipgloss.NewStyle().Foreground(colors.muted).Render(strings.Repeat("\u2500", lipgloss.Width(label)))
+	fmt.Fprint(w, style.Render(label)+"\n"+rule)
+}
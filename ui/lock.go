@@ -0,0 +1,60 @@
+package ui
+
+import (
+	"crypto/subtle"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// lock blanks the screen until the PIN / shared password is entered
+func (m *Model) lock() tea.Cmd {
+	debugLog("Idle for %s, locking", m.idleLock)
+	m.lockedState = m.state
+	if m.state == 5 {
+		m.lockedState = m.prevState
+	}
+	m.state = 6
+	m.lockError = ""
+	m.textInput.Blur()
+	m.palette.Blur()
+	m.lockInput.Reset()
+	return tea.Batch(m.lockInput.Focus(), tickCmd())
+}
+
+func (m *Model) updateLock(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+c":
+		return m.quitCmd()
+	case "enter":
+		if subtle.ConstantTimeCompare([]byte(m.lockInput.Value()), []byte(m.unlockSecret)) != 1 {
+			m.lockError = tr("lock.incorrect")
+			m.lockInput.Reset()
+			return nil
+		}
+		m.state = m.lockedState
+		m.lockInput.Blur()
+		m.lockInput.Reset()
+		if m.state == 3 && (!m.vimKeys || m.vimMode != "normal") {
+			return m.textInput.Focus()
+		}
+		return nil
+	}
+	var cmd tea.Cmd
+	m.lockInput, cmd = m.lockInput.Update(msg)
+	return cmd
+}
+
+func (m Model) viewLocked() string {
+	hint := tr("lock.hint_pin")
+	if m.unlockSecret != "" && m.unlockSecret == m.password {
+		hint = tr("lock.hint_password")
+	}
+	rows := []string{"\U0001F512 " + tr("lock.title"), "", hint, "", m.lockInput.View()}
+	if m.lockError != "" {
+		rows = append(rows, "", lipgloss.NewStyle().Foreground(colors.danger).Render(m.lockError))
+	}
+	box := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 3).
+		Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Log levels from most to least verbose, as tagged by debugLog and errorLog
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// logTailBytes bounds how much of the log file the viewer reads
+const logTailBytes = 256 << 10
+
+func (m *Model) openLogs() tea.Cmd {
+	m.state = 7
+	m.reloadLogs()
+	m.logView.GotoBottom()
+	return nil
+}
+
+// reloadLogs re-reads the tail of the log file, following new lines when the
+// viewer is already scrolled to the bottom
+func (m *Model) reloadLogs() {
+	follow := m.logView.AtBottom()
+	m.logLines = nil
+	f, err := os.Open(logPath())
+	if err == nil {
+		if fi, err := f.Stat(); err == nil && fi.Size() > logTailBytes {
+			f.Seek(-logTailBytes, io.SeekEnd)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		m.logLines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		if len(data) >= logTailBytes && len(m.logLines) > 1 {
+			m.logLines = m.logLines[1:] // first line is probably cut off
+		}
+	}
+	m.filterLogs()
+	if follow {
+		m.logView.GotoBottom()
+	}
+}
+
+// logLineLevel reads the level of a text or JSON slog record, or the
+// [LEVEL] tag of older logs
+func logLineLevel(line string) int {
+	for i, l := range logLevels {
+		l = strings.ToUpper(l)
+		if strings.Contains(line, " level="+l+" ") || strings.Contains(line, `"level":"`+l+`"`) ||
+			strings.Contains(line, "["+l+"]") {
+			return i
+		}
+	}
+	return 1 // untagged lines count as info
+}
+
+// filterLogs applies the level filter and search to the loaded lines
+func (m *Model) filterLogs() {
+	minLevel := slices.Index(logLevels, m.logLevel)
+	query := strings.ToLower(m.logSearch.Value())
+	var shown []string
+	for _, line := range m.logLines {
+		if line == "" || logLineLevel(line) < minLevel {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(line), query) {
+			continue
+		}
+		switch logLineLevel(line) {
+		case 3:
+			line = lipgloss.NewStyle().Foreground(colors.danger).Render(line)
+		case 2:
+			line = lipgloss.NewStyle().Foreground(colors.warning).Render(line)
+		case 0:
+			line = lipgloss.NewStyle().Foreground(colors.muted).Render(line)
+		}
+		shown = append(shown, line)
+	}
+	if len(shown) == 0 {
+		empty := tr("log.empty")
+		if !enableDebug {
+			empty = tr("log.disabled")
+		}
+		shown = []string{lipgloss.NewStyle().Foreground(colors.muted).Render(empty)}
+	}
+	m.logView.SetContent(strings.Join(shown, "\n"))
+}
+
+// updateLogs handles keys in the log viewer: l cycles the level filter, /
+// searches, G follows the tail
+func (m *Model) updateLogs(msg tea.KeyMsg) tea.Cmd {
+	if m.logSearch.Focused() {
+		switch msg.String() {
+		case "esc":
+			m.logSearch.Reset()
+			m.logSearch.Blur()
+		case "enter":
+			m.logSearch.Blur()
+		default:
+			var cmd tea.Cmd
+			m.logSearch, cmd = m.logSearch.Update(msg)
+			m.filterLogs()
+			m.logView.GotoBottom()
+			return cmd
+		}
+		m.filterLogs()
+		return nil
+	}
+	switch msg.String() {
+	case "esc":
+		m.state = 4
+		return nil
+	case "l":
+		m.logLevel = cycle(logLevels, m.logLevel)
+		m.filterLogs()
+		return nil
+	case "/":
+		return m.logSearch.Focus()
+	case "G", "end":
+		m.logView.GotoBottom()
+		return nil
+	case "g", "home":
+		m.logView.GotoTop()
+		return nil
+	}
+	var cmd tea.Cmd
+	m.logView, cmd = m.logView.Update(msg)
+	return cmd
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"lan-chat/internal/protocol"
+)
+
+type peerUpdateMsg struct {
+	name, ip, lastMsg string
+	message           bool // lastMsg is chat content rather than a status
+	found             bool // discovery announced it just now
+}
+
+type transferStatusMsg string
+
+type chatMsg struct {
+	sender, content string    // sender is the name the message claims
+	ip              string    // who sent it; its roster entry names the conversation
+	at              time.Time // when it was sent
+	group           bool      // sent to everyone, shown in the Everyone chat
+}
+
+// progressMsg is how much of an outgoing file has been sent so far
+type progressMsg struct {
+	ip, name    string
+	sent, total int64
+}
+
+type peerVerifiedMsg struct {
+	ip     string
+	secure bool
+}
+
+type configToggleDebugMsg struct{}
+
+type tickMsg time.Time
+
+type flashOffMsg struct{}
+
+// fileReceivedMsg reports a completed incoming transfer
+type fileReceivedMsg struct {
+	name      string
+	path      string // where it was saved
+	ip        string // sender
+	encrypted bool
+}
+
+// receiveMsg is an incoming file on its way; done when it was saved or
+// failed. total is -1 when the sender didn't announce the size.
+type receiveMsg struct {
+	ip, name        string
+	received, total int64
+	done            bool
+	started         time.Time // set by receive: when the first one came in
+	base            int64     // and what it had received
+}
+
+// fileOfferMsg is an incoming file waiting for the user to accept or
+// decline it
+type fileOfferMsg struct {
+	id     int
+	offer  protocol.Offer
+	exists bool // a file is saved under its name already
+}
+
+// offerExpiredMsg is a fileOfferMsg the node stopped waiting for
+type offerExpiredMsg struct{ id int }
+
+// imageCardMsg carries the rendered chat lines for a received image
+type imageCardMsg struct {
+	sender string
+	lines  []string
+}
+
+// peerKeyMsg is the identity key check with a peer; changed means the key
+// differs from the one pinned to its name
+type peerKeyMsg struct {
+	ip      string
+	changed bool
+}
+
+// peerTagsMsg is a known peer's tags changing
+type peerTagsMsg struct {
+	name string
+	tags []string
+}
+
+// peerOfflineMsg is a peer that stopped announcing itself; a
+// peerUpdateMsg with found brings it back
+type peerOfflineMsg struct {
+	ip       string
+	lastSeen time.Time
+}
+
+// peerHealthMsg is emitted by the heartbeat when a peer's TCP reachability changes
+type peerHealthMsg struct {
+	ip        string
+	reachable bool
+}
+
+// peerLatencyMsg is the smoothed round trip of a peer's last heartbeat
+type peerLatencyMsg struct {
+	ip  string
+	rtt time.Duration
+}
+
+// listenerMsg reports whether the TCP or UDP listener came up
+type listenerMsg struct {
+	proto string // "TCP" or "UDP"
+	up    bool
+}
+
+// UpdateMsg says a newer release is out; the peer list footer shows it
+type UpdateMsg struct{ Version string }
+
+// netMsg carries the messages from StartNetwork that queued up since the
+// last one, in order; update handles each and waits for the next batch
+type netMsg []tea.Msg
+
+// errorMsg is surfaced to the user as a dismissible banner
+type errorMsg struct{ title, detail, action string }
@@ -0,0 +1,301 @@
+// Package ui is the Bubble Tea terminal interface: the peer list, chat,
+// file transfers and every overlay, plus the detachable session that hosts
+// it in the background.
+package ui
+
+import (
+	"os"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/bubbles/filepicker"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"lan-chat/internal/crash"
+	"lan-chat/internal/node"
+	"lan-chat/internal/platform"
+	"lan-chat/internal/store"
+)
+
+// Model is the whole UI state; create it with New
+type Model struct {
+	state        int // 0: list, 1: picker, 2: progress, 3: chat, 4: config, 5: palette, 6: locked, 7: log
+	list         list.Model
+	roster       []item // every known peer; the list shows a filtered/sorted view
+	quickFilter  string // one of quickFilters
+	sortMode     string // one of sortModes
+	filepicker   filepicker.Model
+	unseen       int            // messages that arrived while scrolled up
+	unread       map[string]int // unread messages per peer name
+	termTitle    string         // last window title sent to the terminal
+	progress     progress.Model
+	progressPct  float64
+	progressSize int64     // total bytes of the current transfer
+	progressName string    // file name of the current transfer
+	progressFrom time.Time // when the current transfer started
+	progressRate float64   // bytes per second so far, 0 until measured
+	fixedBar     bool      // theme sets an explicit progress width
+	textInput    textinput.Model
+	chatView     chatView // the visible part of chatHistory
+	selectedIP   string
+	selectedName string
+	lastStatus   string
+	chatHistory  []string            // the conversation in the chat pane, chatPeer's
+	chatPeer     string              // name of the peer whose chat was opened last
+	chats        map[string][]string // every other conversation, by the roster name at the sender's IP
+	groupLast    string              // the last group message, the Everyone entry's preview
+	backlogged   map[string]bool     // conversations given their lines from earlier runs
+	networkChan  chan tea.Msg
+	node         *node.Node // sends go through it so they show up in its history
+	userName     string
+	width        int
+	height       int
+	password     string
+	securePeers  map[string]bool
+	configDebug  bool
+	banner       *errorMsg
+	templates    map[string]string
+	vimKeys      bool
+	vimMode      string // "normal", "insert" or "search" while chatting with vim keys
+	pendingG     bool   // first 'g' of a 'gg' jump
+	palette      textinput.Model
+	paletteIdx   int
+	switcher     bool     // palette is showing the ctrl+k quick-switcher
+	prevState    int      // state to return to when the palette closes
+	session      *Session // set when running as a detachable background session
+	startTime    time.Time
+	showClock    bool
+	showUptime   bool
+	showConv     bool
+	lastActivity time.Time
+	idleLock     time.Duration // 0 when the idle lock is disabled
+	unlockSecret string
+	lockInput    textinput.Model
+	lockedState  int // state to restore after unlocking
+	lockError    string
+	alert        string
+	desktop      bool // desktop notifications with the alert
+	focused      bool // terminal focus, from focus reporting
+	flashing     bool
+	dnd          bool   // do-not-disturb mutes alerts
+	themeMode    string // "auto", "dark" or "light"
+	showAddress  bool
+	showLatency  bool
+	localAddrs   []string        // this machine's LAN IPs
+	listeners    map[string]bool // "TCP"/"UDP" listener status; missing while starting
+	selfInfo     bool            // "me" detail overlay is open
+	peerDetail   *peerDetail     // peer detail overlay, when open
+	previewLen   int
+	previewMode  string
+	hidePreviews map[string]bool
+	fileTheme    string // theme.mode and ui.preview_mode in the config file,
+	filePreviews string // which reload applies only when they change
+	thumbnails   bool   // render received images inline
+	logView      viewport.Model
+	logLevel     string // minimum level shown, one of logLevels
+	logSearch    textinput.Model
+	logLines     []string // tail of debug.log
+	pendingUndo  *undoAction
+	blocked      map[string]item // blocked peers by name, kept so they can be unblocked
+	uiState      store.UIState
+	statePath    string
+	showHints    bool       // tips line under the peer list
+	outbox       []outgoing // sends in flight
+	nextSendID   int
+	resume       []store.Outgoing // sends from the last run, waiting for their peer
+	reopen       *reopenChat      // the conversation open at the last exit, waiting for its peer
+	reopenMode   string           // ui.reopen_chat
+	layout       string           // ui.layout: "auto" splits wide windows
+	ticking      bool             // the once-a-second tick is running
+	configPath   string
+	onReload     func() error
+	crash        *crash.Report  // a background goroutine panicked
+	restart      bool           // quit so main can start us again
+	newVersion   string         // a newer release, from the update check
+	lastReceived string         // path of the last file received, for "Open"
+	receiving    []receiveMsg   // incoming files, oldest first
+	offers       []fileOfferMsg // incoming files waiting for an answer, oldest first
+}
+
+// New builds the UI for user name. netChan carries network events from
+// StartNetwork.
+func New(n *node.Node, cfg Config, st store.UIState, netChan chan tea.Msg) Model {
+	name, password := n.Name, n.Password
+	l := list.New([]list.Item{}, sectionDelegate{list.NewDefaultDelegate()}, 0, 0)
+	l.Title = "xYou are: " + name + " | (/) Filter (f) File (c) Config (enter) Chat (esc) Quit"
+
+	// Remove 'q' from the help menu
+	l.KeyMap.Quit.SetKeys()
+	l.SetShowStatusBar(false)
+	l.SetShowHelp(false)  // Hide default help view since we render it manually
+	l.SetShowTitle(false) // Hide default title since we render it manually
+
+	vimKeys := cfg.Keymap == "vim"
+	if vimKeys {
+		// 'g' is reserved for the 'gg' jump handled in handleVimKey
+		l.KeyMap.GoToStart.SetKeys("home")
+	}
+
+	fp := filepicker.New()
+	fp.CurrentDirectory, _ = os.Getwd()
+
+	pi := textinput.New()
+	pi.Placeholder = tr("palette.placeholder")
+	pi.Prompt = "> "
+
+	ti := textinput.New()
+	ti.Placeholder = tr("chat.placeholder")
+	// Don't focus by default, only focus when in chat mode
+
+	ls := textinput.New()
+	ls.Placeholder = tr("log.search_placeholder")
+	ls.Prompt = "/"
+
+	li := textinput.New()
+	li.EchoMode = textinput.EchoPassword
+	li.Prompt = tr("lock.prompt")
+	idleLock, unlockSecret := cfg.idleLock(password)
+
+	m := Model{
+		state:        0,
+		list:         l,
+		filepicker:   fp,
+		progress:     cfg.theme.newProgress(),
+		fixedBar:     cfg.theme.progressWidth > 0,
+		textInput:    ti,
+		networkChan:  netChan,
+		node:         n,
+		userName:     name,
+		password:     password,
+		securePeers:  make(map[string]bool),
+		unread:       make(map[string]int),
+		chats:        make(map[string][]string),
+		backlogged:   make(map[string]bool),
+		quickFilter:  "all",
+		sortMode:     "recent",
+		configDebug:  enableDebug,
+		templates:    cfg.templates,
+		vimKeys:      vimKeys,
+		vimMode:      "normal",
+		palette:      pi,
+		startTime:    time.Now(),
+		showClock:    cfg.showClock,
+		showUptime:   cfg.showUptime,
+		showConv:     cfg.showConversation,
+		lastActivity: time.Now(),
+		idleLock:     idleLock,
+		unlockSecret: unlockSecret,
+		lockInput:    li,
+		alert:        cfg.alert,
+		desktop:      cfg.desktopNotify,
+		themeMode:    cfg.theme.mode,
+		focused:      true,
+		showAddress:  cfg.showAddress,
+		showLatency:  cfg.showLatency,
+		localAddrs:   localIPs(),
+		listeners:    make(map[string]bool),
+		previewLen:   cfg.previewLength,
+		previewMode:  cfg.previewMode,
+		reopenMode:   cfg.reopenChat,
+		layout:       cfg.layout,
+		hidePreviews: cfg.hidePreviews,
+		fileTheme:    cfg.fileTheme,
+		filePreviews: cfg.filePreviews,
+		thumbnails:   cfg.imageThumbnails,
+		logLevel:     "debug",
+		logSearch:    ls,
+		blocked:      make(map[string]item),
+		uiState:      st,
+		statePath:    store.StatePath(),
+		showHints:    cfg.showHints && !st.HintsDismissed && st.Sessions <= hintSessions,
+		ticking:      cfg.showClock || cfg.showUptime || idleLock > 0,
+		configPath:   cfg.path,
+		onReload:     cfg.OnReload,
+		roster:       knownItems(n.Known()),
+	}
+	if slices.Contains(sortModes, st.Sort) {
+		m.sortMode = st.Sort
+	}
+	// Known peers show up offline until discovery finds them
+	m.refreshList()
+	return m
+}
+
+// idleLock is how long before the screen locks, 0 for never, and what
+// unlocks it: the PIN, or the shared password if there's no PIN
+func (c Config) idleLock(password string) (time.Duration, string) {
+	secret := c.lockPIN
+	if secret == "" {
+		secret = password
+	}
+	if secret == "" {
+		if c.idleLockMinutes > 0 {
+			debugLog("Idle lock disabled: set security.lock_pin or --pass")
+		}
+		return 0, ""
+	}
+	return time.Duration(c.idleLockMinutes) * time.Minute, secret
+}
+
+func (m Model) Init() tea.Cmd {
+	// The file picker reads its directory when it is opened, not here
+	cmds := []tea.Cmd{waitForNetwork(m.networkChan)}
+	if m.ticking {
+		cmds = append(cmds, tickCmd())
+	}
+	return tea.Batch(cmds...)
+}
+
+// tickCmd refreshes the clock/uptime in the title once a second
+func tickCmd() tea.Cmd {
+	return tea.Every(time.Second, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+// waitForNetwork is the next message from StartNetwork, a netMsg
+func waitForNetwork(ch chan tea.Msg) tea.Cmd {
+	return func() tea.Msg { return <-ch }
+}
+
+// Update wraps update to keep the terminal window title in sync with the
+// active peer and unread count
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	nm := next.(Model)
+	if title := nm.windowTitle(); title != nm.termTitle {
+		nm.termTitle = title
+		cmd = tea.Batch(cmd, tea.SetWindowTitle(title))
+	}
+	return nm, cmd
+}
+
+// saveUIState writes m.uiState to state.toml, logging a failure: losing a
+// remembered choice isn't worth a banner
+func (m Model) saveUIState() {
+	if err := store.SaveUIState(m.statePath, m.uiState); err != nil {
+		debugLog("Saving %s: %v", m.statePath, err)
+	}
+}
+
+// windowTitle is e.g. "lan-chat — Alice (2 unread)", or "lan-chat [work]
+// — Alice" in a profile
+func (m Model) windowTitle() string {
+	title := "lan-chat"
+	if platform.Profile != "" {
+		title += " [" + platform.Profile + "]"
+	}
+	if m.state == 3 && m.selectedName != "" {
+		title += " \u2014 " + chatName(m.selectedName)
+	}
+	total := 0
+	for _, n := range m.unread {
+		total += n
+	}
+	if total > 0 {
+		title += " (" + tr("title.unread", total) + ")"
+	}
+	return title
+}
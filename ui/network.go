@@ -0,0 +1,319 @@
+package ui
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"lan-chat/internal/bus"
+	"lan-chat/internal/crash"
+	"lan-chat/internal/node"
+	"lan-chat/internal/protocol"
+)
+
+// maxPending bounds the network messages waiting for the model. Past it
+// the oldest are dropped: the model is stuck rather than busy by then, and
+// chats are in the history already.
+const maxPending = 4096
+
+// StartNetwork starts the node (discovery, the heartbeat and the TCP
+// server). The returned channel carries its events to the model (see New).
+func StartNetwork(n *node.Node) chan tea.Msg {
+	netChan := make(chan tea.Msg)
+	n.Logf = debugLog
+	n.Start()
+	go forward(n.Events(), netChan)
+	return netChan
+}
+
+// FollowNetwork is StartNetwork for a node something else starts and logs
+// for, the daemon: the model gets a copy of its events. Call it before
+// the node starts, so the model hears the listeners come up.
+func FollowNetwork(n *node.Node) chan tea.Msg {
+	netChan := make(chan tea.Msg)
+	// forward never waits on the model, so the node never waits on it
+	go forward(n.Subscribe(node.DefaultBuffer, bus.Block).Events(), netChan)
+	return netChan
+}
+
+// forward turns node events into model messages and queues them for out,
+// so the node never waits on the model: while it draws or handles a
+// message, the listeners keep accepting. Whatever queued up meanwhile goes
+// to the model as one netMsg, so a burst (fifty peers answering at start)
+// is one Update rather than fifty.
+func forward(events <-chan node.Event, out chan<- tea.Msg) {
+	defer crash.Recover("network events")
+	var queue []tea.Msg
+	dropped := 0
+	for events != nil || len(queue) > 0 {
+		var send chan<- tea.Msg
+		if len(queue) > 0 {
+			send = out
+		}
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			for _, msg := range netMsgs(ev) {
+				queue = enqueue(queue, msg)
+			}
+			if over := len(queue) - maxPending; over > 0 {
+				queue, dropped = queue[over:], dropped+over
+			}
+		case send <- netMsg(queue):
+			queue = nil
+			if dropped > 0 {
+				errorLog("The UI fell behind the network: dropped %d events", dropped)
+				dropped = 0
+			}
+		}
+	}
+}
+
+// enqueue appends msg to the queue, replacing a waiting health change,
+// latency or progress of the same peer: only the latest one matters
+func enqueue(queue []tea.Msg, msg tea.Msg) []tea.Msg {
+	switch msg := msg.(type) {
+	case peerHealthMsg:
+		queue = slices.DeleteFunc(queue, func(q tea.Msg) bool {
+			old, ok := q.(peerHealthMsg)
+			return ok && old.ip == msg.ip
+		})
+	case peerLatencyMsg:
+		queue = slices.DeleteFunc(queue, func(q tea.Msg) bool {
+			old, ok := q.(peerLatencyMsg)
+			return ok && old.ip == msg.ip
+		})
+	case progressMsg:
+		queue = slices.DeleteFunc(queue, func(q tea.Msg) bool {
+			old, ok := q.(progressMsg)
+			return ok && old.ip == msg.ip && old.name == msg.name
+		})
+	}
+	return append(queue, msg)
+}
+
+// netMsgs turns a node event into model messages
+func netMsgs(ev node.Event) []tea.Msg {
+	switch ev := ev.(type) {
+	case node.ListenerUp:
+		msgs := []tea.Msg{listenerMsg{proto: ev.Proto, up: ev.Err == nil}}
+		if ev.Err != nil {
+			msgs = append(msgs, errorMsg{
+				title:  tr("err." + strings.ToLower(ev.Proto) + "_listen.title"),
+				detail: tr("err.listen.detail", ev.Proto, ev.Port, ev.Err.Error()),
+				action: tr("err.listen.action", ev.Port),
+			})
+		}
+		return msgs
+	case node.PeerFound:
+		return []tea.Msg{peerUpdateMsg{name: ev.Peer.Name, ip: ev.Peer.IP, lastMsg: tr("peer.connected"), found: true}}
+	case node.PeerLost:
+		return []tea.Msg{peerOfflineMsg{ip: ev.Peer.IP, lastSeen: ev.LastSeen}}
+	case node.PeerVerified:
+		return []tea.Msg{peerVerifiedMsg{ip: ev.IP, secure: ev.Secure}}
+	case node.PeerIdentified:
+		msgs := []tea.Msg{peerKeyMsg{ip: ev.IP, changed: ev.Changed}}
+		if ev.Changed {
+			msgs = append(msgs, errorMsg{
+				title:  tr("err.key_changed.title", ev.Name),
+				detail: tr("err.key_changed.detail", ev.IP, ev.Pinned, ev.Key),
+				action: tr("err.key_changed.action", ev.Name),
+			})
+		}
+		return msgs
+	case node.PeerTagged:
+		return []tea.Msg{peerTagsMsg{name: ev.Name, tags: ev.Tags}}
+	case node.PeerHealth:
+		return []tea.Msg{peerHealthMsg{ip: ev.IP, reachable: ev.Reachable}}
+	case node.PeerLatency:
+		return []tea.Msg{peerLatencyMsg{ip: ev.IP, rtt: ev.RTT}}
+	case node.ChatReceived:
+		return chatMsgs(ev.Chat)
+	case node.FileReceived:
+		return []tea.Msg{
+			receiveMsg{ip: ev.From, name: ev.Name, done: true},
+			fileReceivedMsg{name: ev.Name, path: ev.Path, ip: ev.From, encrypted: ev.Encrypted},
+		}
+	case node.TransferProgress:
+		if ev.Done {
+			// The send's own result ends it
+			return nil
+		}
+		return []tea.Msg{progressMsg{ip: ev.IP, name: ev.Name, sent: ev.Sent, total: ev.Total}}
+	case node.ReceiveProgress:
+		return []tea.Msg{receiveMsg{ip: ev.IP, name: ev.Name, received: ev.Received, total: ev.Total}}
+	case node.FileOffered:
+		return []tea.Msg{fileOfferMsg{id: ev.ID, offer: ev.Offer, exists: ev.Exists}}
+	case node.OfferExpired:
+		return []tea.Msg{offerExpiredMsg{id: ev.ID}}
+	case node.ServerError:
+		var msgs []tea.Msg
+		if fe := (*protocol.FileError)(nil); errors.As(ev.Err, &fe) {
+			msgs = append(msgs, receiveMsg{ip: fe.From, name: fe.Name, done: true})
+		}
+		if msg := serverErrorMsg(ev.Err); msg != nil {
+			msgs = append(msgs, msg)
+		}
+		return msgs
+	}
+	return nil
+}
+
+func chatMsgs(c protocol.Chat) []tea.Msg {
+	switch {
+	case errors.Is(c.Err, protocol.ErrNoPassword):
+		return []tea.Msg{chatMsg{sender: c.Sender, ip: c.From, at: c.Time, content: "[" + tr("chat.no_password") + "]", group: c.Group}}
+	case c.Err != nil:
+		return []tea.Msg{
+			chatMsg{sender: c.Sender, ip: c.From, at: c.Time, content: "[" + tr("chat.decrypt_failed") + "]", group: c.Group},
+			errorMsg{
+				title:  tr("err.decrypt_chat.title", c.Sender),
+				detail: c.Err.Error(),
+				action: tr("err.decrypt_chat.action", c.Sender),
+			},
+		}
+	}
+	return []tea.Msg{chatMsg{sender: c.Sender, ip: c.From, at: c.Time, content: c.Text, group: c.Group}}
+}
+
+func serverErrorMsg(err error) tea.Msg {
+	var fe *protocol.FileError
+	switch {
+	case errors.As(err, &fe) && errors.Is(fe.Err, protocol.ErrNoPassword):
+		return errorMsg{
+			title:  tr("err.no_password_file.title", fe.Name),
+			detail: tr("err.no_password_file.detail"),
+			action: tr("err.no_password_file.action"),
+		}
+	case fe != nil && errors.Is(fe.Err, protocol.ErrIncomplete):
+		return errorMsg{
+			title:  tr("err.receive_file.title", fe.Name),
+			detail: fe.Err.Error(),
+			action: tr("err.receive_file.action"),
+		}
+	case fe != nil:
+		return errorMsg{
+			title:  tr("err.decrypt_file.title", fe.Name),
+			detail: fe.Err.Error(),
+			action: tr("err.decrypt_file.action"),
+		}
+	}
+	errorLog("Server: %v", err)
+	return nil
+}
+
+// sendPassword is the password to encrypt with for the peer at ip, or ""
+// to send in the clear because the peer isn't verified
+func (m Model) sendPassword(ip string) string {
+	if m.password != "" && m.securePeers[ip] {
+		return m.password
+	}
+	return ""
+}
+
+func (m Model) sendChatCmd(text string) tea.Cmd {
+	return m.sendChatTo(m.selectedIP, m.selectedName, text)
+}
+
+func (m Model) sendChatTo(ip, peer, text string) tea.Cmd {
+	password := m.sendPassword(ip)
+	return func() tea.Msg {
+		if password != "" {
+			debugLog("Sending encrypted chat to %s", ip)
+		} else {
+			debugLog("Sending plaintext chat to %s", ip)
+		}
+		err := m.node.SendChat(ip, text)
+		var opErr *protocol.OpError
+		if !errors.As(err, &opErr) {
+			return nil
+		}
+		if opErr.Op == "encrypt" {
+			debugLog("Chat encryption error: %v", opErr.Err)
+			return errorMsg{
+				title:  tr("err.encrypt_chat.title"),
+				detail: opErr.Err.Error(),
+				action: tr("err.restart.action"),
+			}
+		}
+		return errorMsg{
+			title:  tr("err.send_chat.title", peer),
+			detail: opErr.Err.Error(),
+			action: tr("err.send_chat.action"),
+		}
+	}
+}
+
+func (m Model) sendFileCmd(path string) tea.Cmd {
+	return m.sendFileTo(m.selectedIP, m.selectedName, path)
+}
+
+func (m Model) sendFileTo(ip, peer, path string) tea.Cmd {
+	password := m.sendPassword(ip)
+	return func() tea.Msg {
+		name := filepath.Base(path)
+		if password != "" {
+			debugLog("Sending encrypted file %s to %s", name, ip)
+		} else {
+			debugLog("Sending plaintext file %s to %s", name, ip)
+		}
+		// Through the node, whose TransferProgress events move the bar
+		err := m.node.SendFile(ip, path)
+		var opErr *protocol.OpError
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) && !errors.As(err, &opErr) {
+			key := "err.open_file"
+			if pathErr.Op == "stat" {
+				key = "err.stat_file"
+			}
+			return errorMsg{
+				title:  tr(key + ".title"),
+				detail: err.Error(),
+				action: tr(key + ".action"),
+			}
+		}
+		if errors.Is(err, protocol.ErrRefused) {
+			return errorMsg{
+				title:  tr("err.refused.title", peer, name),
+				detail: err.Error(),
+				action: tr("err.refused.action", peer),
+			}
+		}
+		if !errors.As(err, &opErr) {
+			return transferStatusMsg(tr("status.sent", name))
+		}
+		switch opErr.Op {
+		case "dial":
+			return errorMsg{
+				title:  tr("err.send_file.title", name, peer),
+				detail: opErr.Err.Error(),
+				action: tr("err.send_file.action"),
+			}
+		case "read":
+			return errorMsg{
+				title:  tr("err.read_file.title", name),
+				detail: opErr.Err.Error(),
+				action: tr("err.read_file.action"),
+			}
+		case "encrypt":
+			return errorMsg{
+				title:  tr("err.encrypt_file.title", name),
+				detail: opErr.Err.Error(),
+				action: tr("err.restart.action"),
+			}
+		default:
+			return errorMsg{
+				title:  tr("err.transfer.title", name),
+				detail: opErr.Err.Error(),
+				action: tr("err.transfer.action"),
+			}
+		}
+	}
+}
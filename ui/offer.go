@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"github.com/charmbracelet/lipgloss"
+
+	"lan-chat/internal/node"
+	"lan-chat/internal/protocol"
+)
+
+// offerHeight is the rows the file offer box takes, like the banner
+const offerHeight = 5
+
+// offerKeys answer the oldest offer from any view; ctrl+o only when its
+// name is taken
+var offerKeys = map[string]node.Answer{
+	"ctrl+y": node.Accept,
+	"ctrl+o": node.Replace,
+	"ctrl+n": node.Decline,
+}
+
+// nameAt is the name of the discovered peer at ip, or ip itself
+func (m Model) nameAt(ip string) string {
+	for _, p := range m.peers() {
+		if p.desc == ip {
+			return p.title
+		}
+	}
+	return ip
+}
+
+// answerOffer gives the oldest file waiting for an answer a; there is
+// nothing to replace unless its name is taken
+func (m *Model) answerOffer(a node.Answer) {
+	o := m.offers[0]
+	if a == node.Replace && !o.exists {
+		return
+	}
+	m.offers = m.offers[1:]
+	if !m.node.AnswerOffer(o.id, a) {
+		debugLog("Offer of %s from %s was no longer waiting", o.offer.Name, o.offer.From)
+	}
+	m.resizeComponents(m.width, m.height)
+}
+
+// dropOffer forgets an offer the node stopped waiting for
+func (m *Model) dropOffer(id int) {
+	for i, o := range m.offers {
+		if o.id == id {
+			m.offers = append(m.offers[:i:i], m.offers[i+1:]...)
+			m.resizeComponents(m.width, m.height)
+			return
+		}
+	}
+}
+
+// offerTitle is who offers what, for the box and the alert
+func (m Model) offerTitle(o protocol.Offer) string {
+	size := tr("offer.unknown_size")
+	if o.Size >= 0 {
+		size = formatBytes(o.Size)
+	}
+	return tr("offer.title", m.nameAt(o.From), o.Name, size)
+}
+
+// renderOffer is the box asking about the oldest file waiting for an
+// answer, above whatever view is active
+func (m Model) renderOffer() string {
+	o, exists := m.offers[0].offer, m.offers[0].exists
+	accent := colors.accent
+	style := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(accent).
+		Padding(0, 1).
+		Width(m.width - 2).
+		MaxHeight(offerHeight)
+	clip := lipgloss.NewStyle().MaxWidth(m.width - 4)
+	muted := lipgloss.NewStyle().Foreground(colors.muted)
+	title := lipgloss.NewStyle().Bold(true).Foreground(accent).Render("⇩ " + m.offerTitle(o))
+	hash := tr("offer.no_hash")
+	if o.Hash != "" {
+		hash = "SHA-256 " + o.Hash
+	}
+	keys := "(ctrl+y) " + tr("offer.accept") + "  (ctrl+n) " + tr("offer.decline")
+	if exists {
+		hash = tr("offer.exists", "received_"+o.Name) + " · " + hash
+		keys = "(ctrl+y) " + tr("offer.keep_both") + "  (ctrl+o) " + tr("offer.replace") + "  (ctrl+n) " + tr("offer.decline")
+	}
+	if more := len(m.offers) - 1; more > 0 {
+		keys += "  " + tr("receive.more", more)
+	}
+	return style.Render(lipgloss.JoinVertical(lipgloss.Left,
+		clip.Render(title),
+		clip.Render(muted.Render(hash)),
+		clip.Render(keys),
+	))
+}
@@ -0,0 +1,229 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/sahilm/fuzzy"
+)
+
+// paletteAction is one entry in the ctrl+p command palette
+type paletteAction struct {
+	label string
+	run   func(m *Model) tea.Cmd
+}
+
+// paletteActions lists every action available from the palette, including
+// per-peer actions for each peer currently in the list.
+func (m Model) paletteActions() []paletteAction {
+	actions := []paletteAction{
+		{tr("palette.open_chat", tr("group.everyone")), func(m *Model) tea.Cmd { return m.openGroup() }},
+	}
+	for _, p := range m.peers() {
+		previewKey := "palette.hide_preview"
+		if m.previewsHidden(p.title) {
+			previewKey = "palette.show_preview"
+		}
+		actions = append(actions,
+			paletteAction{tr("palette.open_chat", p.title), func(m *Model) tea.Cmd { return m.openChat(p) }},
+			paletteAction{tr("palette.send_file", p.title), func(m *Model) tea.Cmd { return m.openFilePicker(p) }},
+			paletteAction{tr(previewKey, p.title), func(m *Model) tea.Cmd { return m.togglePreviews(p) }},
+			paletteAction{tr("palette.peer_detail", p.title), func(m *Model) tea.Cmd { m.openPeerDetail(p); return nil }},
+			paletteAction{tr("palette.block", p.title), func(m *Model) tea.Cmd { return m.blockPeer(p) }},
+		)
+		if p.keyChanged {
+			actions = append(actions, paletteAction{tr("palette.trust_key", p.title), func(m *Model) tea.Cmd { return m.trustKey(p) }})
+		}
+	}
+	for _, p := range m.blocked {
+		actions = append(actions, paletteAction{tr("palette.unblock", p.title), func(m *Model) tea.Cmd {
+			m.unblockPeer(p)
+			return m.refreshList()
+		}})
+	}
+	actions = append(actions,
+		paletteAction{tr("palette.export"), func(m *Model) tea.Cmd { return m.exportHistoryCmd() }},
+		paletteAction{tr("palette.clear_history"), func(m *Model) tea.Cmd { m.clearHistory(); return nil }},
+		paletteAction{tr("palette.config"), func(m *Model) tea.Cmd { m.state = 4; return nil }},
+		paletteAction{tr("palette.self"), func(m *Model) tea.Cmd { m.state = 0; m.selfInfo = true; return nil }},
+		paletteAction{tr("palette.dnd"), func(m *Model) tea.Cmd { m.dnd = !m.dnd; return nil }},
+		paletteAction{tr("palette.preview_mode", m.nextPreviewMode()), func(m *Model) tea.Cmd {
+			m.previewMode = m.nextPreviewMode()
+			m.uiState.Previews = m.previewMode
+			m.saveUIState()
+			return m.refreshList()
+		}},
+		paletteAction{tr("palette.debug"), func(m *Model) tea.Cmd { return func() tea.Msg { return configToggleDebugMsg{} } }},
+		paletteAction{tr("palette.logs"), func(m *Model) tea.Cmd { return m.openLogs() }},
+		paletteAction{tr("palette.reload"), func(m *Model) tea.Cmd { return m.reload() }},
+	)
+	if m.lastReceived != "" {
+		actions = append(actions, paletteAction{tr("palette.open_received", filepath.Base(m.lastReceived)), func(m *Model) tea.Cmd {
+			m.openFile(m.lastReceived)
+			return nil
+		}})
+	}
+	if m.session != nil {
+		actions = append(actions,
+			paletteAction{tr("palette.detach"), func(m *Model) tea.Cmd { return m.quitCmd() }},
+			paletteAction{tr("palette.stop_session"), func(m *Model) tea.Cmd { return tea.Quit }},
+		)
+	} else {
+		actions = append(actions, paletteAction{tr("palette.quit"), func(m *Model) tea.Cmd { return tea.Quit }})
+	}
+	if m.banner != nil {
+		actions = append(actions, paletteAction{tr("palette.dismiss"), func(m *Model) tea.Cmd {
+			m.banner = nil
+			m.resizeComponents(m.width, m.height)
+			return nil
+		}})
+	}
+	return actions
+}
+
+// paletteMatches fuzzy-filters the palette actions by the typed query
+func (m Model) paletteMatches() []paletteAction {
+	actions := m.paletteActions()
+	if m.switcher {
+		actions = m.switcherActions()
+	}
+	query := m.palette.Value()
+	if query == "" {
+		return actions
+	}
+	labels := make([]string, len(actions))
+	for i, a := range actions {
+		labels[i] = a.label
+	}
+	var matches []paletteAction
+	for _, match := range fuzzy.Find(query, labels) {
+		matches = append(matches, actions[match.Index])
+	}
+	return matches
+}
+
+// nextPreviewMode is the preview mode the palette action switches to
+func (m Model) nextPreviewMode() string {
+	return cycle(previewModes, m.previewMode)
+}
+
+// switcherActions are the ctrl+k quick-switch targets: every known conversation
+func (m Model) switcherActions() []paletteAction {
+	var actions []paletteAction
+	for _, p := range m.peers() {
+		label := p.title + "  " + p.desc
+		if n := m.unread[p.title]; n > 0 {
+			label += fmt.Sprintf("  (%d)", n)
+		}
+		actions = append(actions, paletteAction{label, func(m *Model) tea.Cmd { return m.openChat(p) }})
+	}
+	return actions
+}
+
+// openPalette opens the ctrl+p command palette, or with switcher set the
+// ctrl+k conversation quick-switcher
+func (m *Model) openPalette(switcher bool) tea.Cmd {
+	m.prevState = m.state
+	m.state = 5
+	m.switcher = switcher
+	m.paletteIdx = 0
+	m.palette.Reset()
+	m.textInput.Blur()
+	return m.palette.Focus()
+}
+
+func (m *Model) closePalette() {
+	m.state = m.prevState
+	m.palette.Blur()
+	if m.state == 3 && (!m.vimKeys || m.vimMode != "normal") {
+		m.textInput.Focus()
+	}
+}
+
+func (m *Model) updatePalette(msg tea.KeyMsg) tea.Cmd {
+	matches := m.paletteMatches()
+	switch msg.String() {
+	case "esc":
+		m.closePalette()
+		return nil
+	case "up", "ctrl+p":
+		if m.paletteIdx > 0 {
+			m.paletteIdx--
+		}
+		return nil
+	case "down", "ctrl+n":
+		if m.paletteIdx < len(matches)-1 {
+			m.paletteIdx++
+		}
+		return nil
+	case "enter":
+		if m.paletteIdx >= len(matches) {
+			return nil
+		}
+		m.closePalette()
+		return matches[m.paletteIdx].run(m)
+	}
+	var cmd tea.Cmd
+	m.palette, cmd = m.palette.Update(msg)
+	m.paletteIdx = 0
+	return cmd
+}
+
+// viewSwitcher draws the quick-switcher as a box over the view it was opened from
+func (m Model) viewSwitcher() string {
+	base := m
+	base.state = m.prevState
+	behind := base.viewState()
+
+	boxWidth := m.width / 2
+	if boxWidth < 40 {
+		boxWidth = min(40, m.width-2)
+	}
+	matches := m.paletteMatches()
+	rows := []string{lipgloss.NewStyle().Bold(true).Render(tr("switcher.title")), m.palette.View(), ""}
+	selected := lipgloss.NewStyle().Reverse(true)
+	for i := 0; i < len(matches) && i < 8; i++ {
+		label := ansi.Truncate(" "+matches[i].label+" ", boxWidth-4, "\u2026")
+		if i == m.paletteIdx {
+			label = selected.Render(label)
+		}
+		rows = append(rows, label)
+	}
+	if len(matches) == 0 {
+		rows = append(rows, lipgloss.NewStyle().Foreground(colors.muted).Render(" "+tr("palette.no_matches")))
+	}
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(colors.accent).
+		Padding(0, 1).
+		Width(boxWidth - 2).
+		Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+	return overlay(behind, box, m.width, m.height)
+}
+
+// overlay draws box centered on top of base, keeping the base visible around it
+func overlay(base, box string, width, height int) string {
+	baseLines := strings.Split(base, "\n")
+	for len(baseLines) < height {
+		baseLines = append(baseLines, "")
+	}
+	boxLines := strings.Split(box, "\n")
+	boxWidth := lipgloss.Width(box)
+	x := max((width-boxWidth)/2, 0)
+	y := max((height-len(boxLines))/2, 0)
+	for i, line := range boxLines {
+		if y+i >= len(baseLines) {
+			break
+		}
+		under := baseLines[y+i]
+		left := ansi.Truncate(under, x, "")
+		left += strings.Repeat(" ", x-lipgloss.Width(left))
+		right := ansi.TruncateLeft(under, x+boxWidth, "")
+		baseLines[y+i] = left + line + right
+	}
+	return strings.Join(baseLines, "\n")
+}
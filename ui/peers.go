@@ -0,0 +1,258 @@
+package ui
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"lan-chat/internal/store"
+)
+
+// peers returns every known peer, including ones hidden by quick filters
+func (m Model) peers() []item {
+	return m.roster
+}
+
+// updatePeer applies fn to the peer with the given IP, reporting whether it exists
+func (m *Model) updatePeer(ip string, fn func(p *item)) bool {
+	for i := range m.roster {
+		if m.roster[i].desc == ip {
+			fn(&m.roster[i])
+			m.refreshList()
+			return true
+		}
+	}
+	return false
+}
+
+// knownItems are the peers from the roster, offline until discovery finds
+// them again, most recently seen first
+func knownItems(known []store.KnownPeer) []item {
+	slices.SortStableFunc(known, func(a, b store.KnownPeer) int { return b.LastSeen.Compare(a.LastSeen) })
+	var items []item
+	for _, k := range known {
+		if len(k.IPs) == 0 {
+			continue
+		}
+		items = append(items, item{
+			title:   k.Name,
+			desc:    k.IPs[len(k.IPs)-1],
+			lastMsg: tr("peer.last_seen", k.LastSeen.Local().Format("2006-01-02 15:04")),
+			tags:    k.Tags,
+			offline: true,
+		})
+	}
+	return items
+}
+
+// knownTags are the roster tags of the peer called name
+func (m Model) knownTags(name string) []string {
+	for _, k := range m.node.Known() {
+		if strings.EqualFold(k.Name, name) {
+			return k.Tags
+		}
+	}
+	return nil
+}
+
+// forgetOldAddresses drops the offline entries for a known peer that
+// discovery just found at a different address
+func (m *Model) forgetOldAddresses(name, ip string) {
+	m.roster = slices.DeleteFunc(m.roster, func(p item) bool {
+		return p.title == name && p.desc != ip && !p.reachable
+	})
+}
+
+// trustKey pins the identity key p holds now, after it changed
+func (m *Model) trustKey(p item) tea.Cmd {
+	if err := m.node.TrustKey(p.desc); err != nil {
+		m.banner = &errorMsg{title: tr("err.trust_key.title", p.title), detail: err.Error(), action: tr("err.trust_key.action")}
+		m.resizeComponents(m.width, m.height)
+		return nil
+	}
+	m.updatePeer(p.desc, func(p *item) { p.keyChanged = false })
+	return nil
+}
+
+// Quick filters and sort orders for the peer list, cycled from the keyboard
+var (
+	quickFilters = []string{"all", "online", "unread", "verified"}
+	sortModes    = []string{"recent", "name", "unread", "latency"}
+	previewModes = []string{"full", "placeholder", "hidden"}
+)
+
+// visiblePeers applies the quick filter and sort order to the roster
+func (m Model) visiblePeers() []item {
+	var peers []item
+	for _, p := range m.roster {
+		switch m.quickFilter {
+		case "online":
+			if !p.reachable {
+				continue
+			}
+		case "unread":
+			if m.unread[p.title] == 0 {
+				continue
+			}
+		case "verified":
+			if !p.secure {
+				continue
+			}
+		}
+		p.preview, p.unread = m.previewFor(p), m.unread[p.title]
+		if m.showLatency && p.reachable && p.rtt > 0 {
+			p.latency = formatRTT(p.rtt)
+		}
+		peers = append(peers, p)
+	}
+	switch m.sortMode {
+	case "name":
+		sort.SliceStable(peers, func(i, j int) bool {
+			return strings.ToLower(peers[i].title) < strings.ToLower(peers[j].title)
+		})
+	case "unread":
+		sort.SliceStable(peers, func(i, j int) bool { return m.unread[peers[i].title] > m.unread[peers[j].title] })
+	case "latency":
+		// Fastest first; unreachable and not yet measured peers last
+		rtt := func(p item) time.Duration {
+			if !p.reachable || p.rtt == 0 {
+				return time.Duration(math.MaxInt64)
+			}
+			return p.rtt
+		}
+		sort.SliceStable(peers, func(i, j int) bool { return rtt(peers[i]) < rtt(peers[j]) })
+	}
+	return peers
+}
+
+// previewFor applies the preview settings to a peer's last message. Status
+// lines like "Connected" are always shown; chat content can be shortened,
+// replaced by a placeholder, or hidden for shared screens. A peer's own
+// previews setting wins over the global ones.
+func (m Model) previewFor(p item) string {
+	if !p.message {
+		return p.lastMsg
+	}
+	switch {
+	case m.previewsHidden(p.title):
+		return ""
+	case m.previewMode == "placeholder" && m.prefsFor(p.title).Previews != "show":
+		return tr("preview.placeholder")
+	}
+	text := strings.Join(strings.Fields(p.lastMsg), " ")
+	if r := []rune(text); m.previewLen > 0 && len(r) > m.previewLen {
+		text = string(r[:m.previewLen]) + "\u2026"
+	}
+	return text
+}
+
+// refreshList rebuilds the list from the roster, below the Everyone entry.
+// On password-protected networks peers are split into "Encrypted" and
+// "Unverified" sections. The selected peer stays selected.
+func (m *Model) refreshList() tea.Cmd {
+	selectedIP, group := "", false
+	switch p := m.list.SelectedItem().(type) {
+	case item:
+		selectedIP = p.desc
+	case groupItem:
+		group = true
+	}
+
+	items := []list.Item{m.groupEntry()}
+	if m.password == "" {
+		for _, p := range m.visiblePeers() {
+			items = append(items, p)
+		}
+	} else {
+		var secure, unverified []list.Item
+		for _, p := range m.visiblePeers() {
+			if p.secure {
+				secure = append(secure, p)
+			} else {
+				unverified = append(unverified, p)
+			}
+		}
+		if len(secure) > 0 {
+			items = append(items, sectionHeader{tr("section.encrypted"), len(secure)})
+			items = append(items, secure...)
+		}
+		if len(unverified) > 0 {
+			items = append(items, sectionHeader{tr("section.unverified"), len(unverified)})
+			items = append(items, unverified...)
+		}
+	}
+	cmd := m.list.SetItems(items)
+
+	selected := -1
+	if group {
+		selected = 0
+	}
+	for i, itm := range items {
+		if p, ok := itm.(item); ok && (selected < 0 || p.desc == selectedIP) {
+			selected = i
+			if p.desc == selectedIP {
+				break
+			}
+		}
+	}
+	if selected >= 0 {
+		m.list.Select(selected)
+	}
+	return cmd
+}
+
+// cycle returns the option after current, wrapping around
+func cycle(options []string, current string) string {
+	for i, o := range options {
+		if o == current {
+			return options[(i+1)%len(options)]
+		}
+	}
+	return options[0]
+}
+
+// listStatus summarizes the active quick filter and sort order for the
+// footer, with an available update and the chat waiting to be reopened
+func (m Model) listStatus() string {
+	var parts []string
+	if m.quickFilter != "all" {
+		parts = append(parts, tr("filter."+m.quickFilter))
+	}
+	if m.sortMode != "recent" {
+		parts = append(parts, tr("sort.label", tr("sort."+m.sortMode)))
+	}
+	if m.newVersion != "" {
+		parts = append(parts, tr("update.available", m.newVersion))
+	}
+	if r := m.reopen; r != nil && r.offered {
+		parts = append(parts, tr("reopen.offer", r.peer))
+	}
+	if s := m.receiveStatus(); s != "" {
+		parts = append(parts, s)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, ", ") + "] "
+}
+
+// skipSectionHeader moves the cursor off a header in the direction of travel
+func (m *Model) skipSectionHeader(msg tea.Msg) {
+	if _, ok := m.list.SelectedItem().(sectionHeader); !ok {
+		return
+	}
+	up := false
+	if k, ok := msg.(tea.KeyMsg); ok {
+		up = k.String() == "up" || k.String() == "k"
+	}
+	if up && m.list.Index() > 0 {
+		m.list.CursorUp()
+	} else {
+		m.list.CursorDown()
+	}
+}
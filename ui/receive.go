@@ -0,0 +1,48 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+)
+
+// receive records an incoming file's progress, or forgets it once done
+func (m *Model) receive(msg receiveMsg) {
+	for i, r := range m.receiving {
+		if r.ip == msg.ip && r.name == msg.name {
+			if msg.done {
+				m.receiving = append(m.receiving[:i:i], m.receiving[i+1:]...)
+			} else {
+				msg.started, msg.base = r.started, r.base
+				m.receiving[i] = msg
+			}
+			return
+		}
+	}
+	if !msg.done {
+		msg.started, msg.base = time.Now(), msg.received
+		m.receiving = append(m.receiving, msg)
+	}
+}
+
+// receiveStatus is the oldest incoming file, how much of it is here and
+// how fast it comes, for the peer list footer; "" when nothing is coming in
+func (m Model) receiveStatus() string {
+	if len(m.receiving) == 0 {
+		return ""
+	}
+	r := m.receiving[0]
+	sender := m.nameAt(r.ip)
+	amount := formatBytes(r.received)
+	if r.total > 0 {
+		amount = fmt.Sprintf("%s / %s (%.0f%%)", amount, formatBytes(r.total), float64(r.received)*100/float64(r.total))
+	}
+	// From the first report, which comes with the first bytes read
+	if elapsed := time.Since(r.started).Seconds(); elapsed > 0 && r.received > r.base {
+		amount += fmt.Sprintf(", %s/s", formatBytes(int64(float64(r.received-r.base)/elapsed)))
+	}
+	s := tr("receive.progress", r.name, sender, amount)
+	if more := len(m.receiving) - 1; more > 0 {
+		s += " " + tr("receive.more", more)
+	}
+	return s
+}
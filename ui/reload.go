@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ReloadMsg asks the UI to reread its config file, as the reload key does
+type ReloadMsg struct{}
+
+// ReloadOnSignal sends p a ReloadMsg for every SIGHUP
+func ReloadOnSignal(p *tea.Program) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			p.Send(ReloadMsg{})
+		}
+	}()
+}
+
+// reload rereads the config file and applies it in place: peers, chats and
+// transfers are untouched. A bad file changes nothing and shows why.
+func (m *Model) reload() tea.Cmd {
+	prev := catalog // LoadConfig switches the locale before it validates
+	cfg, err := LoadConfig(m.configPath)
+	if err == nil && m.onReload != nil {
+		err = m.onReload()
+	}
+	if err != nil {
+		catalog = prev
+		errorLog("Reloading %s: %v", m.configPath, err)
+		m.banner = &errorMsg{title: tr("err.reload.title"), detail: err.Error(), action: tr("err.reload.action")}
+		m.resizeComponents(m.width, m.height)
+		return nil
+	}
+	debugLog("Reloaded %s", m.configPath)
+
+	m.templates = cfg.templates
+	m.showClock, m.showUptime, m.showConv = cfg.showClock, cfg.showUptime, cfg.showConversation
+	m.showAddress, m.showLatency = cfg.showAddress, cfg.showLatency
+	m.previewLen, m.hidePreviews = cfg.previewLength, cfg.hidePreviews
+	// A choice made in the UI stays until the file's own value is edited
+	remembered := m.uiState
+	if cfg.filePreviews != m.filePreviews {
+		m.previewMode, m.filePreviews, m.uiState.Previews = cfg.filePreviews, cfg.filePreviews, ""
+	}
+	m.thumbnails = cfg.imageThumbnails
+	m.showHints = cfg.showHints && !m.uiState.HintsDismissed && m.uiState.Sessions <= hintSessions
+	m.alert, m.desktop = cfg.alert, cfg.desktopNotify
+	m.reopenMode = cfg.reopenChat
+	m.layout = cfg.layout
+	if cfg.fileTheme != m.fileTheme {
+		m.themeMode, m.fileTheme, m.uiState.Theme = cfg.fileTheme, cfg.fileTheme, ""
+		setTheme(m.themeMode)
+	}
+	if m.uiState != remembered {
+		m.saveUIState()
+	}
+	m.progress = cfg.theme.newProgress()
+	m.fixedBar = cfg.theme.progressWidth > 0
+	m.idleLock, m.unlockSecret = cfg.idleLock(m.password)
+	if m.state == 6 && m.unlockSecret == "" {
+		// Nothing could unlock it any more
+		m.state = m.lockedState
+	}
+	m.lastStatus = tr("status.reloaded")
+	m.resizeComponents(m.width, m.height)
+
+	cmds := []tea.Cmd{m.refreshList()}
+	if !m.ticking && (m.showClock || m.showUptime || m.idleLock > 0) {
+		m.ticking = true
+		cmds = append(cmds, tickCmd())
+	}
+	return tea.Batch(cmds...)
+}
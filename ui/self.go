@@ -0,0 +1,108 @@
+package ui
+
+import (
+	"crypto/ed25519"
+	"net"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"lan-chat/internal/crypto"
+	"lan-chat/internal/discovery"
+	"lan-chat/internal/protocol"
+)
+
+// ownAddress is where colleagues can reach us: the first LAN IP and chat port
+func (m Model) ownAddress() string {
+	if len(m.localAddrs) == 0 {
+		return tr("self.no_address")
+	}
+	return net.JoinHostPort(m.localAddrs[0], protocol.Port)
+}
+
+// listenerStatus describes one listener for the "me" overlay
+func (m Model) listenerStatus(proto string) string {
+	up, known := m.listeners[proto]
+	switch {
+	case !known:
+		return tr("self.starting")
+	case up:
+		return tr("self.up")
+	default:
+		return tr("self.down")
+	}
+}
+
+// discoveryStatus is a compact marker for the title line
+func (m Model) discoveryStatus() string {
+	up, known := m.listeners["UDP"]
+	switch {
+	case !known:
+		return lipgloss.NewStyle().Foreground(colors.muted).Render("\u25cb")
+	case up:
+		return lipgloss.NewStyle().Foreground(colors.success).Render("\u25cf")
+	default:
+		return lipgloss.NewStyle().Foreground(colors.danger).Render("\u25cf")
+	}
+}
+
+// viewSelf draws the "me" detail box over the list: every address and listener
+func (m Model) viewSelf(behind string) string {
+	label := lipgloss.NewStyle().Foreground(colors.muted).Width(16)
+	rows := []string{
+		lipgloss.NewStyle().Bold(true).Render(tr("self.title")),
+		"",
+		label.Render(tr("self.name")) + m.userName,
+	}
+	if len(m.localAddrs) == 0 {
+		rows = append(rows, label.Render(tr("self.addresses"))+tr("self.no_address"))
+	}
+	for i, ip := range m.localAddrs {
+		name := ""
+		if i == 0 {
+			name = tr("self.addresses")
+		}
+		rows = append(rows, label.Render(name)+ip)
+	}
+	rows = append(rows,
+		label.Render(tr("self.chat"))+"TCP "+protocol.Port+" "+m.listenerStatus("TCP"),
+		label.Render(tr("self.discovery"))+"UDP "+discovery.Port+" "+m.listenerStatus("UDP"),
+	)
+	// What peers see as this machine's key in their detail view; the
+	// password's fingerprint would let anyone who sees the screen test
+	// guesses offline
+	if m.node != nil && m.node.Identity != nil {
+		rows = append(rows, label.Render(tr("self.key"))+crypto.KeyFingerprint(m.node.Identity.Public().(ed25519.PublicKey)))
+	}
+	rows = append(rows, "", lipgloss.NewStyle().Foreground(colors.muted).Render(tr("self.close")))
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(colors.accent).
+		Padding(0, 1).
+		Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+	return overlay(behind, box, m.width, m.height)
+}
+
+// localIPs lists the IPv4 addresses of every interface that is up, skipping
+// loopback, so the user can tell a colleague where to find them
+func localIPs() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var ips []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				ips = append(ips, ipnet.IP.String())
+			}
+		}
+	}
+	return ips
+}
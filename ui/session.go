@@ -0,0 +1,281 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+	"github.com/muesli/termenv"
+
+	"lan-chat/internal/control"
+	"lan-chat/internal/platform"
+)
+
+// ResetWindowTitle clears the OSC window title set while running
+const ResetWindowTitle = "\x1b]2;\x07"
+
+// Session multiplexes one long-running tea.Program onto whichever attach
+// client is currently connected, on the session socket of --serve-session
+// or the daemon's control socket. While no client is attached, input
+// blocks and output is discarded, but the model keeps processing network
+// events.
+type Session struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	conn    net.Conn
+	program *tea.Program
+}
+
+// NewSession sets m up to run without a terminal of its own; Run it, and
+// hand it the connections of attach clients with Handle
+func NewSession(m Model) *Session {
+	s := &Session{}
+	s.cond = sync.NewCond(&s.mu)
+	m.session = s
+	// stdout is not a terminal here, so pick colors for the attached one
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	s.program = tea.NewProgram(m, tea.WithInput(s), tea.WithOutput(s), tea.WithReportFocus())
+	return s
+}
+
+// Run runs the TUI until the user stops it from the command palette.
+// SIGHUP reloads the config, so closing the terminal that started it
+// doesn't take it down either.
+func (s *Session) Run() error {
+	ReloadOnSignal(s.program)
+	_, err := s.program.Run()
+	return err
+}
+
+func SessionSocketPath(name string) string {
+	return filepath.Join(platform.RuntimeDir(), "lan-chat-"+name+".sock")
+}
+
+func (s *Session) Read(p []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		for s.conn == nil {
+			s.cond.Wait()
+		}
+		c := s.conn
+		s.mu.Unlock()
+
+		n, err := c.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil {
+			s.drop(c)
+		}
+	}
+}
+
+func (s *Session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	c := s.conn
+	s.mu.Unlock()
+	if c != nil {
+		if _, err := c.Write(p); err != nil {
+			s.drop(c)
+		}
+	}
+	return len(p), nil
+}
+
+// attach makes c the active client, kicking off any previous one
+func (s *Session) attach(c net.Conn) {
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = c
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *Session) drop(c net.Conn) {
+	s.mu.Lock()
+	if s.conn == c {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.mu.Unlock()
+}
+
+func (s *Session) detachCmd() tea.Cmd {
+	return func() tea.Msg {
+		s.mu.Lock()
+		c := s.conn
+		s.mu.Unlock()
+		if c != nil {
+			debugLog("Session client detached")
+			s.drop(c)
+		}
+		return nil
+	}
+}
+
+// serve accepts attach clients on the session socket
+func (s *Session) serve(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		header, err := readLine(c)
+		if err != nil {
+			c.Close()
+			continue
+		}
+		s.Handle(c, header)
+	}
+}
+
+// Handle takes over a client's connection after its first line, header:
+// "ATTACH <w> <h>" (followed by raw terminal input) or "RESIZE <w> <h>".
+// Anything else is closed.
+func (s *Session) Handle(c net.Conn, header string) {
+	var cmd string
+	var w, h int
+	if _, err := fmt.Sscanf(header, "%s %d %d", &cmd, &w, &h); err != nil {
+		c.Close()
+		return
+	}
+	switch cmd {
+	case "ATTACH":
+		debugLog("Session client attached (%dx%d)", w, h)
+		s.attach(c)
+		s.program.Send(tea.WindowSizeMsg{Width: w, Height: h})
+		s.program.Send(tea.ClearScreen())
+	case "RESIZE":
+		s.program.Send(tea.WindowSizeMsg{Width: w, Height: h})
+		c.Close()
+	default:
+		c.Close()
+	}
+}
+
+// readLine reads up to '\n' one byte at a time so no terminal input that
+// follows the header is consumed.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := r.Read(b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+		line = append(line, b[0])
+	}
+}
+
+// RunSession runs the TUI headless behind the session socket until the user
+// stops the session from the command palette. The socket drives the TUI
+// and the node, so it is opened like the control socket: mode 0600, and
+// not taken from a session that still answers on it.
+func RunSession(path string, m Model) error {
+	ln, err := control.Listen(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	defer ln.Close()
+
+	s := NewSession(m)
+	go s.serve(ln)
+	return s.Run()
+}
+
+// StartSession launches a background copy of this binary serving the session
+// socket, and waits for the socket to come up.
+func StartSession(path string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{"--serve-session"}
+	for _, a := range os.Args[1:] {
+		if a == "--detach" || a == "-detach" || strings.HasPrefix(a, "--detach=") || strings.HasPrefix(a, "-detach=") {
+			continue
+		}
+		args = append(args, a)
+	}
+	cmd := exec.Command(exe, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	for i := 0; i < 30; i++ {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("background session did not start (see debug.log with --debug)")
+}
+
+// AttachSession connects this terminal to a running background session, or
+// to the TUI of `lan-chat daemon` on its control socket, and relays raw
+// input and rendered output until the user detaches. A control socket
+// without a TUI behind it is an error, before the terminal is touched.
+func AttachSession(path string) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	w, h, err := term.GetSize(os.Stdout.Fd())
+	if err != nil {
+		w, h = 80, 24
+	}
+	fmt.Fprintf(conn, "ATTACH %d %d\n", w, h)
+	out := bufio.NewReader(conn)
+	if reply, err := out.Peek(4); err != nil {
+		return err
+	} else if string(reply) == "ERR " {
+		line, _ := out.ReadString('\n')
+		return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "ERR ")))
+	}
+
+	state, err := term.MakeRaw(os.Stdin.Fd())
+	if err != nil {
+		return err
+	}
+	defer term.Restore(os.Stdin.Fd(), state)
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l") // alt screen, hide cursor
+	defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l" + ResetWindowTitle)
+
+	go io.Copy(conn, os.Stdin)
+	go func() {
+		// Poll for resizes; SIGWINCH isn't portable
+		for {
+			time.Sleep(500 * time.Millisecond)
+			nw, nh, err := term.GetSize(os.Stdout.Fd())
+			if err != nil || (nw == w && nh == h) {
+				continue
+			}
+			w, h = nw, nh
+			if rc, err := net.Dial("unix", path); err == nil {
+				fmt.Fprintf(rc, "RESIZE %d %d\n", w, h)
+				rc.Close()
+			}
+		}
+	}()
+	io.Copy(os.Stdout, out)
+	return nil
+}
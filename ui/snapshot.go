@@ -0,0 +1,180 @@
+package ui
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"lan-chat/internal/store"
+)
+
+// What a snapshot keeps: the tail of each conversation, and queued sends
+// only while they are recent enough to still make sense
+const (
+	snapshotHistory = 500
+	outboxMaxAge    = 24 * time.Hour
+)
+
+// outgoing is a send in flight, tracked so it can be snapshotted
+type outgoing struct {
+	id int
+	store.Outgoing
+}
+
+// sendDoneMsg wraps what a tracked send command returned
+type sendDoneMsg struct {
+	id     int
+	result tea.Msg
+}
+
+// track records out as in flight until cmd finishes
+func (m *Model) track(out store.Outgoing, cmd tea.Cmd) tea.Cmd {
+	m.nextSendID++
+	id := m.nextSendID
+	m.outbox = append(m.outbox, outgoing{id: id, Outgoing: out})
+	return func() tea.Msg { return sendDoneMsg{id: id, result: cmd()} }
+}
+
+// sendDone drops a finished send from the outbox and handles its result
+func (m Model) sendDone(msg sendDoneMsg) (tea.Model, tea.Cmd) {
+	for i, o := range m.outbox {
+		if o.id == msg.id {
+			m.outbox = append(m.outbox[:i:i], m.outbox[i+1:]...)
+			break
+		}
+	}
+	// A resumed file finishing in the background mustn't pull the user
+	// off the screen they're on
+	if status, ok := msg.result.(transferStatusMsg); ok && m.state != 2 {
+		m.lastStatus = string(status)
+		return m, nil
+	}
+	if msg.result == nil {
+		return m, nil
+	}
+	return m.update(msg.result)
+}
+
+// Snapshot is the state to restore on the next launch
+func (m Model) Snapshot() store.Snapshot {
+	s := store.Snapshot{Saved: time.Now(), Name: m.userName, Unread: m.unread}
+	s.Chats = make(map[string][]string, len(m.chats)+1)
+	for peer, lines := range m.chats {
+		s.Chats[peer] = lines[max(0, len(lines)-snapshotHistory):]
+	}
+	if len(m.chatHistory) > 0 {
+		s.Chats[m.chatPeer] = m.chatHistory[max(0, len(m.chatHistory)-snapshotHistory):]
+	}
+	state := m.state
+	switch state {
+	case 5:
+		state = m.prevState
+	case 6:
+		state = m.lockedState
+	}
+	if state == 3 && !m.inGroup() {
+		// The Everyone chat has no peer to wait for
+		s.Peer, s.IP, s.Draft = m.selectedName, m.selectedIP, m.textInput.Value()
+	} else if r := m.reopen; r != nil {
+		// Never got back to it; still the one to reopen next time
+		s.Peer, s.IP, s.Draft = r.peer, r.ip, r.draft
+	}
+	for _, o := range m.outbox {
+		s.Outbox = append(s.Outbox, o.Outgoing)
+	}
+	s.Outbox = append(s.Outbox, m.resume...)
+	return s
+}
+
+// Restore picks up from s: the conversations and unread counts come back at
+// once, the open conversation and queued sends once their peer is
+// discovered again. It reports false, changing nothing, for another user's
+// snapshot.
+func (m Model) Restore(s store.Snapshot) (Model, bool) {
+	if s.Name != m.userName {
+		return m, false
+	}
+	for peer, lines := range s.Chats {
+		// The snapshot's lines already cover the history before this run
+		m.chats[peer], m.backlogged[peer] = lines, true
+	}
+	for peer, n := range s.Unread {
+		m.unread[peer] = n
+	}
+	if time.Since(s.Saved) < outboxMaxAge {
+		m.resume = s.Outbox
+	} else if len(s.Outbox) > 0 {
+		debugLog("Snapshot from %s is too old, dropping %d queued sends", s.Saved.Format(time.DateTime), len(s.Outbox))
+	}
+	if s.Peer != "" {
+		m.reopen = &reopenChat{peer: s.Peer, ip: s.IP, draft: s.Draft}
+	}
+	return m, true
+}
+
+// reopenChat is the conversation that was open at the last exit. Its draft
+// comes back whenever that chat is opened, however it is opened.
+type reopenChat struct {
+	peer, ip, draft string
+	offered         bool // the peer is selected and the footer offers it
+}
+
+// reopenFor acts on ui.reopen_chat once the peer of the last conversation
+// is discovered again, unless the user has already moved off the list
+func (m *Model) reopenFor(name, ip string) tea.Cmd {
+	r := m.reopen
+	if r == nil || r.offered || m.state != 0 || !strings.EqualFold(r.peer, name) {
+		return nil
+	}
+	r.ip = ip
+	switch m.reopenMode {
+	case "auto":
+		debugLog("Reopening the chat with %s", name)
+		return m.openChat(item{title: name, desc: ip})
+	case "ask":
+		r.offered = true
+		m.refreshList()
+		for i, it := range m.list.Items() {
+			if p, ok := it.(item); ok && p.desc == ip {
+				m.list.Select(i)
+			}
+		}
+	}
+	return nil
+}
+
+// resumeFor sends the queued messages and files for a peer that has just
+// been discovered, matched by name since its IP may have changed
+func (m *Model) resumeFor(name, ip string) tea.Cmd {
+	var cmds []tea.Cmd
+	rest := m.resume[:0]
+	for _, o := range m.resume {
+		if o.Peer != name {
+			rest = append(rest, o)
+			continue
+		}
+		o.IP = ip
+		if o.Path != "" {
+			cmds = append(cmds, m.track(o, m.sendFileTo(ip, name, o.Path)))
+		} else {
+			cmds = append(cmds, m.track(o, m.sendChatTo(ip, name, o.Text)))
+		}
+	}
+	m.resume = rest
+	if len(cmds) > 0 {
+		debugLog("Resuming %d queued sends to %s", len(cmds), name)
+		m.lastStatus = tr("status.resuming", len(cmds), name)
+	}
+	return tea.Batch(cmds...)
+}
+
+// absPath is path made absolute for the outbox; the working directory may
+// differ on the next launch
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
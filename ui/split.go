@@ -0,0 +1,116 @@
+package ui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"lan-chat/internal/store"
+)
+
+// On a terminal at least splitWidth columns wide (and ui.layout "auto")
+// the peer list and the chat are drawn side by side, so previews keep
+// updating while chatting. The states stay as they were: 0 is the list
+// with the focus, 3 the chat. Tab moves between them without dropping the
+// draft; the chat pane shows the conversation opened last.
+
+// splitWidth is the narrowest window the split layout is used in
+const splitWidth = 100
+
+// split reports whether the peer list and the chat share the window
+func (m Model) split() bool {
+	return m.layout == "auto" && m.width >= splitWidth
+}
+
+// paneWidths are the widths of the peer list and the chat: a third of the
+// window, within bounds, and the rest when split, else the whole window
+func (m Model) paneWidths() (list, chat int) {
+	if !m.split() {
+		return m.width, m.width
+	}
+	list = min(max(m.width/3, 32), 48)
+	return list, m.width - list
+}
+
+// showing reports whether the conversation called name is on screen: the
+// open chat, or the chat pane beside the list
+func (m Model) showing(name string) bool {
+	switch {
+	case m.state == 3:
+		return m.selectedName == name
+	case m.state == 0 && m.split():
+		return m.chatPeer == name
+	}
+	return false
+}
+
+// chatItem is the entry of the conversation in the chat pane, false when
+// there is none or its peer is gone
+func (m Model) chatItem() (item, bool) {
+	switch m.chatPeer {
+	case "":
+		return item{}, false
+	case store.Everyone:
+		return item{title: store.Everyone}, true
+	}
+	for _, p := range m.roster {
+		if p.title == m.chatPeer {
+			return p, true
+		}
+	}
+	return item{}, false
+}
+
+// togglePane moves the focus between the list and the chat pane
+func (m *Model) togglePane() tea.Cmd {
+	if m.state == 3 {
+		m.state = 0
+		m.textInput.Blur()
+		return nil
+	}
+	if p, ok := m.chatItem(); ok {
+		return m.openChat(p)
+	}
+	return nil
+}
+
+// tabHint is the footer hint for tab, in the chat pane or the list's when
+// it has the focus
+func (m Model) tabHint(chatPane bool) string {
+	switch {
+	case !m.split() || chatPane != (m.state == 3):
+		return ""
+	case chatPane:
+		return tr("split.to_peers")
+	case m.chatPeer != "":
+		return tr("split.to_chat")
+	}
+	return ""
+}
+
+// viewSplit draws the list and the chat pane side by side, the one with
+// the focus in the accent color
+func (m Model) viewSplit() string {
+	listWidth, chatWidth := m.paneWidths()
+	listBorder, chatBorder := lipgloss.TerminalColor(colors.accent), lipgloss.TerminalColor(colors.muted)
+	if m.state == 3 {
+		listBorder, chatBorder = chatBorder, listBorder
+	}
+	list := m.viewList(listWidth, listBorder)
+	var chat string
+	if m.chatPeer == "" {
+		chat = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(chatBorder).
+			Width(chatWidth-2).Height(lipgloss.Height(list)-2).
+			Foreground(colors.muted).Align(lipgloss.Center, lipgloss.Center).Render(tr("chat.none"))
+	} else {
+		c := m
+		if m.state != 3 {
+			// The titles name the conversation in the pane, not the
+			// peer selected last for a file
+			if p, ok := m.chatItem(); ok {
+				c.selectedName, c.selectedIP = p.title, p.desc
+			}
+		}
+		chat = c.viewChat(chatWidth, chatBorder)
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, list, chat)
+}
@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"hash/fnv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// themeColors is the semantic color palette used throughout the UI
+type themeColors struct {
+	name                                    string
+	muted, accent, success, warning, danger lipgloss.Color
+}
+
+var (
+	darkColors = themeColors{
+		name:    "dark",
+		muted:   lipgloss.Color("240"),
+		accent:  lipgloss.Color("12"),
+		success: lipgloss.Color("10"),
+		warning: lipgloss.Color("11"),
+		danger:  lipgloss.Color("9"),
+	}
+	// Bright yellow/green are unreadable on white, so use darker shades
+	lightColors = themeColors{
+		name:    "light",
+		muted:   lipgloss.Color("243"),
+		accent:  lipgloss.Color("25"),
+		success: lipgloss.Color("28"),
+		warning: lipgloss.Color("130"),
+		danger:  lipgloss.Color("160"),
+	}
+	colors = darkColors
+)
+
+// setTheme picks the palette; "auto" asks the terminal for its background
+func setTheme(mode string) {
+	switch mode {
+	case "light":
+		colors = lightColors
+	case "dark":
+		colors = darkColors
+	default:
+		if lipgloss.HasDarkBackground() {
+			colors = darkColors
+		} else {
+			colors = lightColors
+		}
+	}
+}
+
+// avatarColors are background colors that stay readable with white text
+var avatarColors = []string{"124", "130", "28", "30", "25", "55", "90", "94", "66", "61"}
+
+// avatar renders a two-letter colored block derived from a hash of the peer
+// name, so the same peer always gets the same color on every machine.
+func avatar(name string) string {
+	initials := []rune(strings.ToUpper(name))
+	if fields := strings.Fields(name); len(fields) > 1 {
+		initials = []rune(strings.ToUpper(string([]rune(fields[0])[0]) + string([]rune(fields[1])[0])))
+	}
+	if len(initials) > 2 {
+		initials = initials[:2]
+	}
+	for len(initials) < 2 {
+		initials = append(initials, ' ')
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("15")).
+		Background(lipgloss.Color(avatarColors[h.Sum32()%uint32(len(avatarColors))])).
+		Render(string(initials))
+}
+
+// ApplyTheme picks the palette for the configured theme mode
+func (c Config) ApplyTheme() {
+	setTheme(c.theme.mode)
+}
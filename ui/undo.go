@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// undoWindow is how long a destructive action can be undone with ctrl+z
+const undoWindow = 5 * time.Second
+
+// undoAction is a destructive action waiting out its undo window. The UI
+// already reflects it; undo puts things back, commit (optional) does the
+// part that can't be taken back once the window closes.
+type undoAction struct {
+	label    string
+	deadline time.Time
+	undo     func(m *Model)
+	commit   func(m *Model)
+}
+
+// withUndo starts the undo window for an action. Only the latest action can
+// be undone, so a pending one is committed first.
+func (m *Model) withUndo(label string, undo, commit func(m *Model)) {
+	m.commitUndo()
+	m.pendingUndo = &undoAction{label: label, deadline: time.Now().Add(undoWindow), undo: undo, commit: commit}
+}
+
+func (m *Model) commitUndo() {
+	if m.pendingUndo == nil {
+		return
+	}
+	if m.pendingUndo.commit != nil {
+		m.pendingUndo.commit(m)
+	}
+	m.pendingUndo = nil
+}
+
+// clearHistory empties the conversation in the chat pane, keeping a copy
+// for undo
+func (m *Model) clearHistory() {
+	peer, saved, savedUnseen := m.chatPeer, m.chatHistory, m.unseen
+	m.chatHistory, m.unseen = nil, 0
+	m.chatView.gotoBottom()
+	m.withUndo(tr("undo.cleared"), func(m *Model) {
+		if m.chatPeer != peer {
+			// Another chat was opened since; it goes back where it was kept
+			m.chats[peer] = saved
+			return
+		}
+		m.chatHistory, m.unseen = saved, savedUnseen
+		m.chatView.gotoBottom()
+	}, nil)
+}
+
+// blockPeer hides a peer and drops their messages until unblocked
+func (m *Model) blockPeer(p item) tea.Cmd {
+	m.blocked[p.title] = p
+	m.roster = slices.DeleteFunc(m.roster, func(r item) bool { return r.title == p.title })
+	if m.selectedName == p.title && m.state == 3 {
+		m.state = 0
+		m.textInput.Blur()
+	}
+	m.withUndo(tr("undo.blocked", p.title), func(m *Model) { m.unblockPeer(p) }, nil)
+	return m.refreshList()
+}
+
+func (m *Model) unblockPeer(p item) {
+	delete(m.blocked, p.title)
+	if !slices.ContainsFunc(m.roster, func(r item) bool { return r.title == p.title }) {
+		m.roster = append([]item{p}, m.roster...)
+	}
+}
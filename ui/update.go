@@ -0,0 +1,546 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"lan-chat/internal/platform"
+	"lan-chat/internal/store"
+)
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if batch, ok := msg.(netMsg); ok {
+		// Whatever it holds, and whatever their handlers return
+		cmds := []tea.Cmd{waitForNetwork(m.networkChan)}
+		var next tea.Model = m
+		for _, msg := range batch {
+			var cmd tea.Cmd
+			next, cmd = next.(Model).update(msg)
+			cmds = append(cmds, cmd)
+		}
+		return next, tea.Batch(cmds...)
+	}
+	msgType := fmt.Sprintf("%T", msg)
+	if msgType != "cursor.BlinkMsg" {
+		debugLog("Update: state=%d, msg=%s", m.state, msgType)
+	}
+	var cmd tea.Cmd
+	var cmds []tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		m.lastActivity = time.Now()
+		if m.state == 6 {
+			return m, m.updateLock(msg)
+		}
+		switch msg.String() {
+		case "ctrl+c":
+			return m, m.quitCmd()
+		case "ctrl+r":
+			if m.crash != nil {
+				m.restart = true
+				return m, m.quitCmd()
+			}
+		case "ctrl+y", "ctrl+n", "ctrl+o":
+			if len(m.offers) > 0 {
+				m.answerOffer(offerKeys[msg.String()])
+				return m, nil
+			}
+		case "ctrl+x":
+			if m.banner != nil {
+				m.banner = nil
+				m.resizeComponents(m.width, m.height)
+				return m, nil
+			}
+		case "ctrl+p":
+			if m.state != 5 {
+				return m, m.openPalette(false)
+			}
+		case "ctrl+k":
+			if m.state != 5 {
+				return m, m.openPalette(true)
+			}
+		case "ctrl+z":
+			if m.pendingUndo != nil {
+				debugLog("Undo: %s", m.pendingUndo.label)
+				m.pendingUndo.undo(&m)
+				m.pendingUndo = nil
+				return m, m.refreshList()
+			}
+		}
+		if m.state == 5 {
+			return m, m.updatePalette(msg)
+		}
+		if m.state == 7 {
+			return m, m.updateLogs(msg)
+		}
+		if m.selfInfo {
+			// Any key closes the overlay
+			m.selfInfo = false
+			return m, nil
+		}
+		if m.peerDetail != nil {
+			return m, m.updatePeerDetail(msg)
+		}
+		if msg.String() == "tab" && m.split() && (m.state == 3 || m.state == 0 && m.list.FilterState() != list.Filtering) {
+			return m, m.togglePane()
+		}
+		if m.vimKeys {
+			if cmd, handled := m.handleVimKey(msg); handled {
+				return m, cmd
+			}
+		}
+		switch msg.String() {
+		case "esc":
+			// 1. If the list is currently in "Filtering" mode, let the list handle it
+			if m.state == 0 && m.list.FilterState() == list.Filtering {
+				// We don't return tea.Quit here; we just let the message fall through
+				// to m.list.Update(msg) at the bottom of the function.
+				break
+			}
+
+			// 2. If we are in the main list and NOT filtering, Esc exits the whole app
+			if m.state == 0 {
+				return m, m.quitCmd()
+			}
+
+			// 3. Otherwise, Esc acts as a "Back" button from Chat, File Picker, or Config
+			m.state = 0
+			m.textInput.Blur()
+			m.textInput.Reset()
+			return m, nil
+		case "c":
+			if m.state == 0 {
+				m.state = 4
+				return m, nil
+			}
+		case "i":
+			if m.state == 0 && m.list.FilterState() != list.Filtering {
+				m.selfInfo = true
+				return m, nil
+			}
+		case "p":
+			if p, ok := m.list.SelectedItem().(item); ok && m.state == 0 && m.list.FilterState() != list.Filtering {
+				m.openPeerDetail(p)
+				return m, nil
+			}
+		case "o", "u", "v":
+			if m.state == 0 && m.list.FilterState() != list.Filtering {
+				filter := map[string]string{"o": "online", "u": "unread", "v": "verified"}[msg.String()]
+				if m.quickFilter == filter {
+					filter = "all"
+				}
+				m.quickFilter = filter
+				return m, m.refreshList()
+			}
+		case "s":
+			if m.state == 0 && m.list.FilterState() != list.Filtering {
+				m.sortMode = cycle(sortModes, m.sortMode)
+				m.uiState.Sort = m.sortMode
+				m.saveUIState()
+				return m, m.refreshList()
+			}
+		case "f":
+			if p, ok := m.list.SelectedItem().(item); ok && m.state == 0 {
+				return m, m.openFilePicker(p)
+			}
+		case "enter":
+			// If filtering, let the list handle Enter to stop filtering.
+			// Do NOT switch to chat mode in this case.
+			if m.state == 0 && m.list.FilterState() == list.Filtering {
+				break
+			}
+
+			if _, ok := m.list.SelectedItem().(groupItem); ok && m.state == 0 {
+				return m, m.openGroup()
+			} else if p, ok := m.list.SelectedItem().(item); ok && m.state == 0 {
+				return m, m.openChat(p)
+			} else if m.state == 3 && m.textInput.Value() != "" {
+				text := m.textInput.Value()
+				m.textInput.Reset()
+				m.addChat(m.selectedName, stamp(time.Now())+" "+avatar(m.userName)+" "+tr("chat.me")+": "+text)
+				m.chatView.gotoBottom()
+				if m.inGroup() {
+					m.groupLast = tr("chat.me") + ": " + text
+					return m, tea.Batch(m.sendGroupCmd(text), m.refreshList())
+				}
+				send := m.track(store.Outgoing{Peer: m.selectedName, IP: m.selectedIP, Text: text}, m.sendChatCmd(text))
+				return m, send
+			}
+		}
+
+	case peerUpdateMsg:
+		if _, ok := m.blocked[msg.name]; ok {
+			return m, nil
+		}
+		if msg.found {
+			m.forgetOldAddresses(msg.name, msg.ip)
+		}
+		// Check if peer exists to update last message
+		found := m.updatePeer(msg.ip, func(p *item) {
+			p.lastMsg, p.message = msg.lastMsg, msg.message
+			if msg.found {
+				p.reachable, p.offline, p.tags = true, false, m.knownTags(msg.name)
+			}
+		})
+		if !found {
+			// Newest peers first
+			m.roster = append([]item{{title: msg.name, desc: msg.ip, lastMsg: tr("peer.new_connection"), reachable: true, tags: m.knownTags(msg.name)}}, m.roster...)
+			m.adoptChat(msg.ip, msg.name)
+			resume := m.resumeFor(msg.name, msg.ip)
+			return m, tea.Batch(m.refreshList(), resume, m.reopenFor(msg.name, msg.ip))
+		}
+		if msg.found {
+			return m, m.reopenFor(msg.name, msg.ip)
+		}
+		return m, nil
+
+	case peerOfflineMsg:
+		debugLog("Peer offline: ip=%s", msg.ip)
+		m.updatePeer(msg.ip, func(p *item) {
+			p.reachable, p.offline, p.rtt = false, true, 0
+			p.lastMsg, p.message = tr("peer.last_seen", msg.lastSeen.Format("2006-01-02 15:04")), false
+		})
+		return m, nil
+
+	case peerHealthMsg:
+		debugLog("Peer health: ip=%s reachable=%v", msg.ip, msg.reachable)
+		m.updatePeer(msg.ip, func(p *item) {
+			if p.reachable = msg.reachable; !msg.reachable {
+				p.rtt = 0
+			}
+		})
+		return m, nil
+
+	case peerLatencyMsg:
+		m.updatePeer(msg.ip, func(p *item) { p.rtt = msg.rtt })
+		return m, nil
+
+	case peerKeyMsg:
+		debugLog("Peer identity: ip=%s changed=%v", msg.ip, msg.changed)
+		m.updatePeer(msg.ip, func(p *item) { p.keyChanged = msg.changed })
+		return m, nil
+
+	case peerTagsMsg:
+		for i := range m.roster {
+			if strings.EqualFold(m.roster[i].title, msg.name) {
+				m.roster[i].tags = msg.tags
+			}
+		}
+		return m, m.refreshList()
+
+	case peerVerifiedMsg:
+		debugLog("Peer verification: ip=%s secure=%v", msg.ip, msg.secure)
+		m.securePeers[msg.ip] = msg.secure
+		m.updatePeer(msg.ip, func(p *item) { p.secure = msg.secure })
+		return m, nil
+
+	case chatMsg:
+		// The conversation is the roster's peer at the sender's address,
+		// whatever name the message gives, which is only its label
+		peer := m.nameAt(msg.ip)
+		_, blocked := m.blocked[peer]
+		if _, ok := m.blocked[msg.sender]; ok || blocked {
+			debugLog("Dropped message from blocked peer %s (%s)", msg.sender, msg.ip)
+			return m, nil
+		}
+		if msg.group {
+			return m.groupChat(msg, peer)
+		}
+		m.addChat(peer, stamp(msg.at)+" "+avatar(msg.sender)+" "+msg.sender+": "+msg.content)
+		var alertCmd tea.Cmd
+		// The notification follows the preview settings: it may be on a shared screen
+		body := m.previewFor(item{title: peer, lastMsg: msg.content, message: true})
+		if body == "" {
+			body = tr("preview.placeholder")
+		}
+		if !m.showing(peer) {
+			if m.prefsFor(peer).Notify != "none" {
+				m.unread[peer]++
+			}
+			alertCmd = tea.Batch(m.alertCmd(peer, body), m.refreshList())
+		} else if !m.focused {
+			alertCmd = m.alertCmd(peer, body)
+		}
+		// Also update the preview in the list
+		if peer != msg.ip {
+			// Now rather than as a command, so a burst of messages
+			// leaves the last one as the preview
+			next, cmd := m.update(peerUpdateMsg{name: peer, ip: msg.ip, lastMsg: msg.content, message: true})
+			return next, tea.Batch(alertCmd, cmd)
+		}
+		return m, alertCmd
+
+	case sendDoneMsg:
+		return m.sendDone(msg)
+
+	case ReloadMsg:
+		cmd := m.reload()
+		return m, cmd
+
+	case transferStatusMsg:
+		m.state = 0
+		m.lastStatus = string(msg)
+		return m, nil
+
+	case fileReceivedMsg:
+		if msg.encrypted {
+			m.lastStatus = tr("status.received_encrypted", msg.name)
+		} else {
+			m.lastStatus = tr("status.received", msg.name)
+		}
+		sender := msg.ip
+		for _, p := range m.peers() {
+			if p.desc == msg.ip {
+				sender = p.title
+			}
+		}
+		m.lastReceived = msg.path
+		if m.prefsFor(sender).AutoOpen {
+			m.openFile(msg.path)
+		}
+		return m, tea.Batch(m.alertCmd(sender, tr("status.received", msg.name)), imageCardCmd(sender, msg.path, m.thumbnails))
+
+	case receiveMsg:
+		m.receive(msg)
+		return m, nil
+
+	case fileOfferMsg:
+		m.offers = append(m.offers, msg)
+		m.resizeComponents(m.width, m.height)
+		return m, m.alertCmd(m.nameAt(msg.offer.From), m.offerTitle(msg.offer))
+
+	case offerExpiredMsg:
+		m.dropOffer(msg.id)
+		return m, nil
+
+	case imageCardMsg:
+		m.addChat(msg.sender, msg.lines...)
+		return m, nil
+
+	case tea.FocusMsg:
+		m.focused = true
+		return m, nil
+
+	case tea.BlurMsg:
+		m.focused = false
+		return m, nil
+
+	case flashOffMsg:
+		m.flashing = false
+		return m, nil
+
+	case progressMsg:
+		// Other sends, resumed or from the API, go on in the background
+		if m.state != 2 || msg.ip != m.selectedIP || msg.name != m.progressName {
+			return m, nil
+		}
+		m.progressSize = msg.total
+		m.progressPct = 1
+		if msg.total > 0 {
+			m.progressPct = float64(msg.sent) / float64(msg.total)
+		}
+		if elapsed := time.Since(m.progressFrom).Seconds(); elapsed > 0 && msg.sent > 0 {
+			m.progressRate = float64(msg.sent) / elapsed
+		}
+		return m, nil
+
+	case listenerMsg:
+		debugLog("Listener %s up=%v", msg.proto, msg.up)
+		m.listeners[msg.proto] = msg.up
+		return m, nil
+
+	case tickMsg:
+		// The re-render picks up the new time; only the idle lock and the
+		// local addresses (DHCP, VPNs, Wi-Fi roaming) need state
+		m.localAddrs = localIPs()
+		if m.pendingUndo != nil && time.Now().After(m.pendingUndo.deadline) {
+			m.commitUndo()
+		}
+		if m.state == 7 {
+			m.reloadLogs()
+		}
+		if m.idleLock > 0 && m.state != 6 && time.Since(m.lastActivity) >= m.idleLock {
+			return m, m.lock()
+		}
+		return m, tickCmd()
+
+	case UpdateMsg:
+		debugLog("lan-chat %s is available", msg.Version)
+		m.newVersion = msg.Version
+		return m, nil
+
+	case CrashMsg:
+		m.crashed(msg.Report)
+		return m, nil
+
+	case errorMsg:
+		errorLog("%s: %s", msg.title, msg.detail)
+		if m.state == 2 {
+			m.state = 0
+		}
+		m.banner = &msg
+		m.resizeComponents(m.width, m.height)
+		return m, nil
+
+	case tea.WindowSizeMsg:
+		debugLog("WindowSize: %dx%d", msg.Width, msg.Height)
+		m.width = msg.Width
+		m.height = msg.Height
+		m.resizeComponents(msg.Width, msg.Height)
+
+	case configToggleDebugMsg:
+		setDebug(!m.configDebug)
+		m.configDebug = enableDebug
+		return m, nil
+	}
+
+	if m.state == 1 {
+		m.filepicker, cmd = m.filepicker.Update(msg)
+		if didSelect, path := m.filepicker.DidSelectFile(msg); didSelect {
+			m.state = 2
+			m.progressPct = 0
+			m.progressSize = 0
+			m.progressName = filepath.Base(path)
+			m.progressFrom = time.Now()
+			m.progressRate = 0
+			if fi, err := os.Stat(path); err == nil {
+				m.progressSize = fi.Size()
+			}
+			send := m.track(store.Outgoing{Peer: m.selectedName, IP: m.selectedIP, Path: absPath(path)}, m.sendFileCmd(path))
+			return m, send
+		}
+		return m, cmd
+	} else if m.state == 3 {
+		m.textInput, cmd = m.textInput.Update(msg)
+		cmds = append(cmds, cmd)
+		if keyMsg, ok := msg.(tea.KeyMsg); ok && keyMsg.String() == "ctrl+e" {
+			m.chatView.gotoBottom()
+		}
+		m.chatView.update(m.chatHistory, msg)
+		m.markSeen()
+	} else if m.state == 4 {
+		// Config state - handle key inputs
+		if keyMsg, ok := msg.(tea.KeyMsg); ok {
+			switch keyMsg.String() {
+			case "d":
+				return m, func() tea.Msg { return configToggleDebugMsg{} }
+			case "l":
+				return m, m.openLogs()
+			case "h":
+				m.showHints = !m.showHints
+				m.uiState.HintsDismissed = !m.showHints
+				if m.showHints {
+					m.uiState.Sessions = 0
+				}
+				m.saveUIState()
+				m.resizeComponents(m.width, m.height)
+				return m, nil
+			case "r":
+				cmd := m.reload()
+				return m, cmd
+			case "t":
+				m.themeMode = cycle(themeModes, m.themeMode)
+				setTheme(m.themeMode)
+				m.uiState.Theme = m.themeMode
+				m.saveUIState()
+				return m, nil
+			case "up", "down":
+				// Navigate through options (currently only debug)
+				return m, nil
+			}
+		}
+		return m, nil
+	} else {
+		m.list, cmd = m.list.Update(msg)
+		cmds = append(cmds, cmd)
+		m.skipSectionHeader(msg)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// alertCmd rings the bell and/or flashes the footer for an incoming message
+// or file from title, unless do-not-disturb is on or the peer's
+// notifications say otherwise. With desktop notifications on it also shows
+// title and body there.
+func (m *Model) alertCmd(title, body string) tea.Cmd {
+	switch m.prefsFor(title).Notify {
+	case "silent", "none":
+		return nil
+	case "all":
+		// Through do-not-disturb
+	default:
+		if m.dnd {
+			return nil
+		}
+	}
+	var cmds []tea.Cmd
+	if m.desktop {
+		cmds = append(cmds, func() tea.Msg {
+			if err := platform.Notify(title, body); err != nil {
+				debugLog("Desktop notification: %v", err)
+			}
+			return nil
+		})
+	}
+	if m.alert == "bell" || m.alert == "both" {
+		var out io.Writer = os.Stdout
+		if m.session != nil {
+			out = m.session
+		}
+		cmds = append(cmds, func() tea.Msg {
+			out.Write([]byte("\a"))
+			return nil
+		})
+	}
+	if m.alert == "flash" || m.alert == "both" {
+		m.flashing = true
+		cmds = append(cmds, tea.Tick(600*time.Millisecond, func(time.Time) tea.Msg { return flashOffMsg{} }))
+	}
+	return tea.Batch(cmds...)
+}
+
+// quitCmd exits the app, or only detaches the terminal when running as a
+// background session so networking and transfers keep going.
+func (m Model) quitCmd() tea.Cmd {
+	if m.session != nil {
+		return m.session.detachCmd()
+	}
+	return tea.Quit
+}
+
+func (m *Model) openChat(p item) tea.Cmd {
+	m.selectedIP = p.desc
+	m.selectedName = p.title
+	m.showChat(p.title)
+	if r := m.reopen; r != nil {
+		if strings.EqualFold(r.peer, p.title) {
+			m.textInput.SetValue(r.draft)
+			m.reopen = nil
+		} else {
+			r.offered = false
+		}
+	}
+	m.state = 3
+	delete(m.unread, p.title)
+	m.refreshList()
+	if m.vimKeys {
+		m.vimMode = "normal" // 'i' focuses the input
+		return nil
+	}
+	return m.textInput.Focus() // Focus input when entering chat mode
+}
+
+func (m *Model) openFilePicker(p item) tea.Cmd {
+	m.selectedIP = p.desc
+	m.selectedName = p.title
+	m.state = 1
+	return m.filepicker.Init()
+}
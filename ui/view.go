@@ -0,0 +1,538 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func (m *Model) resizeComponents(width, height int) {
+	// The error banner steals rows from whichever view is active
+	if m.banner != nil {
+		height -= bannerHeight
+	}
+	if len(m.offers) > 0 {
+		height -= offerHeight
+	}
+
+	// Common width accounting for borders (2) and padding (2)
+	// We want the outer frame to be full width.
+	// The content width inside a bordered style with padding(0,1) is width - 2 (border) - 2 (padding) = width - 4.
+	contentWidth := width - 4
+	// The list and the chat each get a pane of their own when split
+	listWidth, chatWidth := m.paneWidths()
+
+	// List View
+	listHeight := height - 5 // -2 borders (wrapper) -3 custom title
+	if m.showHints {
+		listHeight-- // tips line
+	}
+	m.list.SetSize(listWidth-4, listHeight)
+
+	// File Picker View
+	// Title takes ~3 lines (including borders). Height of content area = Height - 3 (title) - 2 (content border) = Height - 5.
+	// Wait, title has borders (2) + text (1) = 3 lines.
+	// Content has borders (2) + padding(0) + text.
+	// Total height = Height.
+	// Available height for filepicker content = Height - 3 (title) - 2 (content border).
+	fpHeight := height - 6 // Reduced by 1 to prevent overflow
+	if fpHeight < 0 {
+		fpHeight = 0
+	}
+	m.filepicker.Height = fpHeight
+
+	// Progress View
+	if !m.fixedBar {
+		m.progress.Width = contentWidth - progressLabelWidth
+	}
+
+	// Chat View
+	// Title: 3 lines (1 text + 2 border)
+	// Input: 3 lines (1 text + 2 border)
+	// Viewport: Remaining height = Height - 6 - 1 (footer border only) = Height - 7
+	// Wait, we have footer now which is 1 line.
+	// Total height = Height.
+	// Used by: Title (3), Input (3), Footer (1).
+	// Remaining for Viewport = Height - 7.
+	// Viewport has borders (2).
+	// Content height inside viewport = Height - 7 - 2 = Height - 9.
+
+	// User reported it's 3 lines too short.
+	// Let's re-evaluate.
+	// Total Available: Height
+	// Layout:
+	// - Title Box (Height 3: 1 line text + 2 border lines)
+	// - Viewport Box (Height X)
+	// - Input Box (Height 3: 1 line text + 2 border lines)
+	// - Footer (Height 1)
+
+	// The View() function joins these with JoinVertical.
+	// JoinVertical simply stacks strings.
+	// If borders overlap (collapsing borders), height calculation is different.
+	// Currently, they do NOT overlap/collapse automatically with standard styles unless handled specifically.
+	// We are just returning Render() output strings.
+
+	// Total Height Used = 3 (Title) + X (Viewport) + 3 (Input) + 1 (Footer) = 7 + X
+	// So X (Viewport Height INCLUDING borders) = Height - 7
+
+	// Viewport Content Height = X - 2 (borders) = (Height - 7) - 2 = Height - 9
+
+	// If it is 3 lines too short, maybe the border calculation is wrong or margins?
+	// lipgloss.JoinVertical adds newlines? No.
+
+	// Let's try increasing viewport height by 3 as requested to see if it fits.
+	// Previous: Height - 9. New: Height - 6.
+
+	viewportHeight := height - 6
+	if viewportHeight < 0 {
+		viewportHeight = 0
+	}
+
+	// Back to the newest message at the new size
+	m.chatView = newChatView(chatWidth-4, viewportHeight)
+
+	// Input width
+	// TextInput width is the number of characters.
+	// We have a border around it. Padding is (0,1).
+	// So visible width is contentWidth.
+	m.textInput.Width = chatWidth - 4
+
+	// Log viewer: title (3), one row for the search input, footer (1)
+	m.logView = viewport.New(contentWidth, max(height-6, 0))
+	m.logSearch.Width = contentWidth - 1
+	m.filterLogs()
+}
+
+func (m Model) customBorderFooter(width int, text string) string {
+	return m.borderFooter(width, lipgloss.NoColor{}, text)
+}
+
+// borderFooter is customBorderFooter with border as the color of the line
+func (m Model) borderFooter(width int, border lipgloss.TerminalColor, text string) string {
+	// Colors
+	textColor := colors.muted
+	borderStyle := lipgloss.NewStyle().Foreground(border)
+	textStyle := lipgloss.NewStyle().Foreground(textColor)
+	if m.flashing {
+		textStyle = lipgloss.NewStyle().Reverse(true).Bold(true).Foreground(colors.warning)
+	}
+	if m.pendingUndo != nil {
+		// The undo toast replaces the usual hints until it expires
+		left := time.Until(m.pendingUndo.deadline).Round(time.Second)
+		text = tr("undo.toast", m.pendingUndo.label, max(left, 0)/time.Second)
+		textStyle = lipgloss.NewStyle().Foreground(colors.accent).Bold(true)
+	}
+	if m.dnd {
+		text = "\U0001F515 " + text
+	}
+
+	cornerLeft := "╰"
+	cornerRight := "╯"
+	horiz := "─"
+
+	// Text formatting, cut to fit between the corners
+	if over := lipgloss.Width(text) + 6 - width; over > 0 {
+		text = ansi.Truncate(text, max(lipgloss.Width(text)-over, 0), "…")
+	}
+	displayQuery := fmt.Sprintf("[ %s ]", text)
+	textLen := lipgloss.Width(displayQuery)
+
+	// Calculate dashes
+	// Total width available for dashes = width - 2 (corners) - textLen
+	// Align right-ish: Give 2 dashes padding on right if possible
+	availableSpace := width - 2 - textLen
+	if availableSpace < 0 {
+		availableSpace = 0
+	}
+
+	rightDashes := 2
+	leftDashes := availableSpace - rightDashes
+
+	if leftDashes < 0 {
+		leftDashes = 0
+		rightDashes = availableSpace
+	}
+
+	line := borderStyle.Render(cornerLeft) +
+		borderStyle.Render(strings.Repeat(horiz, leftDashes)) +
+		textStyle.Render(displayQuery) +
+		borderStyle.Render(strings.Repeat(horiz, rightDashes)) +
+		borderStyle.Render(cornerRight)
+
+	return line
+}
+
+// renderTemplate expands the placeholders in a title/footer template
+func (m Model) renderTemplate(key string) string {
+	encryption := ""
+	if m.password != "" && (m.state != 3 || m.securePeers[m.selectedIP]) {
+		encryption = "(" + tr("encrypted") + ") \U0001F512"
+	}
+	r := strings.NewReplacer(
+		"{name}", m.userName,
+		"{peers}", strconv.Itoa(len(m.peers())),
+		"{encryption}", encryption,
+		"{time}", time.Now().Format("15:04"),
+		"{peer}", chatName(m.selectedName),
+		"{ip}", m.chatAddress(),
+		"{addr}", m.ownAddress(),
+	)
+	return strings.TrimSpace(r.Replace(m.templates[key]))
+}
+
+// sessionInfo is the optional clock / uptime / active conversation summary
+func (m Model) sessionInfo() string {
+	var parts []string
+	if m.showAddress {
+		parts = append(parts, m.ownAddress()+" "+m.discoveryStatus())
+	}
+	if m.showConv && m.selectedName != "" {
+		parts = append(parts, tr("info.chat", chatName(m.selectedName)))
+	}
+	if m.showUptime {
+		parts = append(parts, tr("info.uptime", time.Since(m.startTime).Truncate(time.Second).String()))
+	}
+	if m.showClock {
+		parts = append(parts, time.Now().Format("15:04:05"))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// titleWithInfo right-aligns the session info on the title line of a box
+// width columns wide
+func (m Model) titleWithInfo(text string, width int) string {
+	info := m.sessionInfo()
+	if info == "" {
+		return text
+	}
+	gap := width - 4 - lipgloss.Width(text) - lipgloss.Width(info)
+	if gap < 2 {
+		gap = 2
+	}
+	return text + strings.Repeat(" ", gap) + info
+}
+
+// progressLabelWidth is reserved next to the bar for progressLabel
+const progressLabelWidth = 28
+
+// progressLabel renders "42% 1.2 MB / 3.0 MB" for the current transfer
+func (m Model) progressLabel() string {
+	done := int64(m.progressPct * float64(m.progressSize))
+	return fmt.Sprintf("%3.0f%% %s / %s", m.progressPct*100, formatBytes(done), formatBytes(m.progressSize))
+}
+
+// progressSpeed renders "1.2 MB/s, 42s left" for the current transfer,
+// once there has been a measurement
+func (m Model) progressSpeed() string {
+	if m.progressRate <= 0 {
+		return ""
+	}
+	left := float64(m.progressSize) * (1 - m.progressPct) / m.progressRate
+	eta := (time.Duration(left * float64(time.Second))).Round(time.Second)
+	return tr("progress.speed", formatBytes(int64(m.progressRate)), eta.String())
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatRTT is a round trip in milliseconds, with a decimal below 10
+func formatRTT(d time.Duration) string {
+	ms := float64(d) / float64(time.Millisecond)
+	if ms < 10 {
+		return fmt.Sprintf("%.1f ms", ms)
+	}
+	return fmt.Sprintf("%.0f ms", ms)
+}
+
+const bannerHeight = 5 // 3 lines of text + 2 border lines
+
+func (m Model) renderBanner() string {
+	red := colors.danger
+	style := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(red).
+		Padding(0, 1).
+		Width(m.width - 2).
+		MaxHeight(bannerHeight)
+	// Keep each line on a single row so the banner height stays fixed
+	clip := lipgloss.NewStyle().MaxWidth(m.width - 4)
+	title := lipgloss.NewStyle().Bold(true).Foreground(red).Render("\u26A0 " + m.banner.title)
+	return style.Render(lipgloss.JoinVertical(lipgloss.Left,
+		clip.Render(title+"  "+lipgloss.NewStyle().Foreground(colors.muted).Render("(ctrl+x) "+tr("banner.dismiss"))),
+		clip.Render(m.banner.detail),
+		clip.Render("\u2192 "+m.banner.action),
+	))
+}
+
+func (m Model) View() string {
+	if m.state == 6 {
+		return m.viewLocked()
+	}
+	var boxes []string
+	if m.banner != nil {
+		boxes = append(boxes, m.renderBanner())
+	}
+	if len(m.offers) > 0 {
+		boxes = append(boxes, m.renderOffer())
+	}
+	if boxes == nil {
+		return m.viewState()
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, append(boxes, m.viewState())...)
+}
+
+func (m Model) viewState() string {
+	// Define border styles with minimal padding
+	// Force the width to be full width minus borders (2)
+	// We want all boxes to be full width
+	fullWidthStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1).Width(m.width - 2)
+
+	borderStyle := fullWidthStyle // Used for titles
+	filePickerStyle := fullWidthStyle
+	progressStyle := fullWidthStyle
+
+	// Minimal margins to maximize space
+	containerStyle := lipgloss.NewStyle().Margin(0, 0)
+
+	switch m.state {
+	case 1:
+		title := borderStyle.Render(tr("picker.title"))
+
+		// Custom footer for filepicker
+		footer := m.customBorderFooter(m.width, m.renderTemplate("picker_footer"))
+
+		// Adjust content style to remove bottom border so footer attaches correctly
+		contentStyle := filePickerStyle.Copy().Border(lipgloss.RoundedBorder(), true, true, false, true)
+		content := contentStyle.Render(m.filepicker.View())
+
+		return containerStyle.Render(lipgloss.JoinVertical(lipgloss.Left, title, content, footer))
+	case 2:
+		secureLabel := ""
+		if m.password != "" && m.securePeers[m.selectedIP] {
+			secureLabel = " \U0001F512 " + tr("encrypted")
+		}
+		text := tr("progress.title", m.selectedName, m.selectedIP, secureLabel)
+		if speed := m.progressSpeed(); speed != "" {
+			text += " " + speed
+		} else {
+			// Hashing the file, or the peer hasn't accepted it yet
+			text += " " + tr("progress.waiting", m.selectedName)
+		}
+		title := borderStyle.Render(text)
+
+		// Custom footer for progress
+		// No specific interactions usually, but maybe Quit?
+		footer := m.customBorderFooter(m.width, "")
+
+		contentStyle := progressStyle.Copy().Border(lipgloss.RoundedBorder(), true, true, false, true)
+		content := contentStyle.Render(m.progress.ViewAs(m.progressPct) + " " + m.progressLabel())
+
+		return containerStyle.Render(lipgloss.JoinVertical(lipgloss.Left, title, content, footer))
+	case 3:
+		if m.split() {
+			return m.viewSplit()
+		}
+		return m.viewChat(m.width, lipgloss.NoColor{})
+	case 5:
+		if m.switcher {
+			return m.viewSwitcher()
+		}
+		title := borderStyle.Render(tr("palette.title"))
+
+		matches := m.paletteMatches()
+		visible := m.height - 7 // title (3) + input (1) + blank (1) + footer (1) + top border (1)
+		if m.banner != nil {
+			visible -= bannerHeight
+		}
+		if len(m.offers) > 0 {
+			visible -= offerHeight
+		}
+		start := 0
+		if m.paletteIdx >= visible && visible > 0 {
+			start = m.paletteIdx - visible + 1
+		}
+		rows := []string{m.palette.View(), ""}
+		selected := lipgloss.NewStyle().Reverse(true)
+		for i := start; i < len(matches) && i < start+visible; i++ {
+			if i == m.paletteIdx {
+				rows = append(rows, selected.Render(" "+matches[i].label+" "))
+			} else {
+				rows = append(rows, " "+matches[i].label)
+			}
+		}
+		if len(matches) == 0 {
+			rows = append(rows, lipgloss.NewStyle().Foreground(colors.muted).Render(" "+tr("palette.no_matches")))
+		}
+
+		contentStyle := fullWidthStyle.Copy().Border(lipgloss.RoundedBorder(), true, true, false, true)
+		content := contentStyle.Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+		footer := m.customBorderFooter(m.width, tr("palette.footer"))
+
+		return containerStyle.Render(lipgloss.JoinVertical(lipgloss.Left, title, content, footer))
+	case 7:
+		title := borderStyle.Render(m.titleWithInfo(tr("log.title", strings.ToUpper(m.logLevel)), m.width))
+		search := m.logSearch.View()
+		if !m.logSearch.Focused() && m.logSearch.Value() == "" {
+			search = lipgloss.NewStyle().Foreground(colors.muted).Render(tr("log.search_hint"))
+		}
+		contentStyle := fullWidthStyle.Copy().Border(lipgloss.RoundedBorder(), true, true, false, true)
+		content := contentStyle.Render(lipgloss.JoinVertical(lipgloss.Left, search, m.logView.View()))
+		footer := m.customBorderFooter(m.width, tr("log.footer"))
+		return containerStyle.Render(lipgloss.JoinVertical(lipgloss.Left, title, content, footer))
+	case 4:
+		title := borderStyle.Render(tr("config.title"))
+
+		// Config options
+		debugStatus := tr("config.off")
+		debugColor := colors.muted
+		if m.configDebug {
+			debugStatus = tr("config.on")
+			debugColor = colors.success
+		}
+
+		debugStyle := lipgloss.NewStyle().Foreground(debugColor)
+		debugText := tr("config.debug", debugStyle.Render(debugStatus))
+
+		themeLabel := m.themeMode
+		if m.themeMode == "auto" {
+			themeLabel = "auto (" + colors.name + ")"
+		}
+		themeText := tr("config.theme", lipgloss.NewStyle().Foreground(colors.accent).Render(themeLabel))
+		hintsStatus, hintsColor := tr("config.off"), colors.muted
+		if m.showHints {
+			hintsStatus, hintsColor = tr("config.on"), colors.success
+		}
+		hintsText := tr("config.hints", lipgloss.NewStyle().Foreground(hintsColor).Render(hintsStatus))
+
+		// Create content area
+		contentStyle := fullWidthStyle.Copy().Border(lipgloss.RoundedBorder(), true, true, false, true)
+		content := contentStyle.Render(
+			lipgloss.JoinVertical(lipgloss.Left,
+				"",
+				debugText,
+				themeText,
+				hintsText,
+				"",
+				tr("config.debug_hint"),
+				tr("config.theme_hint"),
+				tr("config.logs_hint"),
+				tr("config.hints_hint"),
+				tr("config.back_hint"),
+				"",
+			),
+		)
+
+		footer := m.customBorderFooter(m.width, m.renderTemplate("config_footer"))
+
+		return containerStyle.Render(lipgloss.JoinVertical(lipgloss.Left, title, content, footer))
+	default:
+		view := m.viewList(m.width, lipgloss.NoColor{})
+		if m.split() {
+			view = m.viewSplit()
+		}
+		if m.selfInfo {
+			return m.viewSelf(view)
+		}
+		if m.peerDetail != nil {
+			return m.viewPeerDetail(view)
+		}
+		return view
+	}
+}
+
+// viewChat is the open chat, width columns wide, with border as the color
+// of its borders
+func (m Model) viewChat(width int, border lipgloss.TerminalColor) string {
+	boxStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(border).Padding(0, 1).Width(width - 2)
+
+	title := boxStyle.Render(m.titleWithInfo(m.renderTemplate("chat_title"), width))
+
+	// Custom footer for chat
+	footer := m.borderFooter(width, border, m.scrollIndicator()+m.vimModeLabel()+m.tabHint(true)+m.renderTemplate("chat_footer"))
+
+	// Adjust viewport and input borders.
+	// Viewport needs top, left, right. Input needs left, right. Footer has bottom.
+	// Wait, viewport is on top of input.
+	// Structure: Title (top border) -> Viewport (side borders) -> Input (side borders) -> Footer (bottom border)
+
+	// Title already has full border. We should probably remove bottom border from Title?
+	// No, standard Bubble Tea list usually keeps title separated.
+	// Let's stick to the pattern: Title Box + Content Box + Footer.
+	// But Chat has two components (Viewport + Input).
+	// Let's wrap them in a container that has side borders?
+
+	// Current design:
+	// Title (Border)
+	// Viewport (Border)
+	// Input (Border)
+
+	// New design requested:
+	// Title (Border)
+	// Viewport + Input (merged or separate?)
+	// Footer (Border with text)
+
+	// If we follow the list pattern:
+	// Top: Title
+	// Middle: Content (Viewport + Input)
+	// Bottom: Footer
+
+	// Let's try to make Input look like the bottom part of the content.
+
+	vpStyle := boxStyle.Copy().Border(lipgloss.RoundedBorder(), true, true, false, true)
+	inputStyle := boxStyle.Copy().Border(lipgloss.RoundedBorder(), false, true, false, true)
+
+	viewport := vpStyle.Render(m.chatView.view(m.chatHistory))
+	input := inputStyle.Render(m.textInput.View())
+
+	return lipgloss.NewStyle().Margin(0, 0).Render(lipgloss.JoinVertical(lipgloss.Left, title, viewport, input, footer))
+}
+
+// viewList is the peer list, width columns wide, with border as the color
+// of its borders
+func (m Model) viewList(width int, border lipgloss.TerminalColor) string {
+	borderStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(border).Padding(0, 1).Width(width - 2)
+	listStyle := borderStyle.Copy().Border(lipgloss.RoundedBorder(), true, true, false, true)
+
+	// Custom rendering for list to support "connected peers" text
+	var titleText string
+	var footerText string
+
+	if m.list.FilterState() == list.Filtering {
+		titleText = tr("filter.title")
+		footerText = m.renderTemplate("filter_footer")
+	} else {
+		titleText = m.titleWithInfo(m.renderTemplate("title"), width)
+		footerText = m.listStatus() + m.vimModeLabel() + m.tabHint(false) + m.renderTemplate("list_footer")
+	}
+
+	title := borderStyle.Render(titleText)
+	listView := m.list.View()
+	if m.showHints {
+		listView = lipgloss.JoinVertical(lipgloss.Left, listView, lipgloss.NewStyle().MaxWidth(width-4).Render(m.hint()))
+	}
+
+	// Wrap list in style to match other components
+	content := listStyle.Render(listView)
+
+	// Render custom footer
+	footer := m.borderFooter(width, border, footerText)
+
+	// Join all parts
+	return lipgloss.NewStyle().Margin(0, 0).Render(lipgloss.JoinVertical(lipgloss.Left, title, content, footer))
+}
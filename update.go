@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lan-chat/internal/update"
+	"lan-chat/ui"
+)
+
+// version is the release this binary was built from, set by the Makefile
+var version = "dev"
+
+// updateTimeout covers finding the release and downloading the binary
+const updateTimeout = 5 * time.Minute
+
+// runUpdate is `lan-chat update`: replace this binary with the latest
+// release, or with --check only say whether there is one
+func runUpdate(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	check := fs.Bool("check", false, "Only report whether a newer release exists")
+	force := fs.Bool("force", false, "Install the latest release even if it isn't newer (or this is a dev build)")
+	insecure := fs.Bool("insecure", false, "Install without checking the release's signature, only its checksum")
+	configFile := fs.String("config", ui.DefaultConfigPath(), "Path to the config file ([update] section)")
+	fs.Parse(args)
+
+	u, err := update.New(*configFile)
+	if err != nil {
+		fatalf("config: %v", err)
+	}
+	u.Version = version
+	u.Insecure = *insecure
+	u.Logf = func(format string, v ...interface{}) { fmt.Printf(format+"\n", v...) }
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	r, err := u.Latest(ctx)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if r.Version == "" {
+		fatalf("%s has no releases", u.Repo)
+	}
+	newer := version != "dev" && update.Newer(r.Version, version)
+	switch {
+	case *check && newer:
+		fmt.Printf("lan-chat %s is available (this is %s): %s\n", r.Version, version, r.URL)
+		return
+	case *check || !newer && !*force:
+		if version == "dev" {
+			fmt.Printf("This is a development build; the latest release is %s (--force installs it)\n", r.Version)
+		} else {
+			fmt.Printf("lan-chat %s is up to date\n", version)
+		}
+		return
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		fatalf("%v", err)
+	}
+	if u.Insecure {
+		fmt.Fprintln(os.Stderr, "Warning: --insecure: the release's signature is not checked, only its checksum")
+	}
+	if err := u.Apply(ctx, r, exe); err != nil {
+		switch {
+		case errors.Is(err, update.ErrNoKey):
+			fatalf("%v; not installing %s (build with RELEASE_KEY, or --insecure to skip the check)", err, r.Version)
+		case errors.Is(err, update.ErrUnsigned):
+			fatalf("%s: %v; not installing it", r.Version, err)
+		}
+		fatalf("%v", err)
+	}
+	fmt.Printf("Updated %s to %s; restart running instances to use it\n", exe, r.Version)
+}